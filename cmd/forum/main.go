@@ -1,85 +1,189 @@
 package main
 
 import (
-	"forum/internal/forum/middleware"
+	"context"
+	"fmt"
+	"forum/internal/forum/app"
+	config2 "forum/internal/forum/config"
+	"forum/internal/forum/health"
+	"forum/internal/forum/migrations"
 	"forum/internal/forum/repository"
 	"forum/internal/utils/logger"
-	delivery2 "forum/pkg/forum/delivery"
-	repository2 "forum/pkg/forum/repository"
-	usecase2 "forum/pkg/forum/usecase"
-	"forum/pkg/models"
-	delivery4 "forum/pkg/post/delivery"
-	repository4 "forum/pkg/post/repository"
-	usecase4 "forum/pkg/post/usecase"
-	delivery5 "forum/pkg/service/delivery"
-	repository5 "forum/pkg/service/repository"
-	usecase5 "forum/pkg/service/usecase"
-	delivery3 "forum/pkg/thread/delivery"
-	repository3 "forum/pkg/thread/repository"
-	usecase3 "forum/pkg/thread/usecase"
-	"forum/pkg/user/delivery"
-	"forum/pkg/user/repostitory"
-	"forum/pkg/user/usecase"
-	"github.com/gorilla/mux"
 	_ "github.com/jackc/pgx"
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
 )
 
-func config() *http.Server {
-	status := models.StatusInit()
-	Db, err := repository.NewPostgres()
+// config собирает сервер; возвращаемая функция закрывает хранилище и
+// сбрасывает логи, её нужно вызвать после остановки сервера.
+func config(cfg config2.Config) (*http.Server, *health.Health, func()) {
+	// logger
+	appLogger, err := logger.New(cfg.Log.Level, cfg.Log.Format)
 	if err != nil {
 		log.Fatal(err)
 	}
-	if Db.ProcedureRequests() != nil {
-		log.Fatal(1)
+	logrus.SetOutput(appLogger.Logger.Logger.Out)
+	logrus.SetFormatter(appLogger.Logger.Logger.Formatter)
+	logrus.SetLevel(appLogger.Logger.Logger.GetLevel())
+	// сообщения usecase и утилит через стандартный log попадают в тот же поток на уровне debug
+	log.SetFlags(0)
+	log.SetOutput(appLogger.Logger.WriterLevel(logrus.DebugLevel))
+
+	a, err := app.New(cfg, appLogger)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
+	cleanup := func() {
+		if err := a.Close(); err != nil {
+			logrus.Error(err)
+		}
+		appLogger.Flush()
+	}
+
+	return a.Server(), a.Health, cleanup
+}
+
+func main() {
+	cfg, err := config2.Load(os.Args[1:])
+	if err != nil {
 		log.Fatal(err)
 	}
 
-	userUsecase := usecase.UserUsecase{DB: &repostitory.UserRepository{DB: Db.GetPostgres()}}
-	forumUsecase := usecase2.ForumUsecase{DB: &repository2.ForumRepository{DB: Db.GetPostgres()}}
-	threadUsecase := usecase3.ThreadUsecase{ThreadDB: &repository3.ThreadRepository{DB: Db.GetPostgres()}, ForumDB: &repository2.ForumRepository{DB: Db.GetPostgres()}}
-	postUsecase := usecase4.PostUsecase{PostDB: &repository4.PostRepository{DB: Db.GetPostgres()}, ThreadDB: &repository3.ThreadRepository{DB: Db.GetPostgres()}}
-	serviceUsecase := usecase5.ServiceUsecase{DB: repository5.ServiceRepository{DB: Db.GetPostgres(), Status: &status}}
+	if len(cfg.Args) > 0 {
+		switch cfg.Args[0] {
+		case "migrate":
+			err = migrate(cfg, cfg.Args[1:])
+		case "admin":
+			err = admin(cfg, cfg.Args[1:])
+		default:
+			log.Fatalf("unknown command %q", cfg.Args[0])
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 
-	// logger
-	logrus.SetFormatter(&logrus.TextFormatter{})
-	mainLogger := logrus.New()
-	loggerM := middleware.LoggerMiddleware{
-		Logger: &logger.Logger{Logger: logrus.NewEntry(mainLogger)},
-		User:   &userUsecase,
+	server, probes, cleanup := config(cfg)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		logrus.WithField("listen", cfg.Server.Listen).Info("Server Start")
+		serveErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err = <-serveErr:
+		logrus.Error(err)
+	case <-ctx.Done():
+		logrus.Info("Shutting down, waiting for active requests")
 	}
+	stop()
 
-	//delivery
-	user := delivery.UserDeliveryStruct{Usecase: userUsecase}
-	forum := delivery2.ForumDelivery{ForumUsecase: forumUsecase, ThreadUsecase: threadUsecase}
-	thread := delivery3.ThreadDelivery{ThreadUsecase: threadUsecase, PostUsecase: postUsecase}
-	post := delivery4.PostDelivery{Usecase: postUsecase}
-	service := delivery5.ServiceDelivery{Usecase: serviceUsecase}
+	probes.SetShuttingDown()
+	if delay := cfg.Server.ShutdownDelay.Duration; delay > 0 && err == nil {
+		time.Sleep(delay)
+	}
 
-	//router
-	mainRouter := mux.NewRouter()
-	subRouter := mainRouter.PathPrefix("/api").Subrouter()
-	subRouter.Use(loggerM.Middleware)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout.Duration)
+	defer cancel()
+	if shutdownErr := server.Shutdown(shutdownCtx); shutdownErr != nil {
+		logrus.Error(shutdownErr)
+	}
+
+	logrus.Info("Server Stopped")
+	cleanup()
+
+	if err != nil && err != http.ErrServerClosed {
+		os.Exit(1)
+	}
+}
 
-	user.SetHandlersForUsers(subRouter)
-	forum.SetHandlersForForum(subRouter)
-	thread.SetHandlersForThread(subRouter)
-	post.SetHandlersForPost(subRouter)
-	service.SetHandlersForService(subRouter)
+// migrate выполняет "migrate up|down [n]|status" и завершается, не поднимая сервер.
+func migrate(cfg config2.Config, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: migrate up|down [n]|status")
+	}
 
-	s := http.Server{
-		Addr:    ":5000",
-		Handler: mainRouter,
+	Db, err := repository.NewPostgres(cfg.Database)
+	if err != nil {
+		return err
 	}
+	defer Db.Close()
 
-	return &s
+	ctx := context.Background()
+	migrator := migrations.Migrator{DB: Db.GetPostgres().ConnPool}
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		for _, m := range applied {
+			fmt.Printf("up %04d_%s\n", m.Version, m.Name)
+		}
+		return err
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				return errors.Errorf("invalid number of steps %q", args[1])
+			}
+		}
+		reverted, err := migrator.Down(ctx, steps)
+		for _, m := range reverted {
+			fmt.Printf("down %04d_%s\n", m.Version, m.Name)
+		}
+		return err
+	case "status":
+		version, err := migrator.Version(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("current %d, latest %d\n", version, migrations.Latest())
+		return nil
+	}
+	return errors.Errorf("unknown migrate command %q", args[0])
 }
 
-func main() {
-	server := config()
-	log.Println("Server Start")
-	log.Fatalln(server.ListenAndServe())
+// admin выполняет "admin grant|revoke <nickname>|list". Роль администратора
+// сайта выдаётся только так, через API её получить нельзя.
+func admin(cfg config2.Config, args []string) error {
+	if len(args) == 0 || (args[0] != "list" && len(args) != 2) {
+		return errors.New("usage: admin grant <nickname>|revoke <nickname>|list")
+	}
+	if cfg.Storage == config2.StorageMemory {
+		return errors.New("admin needs a persistent storage: postgres or sqlite")
+	}
+
+	repos, closeStorage, err := app.OpenStorage(cfg, &health.Health{})
+	if err != nil {
+		return err
+	}
+	defer closeStorage()
+
+	ctx := context.Background()
+	switch args[0] {
+	case "grant", "revoke":
+		if err = repos.User.SetAdmin(ctx, args[1], args[0] == "grant"); err != nil {
+			return errors.Wrap(err, args[1])
+		}
+		fmt.Printf("%s %s\n", args[0], args[1])
+		return nil
+	case "list":
+		admins, err := repos.User.FindAdmins(ctx)
+		for _, user := range admins {
+			fmt.Println(user.Nickname)
+		}
+		return err
+	}
+	return errors.Errorf("unknown admin command %q", args[0])
 }
@@ -0,0 +1,167 @@
+// Package app собирает сервис из конфигурации: хранилище, usecase'ы, обработчики
+// и роутер. Одну и ту же сборку используют cmd/forum, тесты и утилиты.
+package app
+
+import (
+	"crypto/rand"
+	"forum/internal/forum/config"
+	"forum/internal/forum/health"
+	"forum/internal/forum/middleware"
+	"forum/internal/utils/auth"
+	"forum/internal/utils/logger"
+	delivery6 "forum/pkg/apikey/delivery"
+	usecase6 "forum/pkg/apikey/usecase"
+	delivery2 "forum/pkg/forum/delivery"
+	usecase2 "forum/pkg/forum/usecase"
+	"forum/pkg/models"
+	delivery4 "forum/pkg/post/delivery"
+	usecase4 "forum/pkg/post/usecase"
+	delivery5 "forum/pkg/service/delivery"
+	usecase5 "forum/pkg/service/usecase"
+	delivery3 "forum/pkg/thread/delivery"
+	usecase3 "forum/pkg/thread/usecase"
+	"forum/pkg/user/delivery"
+	"forum/pkg/user/usecase"
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+	"time"
+)
+
+type App struct {
+	Config       config.Config
+	Repositories Repositories
+	Health       *health.Health
+	Router       *mux.Router
+
+	closeStorage func() error
+}
+
+// New открывает хранилище и собирает роутер. Close нужно вызвать после
+// остановки сервера.
+func New(cfg config.Config, appLogger *logger.Logger) (*App, error) {
+	if cfg.Auth.Secret == "" {
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+		cfg.Auth.Secret = string(secret)
+		appLogger.Logger.Warn("auth.secret is empty, session tokens will not survive a restart")
+	}
+
+	probes := &health.Health{}
+	repos, closeStorage, err := OpenStorage(cfg, probes)
+	if err != nil {
+		return nil, err
+	}
+
+	return &App{
+		Config:       cfg,
+		Repositories: repos,
+		Health:       probes,
+		Router:       NewRouter(cfg, repos, appLogger, probes),
+		closeStorage: closeStorage,
+	}, nil
+}
+
+// NewRouter собирает usecase'ы и обработчики поверх готовых репозиториев.
+func NewRouter(cfg config.Config, repos Repositories, appLogger *logger.Logger, probes *health.Health) *mux.Router {
+	userUsecase := usecase.UserUsecase{
+		DB:       repos.User,
+		AliasTTL: cfg.Users.AliasTTL.Duration,
+		Tokens: auth.Tokens{
+			Secret: []byte(cfg.Auth.Secret),
+			TTL:    cfg.Auth.TokenTTL.Duration,
+		},
+		PasswordRequired: cfg.Auth.Required,
+	}
+	permissions := usecase2.Permissions{DB: repos.Forum, UserDB: repos.User}
+	forumUsecase := usecase2.ForumUsecase{DB: repos.Forum, UserDB: repos.User, Permissions: permissions}
+	threadUsecase := usecase3.ThreadUsecase{ThreadDB: repos.Thread, ForumDB: repos.Forum, UserDB: repos.User, Permissions: permissions}
+	postUsecase := usecase4.PostUsecase{PostDB: repos.Post, ThreadDB: repos.Thread, UserDB: repos.User, Permissions: permissions}
+	serviceUsecase := usecase5.ServiceUsecase{DB: repos.Service, UserDB: repos.User, Permissions: permissions}
+	keyUsecase := usecase6.KeyUsecase{DB: repos.Key, UserDB: repos.User}
+
+	loggerM := middleware.LoggerMiddleware{
+		Logger: appLogger,
+	}
+	authM := middleware.AuthMiddleware{
+		User:     &userUsecase,
+		Keys:     &keyUsecase,
+		Required: cfg.Auth.Required,
+		Public: map[string]bool{
+			"/api/user/{nickname}/create": true,
+			"/api/user/{nickname}/login":  true,
+		},
+		Scopes: map[string]string{
+			"POST /api/forum/create":                         models.ScopePost,
+			"POST /api/forum/{slug}/create":                  models.ScopePost,
+			"POST /api/thread/{slug_or_id}/create":           models.ScopePost,
+			"POST /api/thread/{slug_or_id}/details":          models.ScopePost,
+			"POST /api/post/{id}/details":                    models.ScopePost,
+			"POST /api/thread/{slug_or_id}/vote":             models.ScopeVote,
+			"POST /api/forum/{slug}/moderators/{nickname}":   models.ScopeModerate,
+			"DELETE /api/forum/{slug}/moderators/{nickname}": models.ScopeModerate,
+			"GET /api/user/{nickname}/keys":                  models.ScopeAdmin,
+			"GET /api/user/{nickname}/export":                models.ScopeAdmin,
+		},
+	}
+
+	routeTimeouts := make(map[string]time.Duration, len(cfg.Server.RouteTimeouts))
+	for route, timeout := range cfg.Server.RouteTimeouts {
+		routeTimeouts[route] = timeout.Duration
+	}
+	timeoutM := middleware.TimeoutMiddleware{
+		Default: cfg.Server.RequestTimeout.Duration,
+		Routes:  routeTimeouts,
+	}
+
+	//delivery
+	user := delivery.UserDeliveryStruct{Usecase: userUsecase, PostUsecase: postUsecase, ThreadUsecase: threadUsecase}
+	forum := delivery2.ForumDelivery{ForumUsecase: forumUsecase, ThreadUsecase: threadUsecase}
+	thread := delivery3.ThreadDelivery{ThreadUsecase: threadUsecase, PostUsecase: postUsecase}
+	post := delivery4.PostDelivery{Usecase: postUsecase}
+	service := delivery5.ServiceDelivery{Usecase: serviceUsecase, Enabled: cfg.Service.Enabled}
+	key := delivery6.KeyDelivery{Usecase: keyUsecase}
+
+	metricsM := middleware.MetricsMiddleware{}
+	streamM := middleware.StreamMiddleware{
+		WriteTimeout: cfg.Server.WriteTimeout.Duration,
+		Routes:       map[string]bool{"/api/user/{nickname}/export": true},
+	}
+
+	//router
+	mainRouter := mux.NewRouter()
+	mainRouter.Handle("/metrics", promhttp.Handler()).Methods(http.MethodGet)
+	probes.SetHandlers(mainRouter)
+	subRouter := mainRouter.PathPrefix("/api").Subrouter()
+	subRouter.Use(loggerM.Middleware)
+	subRouter.Use(metricsM.Middleware)
+	subRouter.Use(streamM.Middleware)
+	subRouter.Use(timeoutM.Middleware)
+	subRouter.Use(authM.Middleware)
+
+	user.SetHandlersForUsers(subRouter)
+	forum.SetHandlersForForum(subRouter)
+	thread.SetHandlersForThread(subRouter)
+	post.SetHandlersForPost(subRouter)
+	service.SetHandlersForService(subRouter)
+	key.SetHandlersForKeys(subRouter)
+
+	return mainRouter
+}
+
+// Server http.Server с таймаутами из конфигурации.
+func (a *App) Server() *http.Server {
+	return &http.Server{
+		Addr:         a.Config.Server.Listen,
+		Handler:      a.Router,
+		ReadTimeout:  a.Config.Server.ReadTimeout.Duration,
+		WriteTimeout: a.Config.Server.WriteTimeout.Duration,
+		ConnContext:  middleware.WithConn,
+	}
+}
+
+func (a *App) Close() error {
+	return a.closeStorage()
+}
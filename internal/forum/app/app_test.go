@@ -0,0 +1,938 @@
+package app_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"forum/internal/forum/app"
+	"forum/internal/forum/config"
+	"forum/internal/forum/middleware"
+	"forum/internal/utils/logger"
+	"forum/pkg/models"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Сквозной сценарий через роутер из app.New: те же middleware, обработчики и
+// хранилище, что и в cmd/forum, только поверх httptest.Server. Сценарий из
+// задания идёт без токенов, поэтому auth.required выключен явно.
+func TestAPI(t *testing.T) {
+	forEachStorage(t, func(cfg *config.Config) {
+		cfg.Auth.Required = false
+		cfg.Service.Enabled = true
+	}, scenario)
+}
+
+// TestAuthDefault по умолчанию запись без токена получает 401, чтение открыто.
+func TestAuthDefault(t *testing.T) {
+	forEachStorage(t, func(cfg *config.Config) {}, func(t *testing.T, c *client) {
+		var message response
+		c.post("/api/user/alice/create", models.User{Fullname: "Alice", Email: "alice@example.com"}, http.StatusBadRequest, &message)
+		c.post("/api/user/alice/create", models.User{Fullname: "Alice", Email: "alice@example.com", Password: "sea"}, http.StatusCreated, nil)
+		c.post("/api/forum/create", models.Forum{Title: "Pirates", User: "alice", Slug: "pirates"}, http.StatusUnauthorized, &message)
+		c.post("/api/user/alice/profile", models.User{About: "hacked"}, http.StatusUnauthorized, &message)
+		c.get("/api/user/alice/profile", http.StatusOK, nil)
+	})
+}
+
+// TestAuth сценарий с обязательной аутентификацией.
+func TestAuth(t *testing.T) {
+	forEachStorage(t, func(cfg *config.Config) {
+		cfg.Auth.Secret = "test secret"
+		cfg.Auth.Required = true
+		cfg.Service.Enabled = true
+	}, authScenario)
+}
+
+// TestServiceDisabled без service.enabled очистки и слияния нет даже у администратора.
+func TestServiceDisabled(t *testing.T) {
+	forEachStorage(t, func(cfg *config.Config) {}, func(t *testing.T, c *client) {
+		root := c.admin()
+		root.post("/api/service/clear", nil, http.StatusNotFound, nil)
+		root.post("/api/service/merge", models.UserMerge{Into: "root", From: "nobody"}, http.StatusNotFound, nil)
+		c.get("/api/service/status", http.StatusOK, nil)
+
+		data, _ := c.send(http.MethodGet, "/metrics", nil, http.StatusOK)
+		for _, want := range []string{
+			`http_requests_total{method="GET",route="/api/service/status",status="200"}`,
+			`http_request_duration_seconds_bucket{method="GET",route="/api/service/status",le="+Inf"}`,
+			"# TYPE forum_posts_created_total counter",
+		} {
+			if !strings.Contains(string(data), want) {
+				t.Fatalf("metrics without %s:\n%s", want, data)
+			}
+		}
+	})
+}
+
+// TestExportSlowClient выгрузка, которую клиент читает дольше WriteTimeout и
+// RequestTimeout, приходит целиком: дедлайн записи переносится, пока клиент
+// читает, а у маршрута выгрузки нет дедлайна обработки.
+func TestExportSlowClient(t *testing.T) {
+	forEachStorage(t, func(cfg *config.Config) {
+		cfg.Server.WriteTimeout = config.Duration{Duration: time.Second}
+		cfg.Server.RequestTimeout = config.Duration{Duration: 500 * time.Millisecond}
+	}, exportSlowly)
+}
+
+func exportSlowly(t *testing.T, c *client) {
+	c.post("/api/user/alice/create", models.User{Fullname: "Alice", Email: "alice@example.com", Password: "sea"}, http.StatusCreated, nil)
+	var session models.UserSession
+	c.post("/api/user/alice/login", models.UserLogin{Password: "sea"}, http.StatusOK, &session)
+	alice := c.as(session.Token)
+	alice.post("/api/forum/create", models.Forum{Title: "Pirates", User: "alice", Slug: "pirates"}, http.StatusCreated, nil)
+	alice.post("/api/forum/pirates/create", models.Thread{Title: "Kraken", Author: "alice", Message: "Beware", Slug: "kraken"}, http.StatusCreated, nil)
+
+	// случайный текст сжимается вдвое, архив выходит около 600 КБ, больше
+	// буферов сокетов с обеих сторон
+	const count = 1000
+	for batch := 0; batch < count/100; batch++ {
+		posts := make([]models.Post, 0, 100)
+		for i := 0; i < 100; i++ {
+			message := make([]byte, 512)
+			if _, err := rand.Read(message); err != nil {
+				t.Fatal(err)
+			}
+			posts = append(posts, models.Post{Author: "alice", Message: hex.EncodeToString(message)})
+		}
+		alice.post("/api/thread/kraken/create", posts, http.StatusCreated, nil)
+	}
+
+	slow := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			conn, err := (&net.Dialer{}).DialContext(ctx, network, addr)
+			if tcp, ok := conn.(*net.TCPConn); ok {
+				_ = tcp.SetReadBuffer(socketBuffer)
+			}
+			return conn, err
+		},
+	}}
+	req, err := http.NewRequest(http.MethodGet, c.url+"/api/user/alice/export", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+session.Token)
+	resp, err := slow.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("export: status %d", resp.StatusCode)
+	}
+
+	// читаем примерно по 250 КБ/с, больше двух секунд
+	started := time.Now()
+	var data bytes.Buffer
+	chunk := make([]byte, 8<<10)
+	for paced := 0; ; {
+		n, err := resp.Body.Read(chunk)
+		data.Write(chunk[:n])
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("export cut off after %d bytes: %v", data.Len(), err)
+		}
+		for ; paced+len(chunk) <= data.Len(); paced += len(chunk) {
+			time.Sleep(30 * time.Millisecond)
+		}
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(data.Bytes()), int64(data.Len()))
+	if err != nil {
+		t.Fatalf("export of %d bytes: %v", data.Len(), err)
+	}
+	reader, err := archive.Open("posts.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	var posts []models.UserExportPost
+	if err = json.NewDecoder(reader).Decode(&posts); err != nil {
+		t.Fatal(err)
+	}
+	if len(posts) != count {
+		t.Fatalf("exported %d posts, want %d", len(posts), count)
+	}
+	if elapsed := time.Since(started); elapsed < 2*time.Second {
+		t.Fatalf("export of %d bytes read in %v, the test does not outlast the deadlines", data.Len(), elapsed)
+	}
+}
+
+func forEachStorage(t *testing.T, configure func(cfg *config.Config), run func(t *testing.T, c *client)) {
+	storages := map[string]func(cfg *config.Config){
+		config.StorageMemory: func(cfg *config.Config) {},
+		config.StorageSQLite: func(cfg *config.Config) {
+			cfg.SQLite.Path = filepath.Join(t.TempDir(), "forum.db")
+		},
+	}
+	if dsn := os.Getenv("FORUM_TEST_DSN"); dsn != "" {
+		storages[config.StoragePostgres] = func(cfg *config.Config) {
+			cfg.Database.DSN = dsn
+			cfg.Database.MaxConnections = 10
+		}
+	} else if os.Getenv("FORUM_TEST_REQUIRE_POSTGRES") != "" {
+		t.Fatal("FORUM_TEST_REQUIRE_POSTGRES is set but FORUM_TEST_DSN is empty")
+	} else {
+		t.Log("WARNING: FORUM_TEST_DSN is not set, the API is NOT tested against Postgres.")
+	}
+
+	for storage, setup := range storages {
+		setup := setup
+		cfg := config.Default()
+		cfg.Storage = storage
+		t.Run(storage, func(t *testing.T) {
+			setup(&cfg)
+			configure(&cfg)
+			run(t, newClient(t, cfg))
+		})
+	}
+}
+
+type client struct {
+	t     *testing.T
+	url   string
+	repos app.Repositories
+	// Токен для заголовка Authorization; пустой — анонимный запрос.
+	token string
+}
+
+// as клиент, который отправляет запросы с token.
+func (c *client) as(token string) *client {
+	copied := *c
+	copied.token = token
+	return &copied
+}
+
+// Больше MSS на loopback, иначе TCP с крошечным окном простаивает.
+const socketBuffer = 64 << 10
+
+// newClient поднимает http.Server из App.Server, с теми же таймаутами, что в cmd/forum.
+func newClient(t *testing.T, cfg config.Config) *client {
+	appLogger, err := logger.New("error", cfg.Log.Format)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := app.New(cfg, appLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewUnstartedServer(a.Router)
+	server.Config = a.Server()
+	// маленький буфер сокета, как у медленного клиента по сети: ответ не
+	// уходит в ядро целиком, и сервер пишет, только пока клиент читает
+	server.Config.ConnContext = func(ctx context.Context, conn net.Conn) context.Context {
+		if tcp, ok := conn.(*net.TCPConn); ok {
+			_ = tcp.SetWriteBuffer(socketBuffer)
+		}
+		return middleware.WithConn(ctx, conn)
+	}
+	server.Start()
+	t.Cleanup(func() {
+		server.Close()
+		if err := a.Close(); err != nil {
+			t.Error(err)
+		}
+	})
+	return &client{t: t, url: server.URL, repos: a.Repositories}
+}
+
+// do отправляет запрос, проверяет код ответа, раскладывает тело в out и
+// возвращает заголовки ответа.
+func (c *client) do(method, path string, body interface{}, code int, out interface{}) http.Header {
+	c.t.Helper()
+	data, header := c.send(method, path, body, code)
+	if out != nil {
+		if err := json.Unmarshal(data, out); err != nil {
+			c.t.Fatalf("%s %s: %v, body %s", method, path, err, data)
+		}
+	}
+	return header
+}
+
+// send отправляет запрос, проверяет код ответа и возвращает тело как есть.
+func (c *client) send(method, path string, body interface{}, code int) ([]byte, http.Header) {
+	c.t.Helper()
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			c.t.Fatal(err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, c.url+path, reader)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if resp.StatusCode != code {
+		c.t.Fatalf("%s %s: status %d, want %d, body %s", method, path, resp.StatusCode, code, data)
+	}
+	return data, resp.Header
+}
+
+func (c *client) get(path string, code int, out interface{}) http.Header {
+	c.t.Helper()
+	return c.do(http.MethodGet, path, nil, code, out)
+}
+
+func (c *client) post(path string, body interface{}, code int, out interface{}) {
+	c.t.Helper()
+	c.do(http.MethodPost, path, body, code, out)
+}
+
+// grant выдаёт роль администратора сайта, как команда "admin grant".
+func (c *client) grant(nickname string) {
+	c.t.Helper()
+	if err := c.repos.User.SetAdmin(context.Background(), nickname, true); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// admin регистрирует администратора сайта root и входит от его имени.
+func (c *client) admin() *client {
+	c.t.Helper()
+	data, err := json.Marshal(models.User{Fullname: "root", Email: "root@example.com", Password: "admin"})
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	resp, err := http.Post(c.url+"/api/user/root/create", "application/json", bytes.NewReader(data))
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	resp.Body.Close()
+	// root мог остаться в базе Postgres от прошлого прогона
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusConflict {
+		c.t.Fatalf("create root: status %d", resp.StatusCode)
+	}
+	c.grant("root")
+
+	var session models.UserSession
+	c.post("/api/user/root/login", models.UserLogin{Password: "admin"}, http.StatusOK, &session)
+	return c.as(session.Token)
+}
+
+func (c *client) status(want models.Status) {
+	c.t.Helper()
+	var status models.Status
+	c.get("/api/service/status", http.StatusOK, &status)
+	if status != want {
+		c.t.Fatalf("status %+v, want %+v", status, want)
+	}
+}
+
+func ids(posts []models.Post) []int {
+	result := make([]int, 0, len(posts))
+	for _, post := range posts {
+		result = append(result, post.Id)
+	}
+	return result
+}
+
+func expectIds(t *testing.T, what string, posts []models.Post, want ...int) {
+	t.Helper()
+	if got := ids(posts); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("%s: posts %v, want %v", what, got, want)
+	}
+}
+
+func scenario(t *testing.T, c *client) {
+	var message response
+	var cleaned models.CleanReport
+	// очистка и слияние доступны только администратору сайта; очистка удаляет и его
+	c.post("/api/service/clear", nil, http.StatusUnauthorized, &message)
+	c.admin().post("/api/service/clear", nil, http.StatusOK, &cleaned)
+	c.status(models.Status{})
+
+	// пользователи
+	alice := models.User{Nickname: "alice", Fullname: "Alice", About: "pirate", Email: "alice@example.com"}
+	bob := models.User{Nickname: "Bob", Fullname: "Bob", About: "sailor", Email: "bob@example.com"}
+	for _, user := range []models.User{alice, bob} {
+		var created models.User
+		c.post("/api/user/"+user.Nickname+"/create", user, http.StatusCreated, &created)
+		if created != user {
+			t.Fatalf("created user %+v, want %+v", created, user)
+		}
+	}
+	var conflicts []models.User
+	c.post("/api/user/ALICE/create", models.User{Fullname: "x", Email: "BOB@example.com"}, http.StatusConflict, &conflicts)
+	if len(conflicts) != 2 {
+		t.Fatalf("conflicting users %+v", conflicts)
+	}
+
+	var user models.User
+	c.get("/api/user/BOB/profile", http.StatusOK, &user)
+	if user != bob {
+		t.Fatalf("profile %+v, want %+v", user, bob)
+	}
+	c.get("/api/user/nobody/profile", http.StatusNotFound, &message)
+	c.post("/api/user/alice/profile", models.User{About: "captain"}, http.StatusOK, &user)
+	if user.About != "captain" || user.Email != alice.Email {
+		t.Fatalf("changed profile %+v", user)
+	}
+	c.post("/api/user/alice/profile", models.User{Email: bob.Email}, http.StatusConflict, &message)
+	c.post("/api/user/nobody/profile", models.User{About: "x"}, http.StatusNotFound, &message)
+
+	var page []models.User
+	header := c.get("/api/users?limit=1", http.StatusOK, &page)
+	if len(page) != 1 || page[0].Nickname != "alice" || header.Get("X-Total-Count") != "2" {
+		t.Fatalf("users page %+v, total %q", page, header.Get("X-Total-Count"))
+	}
+	header = c.get("/api/users?limit=1&since=alice&query=B", http.StatusOK, &page)
+	if len(page) != 1 || page[0].Nickname != "Bob" || header.Get("X-Total-Count") != "1" {
+		t.Fatalf("users page %+v, total %q", page, header.Get("X-Total-Count"))
+	}
+	c.get("/api/users?limit=-1", http.StatusBadRequest, &message)
+
+	// форумы
+	var forum models.Forum
+	c.post("/api/forum/create", models.Forum{Title: "Pirates", User: "ALICE", Slug: "pirates"}, http.StatusCreated, &forum)
+	if forum.User != "alice" || forum.Slug != "pirates" {
+		t.Fatalf("created forum %+v", forum)
+	}
+	c.post("/api/forum/create", models.Forum{Title: "Other", User: "bob", Slug: "PIRATES"}, http.StatusConflict, &forum)
+	if forum.Title != "Pirates" {
+		t.Fatalf("conflicting forum %+v", forum)
+	}
+	c.post("/api/forum/create", models.Forum{Title: "x", User: "nobody", Slug: "x"}, http.StatusNotFound, &message)
+	c.get("/api/forum/missing/details", http.StatusNotFound, &message)
+
+	// ветки
+	created := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	var kraken, anonymous models.Thread
+	c.post("/api/forum/Pirates/create", models.Thread{Title: "Kraken", Author: "bob", Message: "Beware", Slug: "kraken", Created: created},
+		http.StatusCreated, &kraken)
+	if kraken.Id == 0 || kraken.Forum != "pirates" || kraken.Author != "Bob" || !kraken.Created.Equal(created) {
+		t.Fatalf("created thread %+v", kraken)
+	}
+	c.post("/api/forum/pirates/create", models.Thread{Title: "No slug", Author: "alice", Message: "Hi", Created: created.Add(time.Hour)},
+		http.StatusCreated, &anonymous)
+	if anonymous.Slug != "" {
+		t.Fatalf("thread without slug got %q", anonymous.Slug)
+	}
+	var thread models.Thread
+	c.post("/api/forum/pirates/create", models.Thread{Title: "x", Author: "alice", Message: "x", Slug: "KRAKEN"}, http.StatusConflict, &thread)
+	if thread.Id != kraken.Id {
+		t.Fatalf("conflicting thread %+v", thread)
+	}
+	c.post("/api/forum/missing/create", models.Thread{Title: "x", Author: "alice", Message: "x"}, http.StatusNotFound, &message)
+	c.post("/api/forum/pirates/create", models.Thread{Title: "x", Author: "nobody", Message: "x"}, http.StatusNotFound, &message)
+
+	var threads []models.Thread
+	c.get("/api/forum/pirates/threads?desc=true&limit=10", http.StatusOK, &threads)
+	if len(threads) != 2 || threads[0].Id != anonymous.Id || threads[1].Id != kraken.Id {
+		t.Fatalf("forum threads %+v", threads)
+	}
+	c.get("/api/thread/kraken/details", http.StatusOK, &thread)
+	if thread.Id != kraken.Id {
+		t.Fatalf("thread by slug %+v", thread)
+	}
+	c.get("/api/thread/"+strconv.Itoa(int(kraken.Id)+100)+"/details", http.StatusNotFound, &message)
+
+	// посты: r1 ← c1 ← g1, r2
+	var roots, children, grandchildren []models.Post
+	c.post("/api/thread/kraken/create", []models.Post{{Author: "alice", Message: "r1"}, {Author: "bob", Message: "r2"}},
+		http.StatusCreated, &roots)
+	if len(roots) != 2 || roots[0].Thread != int(kraken.Id) || roots[0].Forum != "pirates" {
+		t.Fatalf("created posts %+v", roots)
+	}
+	r1, r2 := roots[0].Id, roots[1].Id
+	c.post("/api/thread/"+strconv.Itoa(int(kraken.Id))+"/create", []models.Post{{Author: "bob", Message: "c1", Parent: int64(r1)}},
+		http.StatusCreated, &children)
+	c1 := children[0].Id
+	c.post("/api/thread/kraken/create", []models.Post{{Author: "alice", Message: "g1", Parent: int64(c1)}}, http.StatusCreated, &grandchildren)
+	g1 := grandchildren[0].Id
+
+	c.post("/api/thread/"+strconv.Itoa(int(anonymous.Id))+"/create", []models.Post{{Author: "alice", Message: "x", Parent: int64(r1)}},
+		http.StatusConflict, &message)
+	c.post("/api/thread/kraken/create", []models.Post{{Author: "nobody", Message: "x"}}, http.StatusNotFound, &message)
+	c.post("/api/thread/missing/create", []models.Post{{Author: "alice", Message: "x"}}, http.StatusNotFound, &message)
+
+	var posts []models.Post
+	c.get("/api/thread/kraken/posts?sort=flat", http.StatusOK, &posts)
+	expectIds(t, "flat", posts, r1, r2, c1, g1)
+	c.get("/api/thread/kraken/posts?sort=flat&desc=true&limit=2", http.StatusOK, &posts)
+	expectIds(t, "flat desc", posts, g1, c1)
+	c.get("/api/thread/kraken/posts?sort=tree", http.StatusOK, &posts)
+	expectIds(t, "tree", posts, r1, c1, g1, r2)
+	c.get(fmt.Sprintf("/api/thread/kraken/posts?sort=tree&since=%d", c1), http.StatusOK, &posts)
+	expectIds(t, "tree since", posts, g1, r2)
+	c.get("/api/thread/kraken/posts?sort=parent_tree&desc=true&limit=1", http.StatusOK, &posts)
+	expectIds(t, "parent_tree desc", posts, r2)
+	c.get("/api/thread/kraken/posts?sort=parent_tree&limit=1", http.StatusOK, &posts)
+	expectIds(t, "parent_tree", posts, r1, c1, g1)
+
+	// список форумов со счётчиками
+	var forums []models.Forum
+	header = c.get("/api/forums?sort=posts&desc=true&query=PIR", http.StatusOK, &forums)
+	if want := (models.Forum{Title: "Pirates", User: "alice", Slug: "pirates", Posts: 4, Threads: 2}); len(forums) != 1 || forums[0] != want ||
+		header.Get("X-Total-Count") != "1" {
+		t.Fatalf("forums %+v, total %q", forums, header.Get("X-Total-Count"))
+	}
+	data, _ := c.send(http.MethodGet, "/api/forums?since=Pirates&sort=created", nil, http.StatusOK)
+	if string(bytes.TrimSpace(data)) != "[]" {
+		t.Fatalf("forums after the last one %s", data)
+	}
+	c.get("/api/forums?sort=title", http.StatusBadRequest, &message)
+	c.get("/api/forums?since=missing", http.StatusNotFound, &message)
+
+	// голоса
+	for _, tc := range []struct {
+		vote  models.Vote
+		votes int64
+	}{
+		{models.Vote{Nickname: "alice", Voice: 1}, 1},
+		{models.Vote{Nickname: "bob", Voice: -1}, 0},
+		{models.Vote{Nickname: "ALICE", Voice: -1}, -2},
+		{models.Vote{Nickname: "alice", Voice: -1}, -2},
+	} {
+		c.post("/api/thread/kraken/vote", tc.vote, http.StatusOK, &thread)
+		if thread.Votes != tc.votes {
+			t.Fatalf("votes after %+v = %d, want %d", tc.vote, thread.Votes, tc.votes)
+		}
+	}
+	c.post("/api/thread/kraken/vote", models.Vote{Nickname: "nobody", Voice: 1}, http.StatusNotFound, &message)
+
+	var stats models.UserStats
+	c.get("/api/user/ALICE/stats", http.StatusOK, &stats)
+	if stats.Nickname != "alice" || stats.Posts != 2 || stats.Threads != 1 || stats.VotesCast != 1 || stats.Forums != 1 ||
+		stats.FirstActivity == nil || !stats.FirstActivity.Equal(created.Add(time.Hour)) {
+		t.Fatalf("user stats %+v", stats)
+	}
+	c.get("/api/user/nobody/stats", http.StatusNotFound, &message)
+
+	c.get("/api/user/ALICE/posts?forum=PIRATES&desc=true", http.StatusOK, &posts)
+	expectIds(t, "user posts", posts, g1, r1)
+	c.get(fmt.Sprintf("/api/user/alice/posts?since=%d", r1), http.StatusOK, &posts)
+	expectIds(t, "user posts since", posts, g1)
+	c.get("/api/user/alice/posts?forum=missing", http.StatusOK, &posts)
+	expectIds(t, "user posts in other forum", posts)
+	c.get("/api/user/nobody/posts", http.StatusNotFound, &message)
+	c.get("/api/user/bob/threads?limit=10", http.StatusOK, &threads)
+	if len(threads) != 1 || threads[0].Id != kraken.Id || threads[0].Slug != "kraken" {
+		t.Fatalf("user threads %+v", threads)
+	}
+	c.get("/api/user/alice/threads", http.StatusOK, &threads)
+	if len(threads) != 1 || threads[0].Id != anonymous.Id || threads[0].Slug != "" {
+		t.Fatalf("user threads %+v", threads)
+	}
+	c.get("/api/user/nobody/threads", http.StatusNotFound, &message)
+
+	// выгрузка только для самого пользователя и администраторов
+	c.get("/api/user/alice/export", http.StatusUnauthorized, &message)
+	root := c.admin()
+	data, header = root.send(http.MethodGet, "/api/user/ALICE/export", nil, http.StatusOK)
+	if header.Get("Content-Type") != "application/zip" || header.Get("Content-Disposition") != `attachment; filename=alice.zip` {
+		t.Fatalf("export headers %v", header)
+	}
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var exported struct {
+		profile models.User
+		threads []models.Thread
+		posts   []models.UserExportPost
+		votes   []models.UserExportVote
+		forums  []models.Forum
+	}
+	for _, file := range []struct {
+		name string
+		out  interface{}
+	}{
+		{"profile.json", &exported.profile},
+		{"threads.json", &exported.threads},
+		{"posts.json", &exported.posts},
+		{"votes.json", &exported.votes},
+		{"forums.json", &exported.forums},
+	} {
+		reader, err := archive.Open(file.name)
+		if err != nil {
+			t.Fatalf("export: %v", err)
+		}
+		if err = json.NewDecoder(reader).Decode(file.out); err != nil {
+			t.Fatalf("export %s: %v", file.name, err)
+		}
+		reader.Close()
+	}
+	if exported.profile.Email != alice.Email || len(exported.threads) != 1 || exported.threads[0].Id != anonymous.Id ||
+		len(exported.posts) != 2 || exported.posts[1].Id != g1 || exported.posts[1].ThreadSlug != "kraken" ||
+		len(exported.votes) != 1 || exported.votes[0].Voice != -1 || len(exported.forums) != 1 || exported.forums[0].Slug != "pirates" {
+		t.Fatalf("export %+v", exported)
+	}
+	root.get("/api/user/nobody/export", http.StatusNotFound, &message)
+
+	// правки
+	c.post("/api/thread/kraken/details", models.ThreadUpdate{Title: "Kraken!"}, http.StatusOK, &thread)
+	if thread.Title != "Kraken!" || thread.Message != "Beware" {
+		t.Fatalf("updated thread %+v", thread)
+	}
+	var post models.Post
+	c.post(fmt.Sprintf("/api/post/%d/details", c1), models.PostUpdate{Message: "c1"}, http.StatusOK, &post)
+	if post.IsEdited {
+		t.Fatalf("same message marked post as edited: %+v", post)
+	}
+	c.post(fmt.Sprintf("/api/post/%d/details", c1), models.PostUpdate{Message: "edited"}, http.StatusOK, &post)
+	if !post.IsEdited || post.Message != "edited" {
+		t.Fatalf("edited post %+v", post)
+	}
+	c.post("/api/post/100000/details", models.PostUpdate{Message: "x"}, http.StatusNotFound, &message)
+
+	var full models.FullPost
+	c.get(fmt.Sprintf("/api/post/%d/details?related=user,thread,forum", g1), http.StatusOK, &full)
+	if full.Post == nil || full.Post.Id != g1 || full.Author == nil || full.Author.Nickname != "alice" ||
+		full.Thread == nil || full.Thread.Id != kraken.Id || full.Forum == nil || full.Forum.Posts != 4 || full.Forum.Threads != 2 {
+		t.Fatalf("post details %+v", full)
+	}
+	c.get("/api/post/100000/details", http.StatusNotFound, &message)
+
+	var users []models.User
+	c.get("/api/forum/pirates/users", http.StatusOK, &users)
+	if len(users) != 2 || users[0].Nickname != "alice" || users[1].Nickname != "Bob" {
+		t.Fatalf("forum users %+v", users)
+	}
+
+	// переименование и удаление только с токеном, даже без auth.required
+	c.post("/api/user/bob/rename", models.UserRename{Nickname: "Robert"}, http.StatusUnauthorized, &message)
+	c.do(http.MethodDelete, "/api/user/bob/profile", nil, http.StatusUnauthorized, &message)
+	root.post("/api/user/bob/rename", models.UserRename{Nickname: "ALICE"}, http.StatusConflict, &message)
+	root.post("/api/user/bob/rename", models.UserRename{}, http.StatusBadRequest, &message)
+	root.post("/api/user/nobody/rename", models.UserRename{Nickname: "somebody"}, http.StatusNotFound, &message)
+	root.post("/api/user/bob/rename", models.UserRename{Nickname: "Robert"}, http.StatusOK, &user)
+	if user.Nickname != "Robert" || user.Email != bob.Email {
+		t.Fatalf("renamed user %+v", user)
+	}
+	c.get("/api/user/BOB/profile", http.StatusOK, &user)
+	if user.Nickname != "Robert" {
+		t.Fatalf("profile by old nickname %+v", user)
+	}
+	c.get("/api/thread/kraken/details", http.StatusOK, &thread)
+	if thread.Author != "Robert" {
+		t.Fatalf("thread author after rename %+v", thread)
+	}
+	c.get("/api/user/bob/threads", http.StatusOK, &threads)
+	if len(threads) != 1 || threads[0].Author != "Robert" {
+		t.Fatalf("threads by old nickname %+v", threads)
+	}
+	c.get("/api/user/bob/stats", http.StatusOK, &stats)
+	if stats.Nickname != "Robert" || stats.Posts != 2 || stats.Threads != 1 {
+		t.Fatalf("stats by old nickname %+v", stats)
+	}
+	c.post("/api/user/bob/profile", models.User{About: "renamed"}, http.StatusOK, &user)
+	if user.Nickname != "Robert" || user.About != "renamed" {
+		t.Fatalf("profile changed by old nickname %+v", user)
+	}
+
+	// удаление
+	c.post("/api/user/Deleted/create", models.User{Fullname: "x", Email: "x@example.com"}, http.StatusBadRequest, &message)
+	c.post("/api/user/x/create", models.User{Fullname: "x", Email: strings.ToUpper(models.DeletedUserEmail)}, http.StatusBadRequest, &message)
+	root.do(http.MethodDelete, "/api/user/ALICE/profile", nil, http.StatusNoContent, nil)
+	root.do(http.MethodDelete, "/api/user/alice/profile", nil, http.StatusNotFound, &message)
+	c.get("/api/user/alice/profile", http.StatusNotFound, &message)
+	c.get(fmt.Sprintf("/api/post/%d/details?related=user,forum", g1), http.StatusOK, &full)
+	if full.Author == nil || full.Author.Nickname != models.DeletedUser || full.Author.Email != models.DeletedUserEmail ||
+		full.Forum == nil || full.Forum.User != models.DeletedUser || full.Forum.Posts != 4 {
+		t.Fatalf("post details after delete %+v", full)
+	}
+	c.get("/api/thread/kraken/details", http.StatusOK, &thread)
+	if thread.Votes != -1 {
+		t.Fatalf("votes after voter is deleted %d", thread.Votes)
+	}
+	c.get("/api/forum/pirates/users", http.StatusOK, &users)
+	if len(users) != 1 || users[0].Nickname != "Robert" {
+		t.Fatalf("forum users after delete %+v", users)
+	}
+
+	// слияние
+	carol := models.User{Fullname: "Carol", Email: "carol@example.com"}
+	c.post("/api/user/carol/create", carol, http.StatusCreated, &user)
+	var report models.UserMergeReport
+	c.post("/api/service/merge", models.UserMerge{Into: "CAROL", From: "bob"}, http.StatusUnauthorized, &message)
+	root.post("/api/service/merge?dry_run=true", models.UserMerge{Into: "CAROL", From: "bob"}, http.StatusOK, &report)
+	want := models.UserMergeReport{Into: "carol", From: "Robert", Votes: models.MergeVotesKeep, DryRun: true,
+		Threads: 1, Posts: 2, Memberships: 1, VotesMoved: 1}
+	if report != want {
+		t.Fatalf("merge dry run %+v, want %+v", report, want)
+	}
+	c.get("/api/user/Robert/profile", http.StatusOK, &user)
+	root.post("/api/service/merge?dry_run=maybe", models.UserMerge{Into: "carol", From: "Robert"}, http.StatusBadRequest, &message)
+	root.post("/api/service/merge", models.UserMerge{Into: "carol", From: "Robert", Votes: "coin"}, http.StatusBadRequest, &message)
+	root.post("/api/service/merge", models.UserMerge{Into: "carol", From: "CAROL"}, http.StatusBadRequest, &message)
+	root.post("/api/service/merge", models.UserMerge{Into: "carol", From: models.DeletedUser}, http.StatusBadRequest, &message)
+	root.post("/api/service/merge", models.UserMerge{Into: "carol", From: "nobody"}, http.StatusNotFound, &message)
+	root.post("/api/service/merge", models.UserMerge{Into: "carol", From: "Robert"}, http.StatusOK, &report)
+	if want.DryRun = false; report != want {
+		t.Fatalf("merge %+v, want %+v", report, want)
+	}
+	c.get("/api/user/Robert/profile", http.StatusNotFound, &message)
+	c.get("/api/thread/kraken/details", http.StatusOK, &thread)
+	if thread.Author != "carol" || thread.Votes != -1 {
+		t.Fatalf("thread after merge %+v", thread)
+	}
+	c.get("/api/forum/pirates/users", http.StatusOK, &users)
+	if len(users) != 1 || users[0].Nickname != "carol" {
+		t.Fatalf("forum users after merge %+v", users)
+	}
+
+	// очистка одного форума оставляет пользователей
+	c.status(models.Status{User: 3, Forum: 1, Thread: 2, Post: 4})
+	root.post("/api/service/clear?forum=PIRATES&dry_run=true", nil, http.StatusOK, &cleaned)
+	wantCleaned := models.CleanReport{Forum: "pirates", DryRun: true, Forums: 1, Threads: 2, Posts: 4, Votes: 1}
+	if cleaned != wantCleaned {
+		t.Fatalf("clean dry run %+v, want %+v", cleaned, wantCleaned)
+	}
+	c.status(models.Status{User: 3, Forum: 1, Thread: 2, Post: 4})
+	root.post("/api/service/clear?dry_run=maybe", nil, http.StatusBadRequest, &message)
+	root.post("/api/service/clear?forum=nowhere", nil, http.StatusNotFound, &message)
+	root.post("/api/service/clear?forum=pirates", nil, http.StatusOK, &cleaned)
+	if wantCleaned.DryRun = false; cleaned != wantCleaned {
+		t.Fatalf("clean forum %+v, want %+v", cleaned, wantCleaned)
+	}
+	c.status(models.Status{User: 3})
+	c.get("/api/forum/pirates/details", http.StatusNotFound, &message)
+
+	var cleanedAll models.CleanReport
+	root.post("/api/service/clear", nil, http.StatusOK, &cleanedAll)
+	if cleanedAll != (models.CleanReport{Users: 3}) {
+		t.Fatalf("clean %+v", cleanedAll)
+	}
+	c.status(models.Status{})
+	c.get("/api/user/alice/profile", http.StatusNotFound, &message)
+}
+
+type response struct {
+	Message string `json:"message"`
+}
+
+func authScenario(t *testing.T, c *client) {
+	var message response
+
+	// регистрация и вход
+	for nickname, password := range map[string]string{"alice": "sea", "bob": "land"} {
+		data, _ := c.send(http.MethodPost, "/api/user/"+nickname+"/create",
+			models.User{Fullname: nickname, Email: nickname + "@example.com", Password: password}, http.StatusCreated)
+		if bytes.Contains(data, []byte("password")) || bytes.Contains(data, []byte(password)) {
+			t.Fatalf("created user leaks password: %s", data)
+		}
+	}
+	c.post("/api/user/carol/create", models.User{Fullname: "carol", Email: "carol@example.com"}, http.StatusBadRequest, &message)
+
+	c.post("/api/user/alice/login", models.UserLogin{Password: "land"}, http.StatusUnauthorized, &message)
+	c.post("/api/user/nobody/login", models.UserLogin{Password: "sea"}, http.StatusUnauthorized, &message)
+	login := func(nickname, password string) *client {
+		t.Helper()
+		var session models.UserSession
+		c.post("/api/user/"+nickname+"/login", models.UserLogin{Password: password}, http.StatusOK, &session)
+		if session.Token == "" || !session.Expires.After(time.Now()) {
+			t.Fatalf("session %+v", session)
+		}
+		return c.as(session.Token)
+	}
+	alice, bob := login("ALICE", "sea"), login("bob", "land")
+
+	// без токена можно только читать
+	header := c.do(http.MethodPost, "/api/forum/create", models.Forum{Title: "Pirates", User: "alice", Slug: "pirates"}, http.StatusUnauthorized, &message)
+	if header.Get("WWW-Authenticate") != "Bearer" {
+		t.Fatalf("WWW-Authenticate %q", header.Get("WWW-Authenticate"))
+	}
+	c.get("/api/user/alice/profile", http.StatusOK, nil)
+	c.as("garbage").get("/api/user/alice/profile", http.StatusUnauthorized, &message)
+
+	// запись только от своего имени
+	var forum models.Forum
+	alice.post("/api/forum/create", models.Forum{Title: "Pirates", User: "bob", Slug: "pirates"}, http.StatusForbidden, &message)
+	alice.post("/api/forum/create", models.Forum{Title: "Pirates", User: "alice", Slug: "pirates"}, http.StatusCreated, &forum)
+	var thread models.Thread
+	alice.post("/api/forum/pirates/create", models.Thread{Title: "t", Author: "bob", Message: "m", Slug: "kraken"}, http.StatusForbidden, &message)
+	alice.post("/api/forum/pirates/create", models.Thread{Title: "t", Author: "alice", Message: "m", Slug: "kraken"}, http.StatusCreated, &thread)
+	var posts []models.Post
+	alice.post("/api/thread/kraken/create", []models.Post{{Author: "alice", Message: "a"}, {Author: "bob", Message: "b"}}, http.StatusForbidden, &message)
+	bob.post("/api/thread/kraken/create", []models.Post{{Author: "bob", Message: "b"}}, http.StatusCreated, &posts)
+	alice.post("/api/thread/kraken/vote", models.Vote{Nickname: "bob", Voice: 1}, http.StatusForbidden, &message)
+	bob.post("/api/thread/kraken/vote", models.Vote{Nickname: "bob", Voice: 1}, http.StatusOK, &thread)
+	alice.post("/api/user/bob/profile", models.User{About: "hacked"}, http.StatusForbidden, &message)
+	alice.do(http.MethodDelete, "/api/user/bob/profile", nil, http.StatusForbidden, &message)
+	c.get("/api/user/alice/export", http.StatusUnauthorized, &message)
+	bob.get("/api/user/alice/export", http.StatusForbidden, &message)
+	alice.send(http.MethodGet, "/api/user/alice/export", nil, http.StatusOK)
+
+	// токен переживает переименование, но не смену пароля
+	var user models.User
+	alice.post("/api/user/alice/rename", models.UserRename{Nickname: "Alicia"}, http.StatusOK, &user)
+	alice.post("/api/thread/kraken/create", []models.Post{{Author: "Alicia", Message: "a"}}, http.StatusCreated, &posts)
+	// старый nickname находит автора, но записи сохраняются под текущим
+	alice.post("/api/thread/kraken/create", []models.Post{{Author: "alice", Message: "a"}, {Author: "ALICE", Message: "b"}}, http.StatusCreated, &posts)
+	if len(posts) != 2 || posts[0].Author != "Alicia" || posts[1].Author != "Alicia" {
+		t.Fatalf("posts by old nickname %+v", posts)
+	}
+	bob.post("/api/thread/kraken/create", []models.Post{{Author: "alice", Message: "a"}}, http.StatusForbidden, &message)
+	alice.post("/api/thread/kraken/vote", models.Vote{Nickname: "alice", Voice: 1}, http.StatusOK, &thread)
+	alice.post("/api/thread/kraken/vote", models.Vote{Nickname: "Alicia", Voice: 1}, http.StatusOK, &thread)
+	if thread.Votes != 2 {
+		t.Fatalf("votes by old nickname %+v", thread)
+	}
+	var stats models.UserStats
+	c.get("/api/user/Alicia/stats", http.StatusOK, &stats)
+	if stats.Posts != 3 || stats.VotesCast != 1 {
+		t.Fatalf("stats after writes by old nickname %+v", stats)
+	}
+	alice.post("/api/user/alice/profile", models.User{Password: "ocean"}, http.StatusOK, &user)
+	if user.Nickname != "Alicia" {
+		t.Fatalf("changed user %+v", user)
+	}
+	alice.post("/api/thread/kraken/create", []models.Post{{Author: "Alicia", Message: "a"}}, http.StatusUnauthorized, &message)
+	c.post("/api/user/Alicia/login", models.UserLogin{Password: "sea"}, http.StatusUnauthorized, &message)
+	alicia := login("Alicia", "ocean")
+	alicia.post("/api/thread/kraken/create", []models.Post{{Author: "Alicia", Message: "a"}}, http.StatusCreated, &posts)
+
+	// ключи API создаёт и отзывает только сам пользователь, ключ ограничен областями
+	var key models.APIKey
+	c.post("/api/user/Alicia/keys", models.APIKey{Name: "importer", Scopes: []string{models.ScopeRead}}, http.StatusUnauthorized, &message)
+	bob.post("/api/user/Alicia/keys", models.APIKey{Name: "importer", Scopes: []string{models.ScopeRead}}, http.StatusForbidden, &message)
+	alicia.post("/api/user/Alicia/keys", models.APIKey{Name: "importer", Scopes: []string{"root"}}, http.StatusBadRequest, &message)
+	alicia.post("/api/user/alice/keys", models.APIKey{Name: "importer", Scopes: []string{models.ScopePost, models.ScopeRead, models.ScopePost}}, http.StatusCreated, &key)
+	if !strings.HasPrefix(key.Key, models.APIKeyPrefix) || key.Nickname != "Alicia" ||
+		len(key.Scopes) != 2 || key.Scopes[0] != models.ScopeRead || key.Scopes[1] != models.ScopePost {
+		t.Fatalf("created key %+v", key)
+	}
+	importer := c.as(key.Key)
+	importer.post("/api/thread/kraken/create", []models.Post{{Author: "Alicia", Message: "bot"}}, http.StatusCreated, &posts)
+	importer.post("/api/thread/kraken/create", []models.Post{{Author: "bob", Message: "bot"}}, http.StatusForbidden, &message)
+	importer.post("/api/thread/kraken/vote", models.Vote{Nickname: "Alicia", Voice: 1}, http.StatusForbidden, &message)
+	importer.get("/api/user/Alicia/keys", http.StatusForbidden, &message)
+	importer.post("/api/user/Alicia/profile", models.User{About: "bot"}, http.StatusForbidden, &message)
+
+	var keys []models.APIKey
+	alicia.get("/api/user/Alicia/keys", http.StatusOK, &keys)
+	if len(keys) != 1 || keys[0].Id != key.Id || keys[0].Key != "" || keys[0].LastUsed == nil {
+		t.Fatalf("keys %+v", keys)
+	}
+	bob.do(http.MethodDelete, "/api/user/Alicia/keys/"+strconv.Itoa(key.Id), nil, http.StatusForbidden, &message)
+	bob.do(http.MethodDelete, "/api/user/bob/keys/"+strconv.Itoa(key.Id), nil, http.StatusNotFound, &message)
+	alicia.do(http.MethodDelete, "/api/user/Alicia/keys/"+strconv.Itoa(key.Id), nil, http.StatusNoContent, nil)
+	importer.get("/api/user/Alicia/profile", http.StatusUnauthorized, &message)
+	c.as(models.APIKeyPrefix+"forged").get("/api/user/Alicia/profile", http.StatusUnauthorized, &message)
+
+	// чужие ветки и сообщения правят только модераторы форума, их назначает владелец
+	var role models.ForumRole
+	var moderators []models.User
+	var edited models.Post
+	c.post("/api/user/root/create", models.User{Fullname: "root", Email: "root@example.com", Password: "admin"}, http.StatusCreated, &user)
+	root := login("root", "admin")
+	// nickname сам по себе роли не даёт, её выдаёт только команда admin grant
+	root.post("/api/forum/pirates/moderators/root", nil, http.StatusForbidden, &message)
+	c.grant("root")
+	bob.post("/api/thread/kraken/create", []models.Post{{Author: "bob", Message: "b"}}, http.StatusCreated, &posts)
+	bobPost := "/api/post/" + strconv.Itoa(posts[0].Id) + "/details"
+	alicia.post("/api/thread/kraken/create", []models.Post{{Author: "Alicia", Message: "a"}}, http.StatusCreated, &posts)
+	aliciaPost := "/api/post/" + strconv.Itoa(posts[0].Id) + "/details"
+
+	bob.post("/api/thread/kraken/details", models.ThreadUpdate{Title: "bob was here"}, http.StatusForbidden, &message)
+	bob.post(aliciaPost, models.PostUpdate{Message: "bob was here"}, http.StatusForbidden, &message)
+	bob.post(bobPost, models.PostUpdate{Message: "own post"}, http.StatusOK, &edited)
+	bob.post("/api/forum/pirates/moderators/bob", nil, http.StatusForbidden, &message)
+	c.get("/api/forum/pirates/role/bob", http.StatusOK, &role)
+	if role.Role != models.RoleMember {
+		t.Fatalf("role %+v", role)
+	}
+
+	alicia.post("/api/forum/pirates/moderators/BOB", nil, http.StatusOK, &user)
+	c.get("/api/forum/pirates/moderators", http.StatusOK, &moderators)
+	if len(moderators) != 1 || moderators[0].Nickname != "bob" {
+		t.Fatalf("moderators %+v", moderators)
+	}
+	for nickname, want := range map[string]string{"bob": models.RoleModerator, "alice": models.RoleOwner, "root": models.RoleAdmin} {
+		c.get("/api/forum/pirates/role/"+nickname, http.StatusOK, &role)
+		if role.Role != want {
+			t.Fatalf("role of %s %+v, want %s", nickname, role, want)
+		}
+	}
+	bob.post("/api/thread/kraken/details", models.ThreadUpdate{Title: "moderated"}, http.StatusOK, &thread)
+	bob.post(aliciaPost, models.PostUpdate{Message: "moderated"}, http.StatusOK, &edited)
+	alicia.post(bobPost, models.PostUpdate{Message: "owner"}, http.StatusOK, &edited)
+
+	// ключу модератора для чужих записей нужна область moderate
+	bob.post("/api/user/bob/keys", models.APIKey{Name: "poster", Scopes: []string{models.ScopePost}}, http.StatusCreated, &key)
+	c.as(key.Key).post(aliciaPost, models.PostUpdate{Message: "bot"}, http.StatusForbidden, &message)
+	bob.post("/api/user/bob/keys", models.APIKey{Name: "moderator", Scopes: []string{models.ScopePost, models.ScopeModerate}}, http.StatusCreated, &key)
+	c.as(key.Key).post(aliciaPost, models.PostUpdate{Message: "bot"}, http.StatusOK, &edited)
+
+	alicia.do(http.MethodDelete, "/api/forum/pirates/moderators/bob", nil, http.StatusNoContent, nil)
+	alicia.do(http.MethodDelete, "/api/forum/pirates/moderators/bob", nil, http.StatusNotFound, &message)
+	bob.post("/api/thread/kraken/details", models.ThreadUpdate{Title: "bob was here"}, http.StatusForbidden, &message)
+	root.post("/api/thread/kraken/details", models.ThreadUpdate{Title: "admin"}, http.StatusOK, &thread)
+	root.post("/api/forum/pirates/moderators/root", nil, http.StatusOK, &user)
+	alicia.do(http.MethodDelete, "/api/forum/pirates/moderators/root", nil, http.StatusNoContent, nil)
+
+	// роль администратора уходит с переименованием; старый nickname, пока он
+	// псевдоним, занять нельзя, и сессии root продолжают работать
+	root.post("/api/user/root/rename", models.UserRename{Nickname: "chief"}, http.StatusOK, &user)
+	c.post("/api/user/ROOT/create", models.User{Fullname: "impostor", Email: "impostor@example.com", Password: "fake"}, http.StatusConflict, nil)
+	bob.post("/api/user/bob/rename", models.UserRename{Nickname: "root"}, http.StatusConflict, &message)
+	c.post("/api/user/root/login", models.UserLogin{Password: "fake"}, http.StatusUnauthorized, &message)
+	for _, nickname := range []string{"chief", "root"} {
+		c.get("/api/forum/pirates/role/"+nickname, http.StatusOK, &role)
+		if role.Nickname != "chief" || role.Role != models.RoleAdmin {
+			t.Fatalf("role of %s %+v", nickname, role)
+		}
+	}
+	root.post("/api/thread/kraken/details", models.ThreadUpdate{Title: "admin"}, http.StatusOK, &thread)
+
+	// nickname удалённого пользователя не наследует его сессии
+	bob.do(http.MethodDelete, "/api/user/bob/profile", nil, http.StatusNoContent, nil)
+	c.post("/api/user/bob/create", models.User{Fullname: "new bob", Email: "new@example.com", Password: "land"}, http.StatusCreated, &user)
+	bob.post("/api/thread/kraken/vote", models.Vote{Nickname: "bob", Voice: -1}, http.StatusUnauthorized, &message)
+
+	// очистка и слияние только у администратора сайта, его ключу нужна область admin
+	var cleaned models.CleanReport
+	c.post("/api/service/clear?dry_run=true", nil, http.StatusUnauthorized, &message)
+	alicia.post("/api/service/clear?dry_run=true", nil, http.StatusForbidden, &message)
+	alicia.post("/api/service/merge?dry_run=true", models.UserMerge{Into: "Alicia", From: "bob"}, http.StatusForbidden, &message)
+	// nickname бывшего администратора не открывает очистку и слияние после
+	// удаления его аккаунта
+	c.post("/api/user/warden/create", models.User{Fullname: "warden", Email: "warden@example.com", Password: "keys"}, http.StatusCreated, &user)
+	c.grant("warden")
+	warden := login("warden", "keys")
+	warden.post("/api/service/clear?dry_run=true", nil, http.StatusOK, &cleaned)
+	warden.do(http.MethodDelete, "/api/user/warden/profile", nil, http.StatusNoContent, nil)
+	c.post("/api/user/warden/create", models.User{Fullname: "new warden", Email: "warden@example.com", Password: "keys"}, http.StatusCreated, &user)
+	impostor := login("warden", "keys")
+	impostor.post("/api/service/clear?dry_run=true", nil, http.StatusForbidden, &message)
+	impostor.post("/api/service/merge?dry_run=true", models.UserMerge{Into: "warden", From: "bob"}, http.StatusForbidden, &message)
+	root.post("/api/user/chief/keys", models.APIKey{Name: "ci", Scopes: []string{models.ScopeRead, models.ScopePost}}, http.StatusCreated, &key)
+	c.as(key.Key).post("/api/service/clear?dry_run=true", nil, http.StatusForbidden, &message)
+	root.post("/api/user/chief/keys", models.APIKey{Name: "ci", Scopes: []string{models.ScopeAdmin}}, http.StatusCreated, &key)
+	c.as(key.Key).post("/api/service/clear?forum=pirates&dry_run=true", nil, http.StatusOK, &cleaned)
+	if cleaned.Forum != "pirates" || !cleaned.DryRun || cleaned.Forums != 1 || cleaned.Users != 0 {
+		t.Fatalf("clean dry run %+v", cleaned)
+	}
+	c.get("/api/forum/pirates/details", http.StatusOK, &forum)
+}
@@ -0,0 +1,131 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"forum/internal/forum/config"
+	"forum/internal/forum/health"
+	"forum/internal/forum/memory"
+	"forum/internal/forum/migrations"
+	"forum/internal/forum/repository"
+	"forum/internal/forum/sqlite"
+	repository6 "forum/pkg/apikey/repository"
+	repository2 "forum/pkg/forum/repository"
+	"forum/pkg/models"
+	repository4 "forum/pkg/post/repository"
+	repository5 "forum/pkg/service/repository"
+	repository3 "forum/pkg/thread/repository"
+	"forum/pkg/user/repostitory"
+	"github.com/sirupsen/logrus"
+)
+
+type Repositories struct {
+	User    repostitory.UserRepositoryInterface
+	Forum   repository2.ForumRepositoryInterface
+	Thread  repository3.ThreadRepositoryInterface
+	Post    repository4.PostRepositoryInterface
+	Service repository5.ServiceRepositoryInterface
+	Key     repository6.KeyRepositoryInterface
+}
+
+// OpenStorage открывает хранилище из cfg.Storage и добавляет его проверки в probes.
+// Возвращаемая функция закрывает хранилище.
+func OpenStorage(cfg config.Config, probes *health.Health) (Repositories, func() error, error) {
+	switch cfg.Storage {
+	case config.StorageMemory:
+		logrus.Warn("Using in-memory storage, all data is lost when the server stops")
+		return MemoryRepositories(memory.NewStore()), func() error { return nil }, nil
+	case config.StorageSQLite:
+		db, err := sqlite.Open(cfg.SQLite.Path)
+		if err != nil {
+			return Repositories{}, nil, err
+		}
+		probes.AddCheck("database", db.PingContext)
+		return SQLiteRepositories(db), db.Close, nil
+	default:
+		Db, err := Postgres(cfg.Database)
+		if err != nil {
+			return Repositories{}, nil, err
+		}
+		probes.AddCheck("database", Db.Ping)
+		probes.AddCheck("statements", Db.CheckStatements)
+		probes.AddCheck("schema", Db.CheckSchema)
+		return PostgresRepositories(Db), Db.Close, nil
+	}
+}
+
+// Postgres открывает пул, применяет миграции, выставляет режим таблиц и
+// регистрирует подготовленные запросы.
+func Postgres(cfg config.Database) (*repository.Postgres, error) {
+	Db, err := repository.NewPostgres(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err = preparePostgres(Db, cfg); err != nil {
+		Db.Close()
+		return nil, err
+	}
+	return Db, nil
+}
+
+func preparePostgres(Db *repository.Postgres, cfg config.Database) error {
+	ctx := context.Background()
+	if cfg.Migrate {
+		applied, err := migrations.Migrator{DB: Db.GetPostgres().ConnPool}.Up(ctx)
+		if err != nil {
+			return err
+		}
+		for _, m := range applied {
+			logrus.WithField("version", m.Version).Info("Applied migration " + m.Name)
+		}
+	}
+	changed, err := Db.SetDurability(ctx, cfg.Durability)
+	if err != nil {
+		return err
+	}
+	if len(changed) > 0 {
+		logrus.WithField("tables", changed).Info("Switched tables to " + cfg.Durability)
+	}
+	unlogged, err := Db.UnloggedTables(ctx)
+	if err != nil {
+		return err
+	}
+	if len(unlogged) > 0 {
+		logrus.WithField("tables", unlogged).Warn("UNLOGGED TABLES: all data in them is lost if Postgres crashes, do not run this in production")
+	}
+	return Db.ProcedureRequests()
+}
+
+func PostgresRepositories(Db *repository.Postgres) Repositories {
+	status := models.StatusInit()
+	return Repositories{
+		User:    &repostitory.UserRepository{DB: Db.GetPostgres()},
+		Forum:   &repository2.ForumRepository{DB: Db.GetPostgres()},
+		Thread:  &repository3.ThreadRepository{DB: Db.GetPostgres()},
+		Post:    &repository4.PostRepository{DB: Db.GetPostgres()},
+		Service: repository5.ServiceRepository{DB: Db.GetPostgres(), Status: &status},
+		Key:     repository6.KeyRepository{DB: Db.GetPostgres()},
+	}
+}
+
+func MemoryRepositories(store *memory.Store) Repositories {
+	return Repositories{
+		User:    &memory.UserRepository{DB: store},
+		Forum:   &memory.ForumRepository{DB: store},
+		Thread:  &memory.ThreadRepository{DB: store},
+		Post:    &memory.PostRepository{DB: store},
+		Service: memory.ServiceRepository{DB: store},
+		Key:     memory.KeyRepository{DB: store},
+	}
+}
+
+func SQLiteRepositories(db *sql.DB) Repositories {
+	return Repositories{
+		User:    &sqlite.UserRepository{DB: db},
+		Forum:   &sqlite.ForumRepository{DB: db},
+		Thread:  &sqlite.ThreadRepository{DB: db},
+		Post:    &sqlite.PostRepository{DB: db},
+		Service: sqlite.ServiceRepository{DB: db},
+		Key:     sqlite.KeyRepository{DB: db},
+	}
+}
@@ -0,0 +1,408 @@
+package config
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Config настройки сервера. Источники применяются по возрастанию приоритета:
+// значения по умолчанию, JSON-файл, переменные окружения, флаги командной строки.
+type Config struct {
+	// Хранилище: "postgres", "sqlite" или "memory" (данные живут до остановки процесса).
+	Storage  string   `json:"storage"`
+	Database Database `json:"database"`
+	SQLite   SQLite   `json:"sqlite"`
+	Server   Server   `json:"server"`
+	Users    Users    `json:"users"`
+	Auth     Auth     `json:"auth"`
+	Service  Service  `json:"service"`
+	Log      Log      `json:"log"`
+
+	// Позиционные аргументы после флагов, например "migrate up".
+	Args []string `json:"-"`
+}
+
+type Database struct {
+	// Строка подключения в формате DSN (user=... dbname=...) или URI (postgres://...).
+	DSN            string   `json:"dsn"`
+	MaxConnections int      `json:"max_connections"`
+	AcquireTimeout Duration `json:"acquire_timeout"`
+	// Применять миграции при старте сервера.
+	Migrate bool `json:"migrate"`
+	// "logged" для продакшена; "unlogged" быстрее, но при падении Postgres
+	// таблицы очищаются, подходит только для нагрузочных тестов.
+	Durability string `json:"durability"`
+}
+
+const (
+	StoragePostgres = "postgres"
+	StorageSQLite   = "sqlite"
+	StorageMemory   = "memory"
+)
+
+const (
+	DurabilityLogged   = "logged"
+	DurabilityUnlogged = "unlogged"
+)
+
+type SQLite struct {
+	// Путь к файлу базы, ":memory:" держит базу в памяти.
+	Path string `json:"path"`
+}
+
+type Server struct {
+	Listen      string   `json:"listen"`
+	ReadTimeout Duration `json:"read_timeout"`
+	// Для выгрузки пользователя отсчитывается от каждой записи в ответ, а не от
+	// начала запроса.
+	WriteTimeout Duration `json:"write_timeout"`
+	// Сколько ждать завершения активных запросов после SIGINT/SIGTERM.
+	ShutdownTimeout Duration `json:"shutdown_timeout"`
+	// Пауза между снятием готовности (/readyz) и закрытием listener, чтобы
+	// балансировщик успел убрать инстанс.
+	ShutdownDelay Duration `json:"shutdown_delay"`
+	// Дедлайн обработки запроса, после него запрос к БД отменяется; 0 отключает.
+	RequestTimeout Duration `json:"request_timeout"`
+	// Дедлайны для отдельных маршрутов, ключ шаблон пути: "/api/thread/{slug_or_id}/posts".
+	// Дополняют значения по умолчанию: у выгрузки пользователя дедлайна нет,
+	// она идёт, пока клиент читает ответ.
+	RouteTimeouts map[string]Duration `json:"route_timeouts"`
+}
+
+type Users struct {
+	// Сколько старый nickname после переименования продолжает находить пользователя.
+	AliasTTL Duration `json:"alias_ttl"`
+}
+
+type Auth struct {
+	// Ключ подписи токенов сессий. Пустой заменяется случайным при запуске,
+	// тогда токены перестают действовать после перезапуска.
+	Secret   string   `json:"secret"`
+	TokenTTL Duration `json:"token_ttl"`
+	// Запись без токена запрещена, кроме регистрации и входа; регистрация
+	// требует пароль. Включено по умолчанию: без токена проверки автора и прав
+	// модерации не работают, false только для старых клиентов без аутентификации.
+	Required bool `json:"required"`
+}
+
+type Service struct {
+	// Регистрировать /api/service/clear и /api/service/merge. Даже включённые,
+	// они доступны только администраторам сайта (команда "admin grant").
+	Enabled bool `json:"enabled"`
+}
+
+type Log struct {
+	Level string `json:"level"`
+	// Формат записей: "logfmt" или "json".
+	Format string `json:"format"`
+}
+
+// Duration time.Duration, который в JSON записывается строкой вида "5s".
+type Duration struct {
+	time.Duration
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = parsed
+	return nil
+}
+
+func Default() Config {
+	return Config{
+		Storage: StoragePostgres,
+		Database: Database{
+			DSN:            "host=localhost port=5432 user=docker password=docker dbname=docker sslmode=disable",
+			MaxConnections: 100,
+			Migrate:        true,
+			Durability:     DurabilityLogged,
+		},
+		SQLite: SQLite{
+			Path: "forum.db",
+		},
+		Server: Server{
+			Listen:          ":5000",
+			ReadTimeout:     Duration{10 * time.Second},
+			WriteTimeout:    Duration{30 * time.Second},
+			ShutdownTimeout: Duration{15 * time.Second},
+			RequestTimeout:  Duration{20 * time.Second},
+			RouteTimeouts: map[string]Duration{
+				"/api/user/{nickname}/export": {0},
+			},
+		},
+		Users: Users{
+			AliasTTL: Duration{30 * 24 * time.Hour},
+		},
+		Auth: Auth{
+			TokenTTL: Duration{24 * time.Hour},
+			Required: true,
+		},
+		Log: Log{
+			Level:  "info",
+			Format: "logfmt",
+		},
+	}
+}
+
+// option описывает одну настройку, которую можно задать флагом или переменной окружения.
+type option struct {
+	flag  string
+	env   string
+	usage string
+	set   func(c *Config, value string) error
+}
+
+var options = []option{
+	{"storage", "FORUM_STORAGE", "storage backend: postgres, sqlite or memory", func(c *Config, v string) error {
+		c.Storage = v
+		return nil
+	}},
+	{"db-dsn", "FORUM_DB_DSN", "PostgreSQL connection string", func(c *Config, v string) error {
+		c.Database.DSN = v
+		return nil
+	}},
+	{"db-max-connections", "FORUM_DB_MAX_CONNECTIONS", "maximum size of the connection pool", func(c *Config, v string) error {
+		return setInt(&c.Database.MaxConnections, v)
+	}},
+	{"db-acquire-timeout", "FORUM_DB_ACQUIRE_TIMEOUT", "how long to wait for a free connection, 0 waits forever", func(c *Config, v string) error {
+		return setDuration(&c.Database.AcquireTimeout, v)
+	}},
+	{"db-migrate", "FORUM_DB_MIGRATE", "apply pending schema migrations on startup", func(c *Config, v string) error {
+		return setBool(&c.Database.Migrate, v)
+	}},
+	{"db-durability", "FORUM_DB_DURABILITY", "table durability: logged or unlogged (benchmarks only)", func(c *Config, v string) error {
+		c.Database.Durability = v
+		return nil
+	}},
+	{"sqlite-path", "FORUM_SQLITE_PATH", "SQLite database file", func(c *Config, v string) error {
+		c.SQLite.Path = v
+		return nil
+	}},
+	{"listen", "FORUM_LISTEN", "HTTP listen address", func(c *Config, v string) error {
+		c.Server.Listen = v
+		return nil
+	}},
+	{"read-timeout", "FORUM_READ_TIMEOUT", "HTTP server read timeout", func(c *Config, v string) error {
+		return setDuration(&c.Server.ReadTimeout, v)
+	}},
+	{"write-timeout", "FORUM_WRITE_TIMEOUT", "HTTP server write timeout", func(c *Config, v string) error {
+		return setDuration(&c.Server.WriteTimeout, v)
+	}},
+	{"shutdown-timeout", "FORUM_SHUTDOWN_TIMEOUT", "how long in-flight requests may run after SIGINT/SIGTERM", func(c *Config, v string) error {
+		return setDuration(&c.Server.ShutdownTimeout, v)
+	}},
+	{"shutdown-delay", "FORUM_SHUTDOWN_DELAY", "how long /readyz fails before the listener is closed on shutdown", func(c *Config, v string) error {
+		return setDuration(&c.Server.ShutdownDelay, v)
+	}},
+	{"request-timeout", "FORUM_REQUEST_TIMEOUT", "default per-request deadline, 0 disables", func(c *Config, v string) error {
+		return setDuration(&c.Server.RequestTimeout, v)
+	}},
+	{"route-timeouts", "FORUM_ROUTE_TIMEOUTS", "per-route deadlines: template=duration,template=duration", func(c *Config, v string) error {
+		return setDurationMap(&c.Server.RouteTimeouts, v)
+	}},
+	{"user-alias-ttl", "FORUM_USER_ALIAS_TTL", "how long an old nickname keeps resolving after a rename", func(c *Config, v string) error {
+		return setDuration(&c.Users.AliasTTL, v)
+	}},
+	{"auth-secret", "FORUM_AUTH_SECRET", "key that signs session tokens, random per process if empty", func(c *Config, v string) error {
+		c.Auth.Secret = v
+		return nil
+	}},
+	{"auth-token-ttl", "FORUM_AUTH_TOKEN_TTL", "how long a session token issued at login stays valid", func(c *Config, v string) error {
+		return setDuration(&c.Auth.TokenTTL, v)
+	}},
+	{"auth-required", "FORUM_AUTH_REQUIRED", "reject writes without a session token and registrations without a password", func(c *Config, v string) error {
+		return setBool(&c.Auth.Required, v)
+	}},
+	{"service-enabled", "FORUM_SERVICE_ENABLED", "enable destructive service endpoints (clear, merge) for site administrators", func(c *Config, v string) error {
+		return setBool(&c.Service.Enabled, v)
+	}},
+	{"log-level", "FORUM_LOG_LEVEL", "log level: debug, info, warn, error", func(c *Config, v string) error {
+		c.Log.Level = v
+		return nil
+	}},
+	{"log-format", "FORUM_LOG_FORMAT", "log format: logfmt or json", func(c *Config, v string) error {
+		c.Log.Format = v
+		return nil
+	}},
+}
+
+func setInt(dst *int, value string) error {
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		return err
+	}
+	*dst = parsed
+	return nil
+}
+
+func setBool(dst *bool, value string) error {
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return err
+	}
+	*dst = parsed
+	return nil
+}
+
+func setDuration(dst *Duration, value string) error {
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	dst.Duration = parsed
+	return nil
+}
+
+func setDurationMap(dst *map[string]Duration, value string) error {
+	parsed := make(map[string]Duration, len(*dst))
+	for route, d := range *dst {
+		parsed[route] = d
+	}
+	for _, pair := range strings.Split(value, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+
+		eq := strings.LastIndex(pair, "=")
+		if eq <= 0 {
+			return errors.Errorf("expected template=duration, got %q", pair)
+		}
+
+		var d Duration
+		if err := setDuration(&d, pair[eq+1:]); err != nil {
+			return err
+		}
+		parsed[pair[:eq]] = d
+	}
+	*dst = parsed
+	return nil
+}
+
+// Load собирает конфигурацию из всех источников. Путь к файлу задаётся флагом
+// -config или переменной FORUM_CONFIG; без него файл не читается.
+func Load(args []string) (Config, error) {
+	fs := flag.NewFlagSet("forum", flag.ContinueOnError)
+	configPath := fs.String("config", os.Getenv("FORUM_CONFIG"), "path to JSON config file")
+	values := make(map[string]*string, len(options))
+	for _, opt := range options {
+		values[opt.flag] = fs.String(opt.flag, "", fmt.Sprintf("%s (env %s)", opt.usage, opt.env))
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+
+	cfg := Default()
+	if *configPath != "" {
+		if err := loadFile(&cfg, *configPath); err != nil {
+			return Config{}, err
+		}
+	}
+
+	for _, opt := range options {
+		value, ok := os.LookupEnv(opt.env)
+		if !ok {
+			continue
+		}
+		if err := opt.set(&cfg, value); err != nil {
+			return Config{}, errors.Wrapf(err, "invalid %s", opt.env)
+		}
+	}
+
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+	for _, opt := range options {
+		if !explicit[opt.flag] {
+			continue
+		}
+		if err := opt.set(&cfg, *values[opt.flag]); err != nil {
+			return Config{}, errors.Wrapf(err, "invalid -%s", opt.flag)
+		}
+	}
+
+	cfg.Args = fs.Args()
+	return cfg, cfg.Validate()
+}
+
+func loadFile(cfg *Config, path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return errors.Wrap(err, "read config")
+	}
+
+	if err = json.Unmarshal(data, cfg); err != nil {
+		return errors.Wrapf(err, "parse config %s", path)
+	}
+	return nil
+}
+
+func (c Config) Validate() error {
+	if c.Storage != StoragePostgres && c.Storage != StorageSQLite && c.Storage != StorageMemory {
+		return errors.Errorf("storage must be postgres, sqlite or memory, got %q", c.Storage)
+	}
+	if c.Storage == StorageSQLite && c.SQLite.Path == "" {
+		return errors.New("sqlite.path must not be empty")
+	}
+	if _, err := pgx.ParseConnectionString(c.Database.DSN); err != nil {
+		return errors.Wrap(err, "database.dsn")
+	}
+	if c.Database.MaxConnections < 1 {
+		return errors.New("database.max_connections must be positive")
+	}
+	if c.Database.AcquireTimeout.Duration < 0 {
+		return errors.New("database.acquire_timeout must not be negative")
+	}
+	if c.Database.Durability != DurabilityLogged && c.Database.Durability != DurabilityUnlogged {
+		return errors.Errorf("database.durability must be logged or unlogged, got %q", c.Database.Durability)
+	}
+	if c.Server.Listen == "" {
+		return errors.New("server.listen must not be empty")
+	}
+	if c.Server.ReadTimeout.Duration < 0 || c.Server.WriteTimeout.Duration < 0 ||
+		c.Server.ShutdownTimeout.Duration < 0 || c.Server.ShutdownDelay.Duration < 0 ||
+		c.Server.RequestTimeout.Duration < 0 {
+		return errors.New("server timeouts must not be negative")
+	}
+	for route, timeout := range c.Server.RouteTimeouts {
+		if timeout.Duration < 0 {
+			return errors.Errorf("server.route_timeouts[%s] must not be negative", route)
+		}
+	}
+	if c.Users.AliasTTL.Duration < 0 {
+		return errors.New("users.alias_ttl must not be negative")
+	}
+	if c.Auth.TokenTTL.Duration <= 0 {
+		return errors.New("auth.token_ttl must be positive")
+	}
+	if _, err := logrus.ParseLevel(c.Log.Level); err != nil {
+		return errors.Wrap(err, "log.level")
+	}
+	if c.Log.Format != "logfmt" && c.Log.Format != "json" {
+		return errors.Errorf("log.format must be logfmt or json, got %q", c.Log.Format)
+	}
+	return nil
+}
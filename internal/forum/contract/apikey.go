@@ -0,0 +1,93 @@
+package contract
+
+import (
+	"forum/internal/utils/errs"
+	"forum/pkg/models"
+	"testing"
+	"time"
+)
+
+var keyTests = map[string]func(t *testing.T, r Repositories){
+	"Keys": func(t *testing.T, r Repositories) {
+		f := newFixture(t, r)
+		alice, bob := f.users[0].Nickname, f.users[1].Nickname
+
+		_, err := r.Key.AddKey(ctx, models.APIKey{Nickname: "nobody", Name: "bot", Scopes: []string{models.ScopeRead}, Created: day(0), Hash: "h0"})
+		expectKind(t, err, errs.KindNotFound)
+
+		first := f.key(t, alice, "importer", "h1", models.ScopeRead, models.ScopePost)
+		second := f.key(t, alice, "ci", "h2", models.ScopeVote)
+		other := f.key(t, bob, "bot", "h3", models.ScopeAdmin)
+		if first.Id == second.Id || first.Nickname != alice {
+			t.Fatalf("AddKey returned %+v and %+v", first, second)
+		}
+
+		keys, err := r.Key.FindKeys(ctx, "ALICE")
+		expectNoError(t, err)
+		if len(keys) != 2 || keys[0].Id != first.Id || keys[1].Id != second.Id {
+			t.Fatalf("FindKeys = %+v", keys)
+		}
+		if keys[0].Name != "importer" || len(keys[0].Scopes) != 2 || keys[0].Scopes[1] != models.ScopePost ||
+			!keys[0].Created.Equal(day(0)) || keys[0].LastUsed != nil || keys[0].Hash != "" {
+			t.Fatalf("FindKeys()[0] = %+v", keys[0])
+		}
+		keys, err = r.Key.FindKeys(ctx, "carol")
+		expectNoError(t, err)
+		if keys == nil || len(keys) != 0 {
+			t.Fatalf("FindKeys(carol) = %#v, want empty", keys)
+		}
+
+		used := day(1).Add(1500 * time.Microsecond)
+		expectNoError(t, r.Key.TouchKey(ctx, second.Id, used))
+		key, err := r.Key.GetKeyByHash(ctx, "h2")
+		expectNoError(t, err)
+		if key.Id != second.Id || key.Nickname != alice || key.LastUsed == nil || !key.LastUsed.Equal(used) {
+			t.Fatalf("GetKeyByHash(h2) = %+v", key)
+		}
+		_, err = r.Key.GetKeyByHash(ctx, "missing")
+		expectKind(t, err, errs.KindNotFound)
+
+		// чужой ключ отозвать нельзя
+		expectKind(t, r.Key.DeleteKey(ctx, alice, other.Id), errs.KindNotFound)
+		expectNoError(t, r.Key.DeleteKey(ctx, alice, first.Id))
+		expectKind(t, r.Key.DeleteKey(ctx, alice, first.Id), errs.KindNotFound)
+		_, err = r.Key.GetKeyByHash(ctx, "h1")
+		expectKind(t, err, errs.KindNotFound)
+		_, err = r.Key.GetKeyByHash(ctx, "h3")
+		expectNoError(t, err)
+	},
+
+	"KeysFollowUser": func(t *testing.T, r Repositories) {
+		f := newFixture(t, r)
+		f.key(t, "carol", "renamed", "h1", models.ScopeRead)
+		f.key(t, "dave", "deleted", "h2", models.ScopeRead)
+		f.key(t, "Bob", "merged", "h3", models.ScopeRead)
+
+		_, err := r.User.RenameUser(ctx, "carol", "Caroline", time.Now().Add(time.Hour))
+		expectNoError(t, err)
+		key, err := r.Key.GetKeyByHash(ctx, "h1")
+		expectNoError(t, err)
+		if key.Nickname != "Caroline" {
+			t.Fatalf("key nickname after rename %q, want Caroline", key.Nickname)
+		}
+
+		expectNoError(t, r.User.DeleteUser(ctx, "dave"))
+		_, err = r.Key.GetKeyByHash(ctx, "h2")
+		expectKind(t, err, errs.KindNotFound)
+
+		// ключи сливаемого аккаунта не переходят к другому пользователю
+		_, err = r.Service.MergeUsers(ctx, models.UserMerge{Into: "alice", From: "Bob", Votes: models.MergeVotesKeep})
+		expectNoError(t, err)
+		_, err = r.Key.GetKeyByHash(ctx, "h3")
+		expectKind(t, err, errs.KindNotFound)
+	},
+}
+
+func (f *fixture) key(t *testing.T, nickname string, name string, hash string, scopes ...string) models.APIKey {
+	t.Helper()
+	key, err := f.r.Key.AddKey(ctx, models.APIKey{Nickname: nickname, Name: name, Scopes: scopes, Created: day(0), Hash: hash})
+	if err != nil {
+		t.Fatalf("AddKey(%s): %v", name, err)
+	}
+	return key
+}
@@ -0,0 +1,212 @@
+// Package contract общий набор тестов для реализаций репозиториев. Каждое
+// хранилище запускает его из своего _test.go и получает одинаковые ожидания:
+//
+//	func TestContract(t *testing.T) {
+//		contract.Run(t, func(t *testing.T) contract.Repositories { ... })
+//	}
+package contract
+
+import (
+	"context"
+	"forum/internal/utils/errs"
+	keyRepository "forum/pkg/apikey/repository"
+	forumRepository "forum/pkg/forum/repository"
+	"forum/pkg/models"
+	postRepository "forum/pkg/post/repository"
+	serviceRepository "forum/pkg/service/repository"
+	threadRepository "forum/pkg/thread/repository"
+	"forum/pkg/user/repostitory"
+	"sort"
+	"testing"
+	"time"
+)
+
+type Repositories struct {
+	User    repostitory.UserRepositoryInterface
+	Forum   forumRepository.ForumRepositoryInterface
+	Thread  threadRepository.ThreadRepositoryInterface
+	Post    postRepository.PostRepositoryInterface
+	Service serviceRepository.ServiceRepositoryInterface
+	Key     keyRepository.KeyRepositoryInterface
+}
+
+// Factory возвращает репозитории над пустым хранилищем. Вызывается перед каждым
+// подтестом; освобождение ресурсов фабрика регистрирует через t.Cleanup.
+type Factory func(t *testing.T) Repositories
+
+func Run(t *testing.T, factory Factory) {
+	for _, group := range []struct {
+		name  string
+		tests map[string]func(t *testing.T, r Repositories)
+	}{
+		{"User", userTests},
+		{"Forum", forumTests},
+		{"Thread", threadTests},
+		{"Post", postTests},
+		{"Service", serviceTests},
+		{"Key", keyTests},
+	} {
+		group := group
+		t.Run(group.name, func(t *testing.T) {
+			names := make([]string, 0, len(group.tests))
+			for name := range group.tests {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+
+			for _, name := range names {
+				test := group.tests[name]
+				t.Run(name, func(t *testing.T) {
+					test(t, factory(t))
+				})
+			}
+		})
+	}
+}
+
+var ctx = context.Background()
+
+// fixture заполняет хранилище типичным набором данных и запоминает созданные сущности.
+type fixture struct {
+	r       Repositories
+	users   []models.User
+	forum   models.Forum
+	threads []models.Thread
+}
+
+func newFixture(t *testing.T, r Repositories) *fixture {
+	t.Helper()
+	f := &fixture{r: r}
+	for _, nick := range []string{"alice", "Bob", "carol", "dave"} {
+		f.users = append(f.users, f.user(t, nick))
+	}
+	f.forum = f.newForum(t, "Pirates", f.users[0].Nickname)
+	return f
+}
+
+func (f *fixture) user(t *testing.T, nick string) models.User {
+	t.Helper()
+	user := models.User{Nickname: nick, Fullname: "Captain " + nick, About: "about " + nick, Email: nick + "@example.com"}
+	if _, err := f.r.User.AddUser(ctx, user); err != nil {
+		t.Fatalf("AddUser(%s): %v", nick, err)
+	}
+	return user
+}
+
+func (f *fixture) newForum(t *testing.T, slug string, user string) models.Forum {
+	t.Helper()
+	forum, err := f.r.Forum.CreateForum(ctx, models.Forum{Title: "Forum " + slug, User: user, Slug: slug})
+	if err != nil {
+		t.Fatalf("CreateForum(%s): %v", slug, err)
+	}
+	return forum
+}
+
+func (f *fixture) thread(t *testing.T, slug string, author string, created time.Time) models.Thread {
+	t.Helper()
+	thread, err := f.r.Thread.CreateThread(ctx, models.Thread{
+		Title:   "Thread " + slug,
+		Author:  author,
+		Forum:   f.forum.Slug,
+		Message: "message " + slug,
+		Slug:    slug,
+		Created: created,
+	})
+	if err != nil {
+		t.Fatalf("CreateThread(%s): %v", slug, err)
+	}
+	f.threads = append(f.threads, thread)
+	return thread
+}
+
+func (f *fixture) posts(t *testing.T, thread models.Thread, posts ...models.Post) models.Posts {
+	t.Helper()
+	inserted, err := f.r.Post.AddPosts(ctx, posts, int(thread.Id), thread.Forum)
+	if err != nil {
+		t.Fatalf("AddPosts: %v", err)
+	}
+	if len(inserted) != len(posts) {
+		t.Fatalf("AddPosts returned %d posts, want %d", len(inserted), len(posts))
+	}
+	return inserted
+}
+
+func post(author string, parent int, message string) models.Post {
+	return models.Post{Author: author, Parent: int64(parent), Message: message}
+}
+
+var epoch = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func day(n int) time.Time {
+	return epoch.AddDate(0, 0, n)
+}
+
+func expectKind(t *testing.T, err error, kind errs.Kind) {
+	t.Helper()
+	if !errs.Is(err, kind) {
+		t.Fatalf("expected %v error, got %v", kind, err)
+	}
+}
+
+func expectNoError(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func postIds(posts []models.Post) []int {
+	ids := make([]int, 0, len(posts))
+	for _, post := range posts {
+		ids = append(ids, post.Id)
+	}
+	return ids
+}
+
+func nicknames(users []models.User) []string {
+	nicks := make([]string, 0, len(users))
+	for _, user := range users {
+		nicks = append(nicks, user.Nickname)
+	}
+	return nicks
+}
+
+func threadSlugs(threads []models.Thread) []string {
+	slugs := make([]string, 0, len(threads))
+	for _, thread := range threads {
+		slugs = append(slugs, thread.Slug)
+	}
+	return slugs
+}
+
+func forumSlugs(forums []models.Forum) []string {
+	slugs := make([]string, 0, len(forums))
+	for _, forum := range forums {
+		slugs = append(slugs, forum.Slug)
+	}
+	return slugs
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,233 @@
+package contract
+
+import (
+	"forum/internal/utils/errs"
+	"forum/pkg/models"
+	"testing"
+	"time"
+)
+
+var forumTests = map[string]func(t *testing.T, r Repositories){
+	"CreateForum": func(t *testing.T, r Repositories) {
+		f := newFixture(t, r)
+
+		forum, err := f.r.Forum.CreateForum(ctx, models.Forum{Title: "Treasure", User: "BOB", Slug: "treasure"})
+		expectNoError(t, err)
+		want := models.Forum{Title: "Treasure", User: "Bob", Slug: "treasure"}
+		if forum != want {
+			t.Fatalf("CreateForum = %+v, want %+v", forum, want)
+		}
+
+		_, err = f.r.Forum.CreateForum(ctx, models.Forum{Title: "Other", User: "alice", Slug: "TREASURE"})
+		expectKind(t, err, errs.KindConflict)
+
+		_, err = f.r.Forum.CreateForum(ctx, models.Forum{Title: "Nobody", User: "nobody", Slug: "nobody"})
+		expectKind(t, err, errs.KindNotFound)
+		_, err = f.r.Forum.GetForumInfo(ctx, "nobody")
+		expectKind(t, err, errs.KindNotFound)
+	},
+
+	"GetForumInfo": func(t *testing.T, r Repositories) {
+		f := newFixture(t, r)
+
+		forum, err := f.r.Forum.GetForumInfo(ctx, "PIRATES")
+		expectNoError(t, err)
+		want := models.Forum{Title: "Forum Pirates", User: "alice", Slug: "Pirates"}
+		if forum != want {
+			t.Fatalf("GetForumInfo = %+v, want %+v", forum, want)
+		}
+
+		_, err = f.r.Forum.GetForumInfo(ctx, "missing")
+		expectKind(t, err, errs.KindNotFound)
+	},
+
+	"Counters": func(t *testing.T, r Repositories) {
+		f := newFixture(t, r)
+		first := f.thread(t, "first", "alice", day(1))
+		second := f.thread(t, "", "bob", day(2))
+		f.posts(t, first, post("carol", 0, "a"), post("alice", 0, "b"))
+		f.posts(t, second, post("carol", 0, "c"))
+
+		forum, err := f.r.Forum.GetForumInfo(ctx, f.forum.Slug)
+		expectNoError(t, err)
+		if forum.Threads != 2 || forum.Posts != 3 {
+			t.Fatalf("forum counters threads=%d posts=%d, want 2 and 3", forum.Threads, forum.Posts)
+		}
+	},
+
+	"FindUsers": func(t *testing.T, r Repositories) {
+		f := newFixture(t, r)
+		f.user(t, "Eve")
+		f.newForum(t, "empty", "alice")
+
+		// участники: автор ветки и авторы постов, в том числе в другом регистре
+		thread := f.thread(t, "thread", "carol", day(1))
+		f.posts(t, thread, post("BOB", 0, "a"), post("eve", 0, "b"), post("Carol", 0, "c"), post("bob", 0, "d"))
+
+		for _, tc := range []struct {
+			name   string
+			params models.ParamsForSearch
+			want   []string
+		}{
+			{"all", models.ParamsForSearch{Limit: 100}, []string{"Bob", "carol", "Eve"}},
+			{"desc", models.ParamsForSearch{Limit: 100, Desc: true}, []string{"Eve", "carol", "Bob"}},
+			{"limit", models.ParamsForSearch{Limit: 2}, []string{"Bob", "carol"}},
+			{"since", models.ParamsForSearch{Limit: 100, Since: "bob"}, []string{"carol", "Eve"}},
+			{"since desc", models.ParamsForSearch{Limit: 100, Since: "Eve", Desc: true}, []string{"carol", "Bob"}},
+			{"since missing nickname", models.ParamsForSearch{Limit: 100, Since: "c"}, []string{"carol", "Eve"}},
+			{"since past the end", models.ParamsForSearch{Limit: 100, Since: "zed"}, nil},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				users, err := f.r.Forum.FindUsers(ctx, "PIRATES", tc.params)
+				expectNoError(t, err)
+				if got := nicknames(users); !equalStrings(got, tc.want) {
+					t.Fatalf("FindUsers = %v, want %v", got, tc.want)
+				}
+				for _, user := range users {
+					if user.Email != user.Nickname+"@example.com" {
+						t.Fatalf("FindUsers returned incomplete user %+v", user)
+					}
+				}
+			})
+		}
+
+		users, err := f.r.Forum.FindUsers(ctx, "empty", models.ParamsForSearch{Limit: 100})
+		expectNoError(t, err)
+		if len(users) != 0 {
+			t.Fatalf("FindUsers on empty forum = %v", nicknames(users))
+		}
+	},
+
+	"FindForums": func(t *testing.T, r Repositories) {
+		f := newFixture(t, r)
+		f.thread(t, "t1", "alice", day(1))
+		pirates := f.thread(t, "t2", "Bob", day(2))
+		f.posts(t, pirates, post("alice", 0, "p"))
+		for _, forum := range []models.Forum{
+			{Title: "Sea_dogs", User: "alice", Slug: "dogs"},
+			{Title: "sea shanties", User: "Bob", Slug: "Shanties"},
+			{Title: "100% pirates", User: "carol", Slug: "apex"},
+		} {
+			_, err := r.Forum.CreateForum(ctx, forum)
+			expectNoError(t, err)
+		}
+		for slug, posts := range map[string]int{"dogs": 3, "Shanties": 1} {
+			thread, err := r.Thread.CreateThread(ctx, models.Thread{Title: "Thread", Author: "dave", Forum: slug, Message: "m", Slug: "in-" + slug, Created: day(3)})
+			expectNoError(t, err)
+			for i := 0; i < posts; i++ {
+				f.posts(t, thread, post("dave", 0, "m"))
+			}
+		}
+
+		// posts: apex 0, Pirates 1, Shanties 1, dogs 3; threads: apex 0, dogs 1, Shanties 1, Pirates 2
+		for _, tc := range []struct {
+			name   string
+			params models.ForumSearch
+			want   []string
+			total  int64
+		}{
+			{"slug", models.ForumSearch{Limit: 100, Sort: models.ForumSortSlug}, []string{"apex", "dogs", "Pirates", "Shanties"}, 4},
+			{"slug desc limit", models.ForumSearch{Limit: 2, Sort: models.ForumSortSlug, Desc: true}, []string{"Shanties", "Pirates"}, 4},
+			{"slug since", models.ForumSearch{Limit: 100, Sort: models.ForumSortSlug, Since: "DOGS"}, []string{"Pirates", "Shanties"}, 4},
+			{"posts", models.ForumSearch{Limit: 100, Sort: models.ForumSortPosts}, []string{"apex", "Pirates", "Shanties", "dogs"}, 4},
+			{"posts desc", models.ForumSearch{Limit: 100, Sort: models.ForumSortPosts, Desc: true}, []string{"dogs", "Shanties", "Pirates", "apex"}, 4},
+			{"posts since tie", models.ForumSearch{Limit: 1, Sort: models.ForumSortPosts, Since: "pirates"}, []string{"Shanties"}, 4},
+			{"posts desc since tie", models.ForumSearch{Limit: 100, Sort: models.ForumSortPosts, Since: "shanties", Desc: true}, []string{"Pirates", "apex"}, 4},
+			{"threads", models.ForumSearch{Limit: 100, Sort: models.ForumSortThreads}, []string{"apex", "dogs", "Shanties", "Pirates"}, 4},
+			{"threads desc since", models.ForumSearch{Limit: 100, Sort: models.ForumSortThreads, Since: "dogs", Desc: true}, []string{"apex"}, 4},
+			{"created", models.ForumSearch{Limit: 100, Sort: models.ForumSortCreated}, []string{"Pirates", "dogs", "Shanties", "apex"}, 4},
+			{"created desc since", models.ForumSearch{Limit: 100, Sort: models.ForumSortCreated, Since: "Shanties", Desc: true}, []string{"dogs", "Pirates"}, 4},
+			{"title prefix", models.ForumSearch{Limit: 100, Sort: models.ForumSortPosts, Desc: true, Query: "SEA"}, []string{"dogs", "Shanties"}, 2},
+			{"underscore is literal", models.ForumSearch{Limit: 100, Sort: models.ForumSortSlug, Query: "sea_"}, []string{"dogs"}, 1},
+			{"percent is literal", models.ForumSearch{Limit: 100, Sort: models.ForumSortSlug, Query: "100%"}, []string{"apex"}, 1},
+			{"percent is not a wildcard", models.ForumSearch{Limit: 100, Sort: models.ForumSortSlug, Query: "%"}, nil, 0},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				forums, err := r.Forum.FindForums(ctx, tc.params)
+				expectNoError(t, err)
+				if got := forumSlugs(forums); !equalStrings(got, tc.want) {
+					t.Fatalf("FindForums = %v, want %v", got, tc.want)
+				}
+
+				total, err := r.Forum.CountForums(ctx, tc.params.Query)
+				expectNoError(t, err)
+				if total != tc.total {
+					t.Fatalf("CountForums(%q) = %d, want %d", tc.params.Query, total, tc.total)
+				}
+			})
+		}
+
+		forums, err := r.Forum.FindForums(ctx, models.ForumSearch{Limit: 1, Sort: models.ForumSortPosts, Desc: true})
+		expectNoError(t, err)
+		if want := (models.Forum{Title: "Sea_dogs", User: "alice", Slug: "dogs", Posts: 3, Threads: 1}); len(forums) != 1 || forums[0] != want {
+			t.Fatalf("FindForums = %+v, want %+v", forums, want)
+		}
+		_, err = r.Forum.FindForums(ctx, models.ForumSearch{Limit: 100, Sort: "title"})
+		expectKind(t, err, errs.KindInvalid)
+		_, err = r.Forum.FindForums(ctx, models.ForumSearch{Limit: -1, Sort: models.ForumSortSlug})
+		expectKind(t, err, errs.KindInvalid)
+	},
+
+	"Moderators": func(t *testing.T, r Repositories) {
+		f := newFixture(t, r)
+
+		expectKind(t, r.Forum.AddModerator(ctx, "missing", "carol"), errs.KindNotFound)
+		expectKind(t, r.Forum.AddModerator(ctx, "pirates", "nobody"), errs.KindNotFound)
+		for _, nick := range []string{"carol", "Bob", "carol"} {
+			expectNoError(t, r.Forum.AddModerator(ctx, "pirates", nick))
+		}
+
+		moderators, err := r.Forum.FindModerators(ctx, "PIRATES")
+		expectNoError(t, err)
+		if got := nicknames(moderators); !equalStrings(got, []string{"Bob", "carol"}) {
+			t.Fatalf("FindModerators = %v", got)
+		}
+		for nick, want := range map[string]bool{"CAROL": true, "bob": true, "alice": false, "dave": false} {
+			moderator, err := r.Forum.IsModerator(ctx, "Pirates", nick)
+			expectNoError(t, err)
+			if moderator != want {
+				t.Fatalf("IsModerator(%s) = %v, want %v", nick, moderator, want)
+			}
+		}
+
+		expectNoError(t, r.Forum.RemoveModerator(ctx, "pirates", "carol"))
+		expectKind(t, r.Forum.RemoveModerator(ctx, "pirates", "carol"), errs.KindNotFound)
+		expectKind(t, r.Forum.RemoveModerator(ctx, "pirates", "dave"), errs.KindNotFound)
+
+		moderators, err = r.Forum.FindModerators(ctx, "pirates")
+		expectNoError(t, err)
+		if got := nicknames(moderators); !equalStrings(got, []string{"Bob"}) {
+			t.Fatalf("FindModerators after remove = %v", got)
+		}
+		f.newForum(t, "empty", "alice")
+		moderators, err = r.Forum.FindModerators(ctx, "empty")
+		expectNoError(t, err)
+		if moderators == nil || len(moderators) != 0 {
+			t.Fatalf("FindModerators on empty forum = %#v", moderators)
+		}
+	},
+
+	"ModeratorsFollowUser": func(t *testing.T, r Repositories) {
+		f := newFixture(t, r)
+		f.newForum(t, "docks", "dave")
+		for _, nick := range []string{"Bob", "carol", "dave"} {
+			expectNoError(t, r.Forum.AddModerator(ctx, "pirates", nick))
+		}
+		expectNoError(t, r.Forum.AddModerator(ctx, "docks", "carol"))
+
+		_, err := r.User.RenameUser(ctx, "Bob", "Robert", time.Now().Add(time.Hour))
+		expectNoError(t, err)
+		expectNoError(t, r.User.DeleteUser(ctx, "dave"))
+		// назначения сливаемого аккаунта переходят к другому без повторов
+		_, err = r.Service.MergeUsers(ctx, models.UserMerge{Into: "Robert", From: "carol", Votes: models.MergeVotesKeep})
+		expectNoError(t, err)
+
+		for slug, want := range map[string][]string{"pirates": {"Robert"}, "docks": {"Robert"}} {
+			moderators, err := r.Forum.FindModerators(ctx, slug)
+			expectNoError(t, err)
+			if got := nicknames(moderators); !equalStrings(got, want) {
+				t.Fatalf("FindModerators(%s) = %v, want %v", slug, got, want)
+			}
+		}
+	},
+}
@@ -0,0 +1,291 @@
+package contract
+
+import (
+	"forum/internal/utils/errs"
+	"forum/pkg/models"
+	"testing"
+)
+
+// postTree строит ветку
+//
+//	r1        r2       r3
+//	├ c1      └ c2     └ c4
+//	│ └ g1
+//	└ c3
+//
+// и возвращает id постов по именам. Посты вставляются тремя пачками, поэтому
+// id растут в порядке r1 r2 r3 c1 c2 c3 g1 c4.
+func postTree(t *testing.T, f *fixture, thread models.Thread) map[string]int {
+	ids := make(map[string]int)
+	add := func(names []string, posts ...models.Post) {
+		for i, inserted := range f.posts(t, thread, posts...) {
+			ids[names[i]] = inserted.Id
+		}
+	}
+
+	add([]string{"r1", "r2", "r3"}, post("alice", 0, "r1"), post("bob", 0, "r2"), post("carol", 0, "r3"))
+	add([]string{"c1", "c2", "c3"}, post("dave", ids["r1"], "c1"), post("alice", ids["r2"], "c2"), post("bob", ids["r1"], "c3"))
+	add([]string{"g1", "c4"}, post("carol", ids["c1"], "g1"), post("dave", ids["r3"], "c4"))
+	return ids
+}
+
+func named(ids map[string]int, names ...string) []int {
+	result := make([]int, 0, len(names))
+	for _, name := range names {
+		result = append(result, ids[name])
+	}
+	return result
+}
+
+var postTests = map[string]func(t *testing.T, r Repositories){
+	"AddPosts": func(t *testing.T, r Repositories) {
+		f := newFixture(t, r)
+		thread := f.thread(t, "kraken", "alice", day(1))
+
+		posts := f.posts(t, thread, post("BOB", 0, "first"), post("alice", 0, "second"))
+		for i, p := range posts {
+			if p.Id == 0 || p.Thread != int(thread.Id) || p.Forum != thread.Forum || p.IsEdited || p.Parent != 0 {
+				t.Fatalf("AddPosts returned %+v", p)
+			}
+			if !p.Created.Equal(posts[0].Created) {
+				t.Fatalf("posts of one batch have different created: %v and %v", posts[0].Created, p.Created)
+			}
+			if i > 0 && p.Id <= posts[i-1].Id {
+				t.Fatalf("ids are not increasing: %v", postIds(posts))
+			}
+		}
+		if posts[0].Author != "BOB" || posts[0].Message != "first" {
+			t.Fatalf("AddPosts returned %+v", posts[0])
+		}
+
+		reply := f.posts(t, thread, post("carol", posts[0].Id, "reply"))
+		if reply[0].Parent != int64(posts[0].Id) {
+			t.Fatalf("reply parent %d, want %d", reply[0].Parent, posts[0].Id)
+		}
+
+		empty, err := f.r.Post.AddPosts(ctx, models.Posts{}, int(thread.Id), thread.Forum)
+		expectNoError(t, err)
+		if len(empty) != 0 {
+			t.Fatalf("AddPosts without posts returned %v", empty)
+		}
+	},
+
+	"AddPostsErrors": func(t *testing.T, r Repositories) {
+		f := newFixture(t, r)
+		thread := f.thread(t, "kraken", "alice", day(1))
+		other := f.thread(t, "other", "alice", day(2))
+		foreign := f.posts(t, other, post("alice", 0, "foreign"))
+
+		for _, tc := range []struct {
+			name  string
+			posts models.Posts
+			kind  errs.Kind
+		}{
+			{"missing parent", models.Posts{post("alice", 0, "ok"), post("alice", foreign[0].Id+1000, "orphan")}, errs.KindConflict},
+			{"parent in another thread", models.Posts{post("alice", foreign[0].Id, "orphan")}, errs.KindConflict},
+			{"unknown author", models.Posts{post("alice", 0, "ok"), post("nobody", 0, "who")}, errs.KindNotFound},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				_, err := f.r.Post.AddPosts(ctx, tc.posts, int(thread.Id), thread.Forum)
+				expectKind(t, err, tc.kind)
+
+				// пачка вставляется целиком или не вставляется совсем
+				posts, err := f.r.Post.GetAllPostByThread(ctx, int(thread.Id), 100, 0, false)
+				expectNoError(t, err)
+				if len(posts) != 0 {
+					t.Fatalf("failed batch left posts %v", postIds(posts))
+				}
+			})
+		}
+
+		forum, err := f.r.Forum.GetForumInfo(ctx, thread.Forum)
+		expectNoError(t, err)
+		if forum.Posts != 1 {
+			t.Fatalf("forum posts = %d after failed batches, want 1", forum.Posts)
+		}
+	},
+
+	"GetPosts": func(t *testing.T, r Repositories) {
+		f := newFixture(t, r)
+		thread := f.thread(t, "kraken", "alice", day(1))
+		other := f.thread(t, "other", "alice", day(2))
+		f.posts(t, other, post("alice", 0, "noise"))
+		ids := postTree(t, f, thread)
+		f.posts(t, other, post("bob", 0, "noise"))
+
+		for _, tc := range []struct {
+			name  string
+			sort  string
+			limit int
+			since string
+			desc  bool
+			want  []string
+		}{
+			{"flat", "flat", 100, "", false, []string{"r1", "r2", "r3", "c1", "c2", "c3", "g1", "c4"}},
+			{"flat limit", "flat", 3, "", false, []string{"r1", "r2", "r3"}},
+			{"flat desc", "flat", 3, "", true, []string{"c4", "g1", "c3"}},
+			{"flat since", "flat", 2, "c1", false, []string{"c2", "c3"}},
+			{"flat since desc", "flat", 100, "c1", true, []string{"r3", "r2", "r1"}},
+
+			{"tree", "tree", 100, "", false, []string{"r1", "c1", "g1", "c3", "r2", "c2", "r3", "c4"}},
+			{"tree limit", "tree", 3, "", false, []string{"r1", "c1", "g1"}},
+			{"tree desc", "tree", 100, "", true, []string{"c4", "r3", "c2", "r2", "c3", "g1", "c1", "r1"}},
+			{"tree since", "tree", 3, "c1", false, []string{"g1", "c3", "r2"}},
+			{"tree since desc", "tree", 100, "r2", true, []string{"c3", "g1", "c1", "r1"}},
+			{"tree since last", "tree", 100, "c4", false, nil},
+
+			{"parent_tree", "parent_tree", 100, "", false, []string{"r1", "c1", "g1", "c3", "r2", "c2", "r3", "c4"}},
+			{"parent_tree limits roots", "parent_tree", 2, "", false, []string{"r1", "c1", "g1", "c3", "r2", "c2"}},
+			{"parent_tree desc", "parent_tree", 2, "", true, []string{"r3", "c4", "r2", "c2"}},
+			{"parent_tree since root", "parent_tree", 100, "r1", false, []string{"r2", "c2", "r3", "c4"}},
+			{"parent_tree since child", "parent_tree", 1, "g1", false, []string{"r2", "c2"}},
+			{"parent_tree since desc", "parent_tree", 1, "r3", true, []string{"r2", "c2"}},
+			{"parent_tree since first desc", "parent_tree", 100, "c3", true, nil},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				var posts []models.Post
+				var err error
+				since := ids[tc.since]
+				switch tc.sort {
+				case "tree":
+					posts, err = f.r.Post.GetPostsTree(ctx, int(thread.Id), tc.limit, since, tc.desc)
+				case "parent_tree":
+					posts, err = f.r.Post.GetPostsParentTree(ctx, int(thread.Id), tc.limit, since, tc.desc)
+				default:
+					posts, err = f.r.Post.GetAllPostByThread(ctx, int(thread.Id), tc.limit, since, tc.desc)
+				}
+				expectNoError(t, err)
+
+				if got, want := postIds(posts), named(ids, tc.want...); !equalInts(got, want) {
+					t.Fatalf("got posts %v, want %v (%v)", got, want, tc.want)
+				}
+			})
+		}
+
+		for _, sort := range []string{"flat", "tree", "parent_tree"} {
+			var posts []models.Post
+			var err error
+			switch sort {
+			case "tree":
+				posts, err = f.r.Post.GetPostsTree(ctx, int(thread.Id)+1000, 100, 0, false)
+			case "parent_tree":
+				posts, err = f.r.Post.GetPostsParentTree(ctx, int(thread.Id)+1000, 100, 0, false)
+			default:
+				posts, err = f.r.Post.GetAllPostByThread(ctx, int(thread.Id)+1000, 100, 0, false)
+			}
+			expectNoError(t, err)
+			if len(posts) != 0 {
+				t.Fatalf("%s posts of missing thread: %v", sort, postIds(posts))
+			}
+		}
+	},
+
+	"FindPostsByUser": func(t *testing.T, r Repositories) {
+		f := newFixture(t, r)
+		thread := f.thread(t, "kraken", "alice", day(1))
+		ids := postTree(t, f, thread)
+		f.forum = f.newForum(t, "Sailors", "bob")
+		other := f.thread(t, "other", "bob", day(2))
+		sailors := f.posts(t, other, post("ALICE", 0, "s1"), post("bob", 0, "noise"), post("alice", 0, "s2"))
+		ids["s1"], ids["s2"] = sailors[0].Id, sailors[2].Id
+
+		for _, tc := range []struct {
+			name   string
+			params models.UserPostsParams
+			want   []string
+		}{
+			{"all forums", models.UserPostsParams{Limit: 100}, []string{"r1", "c2", "s1", "s2"}},
+			{"desc", models.UserPostsParams{Limit: 3, Desc: true}, []string{"s2", "s1", "c2"}},
+			{"forum", models.UserPostsParams{Limit: 100, Forum: "pirates"}, []string{"r1", "c2"}},
+			{"since", models.UserPostsParams{Limit: 2, Since: ids["r1"]}, []string{"c2", "s1"}},
+			{"since desc", models.UserPostsParams{Limit: 100, Desc: true, Since: ids["s1"]}, []string{"c2", "r1"}},
+			{"since last", models.UserPostsParams{Limit: 100, Since: ids["s2"]}, nil},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				posts, err := f.r.Post.FindPostsByUser(ctx, "Alice", tc.params)
+				expectNoError(t, err)
+				if got, want := postIds(posts), named(ids, tc.want...); !equalInts(got, want) {
+					t.Fatalf("got posts %v, want %v (%v)", got, want, tc.want)
+				}
+			})
+		}
+
+		posts, err := f.r.Post.FindPostsByUser(ctx, "nobody", models.UserPostsParams{Limit: 100})
+		expectNoError(t, err)
+		if len(posts) != 0 {
+			t.Fatalf("FindPostsByUser of missing user = %v", postIds(posts))
+		}
+	},
+
+	"ChangePost": func(t *testing.T, r Repositories) {
+		f := newFixture(t, r)
+		thread := f.thread(t, "kraken", "alice", day(1))
+		created := f.posts(t, thread, post("alice", 0, "original"))[0]
+
+		for _, tc := range []struct {
+			name    string
+			message string
+			want    string
+			edited  bool
+		}{
+			{"empty message", "", "original", false},
+			{"same message", "original", "original", false},
+			{"new message", "changed", "changed", true},
+			{"empty message keeps the flag", "", "changed", true},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				changed, err := f.r.Post.ChangePost(ctx, models.PostUpdate{Message: tc.message}, created.Id)
+				expectNoError(t, err)
+				if changed.Id != created.Id || changed.Message != tc.want || changed.IsEdited != tc.edited {
+					t.Fatalf("ChangePost = %+v", changed)
+				}
+				if !changed.Created.Equal(created.Created) || changed.Author != created.Author {
+					t.Fatalf("ChangePost changed other fields: %+v", changed)
+				}
+			})
+		}
+
+		_, err := f.r.Post.ChangePost(ctx, models.PostUpdate{Message: "x"}, created.Id+1000)
+		expectKind(t, err, errs.KindNotFound)
+	},
+
+	"GetAllInfo": func(t *testing.T, r Repositories) {
+		f := newFixture(t, r)
+		thread := f.thread(t, "", "alice", day(1))
+		created := f.posts(t, thread, post("BOB", 0, "hello"))[0]
+
+		for _, tc := range []struct {
+			name   string
+			params models.FullPostParams
+		}{
+			{"post only", models.FullPostParams{}},
+			{"user", models.FullPostParams{User: true}},
+			{"thread and forum", models.FullPostParams{Thread: true, Forum: true}},
+			{"everything", models.FullPostParams{User: true, Thread: true, Forum: true}},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				info, err := f.r.Post.GetAllInfo(ctx, tc.params, created.Id)
+				expectNoError(t, err)
+
+				if info.Post == nil || info.Post.Id != created.Id || info.Post.Message != "hello" {
+					t.Fatalf("post %+v", info.Post)
+				}
+				if (info.Author != nil) != tc.params.User || (info.Thread != nil) != tc.params.Thread || (info.Forum != nil) != tc.params.Forum {
+					t.Fatalf("related objects %+v for %+v", info, tc.params)
+				}
+				if info.Author != nil && *info.Author != f.users[1] {
+					t.Fatalf("author %+v", info.Author)
+				}
+				if info.Thread != nil && (info.Thread.Id != thread.Id || info.Thread.Slug != "") {
+					t.Fatalf("thread %+v", info.Thread)
+				}
+				if info.Forum != nil && (info.Forum.Slug != "Pirates" || info.Forum.Posts != 1 || info.Forum.Threads != 1) {
+					t.Fatalf("forum %+v", info.Forum)
+				}
+			})
+		}
+
+		_, err := f.r.Post.GetAllInfo(ctx, models.FullPostParams{}, created.Id+1000)
+		expectKind(t, err, errs.KindNotFound)
+	},
+}
@@ -0,0 +1,249 @@
+package contract
+
+import (
+	"forum/internal/utils/errs"
+	"forum/pkg/models"
+	"testing"
+)
+
+var serviceTests = map[string]func(t *testing.T, r Repositories){
+	"GetStatus": func(t *testing.T, r Repositories) {
+		status, err := r.Service.GetStatus(ctx)
+		expectNoError(t, err)
+		if status != (models.Status{}) {
+			t.Fatalf("status of empty storage %+v", status)
+		}
+
+		f := newFixture(t, r)
+		f.newForum(t, "other", "bob")
+		thread := f.thread(t, "kraken", "alice", day(1))
+		f.posts(t, thread, post("alice", 0, "a"), post("bob", 0, "b"), post("carol", 0, "c"))
+
+		status, err = r.Service.GetStatus(ctx)
+		expectNoError(t, err)
+		want := models.Status{User: 4, Forum: 2, Thread: 1, Post: 3}
+		if status != want {
+			t.Fatalf("GetStatus = %+v, want %+v", status, want)
+		}
+	},
+
+	"CleanDb": func(t *testing.T, r Repositories) {
+		f := newFixture(t, r)
+		thread := f.thread(t, "kraken", "alice", day(1))
+		f.posts(t, thread, post("alice", 0, "a"))
+		expectNoError(t, r.Thread.SetVote(ctx, models.Vote{Nickname: "alice", Voice: 1}, int(thread.Id)))
+
+		want := models.CleanReport{DryRun: true, Users: 4, Forums: 1, Threads: 1, Posts: 1, Votes: 1}
+		report, err := r.Service.CleanDb(ctx, models.Clean{DryRun: true})
+		expectNoError(t, err)
+		if report != want {
+			t.Fatalf("dry run CleanDb = %+v, want %+v", report, want)
+		}
+		if status, _ := r.Service.GetStatus(ctx); status.Post != 1 {
+			t.Fatalf("dry run changed storage: %+v", status)
+		}
+
+		want.DryRun = false
+		report, err = r.Service.CleanDb(ctx, models.Clean{})
+		expectNoError(t, err)
+		if report != want {
+			t.Fatalf("CleanDb = %+v, want %+v", report, want)
+		}
+		status, err := r.Service.GetStatus(ctx)
+		expectNoError(t, err)
+		if status != (models.Status{}) {
+			t.Fatalf("status after CleanDb %+v", status)
+		}
+
+		// после очистки хранилищем можно пользоваться как новым
+		f = newFixture(t, r)
+		thread = f.thread(t, "kraken", "alice", day(1))
+		f.posts(t, thread, post("alice", 0, "a"))
+		expectNoError(t, r.Thread.SetVote(ctx, models.Vote{Nickname: "alice", Voice: 1}, int(thread.Id)))
+
+		stored, err := r.Thread.GetThreadInfoBySlug(ctx, "kraken")
+		expectNoError(t, err)
+		if stored.Votes != 1 {
+			t.Fatalf("votes after CleanDb = %d, want 1", stored.Votes)
+		}
+	},
+
+	"CleanDbForum": func(t *testing.T, r Repositories) {
+		f := newFixture(t, r)
+		f.newForum(t, "other", "Bob")
+		t1 := f.thread(t, "t1", "alice", day(1))
+		t2 := f.thread(t, "t2", "carol", day(2))
+		kept, err := r.Thread.CreateThread(ctx, models.Thread{Title: "Elsewhere", Author: "Bob", Forum: "other", Message: "m", Slug: "t3", Created: day(3)})
+		expectNoError(t, err)
+		f.posts(t, t1, post("alice", 0, "a"), post("Bob", 0, "b"))
+		f.posts(t, t2, post("carol", 0, "c"))
+		f.posts(t, kept, post("Bob", 0, "d"))
+		expectNoError(t, r.Forum.AddModerator(ctx, "Pirates", "dave"))
+		for _, vote := range []struct {
+			nick   string
+			thread models.Thread
+		}{{"alice", t1}, {"Bob", t1}, {"dave", t2}, {"alice", kept}} {
+			expectNoError(t, r.Thread.SetVote(ctx, models.Vote{Nickname: vote.nick, Voice: 1}, int(vote.thread.Id)))
+		}
+
+		want := models.CleanReport{Forum: "Pirates", DryRun: true, Forums: 1, Threads: 2, Posts: 3, Votes: 3}
+		report, err := r.Service.CleanDb(ctx, models.Clean{Forum: "PIRATES", DryRun: true})
+		expectNoError(t, err)
+		if report != want {
+			t.Fatalf("dry run CleanDb = %+v, want %+v", report, want)
+		}
+		_, err = r.Forum.GetForumInfo(ctx, "pirates")
+		expectNoError(t, err)
+
+		want.DryRun = false
+		report, err = r.Service.CleanDb(ctx, models.Clean{Forum: "pirates"})
+		expectNoError(t, err)
+		if report != want {
+			t.Fatalf("CleanDb = %+v, want %+v", report, want)
+		}
+
+		_, err = r.Forum.GetForumInfo(ctx, "pirates")
+		expectKind(t, err, errs.KindNotFound)
+		_, err = r.Thread.GetThreadInfoBySlug(ctx, "t1")
+		expectKind(t, err, errs.KindNotFound)
+		status, err := r.Service.GetStatus(ctx)
+		expectNoError(t, err)
+		if want := (models.Status{User: 4, Forum: 1, Thread: 1, Post: 1}); status != want {
+			t.Fatalf("status after CleanDb %+v, want %+v", status, want)
+		}
+		stored, err := r.Thread.GetThreadInfoBySlug(ctx, "t3")
+		expectNoError(t, err)
+		if stored.Votes != 1 {
+			t.Fatalf("votes of t3 = %d, want 1", stored.Votes)
+		}
+
+		// slug удалённого форума снова свободен, модераторы не переходят к новому
+		f.newForum(t, "pirates", "carol")
+		moderators, err := r.Forum.FindModerators(ctx, "pirates")
+		expectNoError(t, err)
+		if len(moderators) != 0 {
+			t.Fatalf("moderators of new pirates %+v", moderators)
+		}
+		_, err = r.Service.CleanDb(ctx, models.Clean{Forum: "nowhere"})
+		expectKind(t, err, errs.KindNotFound)
+	},
+
+	"MergeUsers": func(t *testing.T, r Repositories) {
+		f := newFixture(t, r)
+		f.newForum(t, "other", "Bob")
+		t1 := f.thread(t, "t1", "Bob", day(1))
+		t2 := f.thread(t, "t2", "alice", day(2))
+		t3 := f.thread(t, "t3", "carol", day(3))
+		_, err := r.Thread.CreateThread(ctx, models.Thread{Title: "Elsewhere", Author: "Bob", Forum: "other", Message: "m", Slug: "t4", Created: day(4)})
+		expectNoError(t, err)
+		f.posts(t, t1, post("Bob", 0, "b1"))
+		f.posts(t, t2, post("alice", 0, "a1"))
+		f.posts(t, t3, post("Bob", 0, "b3"))
+		for _, vote := range []struct {
+			nick   string
+			voice  float32
+			thread models.Thread
+		}{
+			{"alice", 1, t1}, {"Bob", -1, t1},
+			{"Bob", 1, t2}, {"carol", 1, t2},
+			{"alice", -1, t3}, {"Bob", 1, t3}, {"dave", 1, t3},
+		} {
+			expectNoError(t, r.Thread.SetVote(ctx, models.Vote{Nickname: vote.nick, Voice: vote.voice}, int(vote.thread.Id)))
+		}
+
+		want := models.UserMergeReport{Into: "alice", From: "Bob", Votes: models.MergeVotesReplace, DryRun: true,
+			Threads: 2, Posts: 2, Forums: 1, Memberships: 1, VotesMoved: 1, VoteConflicts: 2}
+		report, err := r.Service.MergeUsers(ctx, models.UserMerge{Into: "alice", From: "Bob", Votes: models.MergeVotesReplace, DryRun: true})
+		expectNoError(t, err)
+		if report != want {
+			t.Fatalf("dry run MergeUsers = %+v, want %+v", report, want)
+		}
+		_, err = r.User.GetUser(ctx, "Bob")
+		expectNoError(t, err)
+		if stored, _ := r.Thread.GetThreadInfoBySlug(ctx, "t1"); stored.Votes != 0 || stored.Author != "Bob" {
+			t.Fatalf("dry run changed thread: %+v", stored)
+		}
+
+		want.DryRun = false
+		report, err = r.Service.MergeUsers(ctx, models.UserMerge{Into: "alice", From: "Bob", Votes: models.MergeVotesReplace})
+		expectNoError(t, err)
+		if report != want {
+			t.Fatalf("MergeUsers = %+v, want %+v", report, want)
+		}
+
+		_, err = r.User.GetUser(ctx, "Bob")
+		expectKind(t, err, errs.KindNotFound)
+		for slug, votes := range map[string]int64{"t1": -1, "t2": 2, "t3": 2} {
+			stored, err := r.Thread.GetThreadInfoBySlug(ctx, slug)
+			expectNoError(t, err)
+			if stored.Votes != votes {
+				t.Fatalf("votes of %s = %d, want %d", slug, stored.Votes, votes)
+			}
+		}
+		// перенесённый голос принадлежит alice: повторный голос меняет его, а не добавляет
+		expectNoError(t, r.Thread.SetVote(ctx, models.Vote{Nickname: "alice", Voice: -1}, int(t2.Id)))
+		if stored, _ := r.Thread.GetThreadInfoBySlug(ctx, "t2"); stored.Votes != 0 {
+			t.Fatalf("votes of t2 after revote = %d, want 0", stored.Votes)
+		}
+
+		threads, err := r.Thread.FindThreadsByUser(ctx, "alice", models.UserThreadsParams{Limit: 10})
+		expectNoError(t, err)
+		if got := threadSlugs(threads); !equalStrings(got, []string{"t1", "t2", "t4"}) {
+			t.Fatalf("threads of alice %v", got)
+		}
+		posts, err := r.Post.FindPostsByUser(ctx, "alice", models.UserPostsParams{Limit: 10})
+		expectNoError(t, err)
+		if len(posts) != 3 {
+			t.Fatalf("alice has %d posts, want 3", len(posts))
+		}
+		forum, err := r.Forum.GetForumInfo(ctx, "other")
+		expectNoError(t, err)
+		if forum.User != "alice" {
+			t.Fatalf("owner of other = %q, want alice", forum.User)
+		}
+		for slug, want := range map[string][]string{"Pirates": {"alice", "carol"}, "other": {"alice"}} {
+			users, err := r.Forum.FindUsers(ctx, slug, models.ParamsForSearch{Limit: 100})
+			expectNoError(t, err)
+			if got := nicknames(users); !equalStrings(got, want) {
+				t.Fatalf("users of %s %v, want %v", slug, got, want)
+			}
+		}
+
+		_, err = r.Service.MergeUsers(ctx, models.UserMerge{Into: "alice", From: "Bob", Votes: models.MergeVotesKeep})
+		expectKind(t, err, errs.KindNotFound)
+		_, err = r.Service.MergeUsers(ctx, models.UserMerge{Into: "alice", From: "carol", Votes: "coin"})
+		expectKind(t, err, errs.KindInvalid)
+		_, err = r.Service.MergeUsers(ctx, models.UserMerge{Into: "carol", From: "CAROL", Votes: models.MergeVotesKeep})
+		expectKind(t, err, errs.KindInvalid)
+		_, err = r.User.GetUser(ctx, "carol")
+		expectNoError(t, err)
+	},
+
+	"MergeUsersVotePolicies": func(t *testing.T, r Repositories) {
+		f := newFixture(t, r)
+		thread := f.thread(t, "kraken", "carol", day(1))
+		for nick, voice := range map[string]float32{"k1": 1, "k2": -1, "d1": 1, "d2": 1} {
+			f.user(t, nick)
+			expectNoError(t, r.Thread.SetVote(ctx, models.Vote{Nickname: nick, Voice: voice}, int(thread.Id)))
+		}
+
+		for _, tc := range []struct {
+			into, from, policy string
+			votes              int64
+		}{
+			{"k1", "k2", models.MergeVotesKeep, 3},
+			{"d1", "d2", models.MergeVotesDrop, 1},
+		} {
+			report, err := r.Service.MergeUsers(ctx, models.UserMerge{Into: tc.into, From: tc.from, Votes: tc.policy})
+			expectNoError(t, err)
+			if report.VoteConflicts != 1 || report.VotesMoved != 0 {
+				t.Fatalf("%s: MergeUsers = %+v", tc.policy, report)
+			}
+			stored, err := r.Thread.GetThreadInfoBySlug(ctx, "kraken")
+			expectNoError(t, err)
+			if stored.Votes != tc.votes {
+				t.Fatalf("%s: votes = %d, want %d", tc.policy, stored.Votes, tc.votes)
+			}
+		}
+	},
+}
@@ -0,0 +1,228 @@
+package contract
+
+import (
+	"forum/internal/utils/errs"
+	"forum/pkg/models"
+	"strconv"
+	"testing"
+)
+
+var threadTests = map[string]func(t *testing.T, r Repositories){
+	"CreateThread": func(t *testing.T, r Repositories) {
+		f := newFixture(t, r)
+
+		thread, err := f.r.Thread.CreateThread(ctx, models.Thread{
+			Title: "Title", Author: "BOB", Forum: "pirates", Message: "Message", Slug: "Kraken", Created: day(1),
+		})
+		expectNoError(t, err)
+		if thread.Id == 0 || thread.Author != "Bob" || thread.Forum != "Pirates" || thread.Slug != "Kraken" {
+			t.Fatalf("CreateThread = %+v", thread)
+		}
+
+		stored, err := f.r.Thread.GetThreadInfoById(ctx, int(thread.Id))
+		expectNoError(t, err)
+		if stored.Title != "Title" || stored.Message != "Message" || stored.Votes != 0 || !stored.Created.Equal(day(1)) {
+			t.Fatalf("stored thread %+v", stored)
+		}
+
+		_, err = f.r.Thread.CreateThread(ctx, models.Thread{Title: "x", Author: "alice", Forum: "Pirates", Message: "x", Slug: "kraken"})
+		expectKind(t, err, errs.KindConflict)
+		_, err = f.r.Thread.CreateThread(ctx, models.Thread{Title: "x", Author: "nobody", Forum: "Pirates", Message: "x"})
+		expectKind(t, err, errs.KindNotFound)
+		_, err = f.r.Thread.CreateThread(ctx, models.Thread{Title: "x", Author: "alice", Forum: "missing", Message: "x"})
+		expectKind(t, err, errs.KindNotFound)
+	},
+
+	"ThreadWithoutSlug": func(t *testing.T, r Repositories) {
+		f := newFixture(t, r)
+
+		// без slug можно создать сколько угодно веток, slug наружу не отдаётся
+		first := f.thread(t, "", "alice", day(1))
+		second := f.thread(t, "", "alice", day(2))
+		if first.Slug != "" || second.Slug != "" || first.Id == second.Id {
+			t.Fatalf("threads without slug: %+v, %+v", first, second)
+		}
+
+		stored, err := f.r.Thread.GetThreadInfoById(ctx, int(first.Id))
+		expectNoError(t, err)
+		if stored.Slug != "" {
+			t.Fatalf("GetThreadInfoById exposes generated slug %q", stored.Slug)
+		}
+
+		threads, err := f.r.Thread.FindThreads(ctx, "pirates", models.ParamsForSearch{Limit: 10})
+		expectNoError(t, err)
+		if got := threadSlugs(threads); !equalStrings(got, []string{"", ""}) {
+			t.Fatalf("FindThreads slugs %q", got)
+		}
+	},
+
+	"GetThread": func(t *testing.T, r Repositories) {
+		f := newFixture(t, r)
+		thread := f.thread(t, "Kraken", "alice", day(1))
+
+		bySlug, err := f.r.Thread.GetThreadInfoBySlug(ctx, "KRAKEN")
+		expectNoError(t, err)
+		byId, err := f.r.Thread.GetThreadInfoById(ctx, int(thread.Id))
+		expectNoError(t, err)
+		id, err := f.r.Thread.GetThreadIdBySlug(ctx, "kraken")
+		expectNoError(t, err)
+		if bySlug.Id != thread.Id || byId.Slug != "Kraken" || id != int(thread.Id) {
+			t.Fatalf("lookups returned %+v, %+v, %d", bySlug, byId, id)
+		}
+
+		_, err = f.r.Thread.GetThreadInfoBySlug(ctx, "missing")
+		expectKind(t, err, errs.KindNotFound)
+		_, err = f.r.Thread.GetThreadInfoById(ctx, int(thread.Id)+1000)
+		expectKind(t, err, errs.KindNotFound)
+		_, err = f.r.Thread.GetThreadIdBySlug(ctx, "missing")
+		expectKind(t, err, errs.KindNotFound)
+	},
+
+	"FindThreads": func(t *testing.T, r Repositories) {
+		f := newFixture(t, r)
+		for i, slug := range []string{"t3", "t1", "t4", "t2"} {
+			f.thread(t, slug, f.users[i].Nickname, day(int(slug[1]-'0')))
+		}
+		f.newForum(t, "empty", "alice")
+
+		for _, tc := range []struct {
+			name   string
+			params models.ParamsForSearch
+			want   []string
+		}{
+			{"all", models.ParamsForSearch{Limit: 100}, []string{"t1", "t2", "t3", "t4"}},
+			{"desc", models.ParamsForSearch{Limit: 100, Desc: true}, []string{"t4", "t3", "t2", "t1"}},
+			{"limit", models.ParamsForSearch{Limit: 2}, []string{"t1", "t2"}},
+			{"since is inclusive", models.ParamsForSearch{Limit: 100, Since: day(2).Format("2006-01-02T15:04:05.000Z")}, []string{"t2", "t3", "t4"}},
+			{"since desc is inclusive", models.ParamsForSearch{Limit: 2, Desc: true, Since: day(3).Format("2006-01-02T15:04:05.000Z")}, []string{"t3", "t2"}},
+			{"since past the end", models.ParamsForSearch{Limit: 100, Since: day(10).Format("2006-01-02T15:04:05.000Z")}, nil},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				threads, err := f.r.Thread.FindThreads(ctx, "PIRATES", tc.params)
+				expectNoError(t, err)
+				if got := threadSlugs(threads); !equalStrings(got, tc.want) {
+					t.Fatalf("FindThreads = %v, want %v", got, tc.want)
+				}
+			})
+		}
+
+		threads, err := f.r.Thread.FindThreads(ctx, "empty", models.ParamsForSearch{Limit: 100})
+		expectNoError(t, err)
+		if len(threads) != 0 {
+			t.Fatalf("FindThreads on empty forum = %v", threadSlugs(threads))
+		}
+	},
+
+	"FindThreadsByUser": func(t *testing.T, r Repositories) {
+		f := newFixture(t, r)
+		f.thread(t, "a2", "alice", day(2))
+		f.thread(t, "b1", "Bob", day(1))
+		f.thread(t, "a1", "ALICE", day(1))
+		f.thread(t, "a3", "alice", day(3))
+		f.forum = f.newForum(t, "Sailors", "bob")
+		f.thread(t, "s2", "alice", day(2))
+		f.thread(t, "", "alice", day(4))
+
+		for _, tc := range []struct {
+			name   string
+			params models.UserThreadsParams
+			want   []string
+		}{
+			{"all forums", models.UserThreadsParams{Limit: 100}, []string{"a1", "a2", "s2", "a3", ""}},
+			{"desc", models.UserThreadsParams{Limit: 3, Desc: true}, []string{"", "a3", "s2"}},
+			{"forum", models.UserThreadsParams{Limit: 100, Forum: "pirates"}, []string{"a1", "a2", "a3"}},
+			{"since is inclusive", models.UserThreadsParams{Limit: 2, Since: day(2).Format("2006-01-02T15:04:05.000Z")}, []string{"a2", "s2"}},
+			{"since desc is inclusive", models.UserThreadsParams{Limit: 100, Desc: true, Since: day(2).Format("2006-01-02T15:04:05.000Z")}, []string{"s2", "a2", "a1"}},
+			{"since past the end", models.UserThreadsParams{Limit: 100, Since: day(10).Format("2006-01-02T15:04:05.000Z")}, nil},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				threads, err := f.r.Thread.FindThreadsByUser(ctx, "Alice", tc.params)
+				expectNoError(t, err)
+				if got := threadSlugs(threads); !equalStrings(got, tc.want) {
+					t.Fatalf("FindThreadsByUser = %v, want %v", got, tc.want)
+				}
+			})
+		}
+
+		threads, err := f.r.Thread.FindThreadsByUser(ctx, "carol", models.UserThreadsParams{Limit: 100})
+		expectNoError(t, err)
+		if len(threads) != 0 {
+			t.Fatalf("FindThreadsByUser without threads = %v", threadSlugs(threads))
+		}
+	},
+
+	"UpdateThread": func(t *testing.T, r Repositories) {
+		f := newFixture(t, r)
+		thread := f.thread(t, "kraken", "alice", day(1))
+		id := strconv.Itoa(int(thread.Id))
+
+		for _, tc := range []struct {
+			name     string
+			slugOrId string
+			update   models.ThreadUpdate
+			title    string
+			message  string
+		}{
+			{"empty update by id", id, models.ThreadUpdate{}, "Thread kraken", "message kraken"},
+			{"title by slug", "KRAKEN", models.ThreadUpdate{Title: "New title"}, "New title", "message kraken"},
+			{"message by id", id, models.ThreadUpdate{Message: "New message"}, "New title", "New message"},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				updated, err := f.r.Thread.UpdateThread(ctx, tc.update, tc.slugOrId)
+				expectNoError(t, err)
+				if updated.Id != thread.Id || updated.Title != tc.title || updated.Message != tc.message {
+					t.Fatalf("UpdateThread = %+v", updated)
+				}
+
+				stored, err := f.r.Thread.GetThreadInfoById(ctx, int(thread.Id))
+				expectNoError(t, err)
+				if stored.Title != tc.title || stored.Message != tc.message {
+					t.Fatalf("stored thread %+v", stored)
+				}
+			})
+		}
+
+		_, err := f.r.Thread.UpdateThread(ctx, models.ThreadUpdate{Title: "x"}, "missing")
+		expectKind(t, err, errs.KindNotFound)
+		_, err = f.r.Thread.UpdateThread(ctx, models.ThreadUpdate{Title: "x"}, strconv.Itoa(int(thread.Id)+1000))
+		expectKind(t, err, errs.KindNotFound)
+	},
+
+	"SetVote": func(t *testing.T, r Repositories) {
+		f := newFixture(t, r)
+		thread := f.thread(t, "kraken", "alice", day(1))
+		other := f.thread(t, "other", "alice", day(2))
+
+		for _, tc := range []struct {
+			name  string
+			vote  models.Vote
+			votes int64
+		}{
+			{"first vote", models.Vote{Nickname: "alice", Voice: 1}, 1},
+			{"another user", models.Vote{Nickname: "bob", Voice: 1}, 2},
+			{"same voice again", models.Vote{Nickname: "alice", Voice: 1}, 2},
+			{"changed voice", models.Vote{Nickname: "alice", Voice: -1}, 0},
+			{"changed voice, nickname in other case", models.Vote{Nickname: "ALICE", Voice: 1}, 2},
+			{"third user against", models.Vote{Nickname: "carol", Voice: -1}, 1},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				expectNoError(t, f.r.Thread.SetVote(ctx, tc.vote, int(thread.Id)))
+
+				stored, err := f.r.Thread.GetThreadInfoById(ctx, int(thread.Id))
+				expectNoError(t, err)
+				if stored.Votes != tc.votes {
+					t.Fatalf("votes = %d, want %d", stored.Votes, tc.votes)
+				}
+			})
+		}
+
+		stored, err := f.r.Thread.GetThreadInfoById(ctx, int(other.Id))
+		expectNoError(t, err)
+		if stored.Votes != 0 {
+			t.Fatalf("votes leaked to another thread: %d", stored.Votes)
+		}
+
+		expectKind(t, f.r.Thread.SetVote(ctx, models.Vote{Nickname: "nobody", Voice: 1}, int(thread.Id)), errs.KindNotFound)
+		expectKind(t, f.r.Thread.SetVote(ctx, models.Vote{Nickname: "alice", Voice: 1}, int(other.Id)+1000), errs.KindNotFound)
+	},
+}
@@ -0,0 +1,591 @@
+package contract
+
+import (
+	"forum/internal/utils/errs"
+	"forum/pkg/models"
+	"sort"
+	"testing"
+	"time"
+)
+
+var userTests = map[string]func(t *testing.T, r Repositories){
+	"AddUser": func(t *testing.T, r Repositories) {
+		user := models.User{Nickname: "jack", Fullname: "Jack Sparrow", About: "captain", Email: "jack@example.com"}
+		users, err := r.User.AddUser(ctx, user)
+		expectNoError(t, err)
+		if len(users) != 1 || users[0] != user {
+			t.Fatalf("AddUser returned %+v, want [%+v]", users, user)
+		}
+	},
+
+	"AddUserConflict": func(t *testing.T, r Repositories) {
+		f := newFixture(t, r)
+
+		for _, tc := range []struct {
+			name string
+			user models.User
+			want []string
+		}{
+			{"same nickname", models.User{Nickname: "alice", Fullname: "x", Email: "new@example.com"}, []string{"alice"}},
+			{"nickname in other case", models.User{Nickname: "ALICE", Fullname: "x", Email: "new@example.com"}, []string{"alice"}},
+			{"email in other case", models.User{Nickname: "new", Fullname: "x", Email: "BOB@example.com"}, []string{"Bob"}},
+			{"nickname and email of the same user", models.User{Nickname: "carol", Fullname: "x", Email: "carol@example.com"}, []string{"carol"}},
+			{"nickname and email of different users", models.User{Nickname: "dave", Fullname: "x", Email: "alice@example.com"}, []string{"alice", "dave"}},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				users, err := f.r.User.AddUser(ctx, tc.user)
+				expectKind(t, err, errs.KindConflict)
+
+				got := nicknames(users)
+				sort.Strings(got)
+				if !equalStrings(got, tc.want) {
+					t.Fatalf("conflicting users %v, want %v", got, tc.want)
+				}
+			})
+		}
+
+		user, err := f.r.User.GetUser(ctx, "alice")
+		expectNoError(t, err)
+		if user != f.users[0] {
+			t.Fatalf("conflicting insert changed the user: %+v", user)
+		}
+	},
+
+	"GetUser": func(t *testing.T, r Repositories) {
+		f := newFixture(t, r)
+
+		for _, nick := range []string{"Bob", "bob", "BOB"} {
+			user, err := f.r.User.GetUser(ctx, nick)
+			expectNoError(t, err)
+			if user != f.users[1] {
+				t.Fatalf("GetUser(%s) = %+v, want %+v", nick, user, f.users[1])
+			}
+		}
+
+		_, err := f.r.User.GetUser(ctx, "nobody")
+		expectKind(t, err, errs.KindNotFound)
+	},
+
+	"GetUserCredentials": func(t *testing.T, r Repositories) {
+		f := newFixture(t, r)
+		_, err := r.User.AddUser(ctx, models.User{Nickname: "eve", Fullname: "Eve", Email: "eve@example.com", PasswordHash: "hash1"})
+		expectNoError(t, err)
+
+		user, err := r.User.GetUser(ctx, "eve")
+		expectNoError(t, err)
+		if user.PasswordHash != "" {
+			t.Fatalf("GetUser returned password hash %q", user.PasswordHash)
+		}
+		for nick, want := range map[string]string{"EVE": "hash1", "Bob": ""} {
+			user, err = r.User.GetUserCredentials(ctx, nick)
+			expectNoError(t, err)
+			if user.PasswordHash != want {
+				t.Fatalf("GetUserCredentials(%s) hash %q, want %q", nick, user.PasswordHash, want)
+			}
+		}
+
+		// хэш меняется вместе с профилем и остаётся после переименования
+		_, err = r.User.ChangeUser(ctx, models.User{Nickname: "eve", About: "spy", PasswordHash: "hash2"})
+		expectNoError(t, err)
+		_, err = r.User.ChangeUser(ctx, models.User{Nickname: f.users[1].Nickname, PasswordHash: "hash3"})
+		expectNoError(t, err)
+		_, err = r.User.RenameUser(ctx, "eve", "Mallory", time.Now().Add(time.Hour))
+		expectNoError(t, err)
+		for nick, want := range map[string]string{"eve": "hash2", "mallory": "hash2", "bob": "hash3"} {
+			user, err = r.User.GetUserCredentials(ctx, nick)
+			expectNoError(t, err)
+			if user.PasswordHash != want {
+				t.Fatalf("GetUserCredentials(%s) hash %q, want %q", nick, user.PasswordHash, want)
+			}
+		}
+
+		// новый владелец nickname не получает пароль удалённого
+		expectNoError(t, r.User.DeleteUser(ctx, "Bob"))
+		_, err = r.User.GetUserCredentials(ctx, "Bob")
+		expectKind(t, err, errs.KindNotFound)
+		f.user(t, "Bob")
+		user, err = r.User.GetUserCredentials(ctx, "Bob")
+		expectNoError(t, err)
+		if user.PasswordHash != "" {
+			t.Fatalf("recreated user has hash %q", user.PasswordHash)
+		}
+	},
+
+	"ChangeUser": func(t *testing.T, r Repositories) {
+		f := newFixture(t, r)
+
+		for _, tc := range []struct {
+			name   string
+			update models.User
+			want   models.User
+		}{
+			{"empty update keeps everything",
+				models.User{Nickname: "alice"},
+				f.users[0]},
+			{"fullname only",
+				models.User{Nickname: "ALICE", Fullname: "Alice Liddell"},
+				models.User{Nickname: "alice", Fullname: "Alice Liddell", About: "about alice", Email: "alice@example.com"}},
+			{"about and email",
+				models.User{Nickname: "alice", About: "wonderland", Email: "liddell@example.com"},
+				models.User{Nickname: "alice", Fullname: "Alice Liddell", About: "wonderland", Email: "liddell@example.com"}},
+			{"own email in other case",
+				models.User{Nickname: "alice", Email: "LIDDELL@example.com"},
+				models.User{Nickname: "alice", Fullname: "Alice Liddell", About: "wonderland", Email: "LIDDELL@example.com"}},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				user, err := f.r.User.ChangeUser(ctx, tc.update)
+				expectNoError(t, err)
+				if user != tc.want {
+					t.Fatalf("ChangeUser = %+v, want %+v", user, tc.want)
+				}
+
+				stored, err := f.r.User.GetUser(ctx, "alice")
+				expectNoError(t, err)
+				if stored != tc.want {
+					t.Fatalf("stored user %+v, want %+v", stored, tc.want)
+				}
+			})
+		}
+
+		_, err := f.r.User.ChangeUser(ctx, models.User{Nickname: "alice", Email: "bob@EXAMPLE.com"})
+		expectKind(t, err, errs.KindConflict)
+
+		// освободившийся адрес можно занять
+		_, err = f.r.User.ChangeUser(ctx, models.User{Nickname: "bob", Email: "alice@example.com"})
+		expectNoError(t, err)
+
+		_, err = f.r.User.ChangeUser(ctx, models.User{Nickname: "nobody", Fullname: "x"})
+		expectKind(t, err, errs.KindNotFound)
+	},
+
+	"FindUsers": func(t *testing.T, r Repositories) {
+		f := newFixture(t, r)
+		for _, user := range []models.User{
+			{Nickname: "Zed", Fullname: "Carl Zed", Email: "zed@example.com"},
+			{Nickname: "zz_top", Fullname: "Band", Email: "zz@example.com"},
+		} {
+			_, err := f.r.User.AddUser(ctx, user)
+			expectNoError(t, err)
+		}
+
+		for _, tc := range []struct {
+			name   string
+			params models.UserSearch
+			want   []string
+			total  int64
+		}{
+			{"all", models.UserSearch{Limit: 100}, []string{"alice", "Bob", "carol", "dave", "Zed", "zz_top"}, 6},
+			{"desc limit", models.UserSearch{Limit: 2, Desc: true}, []string{"zz_top", "Zed"}, 6},
+			{"since", models.UserSearch{Limit: 2, Since: "bob"}, []string{"carol", "dave"}, 6},
+			{"since desc", models.UserSearch{Limit: 100, Since: "Carol", Desc: true}, []string{"Bob", "alice"}, 6},
+			{"nickname or fullname prefix", models.UserSearch{Limit: 100, Query: "CAR"}, []string{"carol", "Zed"}, 2},
+			{"query with since", models.UserSearch{Limit: 100, Query: "captain", Since: "bob"}, []string{"carol", "dave"}, 4},
+			{"underscore is literal", models.UserSearch{Limit: 100, Query: "zz_"}, []string{"zz_top"}, 1},
+			{"underscore is not a wildcard", models.UserSearch{Limit: 100, Query: "a_"}, nil, 0},
+			{"percent is literal", models.UserSearch{Limit: 100, Query: "%"}, nil, 0},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				users, err := f.r.User.FindUsers(ctx, tc.params)
+				expectNoError(t, err)
+				if got := nicknames(users); !equalStrings(got, tc.want) {
+					t.Fatalf("FindUsers = %v, want %v", got, tc.want)
+				}
+
+				total, err := f.r.User.CountUsers(ctx, tc.params.Query)
+				expectNoError(t, err)
+				if total != tc.total {
+					t.Fatalf("CountUsers(%q) = %d, want %d", tc.params.Query, total, tc.total)
+				}
+			})
+		}
+
+		_, err := f.r.User.FindUsers(ctx, models.UserSearch{Limit: -1})
+		expectKind(t, err, errs.KindInvalid)
+	},
+
+	"GetUserStats": func(t *testing.T, r Repositories) {
+		f := newFixture(t, r)
+		other := f.newForum(t, "other", "bob")
+
+		stats, err := f.r.User.GetUserStats(ctx, "ALICE")
+		expectNoError(t, err)
+		if stats != (models.UserStats{Nickname: "alice"}) {
+			t.Fatalf("stats without activity %+v", stats)
+		}
+
+		kraken := f.thread(t, "kraken", "alice", day(1))
+		f.thread(t, "", "ALICE", day(5))
+		f.threads = nil
+		f.forum = other
+		elsewhere := f.thread(t, "elsewhere", "bob", day(3))
+		f.posts(t, kraken, post("Alice", 0, "a"), post("bob", 0, "b"))
+		f.posts(t, elsewhere, post("alice", 0, "c"))
+		for _, vote := range []models.Vote{{Nickname: "bob", Voice: 1}, {Nickname: "carol", Voice: 1}, {Nickname: "dave", Voice: -1}} {
+			expectNoError(t, f.r.Thread.SetVote(ctx, vote, int(kraken.Id)))
+		}
+		expectNoError(t, f.r.Thread.SetVote(ctx, models.Vote{Nickname: "alice", Voice: -1}, int(elsewhere.Id)))
+
+		stats, err = f.r.User.GetUserStats(ctx, "alice")
+		expectNoError(t, err)
+		if stats.Nickname != "alice" || stats.Posts != 2 || stats.Threads != 2 || stats.VotesCast != 1 ||
+			stats.VotesReceived != 1 || stats.Forums != 2 {
+			t.Fatalf("GetUserStats = %+v", stats)
+		}
+		if stats.FirstActivity == nil || !stats.FirstActivity.Equal(day(1)) || stats.LastActivity == nil || stats.LastActivity.Before(day(5)) {
+			t.Fatalf("activity %v - %v", stats.FirstActivity, stats.LastActivity)
+		}
+
+		_, err = f.r.User.GetUserStats(ctx, "nobody")
+		expectKind(t, err, errs.KindNotFound)
+	},
+	"RenameUser": func(t *testing.T, r Repositories) {
+		f := newFixture(t, r)
+		thread := f.thread(t, "kraken", "alice", day(1))
+		created := f.posts(t, thread, post("ALICE", 0, "a"), post("bob", 0, "b"))
+		expectNoError(t, f.r.Thread.SetVote(ctx, models.Vote{Nickname: "alice", Voice: 1}, int(thread.Id)))
+		expires := time.Now().Add(time.Hour)
+
+		user, err := f.r.User.RenameUser(ctx, "Alice", "Alicia", expires)
+		expectNoError(t, err)
+		want := f.users[0]
+		want.Nickname = "Alicia"
+		if user != want {
+			t.Fatalf("RenameUser = %+v, want %+v", user, want)
+		}
+
+		for _, nick := range []string{"alicia", "ALICE"} {
+			user, err = f.r.User.GetUser(ctx, nick)
+			expectNoError(t, err)
+			if user != want {
+				t.Fatalf("GetUser(%s) = %+v, want %+v", nick, user, want)
+			}
+		}
+
+		forum, err := f.r.Forum.GetForumInfo(ctx, "pirates")
+		expectNoError(t, err)
+		stored, err := f.r.Thread.GetThreadInfoById(ctx, int(thread.Id))
+		expectNoError(t, err)
+		info, err := f.r.Post.GetAllInfo(ctx, models.FullPostParams{User: true}, created[0].Id)
+		expectNoError(t, err)
+		if forum.User != "Alicia" || stored.Author != "Alicia" || info.Post.Author != "Alicia" || info.Author == nil || *info.Author != want {
+			t.Fatalf("references not renamed: forum %q, thread %q, post %q", forum.User, stored.Author, info.Post.Author)
+		}
+		members, err := f.r.Forum.FindUsers(ctx, "pirates", models.ParamsForSearch{Limit: 100})
+		expectNoError(t, err)
+		if got := nicknames(members); !equalStrings(got, []string{"Alicia", "Bob"}) {
+			t.Fatalf("forum users %v", got)
+		}
+
+		// голос переименованного пользователя остаётся его голосом, а не новым
+		expectNoError(t, f.r.Thread.SetVote(ctx, models.Vote{Nickname: "alicia", Voice: -1}, int(thread.Id)))
+		stored, err = f.r.Thread.GetThreadInfoById(ctx, int(thread.Id))
+		expectNoError(t, err)
+		stats, err := f.r.User.GetUserStats(ctx, "alicia")
+		expectNoError(t, err)
+		if stored.Votes != -1 || stats.Posts != 1 || stats.Threads != 1 || stats.VotesCast != 1 {
+			t.Fatalf("votes %d, stats %+v", stored.Votes, stats)
+		}
+
+		_, err = f.r.User.RenameUser(ctx, "alicia", "BOB", expires)
+		expectKind(t, err, errs.KindConflict)
+		_, err = f.r.User.RenameUser(ctx, "nobody", "somebody", expires)
+		expectKind(t, err, errs.KindNotFound)
+
+		// повторное переименование переносит и старые псевдонимы
+		_, err = f.r.User.RenameUser(ctx, "alicia", "Ali", expires)
+		expectNoError(t, err)
+		for _, nick := range []string{"alice", "alicia"} {
+			user, err = f.r.User.GetUser(ctx, nick)
+			expectNoError(t, err)
+			if user.Nickname != "Ali" {
+				t.Fatalf("GetUser(%s) = %+v", nick, user)
+			}
+		}
+
+		// действующий псевдоним держит nickname до expires
+		users, err := f.r.User.AddUser(ctx, models.User{Nickname: "ALICE", Fullname: "Another Alice", Email: "another@example.com"})
+		expectKind(t, err, errs.KindConflict)
+		if got := nicknames(users); len(got) != 1 || got[0] != "Ali" {
+			t.Fatalf("AddUser(alice) while it is an alias = %v", got)
+		}
+		_, err = f.r.User.RenameUser(ctx, "bob", "Alicia", expires)
+		expectKind(t, err, errs.KindConflict)
+		user, err = f.r.User.GetUser(ctx, "alicia")
+		expectNoError(t, err)
+		if user.Nickname != "Ali" {
+			t.Fatalf("GetUser(alicia) after rejected takeovers = %+v", user)
+		}
+
+		// свой псевдоним можно вернуть
+		user, err = f.r.User.RenameUser(ctx, "Ali", "alice", expires)
+		expectNoError(t, err)
+		for _, nick := range []string{"alice", "alicia", "ali"} {
+			user, err = f.r.User.GetUser(ctx, nick)
+			expectNoError(t, err)
+			if user.Nickname != "alice" || user.Email != "alice@example.com" {
+				t.Fatalf("GetUser(%s) after renaming back = %+v", nick, user)
+			}
+		}
+
+		// смена только регистра не оставляет псевдонима на самого себя
+		user, err = f.r.User.RenameUser(ctx, "carol", "Carol", expires)
+		expectNoError(t, err)
+		if user.Nickname != "Carol" {
+			t.Fatalf("RenameUser = %+v", user)
+		}
+
+		_, err = f.r.User.RenameUser(ctx, "dave", "david", time.Now().Add(-time.Second))
+		expectNoError(t, err)
+		_, err = f.r.User.GetUser(ctx, "dave")
+		expectKind(t, err, errs.KindNotFound)
+
+		// просроченный псевдоним nickname не держит
+		user, err = f.r.User.RenameUser(ctx, "bob", "Dave", expires)
+		expectNoError(t, err)
+		if user.Nickname != "Dave" {
+			t.Fatalf("RenameUser into an expired alias = %+v", user)
+		}
+		_, err = f.r.User.RenameUser(ctx, "david", "dave2", time.Now().Add(-time.Second))
+		expectNoError(t, err)
+		_, err = f.r.User.AddUser(ctx, models.User{Nickname: "david", Fullname: "Another David", Email: "another@example.com"})
+		expectNoError(t, err)
+	},
+	"DeleteUserPlaceholder": func(t *testing.T, r Repositories) {
+		f := newFixture(t, r)
+		kraken := f.thread(t, "kraken", "alice", day(1))
+
+		// настоящий аккаунт с nickname заглушки записи удалённых не получает
+		impostor := models.User{Nickname: "Deleted", Fullname: "Real person", Email: "real@example.com"}
+		_, err := f.r.User.AddUser(ctx, impostor)
+		expectNoError(t, err)
+		expectKind(t, f.r.User.DeleteUser(ctx, "alice"), errs.KindInternal)
+
+		// адрес заглушки у другого аккаунта тоже останавливает удаление
+		_, err = f.r.User.RenameUser(ctx, "Deleted", "person", time.Now().Add(-time.Second))
+		expectNoError(t, err)
+		_, err = f.r.User.AddUser(ctx, models.User{Nickname: "eve", Fullname: "Eve", Email: models.DeletedUserEmail})
+		expectNoError(t, err)
+		expectKind(t, f.r.User.DeleteUser(ctx, "alice"), errs.KindConflict)
+
+		_, err = f.r.User.GetUser(ctx, "alice")
+		expectNoError(t, err)
+		thread, err := f.r.Thread.GetThreadInfoById(ctx, int(kraken.Id))
+		expectNoError(t, err)
+		if thread.Author != "alice" {
+			t.Fatalf("thread author after failed deletes %q", thread.Author)
+		}
+	},
+	"DeleteUser": func(t *testing.T, r Repositories) {
+		f := newFixture(t, r)
+		kraken := f.thread(t, "kraken", "alice", day(1))
+		other := f.thread(t, "other", "bob", day(2))
+		ids := postTree(t, f, kraken)
+		for _, vote := range []models.Vote{{Nickname: "alice", Voice: 1}, {Nickname: "bob", Voice: 1}} {
+			expectNoError(t, f.r.Thread.SetVote(ctx, vote, int(kraken.Id)))
+		}
+		expectNoError(t, f.r.Thread.SetVote(ctx, models.Vote{Nickname: "ALICE", Voice: -1}, int(other.Id)))
+		_, err := f.r.User.RenameUser(ctx, "alice", "alicia", time.Now().Add(time.Hour))
+		expectNoError(t, err)
+
+		expectNoError(t, f.r.User.DeleteUser(ctx, "ALICIA"))
+
+		for _, nick := range []string{"alicia", "alice"} {
+			_, err = f.r.User.GetUser(ctx, nick)
+			expectKind(t, err, errs.KindNotFound)
+		}
+		placeholder, err := f.r.User.GetUser(ctx, models.DeletedUser)
+		expectNoError(t, err)
+		if placeholder != (models.User{Nickname: models.DeletedUser, Fullname: models.DeletedUserFullname, Email: models.DeletedUserEmail}) {
+			t.Fatalf("placeholder %+v", placeholder)
+		}
+
+		forum, err := f.r.Forum.GetForumInfo(ctx, "pirates")
+		expectNoError(t, err)
+		if forum.User != models.DeletedUser || forum.Threads != 2 || forum.Posts != 8 {
+			t.Fatalf("forum after delete %+v", forum)
+		}
+		for _, tc := range []struct {
+			thread models.Thread
+			author string
+			votes  int64
+		}{
+			{kraken, models.DeletedUser, 1},
+			{other, "Bob", 0},
+		} {
+			thread, err := f.r.Thread.GetThreadInfoById(ctx, int(tc.thread.Id))
+			expectNoError(t, err)
+			if thread.Author != tc.author || thread.Votes != tc.votes {
+				t.Fatalf("thread %s after delete: author %q, votes %d", thread.Slug, thread.Author, thread.Votes)
+			}
+		}
+
+		posts, err := f.r.Post.GetPostsTree(ctx, int(kraken.Id), 100, 0, false)
+		expectNoError(t, err)
+		if got, want := postIds(posts), named(ids, "r1", "c1", "g1", "c3", "r2", "c2", "r3", "c4"); !equalInts(got, want) {
+			t.Fatalf("tree after delete %v, want %v", got, want)
+		}
+		for _, p := range posts {
+			if p.Id == ids["r1"] && p.Author != models.DeletedUser || p.Id == ids["c3"] && p.Author != "bob" {
+				t.Fatalf("post %d author %q", p.Id, p.Author)
+			}
+		}
+
+		members, err := f.r.Forum.FindUsers(ctx, "pirates", models.ParamsForSearch{Limit: 100})
+		expectNoError(t, err)
+		if got := nicknames(members); !equalStrings(got, []string{"Bob", "carol", "dave"}) {
+			t.Fatalf("forum users after delete %v", got)
+		}
+
+		expectKind(t, f.r.User.DeleteUser(ctx, "alicia"), errs.KindNotFound)
+		expectNoError(t, f.r.User.DeleteUser(ctx, "bob"))
+		status, err := f.r.Service.GetStatus(ctx)
+		expectNoError(t, err)
+		if status.User != 3 || status.Post != 8 || status.Thread != 2 {
+			t.Fatalf("status after delete %+v", status)
+		}
+		thread, err := f.r.Thread.GetThreadInfoById(ctx, int(kraken.Id))
+		expectNoError(t, err)
+		if thread.Votes != 0 {
+			t.Fatalf("votes after both voters are deleted %d", thread.Votes)
+		}
+	},
+	"Export": func(t *testing.T, r Repositories) {
+		f := newFixture(t, r)
+		kraken := f.thread(t, "kraken", "bob", day(2))
+		anonymous := f.thread(t, "", "ALICE", day(3))
+		early := f.thread(t, "early", "alice", day(1))
+		f.forum = f.newForum(t, "Sailors", "bob")
+		other := f.thread(t, "other", "bob", day(4))
+		f.posts(t, kraken, post("bob", 0, "noise"))
+		posts := f.posts(t, other, post("alice", 0, "a1"), post("Alice", 0, "a2"))
+		for _, vote := range []struct {
+			thread models.Thread
+			voice  float32
+		}{{other, 1}, {anonymous, -1}, {kraken, 1}} {
+			expectNoError(t, f.r.Thread.SetVote(ctx, models.Vote{Nickname: "alice", Voice: vote.voice}, int(vote.thread.Id)))
+		}
+
+		var threads []models.Thread
+		expectNoError(t, f.r.User.ExportThreads(ctx, "alice", func(thread models.Thread) error {
+			threads = append(threads, thread)
+			return nil
+		}))
+		if got := threadSlugs(threads); !equalStrings(got, []string{"early", ""}) || threads[1].Id != anonymous.Id || threads[1].Votes != -1 {
+			t.Fatalf("exported threads %+v", threads)
+		}
+		if threads[0].Id != early.Id || threads[0].Message != early.Message || !threads[0].Created.Equal(day(1)) {
+			t.Fatalf("exported thread %+v", threads[0])
+		}
+
+		var exported []models.UserExportPost
+		expectNoError(t, f.r.User.ExportPosts(ctx, "ALICE", func(post models.UserExportPost) error {
+			exported = append(exported, post)
+			return nil
+		}))
+		if len(exported) != 2 || exported[0].Id != posts[0].Id || exported[1].Id != posts[1].Id {
+			t.Fatalf("exported posts %+v", exported)
+		}
+		if p := exported[1]; p.Message != "a2" || p.Thread != int(other.Id) || p.Forum != "Sailors" ||
+			p.ThreadTitle != other.Title || p.ThreadSlug != "other" || p.ForumTitle != "Forum Sailors" {
+			t.Fatalf("exported post %+v", p)
+		}
+
+		var votes []models.UserExportVote
+		expectNoError(t, f.r.User.ExportVotes(ctx, "alice", func(vote models.UserExportVote) error {
+			votes = append(votes, vote)
+			return nil
+		}))
+		want := []models.UserExportVote{
+			{Thread: kraken.Id, ThreadSlug: "kraken", Forum: "Pirates", Voice: 1},
+			{Thread: anonymous.Id, Forum: "Pirates", Voice: -1},
+			{Thread: other.Id, ThreadSlug: "other", Forum: "Sailors", Voice: 1},
+		}
+		if len(votes) != len(want) {
+			t.Fatalf("exported votes %+v", votes)
+		}
+		for i := range want {
+			if votes[i] != want[i] {
+				t.Fatalf("exported vote %+v, want %+v", votes[i], want[i])
+			}
+		}
+
+		var forums []models.Forum
+		expectNoError(t, f.r.User.ExportForums(ctx, "alice", func(forum models.Forum) error {
+			forums = append(forums, forum)
+			return nil
+		}))
+		if len(forums) != 2 || forums[0].Slug != "Pirates" || forums[0].Threads != 3 || forums[1].Slug != "Sailors" || forums[1].Posts != 2 {
+			t.Fatalf("exported forums %+v", forums)
+		}
+
+		// ошибка получателя останавливает выгрузку
+		calls := 0
+		err := f.r.User.ExportPosts(ctx, "alice", func(models.UserExportPost) error {
+			calls++
+			return errs.Invalid("stop")
+		})
+		if err == nil || calls != 1 {
+			t.Fatalf("ExportPosts after a failed callback: %v, %d calls", err, calls)
+		}
+
+		expectNoError(t, f.r.User.ExportThreads(ctx, "carol", func(thread models.Thread) error {
+			t.Fatalf("carol has no threads, got %+v", thread)
+			return nil
+		}))
+	},
+	"Admin": func(t *testing.T, r Repositories) {
+		f := newFixture(t, r)
+		admins := func(want ...string) {
+			t.Helper()
+			users, err := f.r.User.FindAdmins(ctx)
+			expectNoError(t, err)
+			if got := nicknames(users); !equalStrings(got, want) {
+				t.Fatalf("admins %v, want %v", got, want)
+			}
+		}
+		isAdmin := func(nick string, want bool) {
+			t.Helper()
+			admin, err := f.r.User.IsAdmin(ctx, nick)
+			expectNoError(t, err)
+			if admin != want {
+				t.Fatalf("IsAdmin(%s) = %v, want %v", nick, admin, want)
+			}
+		}
+
+		admins()
+		expectKind(t, f.r.User.SetAdmin(ctx, "nobody", true), errs.KindNotFound)
+		expectNoError(t, f.r.User.SetAdmin(ctx, "ALICE", true))
+		expectNoError(t, f.r.User.SetAdmin(ctx, "alice", true))
+		expectNoError(t, f.r.User.SetAdmin(ctx, "bob", true))
+		admins("alice", "Bob")
+		isAdmin("Alice", true)
+		isAdmin("carol", false)
+		isAdmin("nobody", false)
+
+		// роль переходит с nickname, старый nickname и его новый владелец (после
+		// того как псевдоним истёк) её не получают
+		_, err := f.r.User.RenameUser(ctx, "alice", "alicia", time.Now().Add(-time.Second))
+		expectNoError(t, err)
+		isAdmin("alicia", true)
+		isAdmin("alice", false)
+		_, err = f.r.User.AddUser(ctx, models.User{Nickname: "alice", Fullname: "impostor", Email: "impostor@example.com"})
+		expectNoError(t, err)
+		isAdmin("alice", false)
+		admins("alicia", "Bob")
+
+		// и пропадает с аккаунтом
+		expectNoError(t, f.r.User.DeleteUser(ctx, "bob"))
+		f.user(t, "bob")
+		isAdmin("bob", false)
+		_, err = f.r.Service.MergeUsers(ctx, models.UserMerge{Into: "carol", From: "alicia", Votes: models.MergeVotesKeep})
+		expectNoError(t, err)
+		isAdmin("carol", false)
+		admins()
+
+		expectNoError(t, f.r.User.SetAdmin(ctx, "dave", true))
+		expectNoError(t, f.r.User.SetAdmin(ctx, "Dave", false))
+		expectNoError(t, f.r.User.SetAdmin(ctx, "dave", false))
+		expectKind(t, f.r.User.SetAdmin(ctx, "nobody", false), errs.KindNotFound)
+		admins()
+	},
+}
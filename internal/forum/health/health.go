@@ -0,0 +1,119 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CheckTimeout время, за которое должны уложиться все проверки готовности.
+const CheckTimeout = 2 * time.Second
+
+type CheckFunc func(ctx context.Context) error
+
+type check struct {
+	name string
+	fn   CheckFunc
+}
+
+// Health отвечает на /healthz (процесс жив) и /readyz (сервис готов принимать
+// запросы). Готовность пропадает, как только начинается остановка сервера.
+type Health struct {
+	mu           sync.RWMutex
+	checks       []check
+	shuttingDown int32
+}
+
+type CheckResult struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type Report struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+const (
+	statusOk   = "ok"
+	statusFail = "fail"
+)
+
+func (h *Health) AddCheck(name string, fn CheckFunc) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.checks = append(h.checks, check{name: name, fn: fn})
+}
+
+func (h *Health) SetShuttingDown() {
+	atomic.StoreInt32(&h.shuttingDown, 1)
+}
+
+func (h *Health) SetHandlers(router *mux.Router) {
+	router.HandleFunc("/healthz", h.Liveness).Methods(http.MethodGet)
+	router.HandleFunc("/readyz", h.Readiness).Methods(http.MethodGet)
+}
+
+func (h *Health) Liveness(w http.ResponseWriter, r *http.Request) {
+	writeReport(w, http.StatusOK, Report{Status: statusOk})
+}
+
+func (h *Health) Readiness(w http.ResponseWriter, r *http.Request) {
+	report := h.Check(r.Context())
+
+	code := http.StatusOK
+	if report.Status != statusOk {
+		code = http.StatusServiceUnavailable
+	}
+	writeReport(w, code, report)
+}
+
+// Check выполняет все проверки параллельно.
+func (h *Health) Check(ctx context.Context) Report {
+	ctx, cancel := context.WithTimeout(ctx, CheckTimeout)
+	defer cancel()
+
+	h.mu.RLock()
+	checks := append([]check(nil), h.checks...)
+	h.mu.RUnlock()
+
+	report := Report{Status: statusOk, Checks: make(map[string]CheckResult, len(checks)+1)}
+	if atomic.LoadInt32(&h.shuttingDown) == 1 {
+		report.Status = statusFail
+		report.Checks["shutdown"] = CheckResult{Status: statusFail, Error: "server is shutting down"}
+	}
+
+	results := make([]CheckResult, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c check) {
+			defer wg.Done()
+			results[i] = CheckResult{Status: statusOk}
+			if err := c.fn(ctx); err != nil {
+				results[i] = CheckResult{Status: statusFail, Error: err.Error()}
+			}
+		}(i, c)
+	}
+	wg.Wait()
+
+	for i, c := range checks {
+		report.Checks[c.name] = results[i]
+		if results[i].Status != statusOk {
+			report.Status = statusFail
+		}
+	}
+
+	return report
+}
+
+func writeReport(w http.ResponseWriter, code int, report Report) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(report)
+}
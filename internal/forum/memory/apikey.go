@@ -0,0 +1,96 @@
+package memory
+
+import (
+	"context"
+	"forum/internal/utils/errs"
+	"forum/pkg/models"
+	"sort"
+	"time"
+)
+
+type KeyRepository struct {
+	DB *Store
+}
+
+func (k KeyRepository) AddKey(ctx context.Context, key models.APIKey) (models.APIKey, error) {
+	k.DB.mu.Lock()
+	defer k.DB.mu.Unlock()
+
+	user, ok := k.DB.users[fold(key.Nickname)]
+	if !ok {
+		return models.APIKey{}, errs.NotFound(models.MissingUser)
+	}
+	if _, ok := k.DB.keyHashes[key.Hash]; ok {
+		return models.APIKey{}, errs.Conflict("already exists")
+	}
+
+	k.DB.keySerial++
+	key.Id, key.Nickname, key.LastUsed = k.DB.keySerial, user.Nickname, nil
+	stored := key
+	stored.Key = ""
+	stored.Scopes = append([]string(nil), key.Scopes...)
+	k.DB.keys[key.Id] = &stored
+	k.DB.keyHashes[key.Hash] = key.Id
+	return key, nil
+}
+
+// copyKey ключ без хэша и без общих с хранилищем срезов и указателей, как
+// строка из SELECT.
+func copyKey(stored *models.APIKey) models.APIKey {
+	key := *stored
+	key.Hash = ""
+	key.Scopes = append([]string(nil), stored.Scopes...)
+	if stored.LastUsed != nil {
+		used := *stored.LastUsed
+		key.LastUsed = &used
+	}
+	return key
+}
+
+func (k KeyRepository) FindKeys(ctx context.Context, nickname string) ([]models.APIKey, error) {
+	k.DB.mu.RLock()
+	defer k.DB.mu.RUnlock()
+
+	keys := []models.APIKey{}
+	for _, key := range k.DB.keys {
+		if fold(key.Nickname) == fold(nickname) {
+			keys = append(keys, copyKey(key))
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Id < keys[j].Id })
+	return keys, nil
+}
+
+func (k KeyRepository) GetKeyByHash(ctx context.Context, hash string) (models.APIKey, error) {
+	k.DB.mu.RLock()
+	defer k.DB.mu.RUnlock()
+
+	id, ok := k.DB.keyHashes[hash]
+	if !ok {
+		return models.APIKey{}, errs.NotFound(models.MissingKey)
+	}
+	return copyKey(k.DB.keys[id]), nil
+}
+
+func (k KeyRepository) DeleteKey(ctx context.Context, nickname string, id int) error {
+	k.DB.mu.Lock()
+	defer k.DB.mu.Unlock()
+
+	key, ok := k.DB.keys[id]
+	if !ok || fold(key.Nickname) != fold(nickname) {
+		return errs.NotFound(models.MissingKey)
+	}
+	delete(k.DB.keyHashes, key.Hash)
+	delete(k.DB.keys, id)
+	return nil
+}
+
+func (k KeyRepository) TouchKey(ctx context.Context, id int, used time.Time) error {
+	k.DB.mu.Lock()
+	defer k.DB.mu.Unlock()
+
+	if key, ok := k.DB.keys[id]; ok {
+		key.LastUsed = &used
+	}
+	return nil
+}
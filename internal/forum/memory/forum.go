@@ -0,0 +1,207 @@
+package memory
+
+import (
+	"context"
+	"forum/internal/utils/errs"
+	"forum/pkg/models"
+	"sort"
+	"strings"
+)
+
+type ForumRepository struct {
+	DB *Store
+}
+
+func (r ForumRepository) FindUsers(ctx context.Context, slug string, params models.ParamsForSearch) ([]models.User, error) {
+	r.DB.mu.RLock()
+	defer r.DB.mu.RUnlock()
+
+	var users []models.User
+	for nick := range r.DB.forumUsers[fold(slug)] {
+		user := r.DB.users[nick]
+		if params.Since != "" {
+			if params.Desc && fold(user.Nickname) >= fold(params.Since) ||
+				!params.Desc && fold(user.Nickname) <= fold(params.Since) {
+				continue
+			}
+		}
+		users = append(users, *user)
+	}
+
+	sort.Slice(users, func(i, j int) bool {
+		if params.Desc {
+			return fold(users[i].Nickname) > fold(users[j].Nickname)
+		}
+		return fold(users[i].Nickname) < fold(users[j].Nickname)
+	})
+
+	n, err := limitOf(len(users), params.Limit)
+	if err != nil || n == 0 {
+		return nil, err
+	}
+	return users[:n], nil
+}
+
+func (r ForumRepository) CreateForum(ctx context.Context, forum models.Forum) (models.Forum, error) {
+	r.DB.mu.Lock()
+	defer r.DB.mu.Unlock()
+
+	user, ok := r.DB.users[fold(forum.User)]
+	if !ok {
+		return forum, errs.NotFound(models.ErrUserUnknown)
+	}
+	if _, ok = r.DB.forums[fold(forum.Slug)]; ok {
+		return forum, errs.Conflict("already exists")
+	}
+
+	forum.User = user.Nickname
+	stored := models.Forum{Title: forum.Title, User: forum.User, Slug: forum.Slug}
+	r.DB.forums[fold(forum.Slug)] = &stored
+	r.DB.forumOrder = append(r.DB.forumOrder, fold(forum.Slug))
+	return forum, nil
+}
+
+func (r ForumRepository) GetForumInfo(ctx context.Context, slug string) (models.Forum, error) {
+	r.DB.mu.RLock()
+	defer r.DB.mu.RUnlock()
+
+	forum, ok := r.DB.forums[fold(slug)]
+	if !ok {
+		return models.Forum{}, errs.NotFound(models.ErrForumNotFound)
+	}
+	return *forum, nil
+}
+
+func (r ForumRepository) AddModerator(ctx context.Context, slug string, nickname string) error {
+	r.DB.mu.Lock()
+	defer r.DB.mu.Unlock()
+
+	if _, ok := r.DB.forums[fold(slug)]; !ok {
+		return errs.NotFound(models.ErrForumNotFound)
+	}
+	if _, ok := r.DB.users[fold(nickname)]; !ok {
+		return errs.NotFound(models.ErrForumNotFound)
+	}
+	moderators, ok := r.DB.moderators[fold(slug)]
+	if !ok {
+		moderators = make(map[string]bool)
+		r.DB.moderators[fold(slug)] = moderators
+	}
+	moderators[fold(nickname)] = true
+	return nil
+}
+
+func (r ForumRepository) RemoveModerator(ctx context.Context, slug string, nickname string) error {
+	r.DB.mu.Lock()
+	defer r.DB.mu.Unlock()
+
+	moderators := r.DB.moderators[fold(slug)]
+	if !moderators[fold(nickname)] {
+		return errs.NotFound(models.ErrNotAppointed)
+	}
+	delete(moderators, fold(nickname))
+	return nil
+}
+
+func (r ForumRepository) FindModerators(ctx context.Context, slug string) ([]models.User, error) {
+	r.DB.mu.RLock()
+	defer r.DB.mu.RUnlock()
+
+	users := []models.User{}
+	for nick := range r.DB.moderators[fold(slug)] {
+		users = append(users, *r.DB.users[nick])
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return fold(users[i].Nickname) < fold(users[j].Nickname)
+	})
+	return users, nil
+}
+
+func (r ForumRepository) IsModerator(ctx context.Context, slug string, nickname string) (bool, error) {
+	r.DB.mu.RLock()
+	defer r.DB.mu.RUnlock()
+
+	return r.DB.moderators[fold(slug)][fold(nickname)], nil
+}
+
+// FindForums повторяет запросы SelectForumsBy*: порядок по ключу сортировки,
+// равные по slug, страница начинается после форума params.Since.
+func (r ForumRepository) FindForums(ctx context.Context, params models.ForumSearch) ([]models.Forum, error) {
+	r.DB.mu.RLock()
+	defer r.DB.mu.RUnlock()
+
+	created := make(map[string]int, len(r.DB.forumOrder))
+	for i, slug := range r.DB.forumOrder {
+		created[slug] = i
+	}
+	var key func(forum *models.Forum) int64
+	switch params.Sort {
+	case models.ForumSortSlug:
+		key = func(*models.Forum) int64 { return 0 }
+	case models.ForumSortPosts:
+		key = func(forum *models.Forum) int64 { return forum.Posts }
+	case models.ForumSortThreads:
+		key = func(forum *models.Forum) int64 { return forum.Threads }
+	case models.ForumSortCreated:
+		key = func(forum *models.Forum) int64 { return int64(created[fold(forum.Slug)]) }
+	default:
+		return nil, errs.Invalid(models.ErrForumSort)
+	}
+	less := func(a, b *models.Forum) bool {
+		if ka, kb := key(a), key(b); ka != kb {
+			return ka < kb
+		}
+		return fold(a.Slug) < fold(b.Slug)
+	}
+	if params.Desc {
+		asc := less
+		less = func(a, b *models.Forum) bool { return asc(b, a) }
+	}
+
+	// по slug страница продолжается и после несуществующего форума, как в Postgres
+	var since *models.Forum
+	if params.Since != "" {
+		since = r.DB.forums[fold(params.Since)]
+		if since == nil && params.Sort == models.ForumSortSlug {
+			since = &models.Forum{Slug: params.Since}
+		}
+	}
+
+	prefix := fold(params.Query)
+	var found []*models.Forum
+	for _, forum := range r.DB.forums {
+		if !strings.HasPrefix(fold(forum.Title), prefix) {
+			continue
+		}
+		if params.Since != "" && (since == nil || !less(since, forum)) {
+			continue
+		}
+		found = append(found, forum)
+	}
+	sort.Slice(found, func(i, j int) bool {
+		return less(found[i], found[j])
+	})
+
+	n, err := limitOf(len(found), params.Limit)
+	if err != nil {
+		return nil, err
+	}
+	forums := make([]models.Forum, 0, n)
+	for _, forum := range found[:n] {
+		forums = append(forums, *forum)
+	}
+	return forums, nil
+}
+
+func (r ForumRepository) CountForums(ctx context.Context, query string) (int64, error) {
+	r.DB.mu.RLock()
+	defer r.DB.mu.RUnlock()
+
+	var count int64
+	for _, forum := range r.DB.forums {
+		if strings.HasPrefix(fold(forum.Title), fold(query)) {
+			count++
+		}
+	}
+	return count, nil
+}
@@ -0,0 +1,20 @@
+package memory
+
+import (
+	"forum/internal/forum/contract"
+	"testing"
+)
+
+func TestContract(t *testing.T) {
+	contract.Run(t, func(t *testing.T) contract.Repositories {
+		store := NewStore()
+		return contract.Repositories{
+			User:    &UserRepository{DB: store},
+			Forum:   &ForumRepository{DB: store},
+			Thread:  &ThreadRepository{DB: store},
+			Post:    &PostRepository{DB: store},
+			Service: ServiceRepository{DB: store},
+			Key:     KeyRepository{DB: store},
+		}
+	})
+}
@@ -0,0 +1,311 @@
+package memory
+
+import (
+	"context"
+	"forum/internal/utils/errs"
+	"forum/pkg/models"
+	"sort"
+	"time"
+)
+
+type PostRepository struct {
+	DB *Store
+}
+
+// comparePaths сравнивает материализованные пути как массивы INT[] в Postgres.
+func comparePaths(a, b []int) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			if a[i] < b[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return len(a) - len(b)
+}
+
+func (p PostRepository) threadPosts(id int) []*postRow {
+	var posts []*postRow
+	for _, postId := range p.DB.threadPosts[id] {
+		posts = append(posts, p.DB.posts[postId])
+	}
+	return posts
+}
+
+func collect(posts []*postRow, max int) ([]models.Post, error) {
+	n, err := limitOf(len(posts), max)
+	if err != nil || n == 0 {
+		return nil, err
+	}
+
+	result := make([]models.Post, 0, n)
+	for _, post := range posts[:n] {
+		result = append(result, post.Post)
+	}
+	return result, nil
+}
+
+func (p PostRepository) GetAllPostByThread(ctx context.Context, id int, limit int, since int, desc bool) ([]models.Post, error) {
+	p.DB.mu.RLock()
+	defer p.DB.mu.RUnlock()
+
+	var posts []*postRow
+	for _, post := range p.threadPosts(id) {
+		if since != 0 && (desc && post.Id >= since || !desc && post.Id <= since) {
+			continue
+		}
+		posts = append(posts, post)
+	}
+
+	sort.Slice(posts, func(i, j int) bool {
+		if desc {
+			return posts[i].Id > posts[j].Id
+		}
+		return posts[i].Id < posts[j].Id
+	})
+	return collect(posts, limit)
+}
+
+func (p PostRepository) FindPostsByUser(ctx context.Context, nickname string, params models.UserPostsParams) ([]models.Post, error) {
+	p.DB.mu.RLock()
+	defer p.DB.mu.RUnlock()
+
+	var posts []*postRow
+	for _, post := range p.DB.posts {
+		if fold(post.Author) != fold(nickname) || params.Forum != "" && fold(post.Forum) != fold(params.Forum) {
+			continue
+		}
+		if params.Since != 0 && (params.Desc && post.Id >= params.Since || !params.Desc && post.Id <= params.Since) {
+			continue
+		}
+		posts = append(posts, post)
+	}
+
+	sort.Slice(posts, func(i, j int) bool {
+		if params.Desc {
+			return posts[i].Id > posts[j].Id
+		}
+		return posts[i].Id < posts[j].Id
+	})
+	return collect(posts, params.Limit)
+}
+
+func (p PostRepository) GetPostsTree(ctx context.Context, id int, limit int, since int, desc bool) ([]models.Post, error) {
+	p.DB.mu.RLock()
+	defer p.DB.mu.RUnlock()
+
+	var sincePath []int
+	if since != 0 {
+		sincePost, ok := p.DB.posts[since]
+		if !ok {
+			return nil, nil
+		}
+		sincePath = sincePost.path
+	}
+
+	var posts []*postRow
+	for _, post := range p.threadPosts(id) {
+		if since != 0 {
+			cmp := comparePaths(post.path, sincePath)
+			if desc && cmp >= 0 || !desc && cmp <= 0 {
+				continue
+			}
+		}
+		posts = append(posts, post)
+	}
+
+	sort.Slice(posts, func(i, j int) bool {
+		cmp := comparePaths(posts[i].path, posts[j].path)
+		if cmp == 0 {
+			cmp = posts[i].Id - posts[j].Id
+		}
+		if desc {
+			return cmp > 0
+		}
+		return cmp < 0
+	})
+	return collect(posts, limit)
+}
+
+func (p PostRepository) GetPostsParentTree(ctx context.Context, id int, limit int, since int, desc bool) ([]models.Post, error) {
+	p.DB.mu.RLock()
+	defer p.DB.mu.RUnlock()
+
+	sinceRoot := 0
+	if since != 0 {
+		sincePost, ok := p.DB.posts[since]
+		if !ok {
+			return nil, nil
+		}
+		sinceRoot = sincePost.path[0]
+	}
+
+	var roots []int
+	var posts []*postRow
+	for _, post := range p.threadPosts(id) {
+		posts = append(posts, post)
+		if post.Parent != 0 {
+			continue
+		}
+		if since != 0 && (desc && post.path[0] >= sinceRoot || !desc && post.path[0] <= sinceRoot) {
+			continue
+		}
+		roots = append(roots, post.Id)
+	}
+
+	sort.Slice(roots, func(i, j int) bool {
+		if desc {
+			return roots[i] > roots[j]
+		}
+		return roots[i] < roots[j]
+	})
+	// LIMIT в parent_tree относится к корневым постам, а не к результату.
+	n, err := limitOf(len(roots), limit)
+	if err != nil {
+		return nil, err
+	}
+	selected := make(map[int]bool, n)
+	for _, root := range roots[:n] {
+		selected[root] = true
+	}
+
+	var tree []*postRow
+	for _, post := range posts {
+		if selected[post.path[0]] {
+			tree = append(tree, post)
+		}
+	}
+
+	sort.Slice(tree, func(i, j int) bool {
+		if desc && tree[i].path[0] != tree[j].path[0] {
+			return tree[i].path[0] > tree[j].path[0]
+		}
+		cmp := comparePaths(tree[i].path, tree[j].path)
+		if cmp == 0 {
+			return tree[i].Id < tree[j].Id
+		}
+		return cmp < 0
+	})
+	return collect(tree, len(tree))
+}
+
+func (p PostRepository) GetAllInfo(ctx context.Context, params models.FullPostParams, id int) (models.FullPost, error) {
+	p.DB.mu.RLock()
+	defer p.DB.mu.RUnlock()
+
+	stored, ok := p.DB.posts[id]
+	if !ok {
+		return models.FullPost{}, errs.NotFound(models.ErrPostNotFound)
+	}
+	post := stored.Post
+	info := models.FullPost{Post: &post}
+
+	if params.User {
+		user, ok := p.DB.users[fold(post.Author)]
+		if !ok {
+			return models.FullPost{}, errs.NotFound(models.MissingUser)
+		}
+		author := *user
+		info.Author = &author
+	}
+
+	if params.Thread {
+		stored, ok := p.DB.threads[post.Thread]
+		if !ok {
+			return models.FullPost{}, errs.NotFound(models.ErrThreadNotfound)
+		}
+		thread := public(*stored)
+		info.Thread = &thread
+	}
+
+	if params.Forum {
+		stored, ok := p.DB.forums[fold(post.Forum)]
+		if !ok {
+			return models.FullPost{}, errs.NotFound(models.ErrForumNotFound)
+		}
+		forum := *stored
+		info.Forum = &forum
+	}
+
+	return info, nil
+}
+
+func (p PostRepository) ChangePost(ctx context.Context, updateMessage models.PostUpdate, id int) (models.Post, error) {
+	p.DB.mu.Lock()
+	defer p.DB.mu.Unlock()
+
+	post, ok := p.DB.posts[id]
+	if !ok {
+		return models.Post{}, errs.NotFound(models.ErrPostNotFound)
+	}
+	if updateMessage.Message != "" && updateMessage.Message != post.Message {
+		post.Message = updateMessage.Message
+		post.IsEdited = true
+	}
+	return post.Post, nil
+}
+
+// AddPosts вставляет посты одной операцией и повторяет триггер add_post:
+// счётчик постов форума, Users_by_Forum и материализованный путь.
+func (p PostRepository) AddPosts(ctx context.Context, posts models.Posts, threadId int, forumName string) (models.Posts, error) {
+	if len(posts) == 0 {
+		return models.Posts{}, nil
+	}
+
+	p.DB.mu.Lock()
+	defer p.DB.mu.Unlock()
+
+	for _, post := range posts {
+		if post.Parent == 0 {
+			continue
+		}
+		parent, ok := p.DB.posts[int(post.Parent)]
+		if !ok || parent.Thread != threadId {
+			return nil, errs.Conflict(models.ErrParentMissing)
+		}
+	}
+	for _, post := range posts {
+		if _, ok := p.DB.users[fold(post.Author)]; !ok {
+			return nil, errs.NotFound(models.ErrUserUnknown)
+		}
+	}
+	forum, ok := p.DB.forums[fold(forumName)]
+	if !ok {
+		return nil, errs.NotFound(models.ErrUserUnknown)
+	}
+	if _, ok = p.DB.threads[threadId]; !ok {
+		return nil, errs.NotFound(models.ErrUserUnknown)
+	}
+
+	// now() в Postgres одна на транзакцию и хранится с точностью до микросекунд.
+	created := time.Now().Truncate(time.Microsecond)
+	inserted := make(models.Posts, 0, len(posts))
+	for _, post := range posts {
+		p.DB.postSerial++
+		stored := &models.Post{
+			Id:      p.DB.postSerial,
+			Parent:  post.Parent,
+			Author:  post.Author,
+			Message: post.Message,
+			Forum:   forumName,
+			Thread:  threadId,
+			Created: created,
+		}
+
+		var path []int
+		if parent, ok := p.DB.posts[int(post.Parent)]; ok {
+			path = append(path, parent.path...)
+		}
+		path = append(path, stored.Id)
+
+		p.DB.posts[stored.Id] = &postRow{Post: *stored, path: path}
+		p.DB.threadPosts[threadId] = append(p.DB.threadPosts[threadId], stored.Id)
+		forum.Posts++
+		p.DB.addForumUser(forumName, post.Author)
+
+		inserted = append(inserted, *stored)
+	}
+
+	return inserted, nil
+}
@@ -0,0 +1,207 @@
+package memory
+
+import (
+	"context"
+	"forum/internal/utils/errs"
+	"forum/pkg/models"
+)
+
+type ServiceRepository struct {
+	DB *Store
+}
+
+// CleanDb очищает таблицы или удаляет один форум, как clean_forum из миграции 0012;
+// счётчики id, как и последовательности после TRUNCATE, не сбрасываются.
+func (r ServiceRepository) CleanDb(ctx context.Context, clean models.Clean) (models.CleanReport, error) {
+	r.DB.mu.Lock()
+	defer r.DB.mu.Unlock()
+
+	report := models.CleanReport{DryRun: clean.DryRun}
+	if clean.Forum == "" {
+		report.Users = int64(len(r.DB.users))
+		report.Forums = int64(len(r.DB.forums))
+		report.Threads = int64(len(r.DB.threads))
+		report.Posts = int64(len(r.DB.posts))
+		report.Votes = int64(len(r.DB.votes))
+		if !clean.DryRun {
+			r.DB.reset()
+		}
+		return report, nil
+	}
+
+	forum, ok := r.DB.forums[fold(clean.Forum)]
+	if !ok {
+		return models.CleanReport{}, errs.NotFound(models.ErrForumNotFound)
+	}
+	slug := fold(forum.Slug)
+	report.Forum, report.Forums = forum.Slug, 1
+
+	removed := make(map[int]bool)
+	for id, thread := range r.DB.threads {
+		if fold(thread.Forum) == slug {
+			removed[id] = true
+			report.Threads++
+			report.Posts += int64(len(r.DB.threadPosts[id]))
+		}
+	}
+	for key := range r.DB.votes {
+		if removed[key.thread] {
+			report.Votes++
+		}
+	}
+	if clean.DryRun {
+		return report, nil
+	}
+
+	for key := range r.DB.votes {
+		if removed[key.thread] {
+			delete(r.DB.votes, key)
+		}
+	}
+	for id := range removed {
+		for _, postId := range r.DB.threadPosts[id] {
+			delete(r.DB.posts, postId)
+		}
+		delete(r.DB.threadPosts, id)
+		delete(r.DB.threadSlugs, fold(r.DB.threads[id].Slug))
+		delete(r.DB.threads, id)
+	}
+	order := r.DB.threadOrder[:0]
+	for _, id := range r.DB.threadOrder {
+		if !removed[id] {
+			order = append(order, id)
+		}
+	}
+	r.DB.threadOrder = order
+
+	for i, key := range r.DB.forumOrder {
+		if key == slug {
+			r.DB.forumOrder = append(r.DB.forumOrder[:i], r.DB.forumOrder[i+1:]...)
+			break
+		}
+	}
+	delete(r.DB.forumUsers, slug)
+	delete(r.DB.moderators, slug)
+	delete(r.DB.forums, slug)
+	return report, nil
+}
+
+func (r ServiceRepository) GetStatus(ctx context.Context) (models.Status, error) {
+	r.DB.mu.RLock()
+	defer r.DB.mu.RUnlock()
+
+	return models.Status{
+		User:   int32(len(r.DB.users)),
+		Forum:  int32(len(r.DB.forums)),
+		Thread: int32(len(r.DB.threads)),
+		Post:   int32(len(r.DB.posts)),
+	}, nil
+}
+
+// MergeUsers повторяет функцию merge_users из миграции 0008.
+func (r ServiceRepository) MergeUsers(ctx context.Context, merge models.UserMerge) (models.UserMergeReport, error) {
+	switch merge.Votes {
+	case models.MergeVotesKeep, models.MergeVotesReplace, models.MergeVotesDrop:
+	default:
+		return models.UserMergeReport{}, errs.Invalid(models.ErrMergeVotes)
+	}
+
+	r.DB.mu.Lock()
+	defer r.DB.mu.Unlock()
+
+	into, ok := r.DB.users[fold(merge.Into)]
+	if !ok {
+		return models.UserMergeReport{}, errs.NotFound(models.MissingUser)
+	}
+	from, ok := r.DB.users[fold(merge.From)]
+	if !ok {
+		return models.UserMergeReport{}, errs.NotFound(models.MissingUser)
+	}
+	a, b := fold(into.Nickname), fold(from.Nickname)
+	if a == b {
+		return models.UserMergeReport{}, errs.Invalid(models.ErrMergeSelf)
+	}
+
+	report := models.UserMergeReport{Into: into.Nickname, From: from.Nickname, Votes: merge.Votes, DryRun: merge.DryRun}
+	for _, thread := range r.DB.threads {
+		if fold(thread.Author) == b {
+			report.Threads++
+		}
+	}
+	for _, post := range r.DB.posts {
+		if fold(post.Author) == b {
+			report.Posts++
+		}
+	}
+	for _, forum := range r.DB.forums {
+		if fold(forum.User) == b {
+			report.Forums++
+		}
+	}
+	for _, members := range r.DB.forumUsers {
+		if members[b] && !members[a] {
+			report.Memberships++
+		}
+	}
+	for key := range r.DB.votes {
+		if key.user != b {
+			continue
+		}
+		if _, ok := r.DB.votes[voteKey{thread: key.thread, user: a}]; ok {
+			report.VoteConflicts++
+		} else {
+			report.VotesMoved++
+		}
+	}
+	if merge.DryRun {
+		return report, nil
+	}
+
+	// Рейтинг ветки меняется на разницу голосов, что равно пересчёту в merge_users.
+	for key, value := range r.DB.votes {
+		if key.user != b {
+			continue
+		}
+		delete(r.DB.votes, key)
+		thread := r.DB.threads[key.thread]
+		kept := voteKey{thread: key.thread, user: a}
+		old, conflict := r.DB.votes[kept]
+		switch {
+		case !conflict || merge.Votes == models.MergeVotesReplace:
+			r.DB.votes[kept] = value
+			thread.Votes -= int64(old)
+		case merge.Votes == models.MergeVotesKeep:
+			thread.Votes -= int64(value)
+		default:
+			delete(r.DB.votes, kept)
+			thread.Votes -= int64(old) + int64(value)
+		}
+	}
+
+	for _, forum := range r.DB.forums {
+		if fold(forum.User) == b {
+			forum.User = into.Nickname
+		}
+	}
+	for _, thread := range r.DB.threads {
+		if fold(thread.Author) == b {
+			thread.Author = into.Nickname
+		}
+	}
+	for _, post := range r.DB.posts {
+		if fold(post.Author) == b {
+			post.Author = into.Nickname
+		}
+	}
+	for _, forums := range []map[string]map[string]bool{r.DB.forumUsers, r.DB.moderators} {
+		for _, members := range forums {
+			if members[b] {
+				delete(members, b)
+				members[a] = true
+			}
+		}
+	}
+
+	r.DB.removeUser(from)
+	return report, nil
+}
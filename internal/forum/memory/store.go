@@ -0,0 +1,144 @@
+package memory
+
+import (
+	"forum/internal/utils/errs"
+	"forum/pkg/models"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Store хранит все таблицы в памяти процесса. Репозитории этого пакета
+// повторяют поведение запросов и триггеров из миграций Postgres, поэтому
+// сервер с --storage=memory отвечает так же, как с базой.
+type Store struct {
+	mu sync.RWMutex
+
+	users      map[string]*models.User // ключ fold(nickname)
+	userEmails map[string]string       // fold(email) -> fold(nickname)
+	userOrder  []string
+	aliases    map[string]userAlias // ключ fold(старый nickname)
+	passwords  map[string]string    // fold(nickname) -> хэш пароля
+	admins     map[string]bool      // fold(nickname) администраторов сайта
+	keys       map[int]*models.APIKey
+	keyHashes  map[string]int
+	keySerial  int
+
+	forums     map[string]*models.Forum // ключ fold(slug)
+	forumOrder []string                 // fold(slug) в порядке создания, как Forum.id
+	forumUsers map[string]map[string]bool
+	moderators map[string]map[string]bool // fold(slug) -> fold(nickname)
+
+	threads      map[int]*models.Thread
+	threadSlugs  map[string]int
+	threadOrder  []int
+	threadSerial int
+
+	posts       map[int]*postRow
+	threadPosts map[int][]int
+	postSerial  int
+
+	votes map[voteKey]int32
+}
+
+type postRow struct {
+	models.Post
+	// Материализованный путь: id всех предков и самого поста, как Post.path в Postgres.
+	path []int
+}
+
+// userAlias строка User_alias: старый nickname находит пользователя до expires.
+type userAlias struct {
+	nickname string // fold(nickname)
+	expires  time.Time
+}
+
+type voteKey struct {
+	thread int
+	user   string
+}
+
+func NewStore() *Store {
+	s := &Store{}
+	s.reset()
+	return s
+}
+
+func (s *Store) reset() {
+	s.users = make(map[string]*models.User)
+	s.userEmails = make(map[string]string)
+	s.userOrder = nil
+	s.aliases = make(map[string]userAlias)
+	s.passwords = make(map[string]string)
+	s.admins = make(map[string]bool)
+	s.keys = make(map[int]*models.APIKey)
+	s.keyHashes = make(map[string]int)
+	s.forums = make(map[string]*models.Forum)
+	s.forumUsers = make(map[string]map[string]bool)
+	s.forumOrder = nil
+	s.moderators = make(map[string]map[string]bool)
+	s.threads = make(map[int]*models.Thread)
+	s.threadSlugs = make(map[string]int)
+	s.threadOrder = nil
+	s.posts = make(map[int]*postRow)
+	s.threadPosts = make(map[int][]int)
+	s.votes = make(map[voteKey]int32)
+}
+
+// fold приводит строку к виду, в котором её сравнивает citext.
+func fold(s string) string {
+	return strings.ToLower(s)
+}
+
+// addForumUser повторяет вставку в Users_by_Forum из триггеров
+// inc_threads_of_forum и add_post.
+func (s *Store) addForumUser(forum, user string) {
+	key := fold(forum)
+	members, ok := s.forumUsers[key]
+	if !ok {
+		members = make(map[string]bool)
+		s.forumUsers[key] = members
+	}
+	members[fold(user)] = true
+}
+
+// removeUser удаляет строку "User" вместе с псевдонимами, паролем, ролью
+// администратора, ключами API и назначениями модератором, как ON DELETE CASCADE.
+func (s *Store) removeUser(user *models.User) {
+	nick := fold(user.Nickname)
+	delete(s.passwords, nick)
+	delete(s.admins, nick)
+	for _, moderators := range s.moderators {
+		delete(moderators, nick)
+	}
+	for id, key := range s.keys {
+		if fold(key.Nickname) == nick {
+			delete(s.keyHashes, key.Hash)
+			delete(s.keys, id)
+		}
+	}
+	for key, alias := range s.aliases {
+		if alias.nickname == nick {
+			delete(s.aliases, key)
+		}
+	}
+	delete(s.userEmails, fold(user.Email))
+	delete(s.users, nick)
+	for i, key := range s.userOrder {
+		if key == nick {
+			s.userOrder = append(s.userOrder[:i], s.userOrder[i+1:]...)
+			break
+		}
+	}
+}
+
+// limitOf обрезает выборку так же, как LIMIT в запросах репозиториев.
+func limitOf(n int, max int) (int, error) {
+	if max < 0 {
+		return 0, errs.Invalid("LIMIT must not be negative")
+	}
+	if n > max {
+		return max, nil
+	}
+	return n, nil
+}
@@ -0,0 +1,230 @@
+package memory
+
+import (
+	"context"
+	"forum/internal/utils/errs"
+	"forum/internal/utils/utils"
+	"forum/pkg/models"
+	"github.com/gofrs/uuid"
+	"sort"
+	"strconv"
+	"time"
+)
+
+type ThreadRepository struct {
+	DB *Store
+}
+
+// public убирает сгенерированный slug, как это делают запросы Postgres-репозитория.
+func public(thread models.Thread) models.Thread {
+	if utils.IsValidUUID(thread.Slug) {
+		thread.Slug = ""
+	}
+	return thread
+}
+
+func (r ThreadRepository) GetThreadIdBySlug(ctx context.Context, slug string) (int, error) {
+	r.DB.mu.RLock()
+	defer r.DB.mu.RUnlock()
+
+	id, ok := r.DB.threadSlugs[fold(slug)]
+	if !ok {
+		return -1, errs.NotFound(models.ErrThreadNotfound)
+	}
+	return id, nil
+}
+
+// SetVote повторяет триггеры add_new_voice и change_voice.
+func (r ThreadRepository) SetVote(ctx context.Context, vote models.Vote, id int) error {
+	r.DB.mu.Lock()
+	defer r.DB.mu.Unlock()
+
+	thread, ok := r.DB.threads[id]
+	if !ok {
+		return errs.NotFound(models.ErrThreadNotfound)
+	}
+	if _, ok = r.DB.users[fold(vote.Nickname)]; !ok {
+		return errs.NotFound(models.ErrThreadNotfound)
+	}
+
+	key := voteKey{thread: id, user: fold(vote.Nickname)}
+	value := int32(vote.Voice)
+	old, voted := r.DB.votes[key]
+	switch {
+	case !voted:
+		thread.Votes += int64(value)
+	case old != value:
+		thread.Votes += int64(value) * 2
+	}
+	r.DB.votes[key] = value
+	return nil
+}
+
+func (r ThreadRepository) UpdateThread(ctx context.Context, update models.ThreadUpdate, slugOrId string) (models.Thread, error) {
+	r.DB.mu.Lock()
+	defer r.DB.mu.Unlock()
+
+	id, err := strconv.Atoi(slugOrId)
+	if err != nil {
+		var ok bool
+		if id, ok = r.DB.threadSlugs[fold(slugOrId)]; !ok {
+			return models.Thread{}, errs.NotFound(models.ErrThreadNotfound)
+		}
+	}
+
+	thread, ok := r.DB.threads[id]
+	if !ok {
+		return models.Thread{}, errs.NotFound(models.ErrThreadNotfound)
+	}
+	if update.Title != "" {
+		thread.Title = update.Title
+	}
+	if update.Message != "" {
+		thread.Message = update.Message
+	}
+	return *thread, nil
+}
+
+func (r ThreadRepository) GetThreadInfoBySlug(ctx context.Context, slug string) (models.Thread, error) {
+	r.DB.mu.RLock()
+	defer r.DB.mu.RUnlock()
+
+	id, ok := r.DB.threadSlugs[fold(slug)]
+	if !ok {
+		return models.Thread{}, errs.NotFound(models.ErrThreadNotfound)
+	}
+	return public(*r.DB.threads[id]), nil
+}
+
+func (r ThreadRepository) GetThreadInfoById(ctx context.Context, id int) (models.Thread, error) {
+	r.DB.mu.RLock()
+	defer r.DB.mu.RUnlock()
+
+	thread, ok := r.DB.threads[id]
+	if !ok {
+		return models.Thread{}, errs.NotFound(models.ErrThreadNotfound)
+	}
+	return public(*thread), nil
+}
+
+func (r ThreadRepository) FindThreads(ctx context.Context, slug string, params models.ParamsForSearch) ([]models.Thread, error) {
+	var since time.Time
+	if params.Since != "" {
+		var err error
+		if since, err = time.Parse(time.RFC3339Nano, params.Since); err != nil {
+			return nil, errs.Wrap(errs.KindInvalid, "invalid input syntax for type timestamp with time zone", err)
+		}
+	}
+
+	r.DB.mu.RLock()
+	defer r.DB.mu.RUnlock()
+
+	var threads []models.Thread
+	for _, id := range r.DB.threadOrder {
+		thread := r.DB.threads[id]
+		if fold(thread.Forum) != fold(slug) {
+			continue
+		}
+		if params.Since != "" {
+			if params.Desc && thread.Created.After(since) || !params.Desc && thread.Created.Before(since) {
+				continue
+			}
+		}
+		threads = append(threads, public(*thread))
+	}
+
+	sort.SliceStable(threads, func(i, j int) bool {
+		if params.Desc {
+			return threads[i].Created.After(threads[j].Created)
+		}
+		return threads[i].Created.Before(threads[j].Created)
+	})
+
+	n, err := limitOf(len(threads), params.Limit)
+	if err != nil || n == 0 {
+		return nil, err
+	}
+	return threads[:n], nil
+}
+
+func (r ThreadRepository) FindThreadsByUser(ctx context.Context, nickname string, params models.UserThreadsParams) ([]models.Thread, error) {
+	var since time.Time
+	if params.Since != "" {
+		var err error
+		if since, err = time.Parse(time.RFC3339Nano, params.Since); err != nil {
+			return nil, errs.Wrap(errs.KindInvalid, "invalid input syntax for type timestamp with time zone", err)
+		}
+	}
+
+	r.DB.mu.RLock()
+	defer r.DB.mu.RUnlock()
+
+	var threads []models.Thread
+	for _, thread := range r.DB.threads {
+		if fold(thread.Author) != fold(nickname) || params.Forum != "" && fold(thread.Forum) != fold(params.Forum) {
+			continue
+		}
+		if params.Since != "" {
+			if params.Desc && thread.Created.After(since) || !params.Desc && thread.Created.Before(since) {
+				continue
+			}
+		}
+		threads = append(threads, public(*thread))
+	}
+
+	sort.Slice(threads, func(i, j int) bool {
+		a, b := threads[i], threads[j]
+		if params.Desc {
+			a, b = b, a
+		}
+		if a.Created.Equal(b.Created) {
+			return a.Id < b.Id
+		}
+		return a.Created.Before(b.Created)
+	})
+
+	n, err := limitOf(len(threads), params.Limit)
+	if err != nil || n == 0 {
+		return nil, err
+	}
+	return threads[:n], nil
+}
+
+// CreateThread повторяет триггер inc_threads_of_forum.
+func (r *ThreadRepository) CreateThread(ctx context.Context, thread models.Thread) (models.Thread, error) {
+	if thread.Slug == "" {
+		gen, _ := uuid.NewV4()
+		thread.Slug = gen.String()
+	}
+
+	r.DB.mu.Lock()
+	defer r.DB.mu.Unlock()
+
+	author, ok := r.DB.users[fold(thread.Author)]
+	if !ok {
+		return public(thread), errs.NotFound(models.ErrUserUnknown)
+	}
+	forum, ok := r.DB.forums[fold(thread.Forum)]
+	if !ok {
+		return public(thread), errs.NotFound(models.ErrUserUnknown)
+	}
+	if _, ok = r.DB.threadSlugs[fold(thread.Slug)]; ok {
+		return public(thread), errs.Conflict("already exists")
+	}
+
+	r.DB.threadSerial++
+	thread.Id = int64(r.DB.threadSerial)
+	thread.Author = author.Nickname
+	thread.Forum = forum.Slug
+	thread.Votes = 0
+
+	stored := thread
+	r.DB.threads[int(thread.Id)] = &stored
+	r.DB.threadSlugs[fold(thread.Slug)] = int(thread.Id)
+	r.DB.threadOrder = append(r.DB.threadOrder, int(thread.Id))
+
+	forum.Threads++
+	r.DB.addForumUser(forum.Slug, author.Nickname)
+
+	return public(thread), nil
+}
@@ -0,0 +1,492 @@
+package memory
+
+import (
+	"context"
+	"forum/internal/utils/errs"
+	"forum/pkg/models"
+	"sort"
+	"strings"
+	"time"
+)
+
+type UserRepository struct {
+	DB *Store
+}
+
+func (u *UserRepository) AddUser(ctx context.Context, user models.User) ([]models.User, error) {
+	u.DB.mu.Lock()
+	defer u.DB.mu.Unlock()
+
+	// nickname держит его владелец или действующий псевдоним (миграция 0015)
+	var users []models.User
+	holder := fold(user.Nickname)
+	if alias, ok := u.liveAlias(holder); ok {
+		holder = alias.nickname
+	}
+	existing, nickTaken := u.DB.users[holder]
+	if nickTaken {
+		users = append(users, *existing)
+	}
+	if nick, ok := u.DB.userEmails[fold(user.Email)]; ok && (!nickTaken || nick != holder) {
+		users = append(users, *u.DB.users[nick])
+	}
+	if len(users) > 0 {
+		return users, errs.Conflict(models.ErrUserExists)
+	}
+
+	stored := user
+	stored.Password, stored.PasswordHash = "", ""
+	if user.PasswordHash != "" {
+		u.DB.passwords[fold(user.Nickname)] = user.PasswordHash
+	}
+	delete(u.DB.aliases, fold(user.Nickname))
+	u.DB.users[fold(user.Nickname)] = &stored
+	u.DB.userEmails[fold(user.Email)] = fold(user.Nickname)
+	u.DB.userOrder = append(u.DB.userOrder, fold(user.Nickname))
+	return []models.User{user}, nil
+}
+
+func (u *UserRepository) ChangeUser(ctx context.Context, user models.User) (models.User, error) {
+	u.DB.mu.Lock()
+	defer u.DB.mu.Unlock()
+
+	stored, ok := u.DB.users[fold(user.Nickname)]
+	if !ok {
+		return models.User{}, errs.NotFound(models.MissingUser)
+	}
+
+	if user.Email != "" {
+		if owner, ok := u.DB.userEmails[fold(user.Email)]; ok && owner != fold(stored.Nickname) {
+			return models.User{}, errs.Conflict(models.ErrUserEmail)
+		}
+		delete(u.DB.userEmails, fold(stored.Email))
+		stored.Email = user.Email
+		u.DB.userEmails[fold(stored.Email)] = fold(stored.Nickname)
+	}
+	if user.Fullname != "" {
+		stored.Fullname = user.Fullname
+	}
+	if user.About != "" {
+		stored.About = user.About
+	}
+	if user.PasswordHash != "" {
+		u.DB.passwords[fold(stored.Nickname)] = user.PasswordHash
+	}
+
+	return *stored, nil
+}
+
+// liveAlias действующий псевдоним key (fold(nickname)). Вызывается под блокировкой.
+func (u UserRepository) liveAlias(key string) (userAlias, bool) {
+	alias, ok := u.DB.aliases[key]
+	return alias, ok && alias.expires.After(time.Now())
+}
+
+// lookupUser находит пользователя по nickname или действующему псевдониму и
+// возвращает его ключ. Вызывается под блокировкой.
+func (u UserRepository) lookupUser(nickname string) (*models.User, string, bool) {
+	key := fold(nickname)
+	if alias, ok := u.liveAlias(key); ok {
+		key = alias.nickname
+	}
+	stored, ok := u.DB.users[key]
+	return stored, key, ok
+}
+
+func (u UserRepository) GetUser(ctx context.Context, nickname string) (models.User, error) {
+	u.DB.mu.RLock()
+	defer u.DB.mu.RUnlock()
+
+	stored, _, ok := u.lookupUser(nickname)
+	if !ok {
+		return models.User{}, errs.NotFound(models.MissingUser)
+	}
+	return *stored, nil
+}
+
+func (u UserRepository) GetUserCredentials(ctx context.Context, nickname string) (models.User, error) {
+	u.DB.mu.RLock()
+	defer u.DB.mu.RUnlock()
+
+	stored, key, ok := u.lookupUser(nickname)
+	if !ok {
+		return models.User{}, errs.NotFound(models.MissingUser)
+	}
+	user := *stored
+	user.PasswordHash = u.DB.passwords[key]
+	return user, nil
+}
+
+// matchUser повторяет условие lower(nickname) LIKE 'prefix%' OR lower(fullname) LIKE 'prefix%'.
+func matchUser(user *models.User, query string) bool {
+	prefix := fold(query)
+	return strings.HasPrefix(fold(user.Nickname), prefix) || strings.HasPrefix(fold(user.Fullname), prefix)
+}
+
+func (u UserRepository) FindUsers(ctx context.Context, params models.UserSearch) ([]models.User, error) {
+	u.DB.mu.RLock()
+	defer u.DB.mu.RUnlock()
+
+	var users []models.User
+	for _, user := range u.DB.users {
+		if !matchUser(user, params.Query) {
+			continue
+		}
+		if params.Since != "" {
+			if params.Desc && fold(user.Nickname) >= fold(params.Since) ||
+				!params.Desc && fold(user.Nickname) <= fold(params.Since) {
+				continue
+			}
+		}
+		users = append(users, *user)
+	}
+
+	sort.Slice(users, func(i, j int) bool {
+		if params.Desc {
+			return fold(users[i].Nickname) > fold(users[j].Nickname)
+		}
+		return fold(users[i].Nickname) < fold(users[j].Nickname)
+	})
+
+	n, err := limitOf(len(users), params.Limit)
+	if err != nil || n == 0 {
+		return nil, err
+	}
+	return users[:n], nil
+}
+
+func (u UserRepository) CountUsers(ctx context.Context, query string) (int64, error) {
+	u.DB.mu.RLock()
+	defer u.DB.mu.RUnlock()
+
+	var count int64
+	for _, user := range u.DB.users {
+		if matchUser(user, query) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (u UserRepository) GetUserStats(ctx context.Context, nickname string) (models.UserStats, error) {
+	u.DB.mu.RLock()
+	defer u.DB.mu.RUnlock()
+
+	user, ok := u.DB.users[fold(nickname)]
+	if !ok {
+		return models.UserStats{}, errs.NotFound(models.MissingUser)
+	}
+	nick := fold(nickname)
+	stats := models.UserStats{Nickname: user.Nickname}
+
+	activity := func(created time.Time) {
+		if stats.FirstActivity == nil || created.Before(*stats.FirstActivity) {
+			first := created
+			stats.FirstActivity = &first
+		}
+		if stats.LastActivity == nil || created.After(*stats.LastActivity) {
+			last := created
+			stats.LastActivity = &last
+		}
+	}
+
+	for _, post := range u.DB.posts {
+		if fold(post.Author) == nick {
+			stats.Posts++
+			activity(post.Created)
+		}
+	}
+	for _, thread := range u.DB.threads {
+		if fold(thread.Author) == nick {
+			stats.Threads++
+			stats.VotesReceived += thread.Votes
+			activity(thread.Created)
+		}
+	}
+	for key := range u.DB.votes {
+		if key.user == nick {
+			stats.VotesCast++
+		}
+	}
+	for _, members := range u.DB.forumUsers {
+		if members[nick] {
+			stats.Forums++
+		}
+	}
+	return stats, nil
+}
+
+// RenameUser повторяет каскадное обновление nickname из миграции 0006.
+func (u UserRepository) RenameUser(ctx context.Context, nickname string, newNickname string, aliasExpires time.Time) (models.User, error) {
+	u.DB.mu.Lock()
+	defer u.DB.mu.Unlock()
+
+	old, renamed := fold(nickname), fold(newNickname)
+	stored, ok := u.DB.users[old]
+	if !ok {
+		return models.User{}, errs.NotFound(models.MissingUser)
+	}
+	if other, ok := u.DB.users[renamed]; ok && other != stored {
+		return models.User{}, errs.Conflict(models.ErrUserNick)
+	}
+	if alias, ok := u.liveAlias(renamed); ok && alias.nickname != old {
+		return models.User{}, errs.Conflict(models.ErrUserNick)
+	}
+
+	stored.Nickname = newNickname
+	delete(u.DB.users, old)
+	u.DB.users[renamed] = stored
+	u.DB.userEmails[fold(stored.Email)] = renamed
+	if hash, ok := u.DB.passwords[old]; ok {
+		delete(u.DB.passwords, old)
+		u.DB.passwords[renamed] = hash
+	}
+	if u.DB.admins[old] {
+		delete(u.DB.admins, old)
+		u.DB.admins[renamed] = true
+	}
+	for _, key := range u.DB.keys {
+		if fold(key.Nickname) == old {
+			key.Nickname = newNickname
+		}
+	}
+	for i, nick := range u.DB.userOrder {
+		if nick == old {
+			u.DB.userOrder[i] = renamed
+		}
+	}
+
+	for _, forum := range u.DB.forums {
+		if fold(forum.User) == old {
+			forum.User = newNickname
+		}
+	}
+	for _, thread := range u.DB.threads {
+		if fold(thread.Author) == old {
+			thread.Author = newNickname
+		}
+	}
+	for _, post := range u.DB.posts {
+		if fold(post.Author) == old {
+			post.Author = newNickname
+		}
+	}
+	for _, forums := range []map[string]map[string]bool{u.DB.forumUsers, u.DB.moderators} {
+		for _, members := range forums {
+			if members[old] {
+				delete(members, old)
+				members[renamed] = true
+			}
+		}
+	}
+	for key, value := range u.DB.votes {
+		if key.user == old {
+			delete(u.DB.votes, key)
+			u.DB.votes[voteKey{thread: key.thread, user: renamed}] = value
+		}
+	}
+
+	for key, alias := range u.DB.aliases {
+		if alias.nickname == old {
+			u.DB.aliases[key] = userAlias{nickname: renamed, expires: alias.expires}
+		}
+	}
+	delete(u.DB.aliases, renamed)
+	if old != renamed {
+		u.DB.aliases[old] = userAlias{nickname: renamed, expires: aliasExpires}
+	}
+	return *stored, nil
+}
+
+// DeleteUser повторяет функцию delete_user из миграции 0007.
+func (u UserRepository) DeleteUser(ctx context.Context, nickname string) error {
+	u.DB.mu.Lock()
+	defer u.DB.mu.Unlock()
+
+	nick := fold(nickname)
+	stored, ok := u.DB.users[nick]
+	if !ok {
+		return errs.NotFound(models.MissingUser)
+	}
+
+	// записи переходят только к самой заглушке, не к аккаунту с её nickname
+	placeholder := fold(models.DeletedUser)
+	if holder, ok := u.DB.users[placeholder]; !ok {
+		if _, taken := u.DB.userEmails[fold(models.DeletedUserEmail)]; taken {
+			return errs.Conflict(models.ErrUserEmail)
+		}
+		u.DB.users[placeholder] = &models.User{Nickname: models.DeletedUser, Fullname: models.DeletedUserFullname, Email: models.DeletedUserEmail}
+		u.DB.userEmails[fold(models.DeletedUserEmail)] = placeholder
+		u.DB.userOrder = append(u.DB.userOrder, placeholder)
+		delete(u.DB.aliases, placeholder)
+	} else if fold(holder.Email) != fold(models.DeletedUserEmail) {
+		return errs.New(errs.KindInternal, models.ErrNotPlaceholder)
+	}
+
+	for key, value := range u.DB.votes {
+		if key.user == nick {
+			u.DB.threads[key.thread].Votes -= int64(value)
+			delete(u.DB.votes, key)
+		}
+	}
+	for _, forum := range u.DB.forums {
+		if fold(forum.User) == nick {
+			forum.User = models.DeletedUser
+		}
+	}
+	for _, thread := range u.DB.threads {
+		if fold(thread.Author) == nick {
+			thread.Author = models.DeletedUser
+		}
+	}
+	for _, post := range u.DB.posts {
+		if fold(post.Author) == nick {
+			post.Author = models.DeletedUser
+		}
+	}
+	for _, members := range u.DB.forumUsers {
+		delete(members, nick)
+	}
+
+	u.DB.removeUser(stored)
+	return nil
+}
+
+// ExportThreads, как и остальные Export*, копирует записи под блокировкой и
+// передаёт их в fn уже без неё, чтобы медленный получатель выгрузки не держал хранилище.
+func (u UserRepository) ExportThreads(ctx context.Context, nickname string, fn func(models.Thread) error) error {
+	u.DB.mu.RLock()
+	nick := fold(nickname)
+	var threads []models.Thread
+	for _, thread := range u.DB.threads {
+		if fold(thread.Author) == nick {
+			threads = append(threads, public(*thread))
+		}
+	}
+	u.DB.mu.RUnlock()
+
+	sort.Slice(threads, func(i, j int) bool {
+		if !threads[i].Created.Equal(threads[j].Created) {
+			return threads[i].Created.Before(threads[j].Created)
+		}
+		return threads[i].Id < threads[j].Id
+	})
+	for _, thread := range threads {
+		if err := fn(thread); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (u UserRepository) ExportPosts(ctx context.Context, nickname string, fn func(models.UserExportPost) error) error {
+	u.DB.mu.RLock()
+	nick := fold(nickname)
+	var posts []models.UserExportPost
+	for _, post := range u.DB.posts {
+		if fold(post.Author) != nick {
+			continue
+		}
+		thread := public(*u.DB.threads[post.Thread])
+		posts = append(posts, models.UserExportPost{
+			Post:        post.Post,
+			ThreadTitle: thread.Title,
+			ThreadSlug:  thread.Slug,
+			ForumTitle:  u.DB.forums[fold(post.Forum)].Title,
+		})
+	}
+	u.DB.mu.RUnlock()
+
+	sort.Slice(posts, func(i, j int) bool {
+		return posts[i].Id < posts[j].Id
+	})
+	for _, post := range posts {
+		if err := fn(post); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (u UserRepository) ExportVotes(ctx context.Context, nickname string, fn func(models.UserExportVote) error) error {
+	u.DB.mu.RLock()
+	nick := fold(nickname)
+	var votes []models.UserExportVote
+	for key, value := range u.DB.votes {
+		if key.user != nick {
+			continue
+		}
+		thread := public(*u.DB.threads[key.thread])
+		votes = append(votes, models.UserExportVote{Thread: thread.Id, ThreadSlug: thread.Slug, Forum: thread.Forum, Voice: value})
+	}
+	u.DB.mu.RUnlock()
+
+	sort.Slice(votes, func(i, j int) bool {
+		return votes[i].Thread < votes[j].Thread
+	})
+	for _, vote := range votes {
+		if err := fn(vote); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (u UserRepository) ExportForums(ctx context.Context, nickname string, fn func(models.Forum) error) error {
+	u.DB.mu.RLock()
+	nick := fold(nickname)
+	var forums []models.Forum
+	for slug, members := range u.DB.forumUsers {
+		if members[nick] {
+			forums = append(forums, *u.DB.forums[slug])
+		}
+	}
+	u.DB.mu.RUnlock()
+
+	sort.Slice(forums, func(i, j int) bool {
+		return fold(forums[i].Slug) < fold(forums[j].Slug)
+	})
+	for _, forum := range forums {
+		if err := fn(forum); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (u UserRepository) IsAdmin(ctx context.Context, nickname string) (bool, error) {
+	u.DB.mu.RLock()
+	defer u.DB.mu.RUnlock()
+
+	return u.DB.admins[fold(nickname)], nil
+}
+
+func (u UserRepository) SetAdmin(ctx context.Context, nickname string, admin bool) error {
+	u.DB.mu.Lock()
+	defer u.DB.mu.Unlock()
+
+	key := fold(nickname)
+	if _, ok := u.DB.users[key]; !ok {
+		return errs.NotFound(models.MissingUser)
+	}
+	if admin {
+		u.DB.admins[key] = true
+	} else {
+		delete(u.DB.admins, key)
+	}
+	return nil
+}
+
+func (u UserRepository) FindAdmins(ctx context.Context) ([]models.User, error) {
+	u.DB.mu.RLock()
+	defer u.DB.mu.RUnlock()
+
+	users := []models.User{}
+	for key := range u.DB.admins {
+		users = append(users, *u.DB.users[key])
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return fold(users[i].Nickname) < fold(users[j].Nickname)
+	})
+	return users, nil
+}
@@ -0,0 +1,130 @@
+package middleware
+
+import (
+	"forum/internal/utils/auth"
+	"forum/internal/utils/errs"
+	"forum/internal/utils/logger"
+	"forum/internal/utils/response"
+	usecase2 "forum/pkg/apikey/usecase"
+	"forum/pkg/models"
+	"forum/pkg/user/usecase"
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"strings"
+)
+
+// AuthMiddleware находит пользователя по токену сессии или ключу API из
+// заголовка Authorization и кладёт его в контекст запроса (auth.FromContext).
+// Запись от имени другого пользователя отклоняют usecase'ы через auth.Check.
+type AuthMiddleware struct {
+	User *usecase.UserUsecase
+	Keys *usecase2.KeyUsecase
+	// Запросы на запись без токена отклоняются с 401.
+	Required bool
+	// Маршруты, доступные без токена и при Required; ключ шаблон пути.
+	Public map[string]bool
+	// Область, которая нужна ключу API для маршрута; ключ "МЕТОД шаблон пути".
+	// Остальные запросы на чтение требуют models.ScopeRead, на запись models.ScopeAdmin.
+	Scopes map[string]string
+}
+
+func (a *AuthMiddleware) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("Authorization")
+		if header == "" {
+			if a.Required && !readOnly(r.Method) && !a.Public[a.template(r)] {
+				a.reject(w, r, errs.Unauthorized(models.ErrNoToken))
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token := strings.TrimPrefix(header, "Bearer ")
+		if token == header {
+			a.reject(w, r, errs.Unauthorized(models.ErrBadToken))
+			return
+		}
+		if auth.IsKey(token) {
+			a.serveKey(w, r, next, token)
+			return
+		}
+
+		user, err := a.User.Authenticate(r.Context(), token)
+		if err != nil {
+			a.reject(w, r, err)
+			return
+		}
+
+		ctx := auth.WithCaller(r.Context(), auth.Caller{Nickname: user.Nickname})
+		ctx = logger.WithContext(ctx, logger.FromContext(ctx).WithField("user", user.Nickname))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// serveKey пропускает запрос с ключом API, если ключу хватает областей, и
+// пишет в журнал аудита каждый запрос, сделанный с ключом.
+func (a *AuthMiddleware) serveKey(w http.ResponseWriter, r *http.Request, next http.Handler, token string) {
+	key, err := a.Keys.Authenticate(r.Context(), token)
+	if err != nil {
+		a.reject(w, r, err)
+		return
+	}
+
+	entry := logger.FromContext(r.Context()).WithFields(logrus.Fields{
+		"user":     key.Nickname,
+		"key_id":   key.Id,
+		"key_name": key.Name,
+	})
+	caller := auth.Caller{Nickname: key.Nickname, Scopes: key.Scopes}
+	r = r.WithContext(logger.WithContext(auth.WithCaller(r.Context(), caller), entry))
+	recorder := &statusRecorder{ResponseWriter: w}
+
+	scope := a.scope(r)
+	if caller.Allows(scope) {
+		next.ServeHTTP(recorder, r)
+	} else {
+		a.reject(recorder, r, errs.Forbidden(models.ErrKeyNoScope))
+	}
+
+	if recorder.status == 0 {
+		recorder.status = http.StatusOK
+	}
+	entry.WithFields(logrus.Fields{
+		"method": r.Method,
+		"path":   r.URL.Path,
+		"scope":  scope,
+		"status": recorder.status,
+	}).Info("api key request")
+}
+
+func (a *AuthMiddleware) template(r *http.Request) string {
+	if current := mux.CurrentRoute(r); current != nil {
+		if template, err := current.GetPathTemplate(); err == nil {
+			return template
+		}
+	}
+	return ""
+}
+
+func (a *AuthMiddleware) scope(r *http.Request) string {
+	if scope, ok := a.Scopes[r.Method+" "+a.template(r)]; ok {
+		return scope
+	}
+	if readOnly(r.Method) {
+		return models.ScopeRead
+	}
+	return models.ScopeAdmin
+}
+
+func (a *AuthMiddleware) reject(w http.ResponseWriter, r *http.Request, err error) {
+	if errs.Is(err, errs.KindUnauthorized) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+	}
+	response.Process(response.LoggerFunc(err.Error(), logger.ErrorFunc(r.Context(), err)), response.ErrorFunc(w, err))
+}
+
+func readOnly(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
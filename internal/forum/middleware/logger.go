@@ -2,30 +2,85 @@ package middleware
 
 import (
 	"forum/internal/utils/logger"
-	"forum/pkg/user/usecase"
-	"log"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
 	"net/http"
 	"time"
 )
 
+const RequestIDHeader = "X-Request-ID"
+
 type LoggerMiddleware struct {
 	Logger *logger.Logger
-	User   *usecase.UserUsecase
+}
+
+// statusRecorder запоминает код ответа и количество записанных байт.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	if s.status == 0 {
+		s.status = code
+	}
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	n, err := s.ResponseWriter.Write(b)
+	s.bytes += n
+	return n, err
+}
+
+func (s *statusRecorder) Flush() {
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
 }
 
 func (l *LoggerMiddleware) Middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
 
+		requestID := r.Header.Get(RequestIDHeader)
+		if requestID == "" {
+			requestID = uuid.New().String()
+		}
+		w.Header().Set(RequestIDHeader, requestID)
 		w.Header().Add("Content-Type", "application/json")
 
-		log.Printf(
-			"%s %s %s",
-			r.Method,
-			r.URL.Path,
-			time.Since(start),
-		)
+		entry := l.Logger.Logger.WithField("request_id", requestID)
+		recorder := &statusRecorder{ResponseWriter: w}
+
+		next.ServeHTTP(recorder, r.WithContext(logger.WithContext(r.Context(), entry)))
+
+		route := ""
+		if current := mux.CurrentRoute(r); current != nil {
+			route, _ = current.GetPathTemplate()
+		}
+		if recorder.status == 0 {
+			recorder.status = http.StatusOK
+		}
 
-		next.ServeHTTP(w, r)
+		access := entry.WithFields(logrus.Fields{
+			"method":      r.Method,
+			"path":        r.URL.Path,
+			"route":       route,
+			"status":      recorder.status,
+			"bytes":       recorder.bytes,
+			"duration_ms": float64(time.Since(start).Microseconds()) / 1000,
+			"remote_addr": r.RemoteAddr,
+		})
+		if recorder.status >= http.StatusInternalServerError {
+			access.Error("request")
+		} else {
+			access.Info("request")
+		}
 	})
 }
@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"context"
+	"github.com/gorilla/mux"
+	"net"
+	"net/http"
+	"time"
+)
+
+type connKey struct{}
+
+// WithConn кладёт соединение в контекст его запросов; подключается как
+// http.Server.ConnContext, без него StreamMiddleware ничего не меняет.
+func WithConn(ctx context.Context, c net.Conn) context.Context {
+	return context.WithValue(ctx, connKey{}, c)
+}
+
+// StreamMiddleware для маршрутов, которые пишут длинный ответ по частям, как
+// выгрузка пользователя. http.Server.WriteTimeout отсчитывается от начала
+// запроса и обрезал бы такой ответ уже после заголовков 200, поэтому здесь
+// дедлайн записи переносится перед каждой записью: медленный клиент получает
+// ответ целиком, а зависший всё равно отключается через WriteTimeout.
+type StreamMiddleware struct {
+	WriteTimeout time.Duration
+	// Ключ шаблон пути маршрута, как в mux.Route.GetPathTemplate.
+	Routes map[string]bool
+}
+
+func (s *StreamMiddleware) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, ok := r.Context().Value(connKey{}).(net.Conn)
+		if !ok || s.WriteTimeout <= 0 || !s.stream(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(&deadlineWriter{ResponseWriter: w, conn: conn, timeout: s.WriteTimeout}, r)
+	})
+}
+
+func (s *StreamMiddleware) stream(r *http.Request) bool {
+	if route := mux.CurrentRoute(r); route != nil {
+		if template, err := route.GetPathTemplate(); err == nil {
+			return s.Routes[template]
+		}
+	}
+	return false
+}
+
+// deadlineWriter переносит дедлайн записи соединения перед каждой записью.
+// Буфер ответа, оставшийся после обработчика, сервер сбрасывает в пределах
+// дедлайна последней записи.
+type deadlineWriter struct {
+	http.ResponseWriter
+	conn    net.Conn
+	timeout time.Duration
+}
+
+func (w *deadlineWriter) WriteHeader(code int) {
+	_ = w.conn.SetWriteDeadline(time.Now().Add(w.timeout))
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *deadlineWriter) Write(p []byte) (int, error) {
+	_ = w.conn.SetWriteDeadline(time.Now().Add(w.timeout))
+	return w.ResponseWriter.Write(p)
+}
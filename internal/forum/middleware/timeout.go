@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"context"
+	"github.com/gorilla/mux"
+	"net/http"
+	"time"
+)
+
+// TimeoutMiddleware ограничивает время обработки запроса. Дедлайн попадает в
+// контекст запроса и через него отменяет запрос к базе, в том числе когда
+// клиент отключился раньше.
+type TimeoutMiddleware struct {
+	Default time.Duration
+	// Ключ шаблон пути маршрута, как в mux.Route.GetPathTemplate.
+	Routes map[string]time.Duration
+}
+
+func (t *TimeoutMiddleware) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		timeout := t.Default
+		if route := mux.CurrentRoute(r); route != nil {
+			if template, err := route.GetPathTemplate(); err == nil {
+				if routeTimeout, ok := t.Routes[template]; ok {
+					timeout = routeTimeout
+				}
+			}
+		}
+
+		if timeout <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,218 @@
+package migrations
+
+import (
+	"context"
+	"embed"
+	"github.com/jackc/pgx"
+	"github.com/pkg/errors"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Файлы миграций называются NNNN_name.up.sql и NNNN_name.down.sql.
+//
+//go:embed sql/*.sql
+var files embed.FS
+
+// lockKey ключ pg_advisory_lock: миграции выполняет только один инстанс.
+const lockKey = 4242001
+
+const (
+	createVersionTable = `CREATE TABLE IF NOT EXISTS public.schema_migrations (
+		version INT PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+	)`
+	selectVersion = `SELECT COALESCE(MAX(version), 0) FROM public.schema_migrations`
+	insertVersion = `INSERT INTO public.schema_migrations (version, name) VALUES ($1, $2)`
+	deleteVersion = `DELETE FROM public.schema_migrations WHERE version = $1`
+)
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Load читает встроенные миграции, отсортированные по версии.
+func Load() ([]Migration, error) {
+	entries, err := files.ReadDir("sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		name := entry.Name()
+		var direction string
+		switch {
+		case strings.HasSuffix(name, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(name, ".down.sql"):
+			direction = "down"
+		default:
+			return nil, errors.Errorf("unexpected migration file %s", name)
+		}
+
+		base := strings.TrimSuffix(name, "."+direction+".sql")
+		underscore := strings.Index(base, "_")
+		if underscore <= 0 {
+			return nil, errors.Errorf("migration file %s has no version prefix", name)
+		}
+		version, err := strconv.Atoi(base[:underscore])
+		if err != nil {
+			return nil, errors.Wrapf(err, "migration file %s", name)
+		}
+
+		body, err := files.ReadFile(path.Join("sql", name))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: base[underscore+1:]}
+			byVersion[version] = m
+		}
+		if direction == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	var migrations []Migration
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, errors.Errorf("migration %04d_%s has no up script", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Latest версия схемы, которую ожидает этот бинарник.
+func Latest() int {
+	migrations, err := Load()
+	if err != nil || len(migrations) == 0 {
+		return 0
+	}
+	return migrations[len(migrations)-1].Version
+}
+
+type Migrator struct {
+	DB *pgx.ConnPool
+}
+
+// Version текущая версия схемы; 0, если миграции ещё не применялись.
+func (m Migrator) Version(ctx context.Context) (int, error) {
+	var exists bool
+	err := m.DB.QueryRowEx(ctx, `SELECT to_regclass('public.schema_migrations') IS NOT NULL`, nil).Scan(&exists)
+	if err != nil || !exists {
+		return 0, err
+	}
+
+	var version int
+	err = m.DB.QueryRowEx(ctx, selectVersion, nil).Scan(&version)
+	return version, err
+}
+
+// Up применяет все неприменённые миграции, каждую в своей транзакции.
+func (m Migrator) Up(ctx context.Context) ([]Migration, error) {
+	migrations, err := Load()
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []Migration
+	err = m.withLock(ctx, func(conn *pgx.Conn, current int) error {
+		for _, migration := range migrations {
+			if migration.Version <= current {
+				continue
+			}
+			if err := apply(ctx, conn, migration.Up, insertVersion, migration.Version, migration.Name); err != nil {
+				return errors.Wrapf(err, "migration %04d_%s up", migration.Version, migration.Name)
+			}
+			applied = append(applied, migration)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down откатывает последние steps миграций.
+func (m Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	migrations, err := Load()
+	if err != nil {
+		return nil, err
+	}
+
+	var reverted []Migration
+	err = m.withLock(ctx, func(conn *pgx.Conn, current int) error {
+		for i := len(migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+			migration := migrations[i]
+			if migration.Version > current {
+				continue
+			}
+			if migration.Down == "" {
+				return errors.Errorf("migration %04d_%s has no down script", migration.Version, migration.Name)
+			}
+			if err := apply(ctx, conn, migration.Down, deleteVersion, migration.Version); err != nil {
+				return errors.Wrapf(err, "migration %04d_%s down", migration.Version, migration.Name)
+			}
+			reverted = append(reverted, migration)
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// withLock берёт отдельное соединение, держит на нём advisory lock и передаёт
+// в fn версию схемы, прочитанную уже под блокировкой.
+func (m Migrator) withLock(ctx context.Context, fn func(conn *pgx.Conn, current int) error) error {
+	conn, err := m.DB.AcquireEx(ctx)
+	if err != nil {
+		return err
+	}
+	defer m.DB.Release(conn)
+
+	if _, err = conn.ExecEx(ctx, "SELECT pg_advisory_lock($1)", nil, int64(lockKey)); err != nil {
+		return errors.Wrap(err, "acquire migration lock")
+	}
+	defer func() {
+		_, _ = conn.ExecEx(context.Background(), "SELECT pg_advisory_unlock($1)", nil, int64(lockKey))
+	}()
+
+	if _, err = conn.ExecEx(ctx, createVersionTable, nil); err != nil {
+		return err
+	}
+
+	var current int
+	if err = conn.QueryRowEx(ctx, selectVersion, nil).Scan(&current); err != nil {
+		return err
+	}
+
+	return fn(conn, current)
+}
+
+func apply(ctx context.Context, conn *pgx.Conn, script string, bookkeeping string, args ...interface{}) error {
+	tx, err := conn.BeginEx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.RollbackEx(context.Background())
+	}()
+
+	if _, err = tx.ExecEx(ctx, script, nil); err != nil {
+		return err
+	}
+	if _, err = tx.ExecEx(ctx, bookkeeping, nil, args...); err != nil {
+		return err
+	}
+	return tx.CommitEx(ctx)
+}
@@ -0,0 +1,6 @@
+DROP SCHEMA IF EXISTS parkmaildb CASCADE;
+
+DROP FUNCTION IF EXISTS inc_threads_of_forum();
+DROP FUNCTION IF EXISTS add_new_voice();
+DROP FUNCTION IF EXISTS change_voice();
+DROP FUNCTION IF EXISTS add_post();
@@ -1,16 +1,9 @@
-DROP SCHEMA IF EXISTS parkmaildb CASCADE;
+-- Исходная схема из init.sql. Запросы идемпотентны, чтобы миграцию можно было
+-- применить к базе, которую уже инициализировал старый init.sql.
 CREATE EXTENSION IF NOT EXISTS citext;
-CREATE SCHEMA parkmaildb;
+CREATE SCHEMA IF NOT EXISTS parkmaildb;
 
-DROP TABLE IF EXISTS parkmaildb."User" CASCADE;
-DROP TABLE IF EXISTS parkmaildb."Post" CASCADE;
-DROP TABLE IF EXISTS parkmaildb."Thread" CASCADE;
-DROP TABLE IF EXISTS parkmaildb."Forum" CASCADE;
-DROP TABLE IF EXISTS parkmaildb."Vote" CASCADE;
-DROP TABLE IF EXISTS parkmaildb."Users_by_Forum" CASCADE;
-
-
-CREATE UNLOGGED TABLE parkmaildb."User"
+CREATE UNLOGGED TABLE IF NOT EXISTS parkmaildb."User"
 (
     Id SERIAL PRIMARY KEY,
     NickName CITEXT UNIQUE NOT NULL,
@@ -19,7 +12,7 @@ CREATE UNLOGGED TABLE parkmaildb."User"
     Email CITEXT UNIQUE NOT NULL
 );
 
-CREATE UNLOGGED TABLE parkmaildb."Forum"
+CREATE UNLOGGED TABLE IF NOT EXISTS parkmaildb."Forum"
 (
     Id SERIAL PRIMARY KEY,
     Title TEXT NOT NULL,
@@ -29,7 +22,7 @@ CREATE UNLOGGED TABLE parkmaildb."Forum"
     Threads INT
 );
 
-CREATE UNLOGGED TABLE parkmaildb."Thread"
+CREATE UNLOGGED TABLE IF NOT EXISTS parkmaildb."Thread"
 (
     Id SERIAL PRIMARY KEY,
     Title TEXT NOT NULL,
@@ -41,7 +34,7 @@ CREATE UNLOGGED TABLE parkmaildb."Thread"
     Created TIMESTAMP WITH TIME ZONE
 );
 
-CREATE UNLOGGED TABLE parkmaildb."Post"
+CREATE UNLOGGED TABLE IF NOT EXISTS parkmaildb."Post"
 (
     Id SERIAL PRIMARY KEY,
     Parent INT DEFAULT 0,
@@ -54,7 +47,7 @@ CREATE UNLOGGED TABLE parkmaildb."Post"
     Path INT[] DEFAULT ARRAY []::INTEGER[]
 );
 
-CREATE UNLOGGED TABLE parkmaildb."Users_by_Forum"
+CREATE UNLOGGED TABLE IF NOT EXISTS parkmaildb."Users_by_Forum"
 (
     Id SERIAL PRIMARY KEY,
     Forum CITEXT NOT NULL,
@@ -62,7 +55,7 @@ CREATE UNLOGGED TABLE parkmaildb."Users_by_Forum"
     CONSTRAINT onlyOneUser UNIQUE (Forum, "user")
 );
 
-CREATE UNLOGGED TABLE parkmaildb."Vote"
+CREATE UNLOGGED TABLE IF NOT EXISTS parkmaildb."Vote"
 (
     Id SERIAL PRIMARY KEY,
     ThreadId INT REFERENCES parkmaildb."Thread"(id) NOT NULL,
@@ -81,6 +74,7 @@ BEGIN
 END
 $$ LANGUAGE 'plpgsql';
 
+DROP TRIGGER IF EXISTS create_thread_trigger ON parkmaildb."Thread";
 CREATE TRIGGER create_thread_trigger
     AFTER INSERT ON parkmaildb."Thread"
     FOR EACH ROW EXECUTE PROCEDURE inc_threads_of_forum();
@@ -93,6 +87,7 @@ BEGIN
 END
 $$ LANGUAGE 'plpgsql';
 
+DROP TRIGGER IF EXISTS voice_trigger ON parkmaildb."Vote";
 CREATE TRIGGER voice_trigger
     AFTER INSERT ON parkmaildb."Vote"
     FOR EACH ROW EXECUTE PROCEDURE add_new_voice();
@@ -107,6 +102,7 @@ BEGIN
 END
 $$ LANGUAGE 'plpgsql';
 
+DROP TRIGGER IF EXISTS voice_update_trigger ON parkmaildb."Vote";
 CREATE TRIGGER voice_update_trigger
     AFTER UPDATE ON parkmaildb."Vote"
     FOR EACH ROW EXECUTE PROCEDURE change_voice();
@@ -125,6 +121,7 @@ BEGIN
 END
 $$ LANGUAGE 'plpgsql';
 
+DROP TRIGGER IF EXISTS add_post ON parkmaildb."Post";
 CREATE TRIGGER add_post
     BEFORE INSERT ON parkmaildb."Post"
     FOR EACH ROW EXECUTE PROCEDURE add_post();
@@ -144,9 +141,9 @@ CREATE INDEX IF NOT EXISTS post_path_1 ON parkmaildb."Post" ((path[1]));
 CREATE INDEX IF NOT EXISTS post_id_path1 on parkmaildb."Post" (id, (path[1]));
 CREATE INDEX IF NOT EXISTS post_thread ON parkmaildb."Post" (thread);
 CREATE INDEX IF NOT EXISTS post_path ON parkmaildb."Post" (path);
-CREATE INDEX IF NOT EXISTS post_path_1 ON parkmaildb."Post" (forum);
+CREATE INDEX IF NOT EXISTS post_forum ON parkmaildb."Post" (forum);
 
 CREATE UNIQUE INDEX IF NOT EXISTS votes_nickname_thread_nickname on parkmaildb."Vote" (threadid, "user");
 
-CREATE INDEX forum_users_user ON parkmaildb."Users_by_Forum" USING hash ("user");
-CREATE INDEX forum_users_forum_user ON parkmaildb."Users_by_Forum" USING hash (forum, "user");
+CREATE INDEX IF NOT EXISTS forum_users_user ON parkmaildb."Users_by_Forum" USING hash ("user");
+-- (forum, "user") покрыт индексом ограничения onlyOneUser.
@@ -0,0 +1,8 @@
+-- Обратный порядок: нежурналируемой можно сделать только таблицу, на которую
+-- уже не ссылаются журналируемые.
+ALTER TABLE parkmaildb."Vote" SET UNLOGGED;
+ALTER TABLE parkmaildb."Users_by_Forum" SET UNLOGGED;
+ALTER TABLE parkmaildb."Post" SET UNLOGGED;
+ALTER TABLE parkmaildb."Thread" SET UNLOGGED;
+ALTER TABLE parkmaildb."Forum" SET UNLOGGED;
+ALTER TABLE parkmaildb."User" SET UNLOGGED;
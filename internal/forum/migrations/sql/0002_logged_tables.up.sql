@@ -0,0 +1,9 @@
+-- Таблицы становятся журналируемыми и переживают падение Postgres.
+-- Сначала таблицы, на которые ссылаются внешние ключи: журналируемая таблица
+-- не может ссылаться на нежурналируемую.
+ALTER TABLE parkmaildb."User" SET LOGGED;
+ALTER TABLE parkmaildb."Forum" SET LOGGED;
+ALTER TABLE parkmaildb."Thread" SET LOGGED;
+ALTER TABLE parkmaildb."Post" SET LOGGED;
+ALTER TABLE parkmaildb."Users_by_Forum" SET LOGGED;
+ALTER TABLE parkmaildb."Vote" SET LOGGED;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS parkmaildb.user_fullname_prefix;
+DROP INDEX IF EXISTS parkmaildb.user_nickname_prefix;
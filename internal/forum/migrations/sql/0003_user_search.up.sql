@@ -0,0 +1,4 @@
+-- Поиск по префиксу для GET /api/users: lower(...) LIKE 'prefix%'.
+-- Порядок по nickname даёт уникальный индекс самой таблицы.
+CREATE INDEX IF NOT EXISTS user_nickname_prefix ON parkmaildb."User" (lower(nickname::text) text_pattern_ops);
+CREATE INDEX IF NOT EXISTS user_fullname_prefix ON parkmaildb."User" (lower(fullname) text_pattern_ops);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS parkmaildb.vote_user;
+DROP INDEX IF EXISTS parkmaildb.thread_author_created;
+DROP INDEX IF EXISTS parkmaildb.post_author_created;
@@ -0,0 +1,5 @@
+-- Выборки по автору для статистики пользователя: COUNT и MIN/MAX(created)
+-- читаются из индексов.
+CREATE INDEX IF NOT EXISTS post_author_created ON parkmaildb."Post" (author, created);
+CREATE INDEX IF NOT EXISTS thread_author_created ON parkmaildb."Thread" (author, created);
+CREATE INDEX IF NOT EXISTS vote_user ON parkmaildb."Vote" ("user");
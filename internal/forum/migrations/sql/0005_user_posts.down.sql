@@ -0,0 +1 @@
+DROP INDEX IF EXISTS parkmaildb.post_author_id;
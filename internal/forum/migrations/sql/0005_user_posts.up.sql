@@ -0,0 +1,2 @@
+-- Списки сообщений пользователя по id; ветки используют thread_author_created из 0004.
+CREATE INDEX IF NOT EXISTS post_author_id ON parkmaildb."Post" (author, id);
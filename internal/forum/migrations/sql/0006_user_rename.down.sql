@@ -0,0 +1,14 @@
+DROP TRIGGER IF EXISTS drop_user_alias ON parkmaildb."User";
+DROP FUNCTION IF EXISTS drop_user_alias();
+DROP TABLE IF EXISTS parkmaildb."User_alias";
+
+ALTER TABLE parkmaildb."Vote" DROP CONSTRAINT IF EXISTS "Vote_user_fkey",
+    ADD CONSTRAINT "Vote_user_fkey" FOREIGN KEY ("user") REFERENCES parkmaildb."User" (nickname);
+ALTER TABLE parkmaildb."Users_by_Forum" DROP CONSTRAINT IF EXISTS "Users_by_Forum_user_fkey",
+    ADD CONSTRAINT "Users_by_Forum_user_fkey" FOREIGN KEY ("user") REFERENCES parkmaildb."User" (nickname);
+ALTER TABLE parkmaildb."Post" DROP CONSTRAINT IF EXISTS "Post_author_fkey",
+    ADD CONSTRAINT "Post_author_fkey" FOREIGN KEY (author) REFERENCES parkmaildb."User" (nickname);
+ALTER TABLE parkmaildb."Thread" DROP CONSTRAINT IF EXISTS "Thread_author_fkey",
+    ADD CONSTRAINT "Thread_author_fkey" FOREIGN KEY (author) REFERENCES parkmaildb."User" (nickname);
+ALTER TABLE parkmaildb."Forum" DROP CONSTRAINT IF EXISTS "Forum_user_fkey",
+    ADD CONSTRAINT "Forum_user_fkey" FOREIGN KEY ("user") REFERENCES parkmaildb."User" (nickname);
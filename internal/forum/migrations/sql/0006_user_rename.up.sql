@@ -0,0 +1,45 @@
+-- Переименование пользователя: nickname во всех таблицах меняется каскадно
+-- вместе с "User", старый nickname остаётся псевдонимом до expires.
+ALTER TABLE parkmaildb."Forum" DROP CONSTRAINT IF EXISTS "Forum_user_fkey",
+    ADD CONSTRAINT "Forum_user_fkey" FOREIGN KEY ("user") REFERENCES parkmaildb."User" (nickname) ON UPDATE CASCADE;
+ALTER TABLE parkmaildb."Thread" DROP CONSTRAINT IF EXISTS "Thread_author_fkey",
+    ADD CONSTRAINT "Thread_author_fkey" FOREIGN KEY (author) REFERENCES parkmaildb."User" (nickname) ON UPDATE CASCADE;
+ALTER TABLE parkmaildb."Post" DROP CONSTRAINT IF EXISTS "Post_author_fkey",
+    ADD CONSTRAINT "Post_author_fkey" FOREIGN KEY (author) REFERENCES parkmaildb."User" (nickname) ON UPDATE CASCADE;
+ALTER TABLE parkmaildb."Users_by_Forum" DROP CONSTRAINT IF EXISTS "Users_by_Forum_user_fkey",
+    ADD CONSTRAINT "Users_by_Forum_user_fkey" FOREIGN KEY ("user") REFERENCES parkmaildb."User" (nickname) ON UPDATE CASCADE;
+ALTER TABLE parkmaildb."Vote" DROP CONSTRAINT IF EXISTS "Vote_user_fkey",
+    ADD CONSTRAINT "Vote_user_fkey" FOREIGN KEY ("user") REFERENCES parkmaildb."User" (nickname) ON UPDATE CASCADE;
+
+-- Таблица создаётся в том же режиме, что и "User" (database.durability):
+-- журналируемая не может ссылаться на нежурналируемую.
+CREATE UNLOGGED TABLE IF NOT EXISTS parkmaildb."User_alias"
+(
+    Alias    CITEXT PRIMARY KEY,
+    NickName CITEXT NOT NULL REFERENCES parkmaildb."User" (NickName) ON UPDATE CASCADE ON DELETE CASCADE,
+    Expires  TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+DO $$
+BEGIN
+    IF (SELECT relpersistence FROM pg_class WHERE oid = 'parkmaildb."User"'::regclass) = 'p' THEN
+        ALTER TABLE parkmaildb."User_alias" SET LOGGED;
+    END IF;
+END
+$$;
+
+CREATE INDEX IF NOT EXISTS user_alias_nickname ON parkmaildb."User_alias" (nickname);
+
+-- Занятый nickname перестаёт быть псевдонимом: пользователь находится по
+-- своему nickname, а не по чужому старому.
+CREATE OR REPLACE FUNCTION drop_user_alias() RETURNS TRIGGER AS $$
+BEGIN
+    DELETE FROM parkmaildb."User_alias" WHERE alias = NEW.nickname;
+    RETURN NULL;
+END
+$$ LANGUAGE 'plpgsql';
+
+DROP TRIGGER IF EXISTS drop_user_alias ON parkmaildb."User";
+CREATE TRIGGER drop_user_alias
+    AFTER INSERT OR UPDATE OF nickname ON parkmaildb."User"
+    FOR EACH ROW EXECUTE PROCEDURE drop_user_alias();
@@ -0,0 +1 @@
+DROP FUNCTION IF EXISTS delete_user(CITEXT, CITEXT, TEXT, CITEXT);
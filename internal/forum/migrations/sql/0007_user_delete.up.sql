@@ -0,0 +1,32 @@
+-- Удаление пользователя: личные данные удаляются вместе со строкой "User",
+-- форумы, ветки и сообщения переходят к общему автору-заглушке, поэтому
+-- деревья сообщений и счётчики форумов не меняются. Отданные голоса снимаются
+-- с рейтинга веток. Возвращает false, если пользователя нет.
+CREATE OR REPLACE FUNCTION delete_user(target CITEXT, placeholder CITEXT, placeholder_fullname TEXT, placeholder_email CITEXT)
+    RETURNS BOOLEAN AS $$
+DECLARE
+    nick CITEXT;
+BEGIN
+    SELECT nickname INTO nick FROM parkmaildb."User" WHERE nickname = target FOR UPDATE;
+    IF NOT FOUND THEN
+        RETURN FALSE;
+    END IF;
+
+--     у пользователя не больше одного голоса за ветку
+    UPDATE parkmaildb."Thread" t SET votes = t.votes - v.value
+    FROM parkmaildb."Vote" v WHERE v.threadid = t.id AND v."user" = nick;
+    DELETE FROM parkmaildb."Vote" WHERE "user" = nick;
+
+    INSERT INTO parkmaildb."User" (nickname, fullname, about, email)
+    VALUES (placeholder, placeholder_fullname, '', placeholder_email)
+    ON CONFLICT DO NOTHING;
+    UPDATE parkmaildb."Forum" SET "user" = placeholder WHERE "user" = nick;
+    UPDATE parkmaildb."Thread" SET author = placeholder WHERE author = nick;
+    UPDATE parkmaildb."Post" SET author = placeholder WHERE author = nick;
+
+    DELETE FROM parkmaildb."Users_by_Forum" WHERE "user" = nick;
+--     псевдонимы удаляются каскадно
+    DELETE FROM parkmaildb."User" WHERE nickname = nick;
+    RETURN TRUE;
+END
+$$ LANGUAGE 'plpgsql';
@@ -0,0 +1,73 @@
+-- Слияние аккаунта source в target: ветки, сообщения, форумы, Users_by_Forum
+-- и голоса переходят к target, source удаляется. Если оба голосовали за одну
+-- ветку, policy решает, чей голос останется: 'keep' голос target, 'replace'
+-- голос source, 'drop' снимаются оба; рейтинг затронутых веток пересчитывается.
+-- Возвращает число затронутых строк; с dry_run только считает. Без строк в
+-- ответе, если одного из пользователей нет.
+CREATE OR REPLACE FUNCTION merge_users(target CITEXT, source CITEXT, policy TEXT, dry_run BOOLEAN)
+    RETURNS TABLE (merged_threads BIGINT, merged_posts BIGINT, merged_forums BIGINT, merged_memberships BIGINT,
+                   merged_votes BIGINT, vote_conflicts BIGINT) AS $$
+DECLARE
+    a CITEXT;
+    b CITEXT;
+    affected INT[];
+BEGIN
+    IF policy NOT IN ('keep', 'replace', 'drop') THEN
+        RAISE EXCEPTION 'Unknown vote merge policy' USING ERRCODE = 'invalid_parameter_value';
+    END IF;
+
+    SELECT nickname INTO a FROM parkmaildb."User" WHERE nickname = target FOR UPDATE;
+    IF NOT FOUND THEN
+        RETURN;
+    END IF;
+    SELECT nickname INTO b FROM parkmaildb."User" WHERE nickname = source FOR UPDATE;
+    IF NOT FOUND THEN
+        RETURN;
+    END IF;
+    IF a = b THEN
+        RAISE EXCEPTION 'Can''t merge a user into itself' USING ERRCODE = 'invalid_parameter_value';
+    END IF;
+
+    merged_threads := (SELECT COUNT(*) FROM parkmaildb."Thread" WHERE author = b);
+    merged_posts := (SELECT COUNT(*) FROM parkmaildb."Post" WHERE author = b);
+    merged_forums := (SELECT COUNT(*) FROM parkmaildb."Forum" WHERE "user" = b);
+    merged_memberships := (SELECT COUNT(*) FROM parkmaildb."Users_by_Forum" f WHERE f."user" = b
+        AND NOT EXISTS (SELECT 1 FROM parkmaildb."Users_by_Forum" o WHERE o."user" = a AND o.forum = f.forum));
+    vote_conflicts := (SELECT COUNT(*) FROM parkmaildb."Vote" v WHERE v."user" = b
+        AND EXISTS (SELECT 1 FROM parkmaildb."Vote" o WHERE o."user" = a AND o.threadid = v.threadid));
+    merged_votes := (SELECT COUNT(*) FROM parkmaildb."Vote" WHERE "user" = b) - vote_conflicts;
+    IF dry_run THEN
+        RETURN NEXT;
+        RETURN;
+    END IF;
+
+    affected := ARRAY(SELECT threadid FROM parkmaildb."Vote" WHERE "user" = b);
+    IF policy = 'replace' THEN
+        DELETE FROM parkmaildb."Vote" o USING parkmaildb."Vote" v
+        WHERE o."user" = a AND v."user" = b AND o.threadid = v.threadid;
+    ELSIF policy = 'drop' THEN
+        DELETE FROM parkmaildb."Vote" v
+        WHERE v."user" IN (a, b) AND v.threadid IN (
+            SELECT threadid FROM parkmaildb."Vote" WHERE "user" = a
+            INTERSECT
+            SELECT threadid FROM parkmaildb."Vote" WHERE "user" = b);
+    ELSE
+        DELETE FROM parkmaildb."Vote" v USING parkmaildb."Vote" o
+        WHERE v."user" = b AND o."user" = a AND o.threadid = v.threadid;
+    END IF;
+    UPDATE parkmaildb."Vote" SET "user" = a WHERE "user" = b;
+--     удаление голосов не трогает рейтинг веток, поэтому он считается заново
+    UPDATE parkmaildb."Thread" t SET votes = COALESCE((SELECT SUM(v.value) FROM parkmaildb."Vote" v WHERE v.threadid = t.id), 0)
+    WHERE t.id = ANY (affected);
+
+    UPDATE parkmaildb."Forum" SET "user" = a WHERE "user" = b;
+    UPDATE parkmaildb."Thread" SET author = a WHERE author = b;
+    UPDATE parkmaildb."Post" SET author = a WHERE author = b;
+    DELETE FROM parkmaildb."Users_by_Forum" f WHERE f."user" = b
+        AND EXISTS (SELECT 1 FROM parkmaildb."Users_by_Forum" o WHERE o."user" = a AND o.forum = f.forum);
+    UPDATE parkmaildb."Users_by_Forum" SET "user" = a WHERE "user" = b;
+
+    DELETE FROM parkmaildb."User" WHERE nickname = b;
+    RETURN NEXT;
+END
+$$ LANGUAGE 'plpgsql';
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS parkmaildb."User_password";
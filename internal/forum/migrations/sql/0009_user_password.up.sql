@@ -0,0 +1,15 @@
+-- Пароли пользователей (bcrypt). Отдельная таблица, а не столбец "User":
+-- пользователи, созданные до регистрации с паролем, просто не имеют строки.
+CREATE UNLOGGED TABLE IF NOT EXISTS parkmaildb."User_password"
+(
+    NickName CITEXT PRIMARY KEY REFERENCES parkmaildb."User" (NickName) ON UPDATE CASCADE ON DELETE CASCADE,
+    Hash     TEXT NOT NULL
+);
+
+DO $$
+BEGIN
+    IF (SELECT relpersistence FROM pg_class WHERE oid = 'parkmaildb."User"'::regclass) = 'p' THEN
+        ALTER TABLE parkmaildb."User_password" SET LOGGED;
+    END IF;
+END
+$$;
@@ -0,0 +1,23 @@
+-- Ключи API ботов и интеграций. Хранится SHA-256 ключа: ключ случайный и
+-- длинный, медленный хэш, как у паролей, ему не нужен, а искать его надо по индексу.
+CREATE UNLOGGED TABLE IF NOT EXISTS parkmaildb."User_key"
+(
+    Id        SERIAL PRIMARY KEY,
+    NickName  CITEXT      NOT NULL REFERENCES parkmaildb."User" (NickName) ON UPDATE CASCADE ON DELETE CASCADE,
+    Name      TEXT        NOT NULL,
+    Hash      TEXT        NOT NULL UNIQUE,
+    -- области через запятую, например 'read,post'
+    Scopes    TEXT        NOT NULL,
+    Created   TIMESTAMPTZ NOT NULL,
+    Last_used TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS user_key_nickname ON parkmaildb."User_key" (NickName);
+
+DO $$
+BEGIN
+    IF (SELECT relpersistence FROM pg_class WHERE oid = 'parkmaildb."User"'::regclass) = 'p' THEN
+        ALTER TABLE parkmaildb."User_key" SET LOGGED;
+    END IF;
+END
+$$;
@@ -0,0 +1 @@
+DROP FUNCTION IF EXISTS clean_forum(CITEXT, BOOLEAN);
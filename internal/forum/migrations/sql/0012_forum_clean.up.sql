@@ -0,0 +1,30 @@
+-- Удаление форума target со всеми ветками, сообщениями, голосами за его ветки,
+-- списком пользователей и модераторами; сами пользователи остаются. Возвращает
+-- slug форума и число удалённых строк; с dry_run только считает. Без строк в
+-- ответе, если форума нет.
+CREATE OR REPLACE FUNCTION clean_forum(target CITEXT, dry_run BOOLEAN)
+    RETURNS TABLE (cleaned_forum CITEXT, cleaned_threads BIGINT, cleaned_posts BIGINT, cleaned_votes BIGINT) AS $$
+BEGIN
+    SELECT slug INTO cleaned_forum FROM parkmaildb."Forum" WHERE slug = target FOR UPDATE;
+    IF NOT FOUND THEN
+        RETURN;
+    END IF;
+
+    cleaned_threads := (SELECT COUNT(*) FROM parkmaildb."Thread" WHERE forum = cleaned_forum);
+    cleaned_posts := (SELECT COUNT(*) FROM parkmaildb."Post" WHERE forum = cleaned_forum);
+    cleaned_votes := (SELECT COUNT(*) FROM parkmaildb."Vote" v JOIN parkmaildb."Thread" t ON t.id = v.threadid
+        WHERE t.forum = cleaned_forum);
+    IF dry_run THEN
+        RETURN NEXT;
+        RETURN;
+    END IF;
+
+    DELETE FROM parkmaildb."Vote" v USING parkmaildb."Thread" t WHERE t.id = v.threadid AND t.forum = cleaned_forum;
+    DELETE FROM parkmaildb."Post" WHERE forum = cleaned_forum;
+    DELETE FROM parkmaildb."Thread" WHERE forum = cleaned_forum;
+    DELETE FROM parkmaildb."Users_by_Forum" WHERE forum = cleaned_forum;
+    DELETE FROM parkmaildb."Forum_moderator" WHERE forum = cleaned_forum;
+    DELETE FROM parkmaildb."Forum" WHERE slug = cleaned_forum;
+    RETURN NEXT;
+END
+$$ LANGUAGE 'plpgsql';
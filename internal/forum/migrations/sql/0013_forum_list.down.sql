@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS parkmaildb.forum_threads_slug;
+DROP INDEX IF EXISTS parkmaildb.forum_posts_slug;
+DROP INDEX IF EXISTS parkmaildb.forum_title_prefix;
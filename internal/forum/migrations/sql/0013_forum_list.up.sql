@@ -0,0 +1,6 @@
+-- Список форумов GET /api/forums: поиск по префиксу названия и страницы по
+-- счётчикам, равные счётчики упорядочены по slug. Порядок по slug и по
+-- созданию (id) дают индексы самой таблицы.
+CREATE INDEX IF NOT EXISTS forum_title_prefix ON parkmaildb."Forum" (lower(title) text_pattern_ops);
+CREATE INDEX IF NOT EXISTS forum_posts_slug ON parkmaildb."Forum" (posts, slug);
+CREATE INDEX IF NOT EXISTS forum_threads_slug ON parkmaildb."Forum" (threads, slug);
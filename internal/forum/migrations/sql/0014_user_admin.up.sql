@@ -0,0 +1,16 @@
+-- Администраторы сайта. Роль хранится на аккаунте, а не сравнивается с
+-- nickname из конфигурации: при переименовании она переходит вместе с
+-- nickname, при удалении пропадает, поэтому освободившийся nickname её не даёт.
+-- Выдаётся только командой "admin grant".
+CREATE UNLOGGED TABLE IF NOT EXISTS parkmaildb."User_admin"
+(
+    NickName CITEXT PRIMARY KEY REFERENCES parkmaildb."User" (NickName) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+DO $$
+BEGIN
+    IF (SELECT relpersistence FROM pg_class WHERE oid = 'parkmaildb."User"'::regclass) = 'p' THEN
+        ALTER TABLE parkmaildb."User_admin" SET LOGGED;
+    END IF;
+END
+$$;
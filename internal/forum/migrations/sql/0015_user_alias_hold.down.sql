@@ -0,0 +1,6 @@
+CREATE OR REPLACE FUNCTION drop_user_alias() RETURNS TRIGGER AS $$
+BEGIN
+    DELETE FROM parkmaildb."User_alias" WHERE alias = NEW.nickname;
+    RETURN NULL;
+END
+$$ LANGUAGE 'plpgsql';
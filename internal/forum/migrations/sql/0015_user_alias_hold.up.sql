@@ -0,0 +1,22 @@
+-- Действующий псевдоним держит nickname до expires: регистрация и
+-- переименование в чужой псевдоним получают unique_violation (409), а не
+-- отбирают nickname у переименованного пользователя. Свой псевдоним и
+-- просроченный по-прежнему удаляются.
+CREATE OR REPLACE FUNCTION drop_user_alias() RETURNS TRIGGER AS $$
+DECLARE
+    previous CITEXT;
+BEGIN
+    IF TG_OP = 'UPDATE' THEN
+        previous := OLD.nickname;
+    END IF;
+
+    IF EXISTS (SELECT 1 FROM parkmaildb."User_alias"
+               WHERE alias = NEW.nickname AND expires > now()
+                 AND nickname <> NEW.nickname AND nickname IS DISTINCT FROM previous) THEN
+        RAISE unique_violation USING MESSAGE = 'nickname ' || NEW.nickname || ' is an alias of another user';
+    END IF;
+
+    DELETE FROM parkmaildb."User_alias" WHERE alias = NEW.nickname;
+    RETURN NULL;
+END
+$$ LANGUAGE 'plpgsql';
@@ -0,0 +1,50 @@
+-- Заглушка удалённых пользователей отличается от настоящего аккаунта с тем же
+-- nickname адресом deleted@invalid (models.DeletedUserEmail), который нельзя
+-- зарегистрировать. Пользователь "deleted",
+-- зарегистрированный до 0007, получал бы ветки и сообщения всех удалённых,
+-- поэтому миграция останавливается: такой аккаунт нужно переименовать
+-- вручную (UPDATE ... SET nickname, ссылки обновятся каскадно).
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM parkmaildb."User" WHERE nickname = 'deleted' AND email <> 'deleted@invalid')
+        OR EXISTS (SELECT 1 FROM parkmaildb."User" WHERE email = 'deleted@invalid' AND nickname <> 'deleted') THEN
+        RAISE EXCEPTION 'user "deleted" or email deleted@invalid belongs to a real account, rename it before migrating';
+    END IF;
+END
+$$;
+
+CREATE OR REPLACE FUNCTION delete_user(target CITEXT, placeholder CITEXT, placeholder_fullname TEXT, placeholder_email CITEXT)
+    RETURNS BOOLEAN AS $$
+DECLARE
+    nick CITEXT;
+    holder CITEXT;
+BEGIN
+    SELECT nickname INTO nick FROM parkmaildb."User" WHERE nickname = target FOR UPDATE;
+    IF NOT FOUND THEN
+        RETURN FALSE;
+    END IF;
+
+--     записи переходят только к самой заглушке, не к аккаунту с её nickname
+    SELECT email INTO holder FROM parkmaildb."User" WHERE nickname = placeholder FOR UPDATE;
+    IF NOT FOUND THEN
+        INSERT INTO parkmaildb."User" (nickname, fullname, about, email)
+        VALUES (placeholder, placeholder_fullname, '', placeholder_email);
+    ELSIF holder <> placeholder_email THEN
+        RAISE EXCEPTION 'user % is a real account, not the placeholder for deleted users', placeholder;
+    END IF;
+
+--     у пользователя не больше одного голоса за ветку
+    UPDATE parkmaildb."Thread" t SET votes = t.votes - v.value
+    FROM parkmaildb."Vote" v WHERE v.threadid = t.id AND v."user" = nick;
+    DELETE FROM parkmaildb."Vote" WHERE "user" = nick;
+
+    UPDATE parkmaildb."Forum" SET "user" = placeholder WHERE "user" = nick;
+    UPDATE parkmaildb."Thread" SET author = placeholder WHERE author = nick;
+    UPDATE parkmaildb."Post" SET author = placeholder WHERE author = nick;
+
+    DELETE FROM parkmaildb."Users_by_Forum" WHERE "user" = nick;
+--     псевдонимы удаляются каскадно
+    DELETE FROM parkmaildb."User" WHERE nickname = nick;
+    RETURN TRUE;
+END
+$$ LANGUAGE 'plpgsql';
@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"forum/internal/forum/config"
+)
+
+// durabilityTables в порядке внешних ключей: сначала таблицы, на которые ссылаются.
+// SET LOGGED идёт по списку, SET UNLOGGED в обратном порядке.
+var durabilityTables = []string{"User", "User_alias", "User_password", "User_key", "Forum", "Thread", "Post", "Users_by_Forum", "Vote", "Forum_moderator", "User_admin"}
+
+func (p *Postgres) logged(ctx context.Context, table string) (bool, error) {
+	var persistence string
+	err := p.DB.QueryRowEx(ctx, `SELECT relpersistence::text FROM pg_class WHERE oid = to_regclass($1)`, nil,
+		fmt.Sprintf(`parkmaildb."%s"`, table)).Scan(&persistence)
+	return persistence == "p", err
+}
+
+// SetDurability переводит таблицы в нужный режим и возвращает те, что пришлось изменить.
+// ALTER TABLE переписывает таблицу целиком, поэтому уже подходящие таблицы не трогаются.
+func (p *Postgres) SetDurability(ctx context.Context, mode string) ([]string, error) {
+	wantLogged := mode == config.DurabilityLogged
+	persistence := "LOGGED"
+	tables := append([]string(nil), durabilityTables...)
+	if !wantLogged {
+		persistence = "UNLOGGED"
+		for i, j := 0, len(tables)-1; i < j; i, j = i+1, j-1 {
+			tables[i], tables[j] = tables[j], tables[i]
+		}
+	}
+
+	var changed []string
+	for _, table := range tables {
+		logged, err := p.logged(ctx, table)
+		if err != nil {
+			return changed, err
+		}
+		if logged == wantLogged {
+			continue
+		}
+
+		if _, err = p.DB.ExecEx(ctx, fmt.Sprintf(`ALTER TABLE parkmaildb."%s" SET %s`, table, persistence), nil); err != nil {
+			return changed, err
+		}
+		changed = append(changed, table)
+	}
+	return changed, nil
+}
+
+// UnloggedTables таблицы, данные которых пропадут при аварийном перезапуске Postgres.
+func (p *Postgres) UnloggedTables(ctx context.Context) ([]string, error) {
+	var unlogged []string
+	for _, table := range durabilityTables {
+		logged, err := p.logged(ctx, table)
+		if err != nil {
+			return nil, err
+		}
+		if !logged {
+			unlogged = append(unlogged, table)
+		}
+	}
+	return unlogged, nil
+}
@@ -0,0 +1,34 @@
+package repository
+
+import (
+	"context"
+	"forum/internal/forum/migrations"
+	"github.com/pkg/errors"
+	"sync/atomic"
+)
+
+// Ping проверяет, что база отвечает.
+func (p *Postgres) Ping(ctx context.Context) error {
+	_, err := p.DB.ExecEx(ctx, "SELECT 1", nil)
+	return err
+}
+
+// CheckStatements проверяет, что ProcedureRequests успешно зарегистрировал запросы.
+func (p *Postgres) CheckStatements(ctx context.Context) error {
+	if atomic.LoadInt32(&p.prepared) == 0 {
+		return errors.New("prepared statements are not registered")
+	}
+	return nil
+}
+
+// CheckSchema проверяет, что применены все миграции, которые знает бинарник.
+func (p *Postgres) CheckSchema(ctx context.Context) error {
+	version, err := migrations.Migrator{DB: p.DB.ConnPool}.Version(ctx)
+	if err != nil {
+		return err
+	}
+	if latest := migrations.Latest(); version < latest {
+		return errors.Errorf("schema version %d, expected %d", version, latest)
+	}
+	return nil
+}
@@ -1,42 +1,51 @@
 package repository
 
 import (
+	"forum/internal/forum/config"
+	"forum/internal/utils/pgxtime"
+	repository5 "forum/pkg/apikey/repository"
 	"forum/pkg/forum/repository"
 	repository2 "forum/pkg/post/repository"
 	repository3 "forum/pkg/service/repository"
 	repository4 "forum/pkg/thread/repository"
 	"forum/pkg/user/repostitory"
 	"github.com/jackc/pgx"
+	"sync/atomic"
 )
 
 type Postgres struct {
-	DB *pgx.ConnPool
+	DB *pgxtime.Pool
+	// 1 после успешного ProcedureRequests.
+	prepared int32
 }
 
-func NewPostgres() (*Postgres, error) {
-	conf := pgx.ConnConfig{
-		User:                 "docker",
-		Database:             "docker",
-		Password:             "docker",
-		PreferSimpleProtocol: false,
+func NewPostgres(cfg config.Database) (*Postgres, error) {
+	conf, err := pgx.ParseConnectionString(cfg.DSN)
+	if err != nil {
+		return nil, err
 	}
+	conf.PreferSimpleProtocol = false
+	conf.Logger = driverLogger{}
+	conf.LogLevel = pgx.LogLevelWarn
 
 	poolConf := pgx.ConnPoolConfig{
 		ConnConfig:     conf,
-		MaxConnections: 100,
+		MaxConnections: cfg.MaxConnections,
 		AfterConnect:   nil,
-		AcquireTimeout: 0,
+		AcquireTimeout: cfg.AcquireTimeout.Duration,
 	}
 	db, err := pgx.NewConnPool(poolConf)
 	if err != nil {
 		return nil, err
 	}
+	registerPoolMetrics(db)
+
 	return &Postgres{
-		DB: db,
+		DB: &pgxtime.Pool{ConnPool: db, Observe: observeStatements(statementNames())},
 	}, nil
 }
 
-func (p *Postgres) GetPostgres() *pgx.ConnPool {
+func (p *Postgres) GetPostgres() *pgxtime.Pool {
 	return p.DB
 }
 
@@ -45,151 +54,120 @@ func (p *Postgres) Close() error {
 	return nil
 }
 
-func (p *Postgres) ProcedureRequests() error {
+// statements подготовленные запросы, которые регистрируются на каждом соединении пула.
+var statements = []struct {
+	name string
+	sql  string
+}{
+	//apikey
+	{"InsertKey", repository5.InsertKey},
+	{"SelectKeys", repository5.SelectKeys},
+	{"SelectKeyByHash", repository5.SelectKeyByHash},
+	{"DeleteKey", repository5.DeleteKey},
+	{"UpdateKeyUsed", repository5.UpdateKeyUsed},
+
 	//forum
-	if _, err := p.DB.Prepare("SelectUsersByForumDesc", repository.SelectUsersByForumDesc); err != nil {
-		return err
-	}
-	if _, err := p.DB.Prepare("SelectUsersByForumSince", repository.SelectUsersByForumSince); err != nil {
-		return err
-	}
-	if _, err := p.DB.Prepare("SelectUsersByForumSinceDesc", repository.SelectUsersByForumSinceDesc); err != nil {
-		return err
-	}
-	if _, err := p.DB.Prepare("SelectForum", repository.SelectForum); err != nil {
-		return err
-	}
-	if _, err := p.DB.Prepare("SelectUsersByForum", repository.SelectUsersByForum); err != nil {
-		return err
-	}
-	if _, err := p.DB.Prepare("InsertForum", repository.InsertForum); err != nil {
-		return err
-	}
+	{"SelectUsersByForumDesc", repository.SelectUsersByForumDesc},
+	{"SelectUsersByForumSince", repository.SelectUsersByForumSince},
+	{"SelectUsersByForumSinceDesc", repository.SelectUsersByForumSinceDesc},
+	{"SelectForum", repository.SelectForum},
+	{"SelectUsersByForum", repository.SelectUsersByForum},
+	{"InsertForum", repository.InsertForum},
+	{"InsertModerator", repository.InsertModerator},
+	{"DeleteModerator", repository.DeleteModerator},
+	{"SelectModerators", repository.SelectModerators},
+	{"SelectIsModerator", repository.SelectIsModerator},
+	{"CountForums", repository.CountForums},
+	{"SelectForumsBySlug", repository.SelectForumsBySlug},
+	{"SelectForumsBySlugDesc", repository.SelectForumsBySlugDesc},
+	{"SelectForumsByPosts", repository.SelectForumsByPosts},
+	{"SelectForumsByPostsDesc", repository.SelectForumsByPostsDesc},
+	{"SelectForumsByThreads", repository.SelectForumsByThreads},
+	{"SelectForumsByThreadsDesc", repository.SelectForumsByThreadsDesc},
+	{"SelectForumsByCreated", repository.SelectForumsByCreated},
+	{"SelectForumsByCreatedDesc", repository.SelectForumsByCreatedDesc},
 
 	//post
-	if _, err := p.DB.Prepare("GetPostsTreeDesc", repository2.GetPostsTreeDesc); err != nil {
-		return err
-	}
-	if _, err := p.DB.Prepare("GetPostsTree", repository2.GetPostsTree); err != nil {
-		return err
-	}
-	if _, err := p.DB.Prepare("GetPostsFlat", repository2.GetPostsFlat); err != nil {
-		return err
-	}
-	if _, err := p.DB.Prepare("GetPostParent", repository2.GetPostParent); err != nil {
-		return err
-	}
-	if _, err := p.DB.Prepare("GetPostsFlatDesc", repository2.GetPostsFlatDesc); err != nil {
-		return err
-	}
-	if _, err := p.DB.Prepare("GetPostsFlatSince", repository2.GetPostsFlatSince); err != nil {
-		return err
-	}
-	if _, err := p.DB.Prepare("GetPostsFlatSinceDesc", repository2.GetPostsFlatSinceDesc); err != nil {
-		return err
-	}
-	if _, err := p.DB.Prepare("GetPostsParent", repository2.GetPostsParent); err != nil {
-		return err
-	}
-	if _, err := p.DB.Prepare("GetPostsTreeSinceDesc", repository2.GetPostsTreeSinceDesc); err != nil {
-		return err
-	}
-	if _, err := p.DB.Prepare("GetPostsTreeSince", repository2.GetPostsTreeSince); err != nil {
-		return err
-	}
-	if _, err := p.DB.Prepare("GetPostsParentDesc", repository2.GetPostsParentDesc); err != nil {
-		return err
-	}
-	if _, err := p.DB.Prepare("GetPostsParentSinceDesc", repository2.GetPostsParentSinceDesc); err != nil {
-		return err
-	}
-	if _, err := p.DB.Prepare("GetPostsParentSince", repository2.GetPostsParentSince); err != nil {
-		return err
-	}
-	if _, err := p.DB.Prepare("SelectPostInfo", repository2.SelectPostInfo); err != nil {
-		return err
-	}
-	if _, err := p.DB.Prepare("SelectPostInfoUser", repository2.SelectPostInfoUser); err != nil {
-		return err
-	}
-	if _, err := p.DB.Prepare("SelectPostInfoThread", repository2.SelectPostInfoThread); err != nil {
-		return err
-	}
-	if _, err := p.DB.Prepare("SelectPostInfoForum", repository2.SelectPostInfoForum); err != nil {
-		return err
-	}
-	if _, err := p.DB.Prepare("UpdatePost", repository2.UpdatePost); err != nil {
-		return err
-	}
+	{"GetPostsTreeDesc", repository2.GetPostsTreeDesc},
+	{"GetPostsTree", repository2.GetPostsTree},
+	{"GetPostsFlat", repository2.GetPostsFlat},
+	{"GetPostParent", repository2.GetPostParent},
+	{"GetPostsFlatDesc", repository2.GetPostsFlatDesc},
+	{"GetPostsFlatSince", repository2.GetPostsFlatSince},
+	{"GetPostsFlatSinceDesc", repository2.GetPostsFlatSinceDesc},
+	{"GetPostsParent", repository2.GetPostsParent},
+	{"GetPostsTreeSinceDesc", repository2.GetPostsTreeSinceDesc},
+	{"GetPostsTreeSince", repository2.GetPostsTreeSince},
+	{"GetPostsParentDesc", repository2.GetPostsParentDesc},
+	{"GetPostsParentSinceDesc", repository2.GetPostsParentSinceDesc},
+	{"GetPostsParentSince", repository2.GetPostsParentSince},
+	{"SelectPostInfo", repository2.SelectPostInfo},
+	{"SelectPostInfoUser", repository2.SelectPostInfoUser},
+	{"SelectPostInfoThread", repository2.SelectPostInfoThread},
+	{"SelectPostInfoForum", repository2.SelectPostInfoForum},
+	{"UpdatePost", repository2.UpdatePost},
+	{"SelectPostsByUserDesc", repository2.SelectPostsByUserDesc},
+	{"SelectPostsByUser", repository2.SelectPostsByUser},
+	{"SelectPostsByUserSinceDesc", repository2.SelectPostsByUserSinceDesc},
+	{"SelectPostsByUserSince", repository2.SelectPostsByUserSince},
 
 	//service
-	if _, err := p.DB.Prepare("CleanDB", repository3.CleanDB); err != nil {
-		return err
-	}
-	if _, err := p.DB.Prepare("StatusPost", repository3.StatusPost); err != nil {
-		return err
-	}
-	if _, err := p.DB.Prepare("StatusUser", repository3.StatusUser); err != nil {
-		return err
-	}
-	if _, err := p.DB.Prepare("StatusForum", repository3.StatusForum); err != nil {
-		return err
-	}
-	if _, err := p.DB.Prepare("StatusThread", repository3.StatusThread); err != nil {
-		return err
-	}
+	{"CleanDB", repository3.CleanDB},
+	{"CleanCount", repository3.CleanCount},
+	{"CleanForum", repository3.CleanForum},
+	{"StatusPost", repository3.StatusPost},
+	{"StatusUser", repository3.StatusUser},
+	{"StatusForum", repository3.StatusForum},
+	{"StatusThread", repository3.StatusThread},
+	{"MergeUsers", repository3.MergeUsers},
 
 	//thread
-	if _, err := p.DB.Prepare("SelectThreadIdBySlug", repository4.SelectThreadIdBySlug); err != nil {
-		return err
-	}
-	if _, err := p.DB.Prepare("InsertVote", repository4.InsertVote); err != nil {
-		return err
-	}
-	if _, err := p.DB.Prepare("UpdateVote", repository4.UpdateVote); err != nil {
-		return err
-	}
-	if _, err := p.DB.Prepare("UpdateThreadId", repository4.UpdateThreadId); err != nil {
-		return err
-	}
-	if _, err := p.DB.Prepare("UpdateThreadSlug", repository4.UpdateThreadSlug); err != nil {
-		return err
-	}
-	if _, err := p.DB.Prepare("SelectThreadInfoBySlug", repository4.SelectThreadInfoBySlug); err != nil {
-		return err
-	}
-	if _, err := p.DB.Prepare("SelectThreadInfoById", repository4.SelectThreadInfoById); err != nil {
-		return err
-	}
-	if _, err := p.DB.Prepare("SelectThreadDesc", repository4.SelectThreadDesc); err != nil {
-		return err
-	}
-	if _, err := p.DB.Prepare("SelectThread", repository4.SelectThread); err != nil {
-		return err
-	}
-	if _, err := p.DB.Prepare("SelectThreadSinceDesc", repository4.SelectThreadSinceDesc); err != nil {
-		return err
-	}
-	if _, err := p.DB.Prepare("SelectThreadSince", repository4.SelectThreadSince); err != nil {
-		return err
-	}
-	if _, err := p.DB.Prepare("InsertThread", repository4.InsertThread); err != nil {
-		return err
-	}
+	{"SelectThreadIdBySlug", repository4.SelectThreadIdBySlug},
+	{"InsertVote", repository4.InsertVote},
+	{"UpdateVote", repository4.UpdateVote},
+	{"UpdateThreadId", repository4.UpdateThreadId},
+	{"UpdateThreadSlug", repository4.UpdateThreadSlug},
+	{"SelectThreadInfoBySlug", repository4.SelectThreadInfoBySlug},
+	{"SelectThreadInfoById", repository4.SelectThreadInfoById},
+	{"SelectThreadDesc", repository4.SelectThreadDesc},
+	{"SelectThread", repository4.SelectThread},
+	{"SelectThreadSinceDesc", repository4.SelectThreadSinceDesc},
+	{"SelectThreadSince", repository4.SelectThreadSince},
+	{"InsertThread", repository4.InsertThread},
+	{"SelectThreadsByUserDesc", repository4.SelectThreadsByUserDesc},
+	{"SelectThreadsByUser", repository4.SelectThreadsByUser},
+	{"SelectThreadsByUserSinceDesc", repository4.SelectThreadsByUserSinceDesc},
+	{"SelectThreadsByUserSince", repository4.SelectThreadsByUserSince},
 
 	//user
-	if _, err := p.DB.Prepare("InsertUser", repostitory.InsertUser); err != nil {
-		return err
-	}
-	if _, err := p.DB.Prepare("SelectUser", repostitory.SelectUser); err != nil {
-		return err
-	}
-	if _, err := p.DB.Prepare("UpdateUser", repostitory.UpdateUser); err != nil {
-		return err
-	}
-	if _, err := p.DB.Prepare("SelectUserByNick", repostitory.SelectUserByNick); err != nil {
-		return err
+	{"InsertUser", repostitory.InsertUser},
+	{"SelectUser", repostitory.SelectUser},
+	{"UpdateUser", repostitory.UpdateUser},
+	{"SelectUserByNick", repostitory.SelectUserByNick},
+	{"SelectUserCredentials", repostitory.SelectUserCredentials},
+	{"SelectUsers", repostitory.SelectUsers},
+	{"SelectUsersDesc", repostitory.SelectUsersDesc},
+	{"CountUsers", repostitory.CountUsers},
+	{"SelectUserStats", repostitory.SelectUserStats},
+	{"RenameUser", repostitory.RenameUser},
+	{"DeleteUser", repostitory.DeleteUser},
+	{"ExportUserThreads", repostitory.ExportUserThreads},
+	{"ExportUserPosts", repostitory.ExportUserPosts},
+	{"ExportUserVotes", repostitory.ExportUserVotes},
+	{"ExportUserForums", repostitory.ExportUserForums},
+	{"SelectIsAdmin", repostitory.SelectIsAdmin},
+	{"InsertAdmin", repostitory.InsertAdmin},
+	{"DeleteAdmin", repostitory.DeleteAdmin},
+	{"SelectAdmins", repostitory.SelectAdmins},
+}
+
+func (p *Postgres) ProcedureRequests() error {
+	for _, statement := range statements {
+		if _, err := p.DB.Prepare(statement.name, statement.sql); err != nil {
+			return err
+		}
 	}
 
+	atomic.StoreInt32(&p.prepared, 1)
 	return nil
 }
@@ -0,0 +1,101 @@
+package repository
+
+import (
+	"forum/internal/utils/pgxtime"
+	"github.com/jackc/pgx"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sirupsen/logrus"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	statementCalls = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "db_statement_calls_total",
+		Help: "Calls of prepared statements registered by ProcedureRequests.",
+	}, []string{"statement", "result"})
+	statementDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "db_statement_duration_seconds",
+		Help: "Latency of successful prepared statement calls.",
+	}, []string{"statement"})
+
+	poolMetricsOnce sync.Once
+	currentPool     atomic.Value
+)
+
+// statementNames сопоставляет имя и текст подготовленного запроса с меткой.
+// Запрос можно вызвать и по имени, и по тексту. У одинаковых по тексту
+// запросов метка содержит все имена через запятую.
+func statementNames() map[string]string {
+	bySQL := make(map[string][]string)
+	for _, statement := range statements {
+		bySQL[statement.sql] = append(bySQL[statement.sql], statement.name)
+	}
+
+	names := make(map[string]string, len(statements)*2)
+	for _, statement := range statements {
+		label := strings.Join(bySQL[statement.sql], ",")
+		names[statement.name] = label
+		names[statement.sql] = label
+	}
+	return names
+}
+
+// observeStatements считает метрики по замерам pgxtime.Pool; запросы не из
+// ProcedureRequests не учитываются.
+func observeStatements(names map[string]string) pgxtime.Observe {
+	return func(sql string, elapsed time.Duration, err error) {
+		name, ok := names[sql]
+		if !ok {
+			return
+		}
+		if err != nil {
+			statementCalls.WithLabelValues(name, "error").Inc()
+			return
+		}
+		statementCalls.WithLabelValues(name, "ok").Inc()
+		statementDuration.WithLabelValues(name).Observe(elapsed.Seconds())
+	}
+}
+
+// driverLogger пишет предупреждения и ошибки pgx в logrus. Уровень Info не
+// включать: на нём pgx на каждый запрос собирает запись с копией аргументов.
+type driverLogger struct{}
+
+func (driverLogger) Log(level pgx.LogLevel, msg string, data map[string]interface{}) {
+	switch {
+	case level <= pgx.LogLevelError:
+		logrus.WithFields(data).Error("pgx: " + msg)
+	case level == pgx.LogLevelWarn:
+		logrus.WithFields(data).Warn("pgx: " + msg)
+	}
+}
+
+func poolStat(get func(s pgx.ConnPoolStat) int) func() float64 {
+	return func() float64 {
+		pool, ok := currentPool.Load().(*pgx.ConnPool)
+		if !ok {
+			return 0
+		}
+		return float64(get(pool.Stat()))
+	}
+}
+
+// registerPoolMetrics публикует статистику пула; метрики регистрируются один раз
+// и всегда показывают последний созданный пул.
+func registerPoolMetrics(pool *pgx.ConnPool) {
+	currentPool.Store(pool)
+	poolMetricsOnce.Do(func() {
+		promauto.NewGaugeFunc(prometheus.GaugeOpts{Name: "pgx_pool_max_connections", Help: "Maximum size of the pgx connection pool."},
+			poolStat(func(s pgx.ConnPoolStat) int { return s.MaxConnections }))
+		promauto.NewGaugeFunc(prometheus.GaugeOpts{Name: "pgx_pool_current_connections", Help: "Open connections in the pgx pool."},
+			poolStat(func(s pgx.ConnPoolStat) int { return s.CurrentConnections }))
+		promauto.NewGaugeFunc(prometheus.GaugeOpts{Name: "pgx_pool_available_connections", Help: "Idle connections in the pgx pool."},
+			poolStat(func(s pgx.ConnPoolStat) int { return s.AvailableConnections }))
+		promauto.NewGaugeFunc(prometheus.GaugeOpts{Name: "pgx_pool_acquired_connections", Help: "Connections checked out of the pgx pool."},
+			poolStat(func(s pgx.ConnPoolStat) int { return s.CheckedOutConnections() }))
+	})
+}
@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"context"
+	"forum/internal/forum/config"
+	"forum/internal/forum/contract"
+	"forum/internal/forum/migrations"
+	repository5 "forum/pkg/apikey/repository"
+	"forum/pkg/forum/repository"
+	"forum/pkg/models"
+	repository2 "forum/pkg/post/repository"
+	repository3 "forum/pkg/service/repository"
+	repository4 "forum/pkg/thread/repository"
+	"forum/pkg/user/repostitory"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"os"
+	"testing"
+)
+
+// TestContract запускается только при заданном FORUM_TEST_DSN: тест очищает
+// все таблицы, поэтому указывать рабочую базу нельзя. В CI задан и
+// FORUM_TEST_REQUIRE_POSTGRES, тогда без базы тест падает, а не пропускается.
+func TestContract(t *testing.T) {
+	dsn := os.Getenv("FORUM_TEST_DSN")
+	if dsn == "" {
+		if os.Getenv("FORUM_TEST_REQUIRE_POSTGRES") != "" {
+			t.Fatal("FORUM_TEST_REQUIRE_POSTGRES is set but FORUM_TEST_DSN is empty")
+		}
+		t.Log("WARNING: FORUM_TEST_DSN is not set, the Postgres repositories and migrations are NOT tested.")
+		t.Log("WARNING: point FORUM_TEST_DSN at a disposable database to run the contract suite against Postgres.")
+		t.Skip("FORUM_TEST_DSN is not set")
+	}
+
+	cfg := config.Default().Database
+	cfg.DSN = dsn
+	cfg.MaxConnections = 10
+	db, err := NewPostgres(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	if _, err = (&migrations.Migrator{DB: db.DB.ConnPool}).Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = db.SetDurability(ctx, config.DurabilityLogged); err != nil {
+		t.Fatal(err)
+	}
+	if err = db.ProcedureRequests(); err != nil {
+		t.Fatal(err)
+	}
+
+	contract.Run(t, func(t *testing.T) contract.Repositories {
+		service := repository3.ServiceRepository{DB: db.DB}
+		if _, err := service.CleanDb(ctx, models.Clean{}); err != nil {
+			t.Fatal(err)
+		}
+		return contract.Repositories{
+			User:    &repostitory.UserRepository{DB: db.DB},
+			Forum:   &repository.ForumRepository{DB: db.DB},
+			Thread:  &repository4.ThreadRepository{DB: db.DB},
+			Post:    &repository2.PostRepository{DB: db.DB},
+			Service: service,
+			Key:     repository5.KeyRepository{DB: db.DB},
+		}
+	})
+
+	// замеры идут через pgxtime.Pool, а не через логгер pgx
+	if calls := testutil.ToFloat64(statementCalls.WithLabelValues("SelectUser", "ok")); calls == 0 {
+		t.Fatal("db_statement_calls_total has no SelectUser calls")
+	}
+	if series := testutil.CollectAndCount(statementDuration, "db_statement_duration_seconds"); series == 0 {
+		t.Fatal("db_statement_duration_seconds is empty")
+	}
+}
@@ -0,0 +1,105 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"forum/internal/utils/errs"
+	"forum/internal/utils/logger"
+	"forum/pkg/models"
+	"strings"
+	"time"
+)
+
+const (
+	insertKey = `INSERT INTO "User_key" (nickname, name, hash, scopes, created) VALUES (?, ?, ?, ?, ?)
+					RETURNING id, nickname`
+	selectKeys = `SELECT id, nickname, name, scopes, created, last_used FROM "User_key"
+					WHERE nickname = ? ORDER BY id`
+	selectKeyByHash = `SELECT id, nickname, name, scopes, created, last_used FROM "User_key" WHERE hash = ?`
+	deleteKey       = `DELETE FROM "User_key" WHERE nickname = ? AND id = ?`
+	updateKeyUsed   = `UPDATE "User_key" SET last_used = ? WHERE id = ?`
+)
+
+type KeyRepository struct {
+	DB *sql.DB
+}
+
+func (k KeyRepository) AddKey(ctx context.Context, key models.APIKey) (models.APIKey, error) {
+	err := k.DB.QueryRowContext(ctx, insertKey, key.Nickname, key.Name, key.Hash, strings.Join(key.Scopes, ","), toMicros(key.Created)).
+		Scan(&key.Id, &key.Nickname)
+	if err != nil {
+		logger.FromContext(ctx).Debug(err)
+		return models.APIKey{}, fromSqlite(err, models.MissingUser)
+	}
+	return key, nil
+}
+
+type keyScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanKey(row keyScanner) (models.APIKey, error) {
+	var key models.APIKey
+	var scopes string
+	var created int64
+	var used sql.NullInt64
+
+	if err := row.Scan(&key.Id, &key.Nickname, &key.Name, &scopes, &created, &used); err != nil {
+		return models.APIKey{}, err
+	}
+	key.Scopes = strings.Split(scopes, ",")
+	key.Created = fromMicros(created)
+	if used.Valid {
+		t := fromMicros(used.Int64)
+		key.LastUsed = &t
+	}
+	return key, nil
+}
+
+func (k KeyRepository) FindKeys(ctx context.Context, nickname string) ([]models.APIKey, error) {
+	rows, err := k.DB.QueryContext(ctx, selectKeys, nickname)
+	if err != nil {
+		logger.FromContext(ctx).Debug(err)
+		return nil, fromSqlite(err, models.MissingUser)
+	}
+	defer rows.Close()
+
+	keys := []models.APIKey{}
+	for rows.Next() {
+		key, err := scanKey(rows)
+		if err != nil {
+			logger.FromContext(ctx).Debug(err)
+			return nil, fromSqlite(err, models.MissingUser)
+		}
+		keys = append(keys, key)
+	}
+	return keys, fromSqlite(rows.Err(), models.MissingUser)
+}
+
+func (k KeyRepository) GetKeyByHash(ctx context.Context, hash string) (models.APIKey, error) {
+	key, err := scanKey(k.DB.QueryRowContext(ctx, selectKeyByHash, hash))
+	if err != nil {
+		return models.APIKey{}, fromSqlite(err, models.MissingKey)
+	}
+	return key, nil
+}
+
+func (k KeyRepository) DeleteKey(ctx context.Context, nickname string, id int) error {
+	result, err := k.DB.ExecContext(ctx, deleteKey, nickname, id)
+	if err != nil {
+		logger.FromContext(ctx).Debug(err)
+		return fromSqlite(err, models.MissingKey)
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		return errs.NotFound(models.MissingKey)
+	}
+	return nil
+}
+
+func (k KeyRepository) TouchKey(ctx context.Context, id int, used time.Time) error {
+	_, err := k.DB.ExecContext(ctx, updateKeyUsed, toMicros(used), id)
+	if err != nil {
+		logger.FromContext(ctx).Debug(err)
+	}
+	return fromSqlite(err, models.MissingKey)
+}
@@ -0,0 +1,194 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"forum/internal/utils/errs"
+	"forum/internal/utils/logger"
+	"forum/internal/utils/utils"
+	"forum/pkg/models"
+)
+
+const (
+	selectUsersByForumDesc      = `SELECT U.nickname, U.fullname, U.about, U.email FROM "Users_by_Forum" users INNER JOIN "User" U ON U.nickname = users."user" AND users.forum = ? ORDER BY users."user" DESC LIMIT ?`
+	selectUsersByForum          = `SELECT U.nickname, U.fullname, U.about, U.email FROM "Users_by_Forum" users INNER JOIN "User" U ON U.nickname = users."user" AND users.forum = ? ORDER BY users."user" LIMIT ?`
+	selectUsersByForumSinceDesc = `SELECT U.nickname, U.fullname, U.about, U.email FROM "Users_by_Forum" users INNER JOIN "User" U ON U.nickname = users."user" AND users.forum = ? AND U.nickname < ? ORDER BY users."user" DESC LIMIT ?`
+	selectUsersByForumSince     = `SELECT U.nickname, U.fullname, U.about, U.email FROM "Users_by_Forum" users INNER JOIN "User" U ON U.nickname = users."user" AND users.forum = ? AND U.nickname > ? ORDER BY users."user" LIMIT ?`
+	insertForum                 = `INSERT INTO "Forum" (title, "user", slug, posts, threads) VALUES (?, (SELECT nickname FROM "User" WHERE nickname = ?), ?, 0, 0) RETURNING "user"`
+	selectForum                 = `SELECT slug, title, "user", posts, threads FROM "Forum" WHERE slug = ?`
+	insertModerator             = `INSERT INTO "Forum_moderator" (forum, "user") VALUES (?, ?) ON CONFLICT DO NOTHING`
+	deleteModerator             = `DELETE FROM "Forum_moderator" WHERE forum = ? AND "user" = ?`
+	selectModerators            = `SELECT U.nickname, U.fullname, U.about, U.email FROM "Forum_moderator" m INNER JOIN "User" U ON U.nickname = m."user" AND m.forum = ? ORDER BY U.nickname`
+	selectIsModerator           = `SELECT EXISTS (SELECT 1 FROM "Forum_moderator" WHERE forum = ? AND "user" = ?)`
+	countForums                 = `SELECT COUNT(*) FROM "Forum" WHERE fold(title) LIKE ?1 ESCAPE '\'`
+)
+
+// ?1 шаблон из utils.LikePrefix, ?2 slug последнего форума предыдущей страницы или пустая строка.
+const selectForums = `SELECT f.slug, f.title, f."user", f.posts, f.threads FROM "Forum" f
+					WHERE fold(f.title) LIKE ?1 ESCAPE '\' AND `
+
+// forumsQueries запросы FindForums для каждого порядка: по возрастанию и по убыванию.
+var forumsQueries = map[string][2]string{
+	models.ForumSortSlug: {
+		selectForums + `(?2 = '' OR f.slug > ?2) ORDER BY f.slug LIMIT ?3`,
+		selectForums + `(?2 = '' OR f.slug < ?2) ORDER BY f.slug DESC LIMIT ?3`,
+	},
+	models.ForumSortPosts: {
+		selectForums + `(?2 = '' OR (f.posts, f.slug) > (SELECT s.posts, s.slug FROM "Forum" s WHERE s.slug = ?2)) ORDER BY f.posts, f.slug LIMIT ?3`,
+		selectForums + `(?2 = '' OR (f.posts, f.slug) < (SELECT s.posts, s.slug FROM "Forum" s WHERE s.slug = ?2)) ORDER BY f.posts DESC, f.slug DESC LIMIT ?3`,
+	},
+	models.ForumSortThreads: {
+		selectForums + `(?2 = '' OR (f.threads, f.slug) > (SELECT s.threads, s.slug FROM "Forum" s WHERE s.slug = ?2)) ORDER BY f.threads, f.slug LIMIT ?3`,
+		selectForums + `(?2 = '' OR (f.threads, f.slug) < (SELECT s.threads, s.slug FROM "Forum" s WHERE s.slug = ?2)) ORDER BY f.threads DESC, f.slug DESC LIMIT ?3`,
+	},
+	models.ForumSortCreated: {
+		selectForums + `(?2 = '' OR f.id > (SELECT s.id FROM "Forum" s WHERE s.slug = ?2)) ORDER BY f.id LIMIT ?3`,
+		selectForums + `(?2 = '' OR f.id < (SELECT s.id FROM "Forum" s WHERE s.slug = ?2)) ORDER BY f.id DESC LIMIT ?3`,
+	},
+}
+
+type ForumRepository struct {
+	DB *sql.DB
+}
+
+func (r ForumRepository) FindUsers(ctx context.Context, slug string, params models.ParamsForSearch) ([]models.User, error) {
+	if err := checkLimit(params.Limit); err != nil {
+		return nil, err
+	}
+
+	var rows *sql.Rows
+	var err error
+
+	if params.Since == "" {
+		if params.Desc {
+			rows, err = r.DB.QueryContext(ctx, selectUsersByForumDesc, slug, params.Limit)
+		} else {
+			rows, err = r.DB.QueryContext(ctx, selectUsersByForum, slug, params.Limit)
+		}
+	} else {
+		if params.Desc {
+			rows, err = r.DB.QueryContext(ctx, selectUsersByForumSinceDesc, slug, params.Since, params.Limit)
+		} else {
+			rows, err = r.DB.QueryContext(ctx, selectUsersByForumSince, slug, params.Since, params.Limit)
+		}
+	}
+	if err != nil {
+		logger.FromContext(ctx).Debug(err)
+		return nil, fromSqlite(err, models.ErrForumNotFound)
+	}
+	defer rows.Close()
+
+	var users []models.User
+	for rows.Next() {
+		var user models.User
+		if err = rows.Scan(&user.Nickname, &user.Fullname, &user.About, &user.Email); err != nil {
+			return nil, fromSqlite(err, models.ErrForumNotFound)
+		}
+		users = append(users, user)
+	}
+	return users, fromSqlite(rows.Err(), models.ErrForumNotFound)
+}
+
+func (r ForumRepository) CreateForum(ctx context.Context, forum models.Forum) (models.Forum, error) {
+	err := r.DB.QueryRowContext(ctx, insertForum, forum.Title, forum.User, forum.Slug).Scan(&forum.User)
+	return forum, fromSqlite(err, models.ErrUserUnknown)
+}
+
+func (r ForumRepository) GetForumInfo(ctx context.Context, slug string) (models.Forum, error) {
+	var forum models.Forum
+	err := r.DB.QueryRowContext(ctx, selectForum, slug).Scan(&forum.Slug, &forum.Title, &forum.User, &forum.Posts, &forum.Threads)
+	if err != nil {
+		logger.FromContext(ctx).Debug(err)
+		return models.Forum{}, fromSqlite(err, models.ErrForumNotFound)
+	}
+
+	return forum, nil
+}
+
+func (r ForumRepository) AddModerator(ctx context.Context, slug string, nickname string) error {
+	_, err := r.DB.ExecContext(ctx, insertModerator, slug, nickname)
+	if err != nil {
+		logger.FromContext(ctx).Debug(err)
+	}
+	return fromSqlite(err, models.ErrForumNotFound)
+}
+
+func (r ForumRepository) RemoveModerator(ctx context.Context, slug string, nickname string) error {
+	result, err := r.DB.ExecContext(ctx, deleteModerator, slug, nickname)
+	if err != nil {
+		logger.FromContext(ctx).Debug(err)
+		return fromSqlite(err, models.ErrNotAppointed)
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		return errs.NotFound(models.ErrNotAppointed)
+	}
+	return nil
+}
+
+func (r ForumRepository) FindModerators(ctx context.Context, slug string) ([]models.User, error) {
+	rows, err := r.DB.QueryContext(ctx, selectModerators, slug)
+	if err != nil {
+		logger.FromContext(ctx).Debug(err)
+		return nil, fromSqlite(err, models.ErrForumNotFound)
+	}
+	defer rows.Close()
+
+	users := []models.User{}
+	for rows.Next() {
+		var user models.User
+		if err = rows.Scan(&user.Nickname, &user.Fullname, &user.About, &user.Email); err != nil {
+			return nil, fromSqlite(err, models.ErrForumNotFound)
+		}
+		users = append(users, user)
+	}
+	return users, fromSqlite(rows.Err(), models.ErrForumNotFound)
+}
+
+func (r ForumRepository) IsModerator(ctx context.Context, slug string, nickname string) (bool, error) {
+	var moderator bool
+	err := r.DB.QueryRowContext(ctx, selectIsModerator, slug, nickname).Scan(&moderator)
+	if err != nil {
+		logger.FromContext(ctx).Debug(err)
+	}
+	return moderator, fromSqlite(err, models.ErrForumNotFound)
+}
+
+func (r ForumRepository) FindForums(ctx context.Context, params models.ForumSearch) ([]models.Forum, error) {
+	queries, ok := forumsQueries[params.Sort]
+	if !ok {
+		return nil, errs.Invalid(models.ErrForumSort)
+	}
+	if err := checkLimit(params.Limit); err != nil {
+		return nil, err
+	}
+	query := queries[0]
+	if params.Desc {
+		query = queries[1]
+	}
+
+	rows, err := r.DB.QueryContext(ctx, query, utils.LikePrefix(params.Query), params.Since, params.Limit)
+	if err != nil {
+		logger.FromContext(ctx).Debug(err)
+		return nil, fromSqlite(err, models.ErrForumNotFound)
+	}
+	defer rows.Close()
+
+	forums := []models.Forum{}
+	for rows.Next() {
+		var forum models.Forum
+		if err = rows.Scan(&forum.Slug, &forum.Title, &forum.User, &forum.Posts, &forum.Threads); err != nil {
+			return nil, fromSqlite(err, models.ErrForumNotFound)
+		}
+		forums = append(forums, forum)
+	}
+	return forums, fromSqlite(rows.Err(), models.ErrForumNotFound)
+}
+
+func (r ForumRepository) CountForums(ctx context.Context, query string) (int64, error) {
+	var count int64
+	err := r.DB.QueryRowContext(ctx, countForums, utils.LikePrefix(query)).Scan(&count)
+	if err != nil {
+		logger.FromContext(ctx).Debug(err)
+	}
+	return count, fromSqlite(err, models.ErrForumNotFound)
+}
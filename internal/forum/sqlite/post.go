@@ -0,0 +1,234 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"forum/internal/utils/errs"
+	"forum/internal/utils/logger"
+	"forum/internal/utils/utils"
+	"forum/pkg/models"
+	"time"
+)
+
+const (
+	postColumns = `id, parent, author, message, isedited, forum, thread, created`
+
+	getPostsTreeDesc      = `SELECT ` + postColumns + ` FROM "Post" WHERE thread = ? ORDER BY path DESC, id DESC LIMIT ?`
+	getPostsTree          = `SELECT ` + postColumns + ` FROM "Post" WHERE thread = ? ORDER BY path, id LIMIT ?`
+	getPostsTreeSinceDesc = `SELECT ` + postColumns + ` FROM "Post" WHERE thread = ? AND path < (SELECT path FROM "Post" WHERE id = ?) ORDER BY path DESC, id DESC LIMIT ?`
+	getPostsTreeSince     = `SELECT ` + postColumns + ` FROM "Post" WHERE thread = ? AND path > (SELECT path FROM "Post" WHERE id = ?) ORDER BY path, id LIMIT ?`
+
+	getPostsParentDesc      = `SELECT ` + postColumns + ` FROM "Post" WHERE root IN (SELECT id FROM "Post" WHERE thread = ? AND parent = 0 ORDER BY id DESC LIMIT ?) ORDER BY root DESC, path, id`
+	getPostsParent          = `SELECT ` + postColumns + ` FROM "Post" WHERE root IN (SELECT id FROM "Post" WHERE thread = ? AND parent = 0 ORDER BY id LIMIT ?) ORDER BY path, id`
+	getPostsParentSinceDesc = `SELECT ` + postColumns + ` FROM "Post" WHERE root IN (SELECT id FROM "Post" WHERE thread = ? AND parent = 0 AND root < (SELECT root FROM "Post" WHERE id = ?) ORDER BY id DESC LIMIT ?) ORDER BY root DESC, path, id`
+	getPostsParentSince     = `SELECT ` + postColumns + ` FROM "Post" WHERE root IN (SELECT id FROM "Post" WHERE thread = ? AND parent = 0 AND root > (SELECT root FROM "Post" WHERE id = ?) ORDER BY id LIMIT ?) ORDER BY path, id`
+
+	getPostsFlatDesc      = `SELECT ` + postColumns + ` FROM "Post" WHERE thread = ? ORDER BY id DESC LIMIT ?`
+	getPostsFlat          = `SELECT ` + postColumns + ` FROM "Post" WHERE thread = ? ORDER BY id LIMIT ?`
+	getPostsFlatSinceDesc = `SELECT ` + postColumns + ` FROM "Post" WHERE thread = ? AND id < ? ORDER BY id DESC LIMIT ?`
+	getPostsFlatSince     = `SELECT ` + postColumns + ` FROM "Post" WHERE thread = ? AND id > ? ORDER BY id LIMIT ?`
+
+	selectPostsByUserDesc      = `SELECT ` + postColumns + ` FROM "Post" WHERE author = ?1 AND (?2 = '' OR forum = ?2) ORDER BY id DESC LIMIT ?3`
+	selectPostsByUser          = `SELECT ` + postColumns + ` FROM "Post" WHERE author = ?1 AND (?2 = '' OR forum = ?2) ORDER BY id LIMIT ?3`
+	selectPostsByUserSinceDesc = `SELECT ` + postColumns + ` FROM "Post" WHERE author = ?1 AND (?2 = '' OR forum = ?2) AND id < ?3 ORDER BY id DESC LIMIT ?4`
+	selectPostsByUserSince     = `SELECT ` + postColumns + ` FROM "Post" WHERE author = ?1 AND (?2 = '' OR forum = ?2) AND id > ?3 ORDER BY id LIMIT ?4`
+
+	selectPostInfo      = `SELECT ` + postColumns + ` FROM "Post" WHERE id = ?`
+	selectPostInfoForum = `SELECT title, "user", slug, posts, threads FROM "Forum" WHERE slug = ?`
+	updatePost          = `UPDATE "Post" SET message = COALESCE(NULLIF(?1, ''), message), isedited = CASE WHEN ?1 = '' OR message = ?1 THEN isedited ELSE 1 END WHERE id = ?2 RETURNING ` + postColumns
+	getPostParent       = `SELECT id FROM "Post" WHERE thread = ? AND id = ?`
+	insertPost          = `INSERT INTO "Post" (parent, author, message, forum, thread, created) VALUES (?, ?, ?, ?, ?, ?)`
+)
+
+type PostRepository struct {
+	DB *sql.DB
+}
+
+func scanPost(row scanner) (models.Post, error) {
+	var post models.Post
+	var created int64
+	err := row.Scan(&post.Id, &post.Parent, &post.Author, &post.Message, &post.IsEdited, &post.Forum, &post.Thread, &created)
+	post.Created = fromMicros(created)
+	return post, err
+}
+
+func (p PostRepository) query(ctx context.Context, query string, args ...interface{}) ([]models.Post, error) {
+	rows, err := p.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		logger.FromContext(ctx).Debug(err)
+		return nil, fromSqlite(err, models.ErrThreadNotfound)
+	}
+	defer rows.Close()
+
+	var posts []models.Post
+	for rows.Next() {
+		post, err := scanPost(rows)
+		if err != nil {
+			return nil, fromSqlite(err, models.ErrPostNotFound)
+		}
+		posts = append(posts, post)
+	}
+	return posts, fromSqlite(rows.Err(), models.ErrPostNotFound)
+}
+
+// posts выбирает один из четырёх вариантов запроса, как Postgres-репозиторий.
+func (p PostRepository) posts(ctx context.Context, queries [4]string, id int, limit int, since int, desc bool) ([]models.Post, error) {
+	if err := checkLimit(limit); err != nil {
+		return nil, err
+	}
+
+	if since == 0 {
+		if desc {
+			return p.query(ctx, queries[0], id, limit)
+		}
+		return p.query(ctx, queries[1], id, limit)
+	}
+	if desc {
+		return p.query(ctx, queries[2], id, since, limit)
+	}
+	return p.query(ctx, queries[3], id, since, limit)
+}
+
+func (p PostRepository) GetPostsTree(ctx context.Context, id int, limit int, since int, desc bool) ([]models.Post, error) {
+	return p.posts(ctx, [4]string{getPostsTreeDesc, getPostsTree, getPostsTreeSinceDesc, getPostsTreeSince}, id, limit, since, desc)
+}
+
+func (p PostRepository) GetPostsParentTree(ctx context.Context, id int, limit int, since int, desc bool) ([]models.Post, error) {
+	return p.posts(ctx, [4]string{getPostsParentDesc, getPostsParent, getPostsParentSinceDesc, getPostsParentSince}, id, limit, since, desc)
+}
+
+func (p PostRepository) GetAllPostByThread(ctx context.Context, id int, limit int, since int, desc bool) ([]models.Post, error) {
+	return p.posts(ctx, [4]string{getPostsFlatDesc, getPostsFlat, getPostsFlatSinceDesc, getPostsFlatSince}, id, limit, since, desc)
+}
+
+func (p PostRepository) FindPostsByUser(ctx context.Context, nickname string, params models.UserPostsParams) ([]models.Post, error) {
+	if err := checkLimit(params.Limit); err != nil {
+		return nil, err
+	}
+
+	if params.Since == 0 {
+		if params.Desc {
+			return p.query(ctx, selectPostsByUserDesc, nickname, params.Forum, params.Limit)
+		}
+		return p.query(ctx, selectPostsByUser, nickname, params.Forum, params.Limit)
+	}
+	if params.Desc {
+		return p.query(ctx, selectPostsByUserSinceDesc, nickname, params.Forum, params.Since, params.Limit)
+	}
+	return p.query(ctx, selectPostsByUserSince, nickname, params.Forum, params.Since, params.Limit)
+}
+
+func (p PostRepository) GetAllInfo(ctx context.Context, params models.FullPostParams, id int) (models.FullPost, error) {
+	var info models.FullPost
+
+	post, err := scanPost(p.DB.QueryRowContext(ctx, selectPostInfo, id))
+	if err != nil {
+		logger.FromContext(ctx).Debug(err)
+		return models.FullPost{}, fromSqlite(err, models.ErrPostNotFound)
+	}
+	info.Post = &post
+
+	if params.User {
+		user, err := UserRepository{DB: p.DB}.GetUser(ctx, post.Author)
+		if err != nil {
+			return models.FullPost{}, err
+		}
+		info.Author = &user
+	}
+
+	if params.Thread {
+		thread, err := scanThread(p.DB.QueryRowContext(ctx, selectThreadInfoById, post.Thread))
+		if err != nil {
+			return models.FullPost{}, fromSqlite(err, models.ErrThreadNotfound)
+		}
+		if utils.IsValidUUID(thread.Slug) {
+			thread.Slug = ""
+		}
+		info.Thread = &thread
+	}
+
+	if params.Forum {
+		var forum models.Forum
+		err = p.DB.QueryRowContext(ctx, selectPostInfoForum, post.Forum).
+			Scan(&forum.Title, &forum.User, &forum.Slug, &forum.Posts, &forum.Threads)
+		if err != nil {
+			return models.FullPost{}, fromSqlite(err, models.ErrForumNotFound)
+		}
+		info.Forum = &forum
+	}
+
+	return info, nil
+}
+
+func (p PostRepository) ChangePost(ctx context.Context, updateMessage models.PostUpdate, id int) (models.Post, error) {
+	post, err := scanPost(p.DB.QueryRowContext(ctx, updatePost, updateMessage.Message, id))
+	if err != nil {
+		logger.FromContext(ctx).Debug(err)
+		return models.Post{}, fromSqlite(err, models.ErrPostNotFound)
+	}
+
+	return post, nil
+}
+
+// AddPosts вставляет посты в одной транзакции; счётчики, Users_by_Forum и путь
+// заполняет триггер add_post.
+func (p PostRepository) AddPosts(ctx context.Context, posts models.Posts, threadId int, forumName string) (models.Posts, error) {
+	if len(posts) == 0 {
+		return models.Posts{}, nil
+	}
+
+	for _, post := range posts {
+		if post.Parent == 0 {
+			continue
+		}
+		id := -1
+		err := p.DB.QueryRowContext(ctx, getPostParent, threadId, post.Parent).Scan(&id)
+		if err == sql.ErrNoRows {
+			return nil, errs.Conflict(models.ErrParentMissing)
+		}
+		if err != nil {
+			return nil, fromSqlite(err, models.ErrParentMissing)
+		}
+	}
+
+	tx, err := p.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fromSqlite(err, models.ErrUserUnknown)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, insertPost)
+	if err != nil {
+		return nil, fromSqlite(err, models.ErrUserUnknown)
+	}
+	defer stmt.Close()
+
+	created := time.Now().Truncate(time.Microsecond).UTC()
+	insertedPosts := make(models.Posts, 0, len(posts))
+	for _, post := range posts {
+		result, err := stmt.ExecContext(ctx, post.Parent, post.Author, post.Message, forumName, threadId, toMicros(created))
+		if err != nil {
+			logger.FromContext(ctx).Debug(err)
+			return nil, fromSqlite(err, models.ErrUserUnknown)
+		}
+		id, err := result.LastInsertId()
+		if err != nil {
+			return nil, fromSqlite(err, models.ErrUserUnknown)
+		}
+
+		insertedPosts = append(insertedPosts, models.Post{
+			Id:      int(id),
+			Parent:  post.Parent,
+			Author:  post.Author,
+			Message: post.Message,
+			Forum:   forumName,
+			Thread:  threadId,
+			Created: created,
+		})
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fromSqlite(err, models.ErrUserUnknown)
+	}
+	return insertedPosts, nil
+}
@@ -0,0 +1,176 @@
+-- Схема повторяет миграции Postgres. Вместо citext используется сортировка
+-- CITEXT (регистронезависимое сравнение, регистрируется драйвером в sqlite.go),
+-- вместо INT[] путь поста хранится строкой из id, дополненных нулями до 10 цифр,
+-- поэтому строки сортируются так же, как массивы.
+CREATE TABLE IF NOT EXISTS "User"
+(
+    id       INTEGER PRIMARY KEY AUTOINCREMENT,
+    nickname TEXT COLLATE CITEXT UNIQUE NOT NULL,
+    fullname TEXT NOT NULL,
+    about    TEXT NOT NULL DEFAULT '',
+    email    TEXT COLLATE CITEXT UNIQUE NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS "Forum"
+(
+    id      INTEGER PRIMARY KEY AUTOINCREMENT,
+    title   TEXT NOT NULL,
+    "user"  TEXT COLLATE CITEXT NOT NULL REFERENCES "User" (nickname),
+    slug    TEXT COLLATE CITEXT UNIQUE NOT NULL,
+    posts   INTEGER NOT NULL DEFAULT 0,
+    threads INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS "Thread"
+(
+    id      INTEGER PRIMARY KEY AUTOINCREMENT,
+    title   TEXT NOT NULL,
+    author  TEXT COLLATE CITEXT NOT NULL REFERENCES "User" (nickname),
+    forum   TEXT COLLATE CITEXT NOT NULL REFERENCES "Forum" (slug),
+    message TEXT NOT NULL,
+    votes   INTEGER NOT NULL DEFAULT 0,
+    slug    TEXT COLLATE CITEXT UNIQUE NOT NULL,
+    -- микросекунды с начала эпохи, как точность timestamptz
+    created INTEGER NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS "Post"
+(
+    id       INTEGER PRIMARY KEY AUTOINCREMENT,
+    parent   INTEGER NOT NULL DEFAULT 0,
+    author   TEXT COLLATE CITEXT NOT NULL REFERENCES "User" (nickname),
+    message  TEXT NOT NULL,
+    isedited INTEGER NOT NULL DEFAULT 0,
+    forum    TEXT COLLATE CITEXT NOT NULL REFERENCES "Forum" (slug),
+    thread   INTEGER NOT NULL REFERENCES "Thread" (id),
+    created  INTEGER NOT NULL,
+    path     TEXT NOT NULL DEFAULT '',
+    -- path[1] в Postgres: id корневого поста ветки
+    root     INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS "Users_by_Forum"
+(
+    id     INTEGER PRIMARY KEY AUTOINCREMENT,
+    forum  TEXT COLLATE CITEXT NOT NULL,
+    "user" TEXT COLLATE CITEXT NOT NULL REFERENCES "User" (nickname),
+    UNIQUE (forum, "user")
+);
+
+CREATE TABLE IF NOT EXISTS "Vote"
+(
+    id       INTEGER PRIMARY KEY AUTOINCREMENT,
+    threadid INTEGER NOT NULL REFERENCES "Thread" (id),
+    "user"   TEXT COLLATE CITEXT NOT NULL REFERENCES "User" (nickname),
+    value    INTEGER NOT NULL,
+    UNIQUE (threadid, "user")
+);
+
+-- Старые nickname после переименования; внешние ключи других таблиц здесь
+-- без ON UPDATE CASCADE (CREATE TABLE IF NOT EXISTS не меняет уже созданные
+-- таблицы), поэтому RenameUser обновляет их сам.
+CREATE TABLE IF NOT EXISTS "User_alias"
+(
+    alias    TEXT COLLATE CITEXT PRIMARY KEY,
+    nickname TEXT COLLATE CITEXT NOT NULL REFERENCES "User" (nickname) ON UPDATE CASCADE ON DELETE CASCADE,
+    -- микросекунды с начала эпохи
+    expires  INTEGER NOT NULL
+);
+
+-- Пароли пользователей (bcrypt); у пользователей без пароля строки нет.
+CREATE TABLE IF NOT EXISTS "User_password"
+(
+    nickname TEXT COLLATE CITEXT PRIMARY KEY REFERENCES "User" (nickname) ON UPDATE CASCADE ON DELETE CASCADE,
+    hash     TEXT NOT NULL
+);
+
+-- Администраторы сайта; роль переходит с nickname и пропадает с аккаунтом.
+CREATE TABLE IF NOT EXISTS "User_admin"
+(
+    nickname TEXT COLLATE CITEXT PRIMARY KEY REFERENCES "User" (nickname) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+-- Ключи API; хранится SHA-256 ключа, области через запятую.
+CREATE TABLE IF NOT EXISTS "User_key"
+(
+    id        INTEGER PRIMARY KEY AUTOINCREMENT,
+    nickname  TEXT COLLATE CITEXT NOT NULL REFERENCES "User" (nickname) ON UPDATE CASCADE ON DELETE CASCADE,
+    name      TEXT    NOT NULL,
+    hash      TEXT    NOT NULL UNIQUE,
+    scopes    TEXT    NOT NULL,
+    -- микросекунды с начала эпохи
+    created   INTEGER NOT NULL,
+    last_used INTEGER
+);
+
+-- Модераторы форумов; владелец и администраторы сайта модерируют и без строки здесь.
+CREATE TABLE IF NOT EXISTS "Forum_moderator"
+(
+    forum  TEXT COLLATE CITEXT NOT NULL REFERENCES "Forum" (slug) ON DELETE CASCADE,
+    "user" TEXT COLLATE CITEXT NOT NULL REFERENCES "User" (nickname) ON UPDATE CASCADE ON DELETE CASCADE,
+    PRIMARY KEY (forum, "user")
+);
+
+-- занятый nickname перестаёт быть псевдонимом; чужой действующий псевдоним
+-- занять нельзя, это проверяет UserRepository (checkAlias)
+CREATE TRIGGER IF NOT EXISTS drop_user_alias
+    AFTER INSERT ON "User"
+BEGIN
+    DELETE FROM "User_alias" WHERE alias = NEW.nickname;
+END;
+
+CREATE TRIGGER IF NOT EXISTS drop_user_alias_rename
+    AFTER UPDATE OF nickname ON "User"
+BEGIN
+    DELETE FROM "User_alias" WHERE alias = NEW.nickname;
+END;
+
+-- добавление новой ветки
+CREATE TRIGGER IF NOT EXISTS create_thread_trigger
+    AFTER INSERT ON "Thread"
+BEGIN
+    UPDATE "Forum" SET threads = threads + 1 WHERE slug = NEW.forum;
+    INSERT OR IGNORE INTO "Users_by_Forum" (forum, "user") VALUES (NEW.forum, NEW.author);
+END;
+
+-- добавление нового голоса
+CREATE TRIGGER IF NOT EXISTS voice_trigger
+    AFTER INSERT ON "Vote"
+BEGIN
+    UPDATE "Thread" SET votes = votes + NEW.value WHERE id = NEW.threadid;
+END;
+
+-- изменение голоса
+CREATE TRIGGER IF NOT EXISTS voice_update_trigger
+    AFTER UPDATE ON "Vote"
+    WHEN OLD.value <> NEW.value
+BEGIN
+    UPDATE "Thread" SET votes = votes + NEW.value * 2 WHERE id = NEW.threadid;
+END;
+
+-- добавление поста
+CREATE TRIGGER IF NOT EXISTS add_post
+    AFTER INSERT ON "Post"
+BEGIN
+    UPDATE "Forum" SET posts = posts + 1 WHERE slug = NEW.forum;
+    INSERT OR IGNORE INTO "Users_by_Forum" (forum, "user") VALUES (NEW.forum, NEW.author);
+    UPDATE "Post"
+    SET path = COALESCE((SELECT p.path || '.' FROM "Post" p WHERE p.id = NEW.parent), '') || printf('%010d', NEW.id),
+        root = COALESCE((SELECT p.root FROM "Post" p WHERE p.id = NEW.parent), NEW.id)
+    WHERE id = NEW.id;
+END;
+
+CREATE INDEX IF NOT EXISTS thread_forum_created ON "Thread" (forum, created);
+CREATE INDEX IF NOT EXISTS post_thread_id ON "Post" (thread, id);
+CREATE INDEX IF NOT EXISTS post_thread_path ON "Post" (thread, path);
+CREATE INDEX IF NOT EXISTS post_root_path ON "Post" (root, path);
+CREATE INDEX IF NOT EXISTS forum_users_forum_user ON "Users_by_Forum" (forum, "user");
+CREATE INDEX IF NOT EXISTS post_author_created ON "Post" (author, created);
+CREATE INDEX IF NOT EXISTS thread_author_created ON "Thread" (author, created);
+CREATE INDEX IF NOT EXISTS vote_user ON "Vote" ("user");
+CREATE INDEX IF NOT EXISTS post_author_id ON "Post" (author, id);
+CREATE INDEX IF NOT EXISTS user_alias_nickname ON "User_alias" (nickname);
+CREATE INDEX IF NOT EXISTS user_key_nickname ON "User_key" (nickname);
+CREATE INDEX IF NOT EXISTS forum_moderator_user ON "Forum_moderator" ("user");
+CREATE INDEX IF NOT EXISTS forum_posts_slug ON "Forum" (posts, slug);
+CREATE INDEX IF NOT EXISTS forum_threads_slug ON "Forum" (threads, slug);
@@ -0,0 +1,169 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"forum/internal/utils/errs"
+	"forum/internal/utils/logger"
+	"forum/pkg/models"
+	"strings"
+)
+
+const (
+	// В SQLite нет TRUNCATE; таблицы очищаются от зависимых к главным из-за внешних ключей.
+	cleanDB = `DELETE FROM "Vote"; DELETE FROM "Forum_moderator"; DELETE FROM "Users_by_Forum"; DELETE FROM "Post";
+				DELETE FROM "Thread"; DELETE FROM "Forum"; DELETE FROM "User_alias"; DELETE FROM "User_password"; DELETE FROM "User_key"; DELETE FROM "User_admin"; DELETE FROM "User";`
+	cleanCount = `SELECT (SELECT COUNT(*) FROM "User"), (SELECT COUNT(*) FROM "Forum"),
+				(SELECT COUNT(*) FROM "Thread"), (SELECT COUNT(*) FROM "Post"), (SELECT COUNT(*) FROM "Vote")`
+	selectForumSlug = `SELECT slug FROM "Forum" WHERE slug = ?`
+	// ?1 slug форума.
+	cleanForumCount = `SELECT (SELECT COUNT(*) FROM "Thread" WHERE forum = ?1),
+				(SELECT COUNT(*) FROM "Post" WHERE forum = ?1),
+				(SELECT COUNT(*) FROM "Vote" WHERE threadid IN (SELECT id FROM "Thread" WHERE forum = ?1))`
+	status = `SELECT (SELECT COUNT(*) FROM "User"), (SELECT COUNT(*) FROM "Forum"),
+				(SELECT COUNT(*) FROM "Thread"), (SELECT COUNT(*) FROM "Post")`
+	// ?1 nickname, к которому переходят данные, ?2 сливаемый nickname.
+	mergeReport = `SELECT (SELECT COUNT(*) FROM "Thread" WHERE author = ?2),
+				(SELECT COUNT(*) FROM "Post" WHERE author = ?2),
+				(SELECT COUNT(*) FROM "Forum" WHERE "user" = ?2),
+				(SELECT COUNT(*) FROM "Users_by_Forum" f WHERE f."user" = ?2
+					AND NOT EXISTS (SELECT 1 FROM "Users_by_Forum" o WHERE o."user" = ?1 AND o.forum = f.forum)),
+				(SELECT COUNT(*) FROM "Vote" v WHERE v."user" = ?2
+					AND NOT EXISTS (SELECT 1 FROM "Vote" o WHERE o."user" = ?1 AND o.threadid = v.threadid)),
+				(SELECT COUNT(*) FROM "Vote" v WHERE v."user" = ?2
+					AND EXISTS (SELECT 1 FROM "Vote" o WHERE o."user" = ?1 AND o.threadid = v.threadid))`
+	// Ветки, рейтинг которых пересчитывается после слияния голосов.
+	mergeVoted = `CREATE TEMP TABLE merge_threads AS SELECT threadid FROM "Vote" WHERE "user" = ?2`
+)
+
+// cleanForum повторяет функцию clean_forum из миграций Postgres.
+var cleanForum = []string{
+	`DELETE FROM "Vote" WHERE threadid IN (SELECT id FROM "Thread" WHERE forum = ?1)`,
+	`DELETE FROM "Post" WHERE forum = ?1`,
+	`DELETE FROM "Thread" WHERE forum = ?1`,
+	`DELETE FROM "Users_by_Forum" WHERE forum = ?1`,
+	`DELETE FROM "Forum_moderator" WHERE forum = ?1`,
+	`DELETE FROM "Forum" WHERE slug = ?1`,
+}
+
+// mergeVotes снимает конфликтующие голоса по политике слияния.
+var mergeVotes = map[string]string{
+	models.MergeVotesKeep:    `DELETE FROM "Vote" WHERE "user" = ?2 AND threadid IN (SELECT threadid FROM "Vote" WHERE "user" = ?1)`,
+	models.MergeVotesReplace: `DELETE FROM "Vote" WHERE "user" = ?1 AND threadid IN (SELECT threadid FROM "Vote" WHERE "user" = ?2)`,
+	models.MergeVotesDrop: `DELETE FROM "Vote" WHERE "user" IN (?1, ?2) AND threadid IN
+				(SELECT threadid FROM "Vote" WHERE "user" = ?1 INTERSECT SELECT threadid FROM "Vote" WHERE "user" = ?2)`,
+}
+
+// mergeUsers повторяет функцию merge_users из миграций Postgres после mergeVotes.
+var mergeUsers = []string{
+	`UPDATE "Vote" SET "user" = ?1 WHERE "user" = ?2`,
+	`UPDATE "Thread" SET votes = COALESCE((SELECT SUM(v.value) FROM "Vote" v WHERE v.threadid = "Thread".id), 0)
+		WHERE id IN (SELECT threadid FROM temp.merge_threads)`,
+	`DROP TABLE temp.merge_threads`,
+	`UPDATE "Forum" SET "user" = ?1 WHERE "user" = ?2`,
+	`UPDATE "Thread" SET author = ?1 WHERE author = ?2`,
+	`UPDATE "Post" SET author = ?1 WHERE author = ?2`,
+	`DELETE FROM "Users_by_Forum" WHERE "user" = ?2 AND forum IN (SELECT forum FROM "Users_by_Forum" WHERE "user" = ?1)`,
+	`UPDATE "Users_by_Forum" SET "user" = ?1 WHERE "user" = ?2`,
+	`DELETE FROM "Forum_moderator" WHERE "user" = ?2 AND forum IN (SELECT forum FROM "Forum_moderator" WHERE "user" = ?1)`,
+	`UPDATE "Forum_moderator" SET "user" = ?1 WHERE "user" = ?2`,
+	`DELETE FROM "User" WHERE nickname = ?2`,
+}
+
+type ServiceRepository struct {
+	DB *sql.DB
+}
+
+func (r ServiceRepository) CleanDb(ctx context.Context, clean models.Clean) (models.CleanReport, error) {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return models.CleanReport{}, fromSqlite(err, "")
+	}
+	defer tx.Rollback()
+
+	report := models.CleanReport{DryRun: clean.DryRun}
+	queries, args := []string{cleanDB}, []interface{}{}
+	if clean.Forum != "" {
+		report.Forums = 1
+		if err = tx.QueryRowContext(ctx, selectForumSlug, clean.Forum).Scan(&report.Forum); err != nil {
+			logger.FromContext(ctx).Debug(err)
+			return models.CleanReport{}, fromSqlite(err, models.ErrForumNotFound)
+		}
+		err = tx.QueryRowContext(ctx, cleanForumCount, report.Forum).Scan(&report.Threads, &report.Posts, &report.Votes)
+		queries, args = cleanForum, []interface{}{report.Forum}
+	} else {
+		err = tx.QueryRowContext(ctx, cleanCount).Scan(&report.Users, &report.Forums, &report.Threads, &report.Posts, &report.Votes)
+	}
+	if err != nil {
+		logger.FromContext(ctx).Debug(err)
+		return models.CleanReport{}, fromSqlite(err, "")
+	}
+	if clean.DryRun {
+		return report, nil
+	}
+
+	for _, query := range queries {
+		if _, err = tx.ExecContext(ctx, query, args...); err != nil {
+			logger.FromContext(ctx).Debug(err)
+			return models.CleanReport{}, fromSqlite(err, "")
+		}
+	}
+	return report, fromSqlite(tx.Commit(), "")
+}
+
+func (r ServiceRepository) GetStatus(ctx context.Context) (models.Status, error) {
+	var s models.Status
+	err := r.DB.QueryRowContext(ctx, status).Scan(&s.User, &s.Forum, &s.Thread, &s.Post)
+	if err != nil {
+		logger.FromContext(ctx).Debug(err)
+		return models.Status{}, fromSqlite(err, "")
+	}
+	return s, nil
+}
+
+func (r ServiceRepository) MergeUsers(ctx context.Context, merge models.UserMerge) (models.UserMergeReport, error) {
+	votes, ok := mergeVotes[merge.Votes]
+	if !ok {
+		return models.UserMergeReport{}, errs.Invalid(models.ErrMergeVotes)
+	}
+
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return models.UserMergeReport{}, fromSqlite(err, models.MissingUser)
+	}
+	defer tx.Rollback()
+
+	report := models.UserMergeReport{Votes: merge.Votes, DryRun: merge.DryRun}
+	for _, user := range []struct {
+		nickname string
+		dst      *string
+	}{{merge.Into, &report.Into}, {merge.From, &report.From}} {
+		if err = tx.QueryRowContext(ctx, selectNickname, user.nickname).Scan(user.dst); err != nil {
+			logger.FromContext(ctx).Debug(err)
+			return models.UserMergeReport{}, fromSqlite(err, models.MissingUser)
+		}
+	}
+
+	if strings.EqualFold(report.Into, report.From) {
+		return models.UserMergeReport{}, errs.Invalid(models.ErrMergeSelf)
+	}
+
+	err = tx.QueryRowContext(ctx, mergeReport, report.Into, report.From).
+		Scan(&report.Threads, &report.Posts, &report.Forums, &report.Memberships, &report.VotesMoved, &report.VoteConflicts)
+	if err != nil {
+		logger.FromContext(ctx).Debug(err)
+		return models.UserMergeReport{}, fromSqlite(err, models.MissingUser)
+	}
+	if merge.DryRun {
+		return report, nil
+	}
+
+	for _, query := range append([]string{mergeVoted, votes}, mergeUsers...) {
+		if _, err = tx.ExecContext(ctx, query, report.Into, report.From); err != nil {
+			logger.FromContext(ctx).Debug(err)
+			return models.UserMergeReport{}, fromSqlite(err, models.MissingUser)
+		}
+	}
+
+	return report, fromSqlite(tx.Commit(), models.MissingUser)
+}
@@ -0,0 +1,120 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	_ "embed"
+	"errors"
+	"forum/internal/utils/errs"
+	"github.com/mattn/go-sqlite3"
+	"strings"
+	"time"
+)
+
+//go:embed schema.sql
+var schema string
+
+// driverName драйвер go-sqlite3 с сортировкой CITEXT, которая сравнивает
+// строки без учёта регистра, как тип citext в Postgres, и функцией fold,
+// понижающей регистр так же, как lower в Postgres.
+const driverName = "sqlite3_forum"
+
+func init() {
+	sql.Register(driverName, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			err := conn.RegisterCollation("CITEXT", func(a, b string) int {
+				return strings.Compare(strings.ToLower(a), strings.ToLower(b))
+			})
+			if err != nil {
+				return err
+			}
+			return conn.RegisterFunc("fold", strings.ToLower, true)
+		},
+	})
+}
+
+// Open открывает базу по пути к файлу (":memory:" для базы в памяти) и создаёт схему.
+func Open(path string) (*sql.DB, error) {
+	dsn := "file:" + path + "?_foreign_keys=on&_busy_timeout=5000&_txlock=immediate"
+	if path != ":memory:" {
+		dsn += "&_journal_mode=WAL"
+	}
+
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		return nil, err
+	}
+	if path == ":memory:" {
+		// каждое соединение получило бы свою пустую базу
+		db.SetMaxOpenConns(1)
+	}
+
+	if _, err = db.Exec(schema); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// fromSqlite переводит ошибку драйвера в доменную так же, как errs.FromPgx.
+func fromSqlite(err error, notFound string) error {
+	if err == nil {
+		return nil
+	}
+
+	var e *errs.Error
+	if errors.As(err, &e) {
+		return err
+	}
+
+	if err == sql.ErrNoRows {
+		return errs.NotFound(notFound)
+	}
+
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		switch sqliteErr.ExtendedCode {
+		case sqlite3.ErrConstraintForeignKey, sqlite3.ErrConstraintNotNull:
+			return errs.Wrap(errs.KindNotFound, notFound, err)
+		case sqlite3.ErrConstraintUnique, sqlite3.ErrConstraintPrimaryKey:
+			return errs.Wrap(errs.KindConflict, "already exists", err)
+		}
+		switch sqliteErr.Code {
+		case sqlite3.ErrBusy, sqlite3.ErrLocked:
+			return errs.Unavailable(err)
+		}
+		return errs.Internal(err)
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return errs.Unavailable(err)
+	}
+	return errs.Internal(err)
+}
+
+// toMicros и fromMicros хранят время целым числом микросекунд, чтобы сравнение
+// и сортировка не зависели от часового пояса.
+func toMicros(t time.Time) int64 {
+	return t.Unix()*1e6 + int64(t.Nanosecond()/1e3)
+}
+
+func fromMicros(us int64) time.Time {
+	return time.Unix(us/1e6, us%1e6*1e3).UTC()
+}
+
+// parseTime разбирает since так же строго, как Postgres разбирает timestamptz.
+func parseTime(value string) (int64, error) {
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return 0, errs.Wrap(errs.KindInvalid, "invalid input syntax for type timestamp with time zone", err)
+	}
+	return toMicros(t), nil
+}
+
+// checkLimit отрицательный LIMIT в SQLite снимает ограничение, а Postgres его отвергает.
+func checkLimit(limit int) error {
+	if limit < 0 {
+		return errs.Invalid("LIMIT must not be negative")
+	}
+	return nil
+}
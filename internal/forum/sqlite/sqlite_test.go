@@ -0,0 +1,27 @@
+package sqlite
+
+import (
+	"forum/internal/forum/contract"
+	"path/filepath"
+	"testing"
+)
+
+func TestContract(t *testing.T) {
+	contract.Run(t, func(t *testing.T) contract.Repositories {
+		// файл, а не :memory:, чтобы проверялся тот же режим WAL, что и в работе
+		db, err := Open(filepath.Join(t.TempDir(), "forum.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+
+		return contract.Repositories{
+			User:    &UserRepository{DB: db},
+			Forum:   &ForumRepository{DB: db},
+			Thread:  &ThreadRepository{DB: db},
+			Post:    &PostRepository{DB: db},
+			Service: ServiceRepository{DB: db},
+			Key:     KeyRepository{DB: db},
+		}
+	})
+}
@@ -0,0 +1,227 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"forum/internal/utils/errs"
+	"forum/internal/utils/logger"
+	"forum/internal/utils/utils"
+	"forum/pkg/models"
+	"github.com/gofrs/uuid"
+	"strconv"
+)
+
+const (
+	threadColumns = `id, title, author, forum, message, votes, slug, created`
+
+	selectThreadIdBySlug   = `SELECT id FROM "Thread" WHERE slug = ?`
+	insertVote             = `INSERT INTO "Vote" (threadid, "user", value) VALUES (?, ?, ?)`
+	updateVote             = `UPDATE "Vote" SET value = ? WHERE threadid = ? AND "user" = ?`
+	updateThreadId         = `UPDATE "Thread" SET title = COALESCE(NULLIF(?1, ''), title), message = COALESCE(NULLIF(?2, ''), message) WHERE id = ?3 RETURNING ` + threadColumns
+	updateThreadSlug       = `UPDATE "Thread" SET title = COALESCE(NULLIF(?1, ''), title), message = COALESCE(NULLIF(?2, ''), message) WHERE slug = ?3 RETURNING ` + threadColumns
+	selectThreadInfoBySlug = `SELECT ` + threadColumns + ` FROM "Thread" WHERE slug = ?`
+	selectThreadInfoById   = `SELECT ` + threadColumns + ` FROM "Thread" WHERE id = ?`
+	selectThreadDesc       = `SELECT ` + threadColumns + ` FROM "Thread" WHERE forum = ? ORDER BY created DESC LIMIT ?`
+	selectThread           = `SELECT ` + threadColumns + ` FROM "Thread" WHERE forum = ? ORDER BY created LIMIT ?`
+	selectThreadSinceDesc  = `SELECT ` + threadColumns + ` FROM "Thread" WHERE forum = ? AND created <= ? ORDER BY created DESC LIMIT ?`
+	selectThreadSince      = `SELECT ` + threadColumns + ` FROM "Thread" WHERE forum = ? AND created >= ? ORDER BY created LIMIT ?`
+
+	selectThreadsByUserDesc      = `SELECT ` + threadColumns + ` FROM "Thread" WHERE author = ?1 AND (?2 = '' OR forum = ?2) ORDER BY created DESC, id DESC LIMIT ?3`
+	selectThreadsByUser          = `SELECT ` + threadColumns + ` FROM "Thread" WHERE author = ?1 AND (?2 = '' OR forum = ?2) ORDER BY created, id LIMIT ?3`
+	selectThreadsByUserSinceDesc = `SELECT ` + threadColumns + ` FROM "Thread" WHERE author = ?1 AND (?2 = '' OR forum = ?2) AND created <= ?3 ORDER BY created DESC, id DESC LIMIT ?4`
+	selectThreadsByUserSince     = `SELECT ` + threadColumns + ` FROM "Thread" WHERE author = ?1 AND (?2 = '' OR forum = ?2) AND created >= ?3 ORDER BY created, id LIMIT ?4`
+	insertThread                 = `INSERT INTO "Thread" (title, author, forum, message, votes, slug, created)
+					VALUES (?, (SELECT nickname FROM "User" WHERE nickname = ?), (SELECT slug FROM "Forum" WHERE slug = ?), ?, 0, ?, ?)
+					RETURNING id, forum, author, slug`
+)
+
+type ThreadRepository struct {
+	DB *sql.DB
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanThread(row scanner) (models.Thread, error) {
+	var thread models.Thread
+	var created int64
+	err := row.Scan(&thread.Id, &thread.Title, &thread.Author, &thread.Forum, &thread.Message, &thread.Votes, &thread.Slug, &created)
+	thread.Created = fromMicros(created)
+	return thread, err
+}
+
+func (r ThreadRepository) GetThreadIdBySlug(ctx context.Context, slug string) (int, error) {
+	id := -1
+	err := r.DB.QueryRowContext(ctx, selectThreadIdBySlug, slug).Scan(&id)
+	if err != nil {
+		logger.FromContext(ctx).Debug(err)
+		return -1, fromSqlite(err, models.ErrThreadNotfound)
+	}
+
+	return id, nil
+}
+
+func (r ThreadRepository) SetVote(ctx context.Context, vote models.Vote, id int) error {
+	_, err := r.DB.ExecContext(ctx, insertVote, id, vote.Nickname, int32(vote.Voice))
+	if err == nil {
+		return nil
+	}
+
+	logger.FromContext(ctx).Debug(err)
+	if err = fromSqlite(err, models.ErrThreadNotfound); errs.Is(err, errs.KindConflict) {
+		_, err = r.DB.ExecContext(ctx, updateVote, int32(vote.Voice), id, vote.Nickname)
+	}
+
+	return fromSqlite(err, models.ErrThreadNotfound)
+}
+
+func (r ThreadRepository) UpdateThread(ctx context.Context, update models.ThreadUpdate, slugOrId string) (models.Thread, error) {
+	var thread models.Thread
+	id, err := strconv.Atoi(slugOrId)
+	if err != nil {
+		thread, err = scanThread(r.DB.QueryRowContext(ctx, updateThreadSlug, update.Title, update.Message, slugOrId))
+	} else {
+		thread, err = scanThread(r.DB.QueryRowContext(ctx, updateThreadId, update.Title, update.Message, id))
+	}
+
+	if err != nil {
+		return models.Thread{}, fromSqlite(err, models.ErrThreadNotfound)
+	}
+	return thread, nil
+}
+
+func (r ThreadRepository) GetThreadInfoBySlug(ctx context.Context, slug string) (models.Thread, error) {
+	thread, err := scanThread(r.DB.QueryRowContext(ctx, selectThreadInfoBySlug, slug))
+	if err != nil {
+		return models.Thread{}, fromSqlite(err, models.ErrThreadNotfound)
+	}
+
+	if utils.IsValidUUID(thread.Slug) {
+		thread.Slug = ""
+	}
+
+	return thread, nil
+}
+
+func (r ThreadRepository) GetThreadInfoById(ctx context.Context, id int) (models.Thread, error) {
+	thread, err := scanThread(r.DB.QueryRowContext(ctx, selectThreadInfoById, id))
+	if err != nil {
+		return models.Thread{}, fromSqlite(err, models.ErrThreadNotfound)
+	}
+
+	if utils.IsValidUUID(thread.Slug) {
+		thread.Slug = ""
+	}
+
+	return thread, nil
+}
+
+func (r ThreadRepository) FindThreads(ctx context.Context, slug string, params models.ParamsForSearch) ([]models.Thread, error) {
+	if err := checkLimit(params.Limit); err != nil {
+		return nil, err
+	}
+
+	var rows *sql.Rows
+	var err error
+
+	if params.Since == "" {
+		if params.Desc {
+			rows, err = r.DB.QueryContext(ctx, selectThreadDesc, slug, params.Limit)
+		} else {
+			rows, err = r.DB.QueryContext(ctx, selectThread, slug, params.Limit)
+		}
+	} else {
+		var since int64
+		if since, err = parseTime(params.Since); err != nil {
+			return nil, err
+		}
+		if params.Desc {
+			rows, err = r.DB.QueryContext(ctx, selectThreadSinceDesc, slug, since, params.Limit)
+		} else {
+			rows, err = r.DB.QueryContext(ctx, selectThreadSince, slug, since, params.Limit)
+		}
+	}
+
+	if err != nil {
+		logger.FromContext(ctx).Debug(err)
+		return nil, fromSqlite(err, models.ErrForumNotFound)
+	}
+	defer rows.Close()
+
+	var threads []models.Thread
+	for rows.Next() {
+		thread, err := scanThread(rows)
+		if err != nil {
+			return nil, fromSqlite(err, models.ErrForumNotFound)
+		}
+		if utils.IsValidUUID(thread.Slug) {
+			thread.Slug = ""
+		}
+		threads = append(threads, thread)
+	}
+
+	return threads, fromSqlite(rows.Err(), models.ErrForumNotFound)
+}
+
+func (r ThreadRepository) FindThreadsByUser(ctx context.Context, nickname string, params models.UserThreadsParams) ([]models.Thread, error) {
+	if err := checkLimit(params.Limit); err != nil {
+		return nil, err
+	}
+
+	var rows *sql.Rows
+	var err error
+
+	if params.Since == "" {
+		if params.Desc {
+			rows, err = r.DB.QueryContext(ctx, selectThreadsByUserDesc, nickname, params.Forum, params.Limit)
+		} else {
+			rows, err = r.DB.QueryContext(ctx, selectThreadsByUser, nickname, params.Forum, params.Limit)
+		}
+	} else {
+		var since int64
+		if since, err = parseTime(params.Since); err != nil {
+			return nil, err
+		}
+		if params.Desc {
+			rows, err = r.DB.QueryContext(ctx, selectThreadsByUserSinceDesc, nickname, params.Forum, since, params.Limit)
+		} else {
+			rows, err = r.DB.QueryContext(ctx, selectThreadsByUserSince, nickname, params.Forum, since, params.Limit)
+		}
+	}
+
+	if err != nil {
+		logger.FromContext(ctx).Debug(err)
+		return nil, fromSqlite(err, models.MissingUser)
+	}
+	defer rows.Close()
+
+	var threads []models.Thread
+	for rows.Next() {
+		thread, err := scanThread(rows)
+		if err != nil {
+			return nil, fromSqlite(err, models.MissingUser)
+		}
+		if utils.IsValidUUID(thread.Slug) {
+			thread.Slug = ""
+		}
+		threads = append(threads, thread)
+	}
+
+	return threads, fromSqlite(rows.Err(), models.MissingUser)
+}
+
+func (r *ThreadRepository) CreateThread(ctx context.Context, thread models.Thread) (models.Thread, error) {
+	if thread.Slug == "" {
+		gen, _ := uuid.NewV4()
+		thread.Slug = gen.String()
+	}
+
+	err := r.DB.QueryRowContext(ctx, insertThread, thread.Title, thread.Author, thread.Forum, thread.Message, thread.Slug, toMicros(thread.Created)).
+		Scan(&thread.Id, &thread.Forum, &thread.Author, &thread.Slug)
+
+	if utils.IsValidUUID(thread.Slug) {
+		thread.Slug = ""
+	}
+	return thread, fromSqlite(err, models.ErrUserUnknown)
+}
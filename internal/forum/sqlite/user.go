@@ -0,0 +1,488 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"forum/internal/utils/errs"
+	"forum/internal/utils/logger"
+	"forum/internal/utils/utils"
+	"forum/pkg/models"
+	"strings"
+	"time"
+)
+
+const (
+	insertUser = `INSERT INTO "User" (nickname, fullname, about, email) VALUES (?, ?, ?, ?)`
+	selectUser = `SELECT nickname, fullname, about, email FROM "User"
+					WHERE nickname = ?1 OR email = ?2
+						OR nickname = (SELECT a.nickname FROM "User_alias" a WHERE a.alias = ?1 AND a.expires > ?3)
+					ORDER BY id`
+	updateUser = `UPDATE "User"
+					SET fullname = COALESCE(NULLIF(?1, ''), fullname), about = COALESCE(NULLIF(?2, ''), about), email = COALESCE(NULLIF(?3, ''), email)
+					WHERE nickname = ?4
+					RETURNING nickname, fullname, about, email`
+	selectUserByNick = `SELECT nickname, fullname, about, email FROM "User"
+					WHERE nickname = COALESCE((SELECT a.nickname FROM "User_alias" a WHERE a.alias = ?1 AND a.expires > ?2), ?1)`
+	selectUserCredentials = `SELECT u.nickname, u.fullname, u.about, u.email, COALESCE(p.hash, '') FROM "User" u
+					LEFT JOIN "User_password" p ON p.nickname = u.nickname
+					WHERE u.nickname = COALESCE((SELECT a.nickname FROM "User_alias" a WHERE a.alias = ?1 AND a.expires > ?2), ?1)`
+	upsertUserPassword = `INSERT INTO "User_password" (nickname, hash) VALUES (?, ?)
+					ON CONFLICT (nickname) DO UPDATE SET hash = excluded.hash`
+	// fold регистрируется в Open: lower в SQLite понижает только ASCII.
+	selectUsers = `SELECT nickname, fullname, about, email FROM "User"
+					WHERE (fold(nickname) LIKE ?1 ESCAPE '\' OR fold(fullname) LIKE ?1 ESCAPE '\') AND (?2 = '' OR nickname > ?2)
+					ORDER BY nickname LIMIT ?3`
+	selectUsersDesc = `SELECT nickname, fullname, about, email FROM "User"
+					WHERE (fold(nickname) LIKE ?1 ESCAPE '\' OR fold(fullname) LIKE ?1 ESCAPE '\') AND (?2 = '' OR nickname < ?2)
+					ORDER BY nickname DESC LIMIT ?3`
+	countUsers = `SELECT COUNT(*) FROM "User" WHERE fold(nickname) LIKE ?1 ESCAPE '\' OR fold(fullname) LIKE ?1 ESCAPE '\'`
+	// min и max от нескольких аргументов в SQLite возвращают NULL, если NULL
+	// хотя бы один из них, поэтому крайние значения берутся по объединению.
+	selectUserStats = `SELECT u.nickname,
+					(SELECT COUNT(*) FROM "Post" p WHERE p.author = u.nickname),
+					(SELECT COUNT(*) FROM "Thread" t WHERE t.author = u.nickname),
+					(SELECT COUNT(*) FROM "Vote" v WHERE v."user" = u.nickname),
+					(SELECT COALESCE(SUM(t.votes), 0) FROM "Thread" t WHERE t.author = u.nickname),
+					(SELECT COUNT(*) FROM "Users_by_Forum" f WHERE f."user" = u.nickname),
+					(SELECT MIN(created) FROM (SELECT created FROM "Post" p WHERE p.author = u.nickname
+						UNION ALL SELECT created FROM "Thread" t WHERE t.author = u.nickname)),
+					(SELECT MAX(created) FROM (SELECT created FROM "Post" p WHERE p.author = u.nickname
+						UNION ALL SELECT created FROM "Thread" t WHERE t.author = u.nickname))
+					FROM "User" u WHERE u.nickname = ?`
+	renameUser        = `UPDATE "User" SET nickname = ?2 WHERE nickname = ?1 RETURNING nickname, fullname, about, email`
+	exportUserThreads = `SELECT ` + threadColumns + ` FROM "Thread" WHERE author = ? ORDER BY created, id`
+	exportUserPosts   = `SELECT p.id, p.parent, p.author, p.message, p.isedited, p.forum, p.thread, p.created, t.title, t.slug, f.title
+					FROM "Post" p
+					JOIN "Thread" t ON t.id = p.thread
+					JOIN "Forum" f ON f.slug = p.forum
+					WHERE p.author = ? ORDER BY p.id`
+	exportUserVotes = `SELECT v.threadid, t.slug, t.forum, v.value FROM "Vote" v
+					JOIN "Thread" t ON t.id = v.threadid
+					WHERE v."user" = ? ORDER BY v.threadid`
+	exportUserForums = `SELECT f.title, f."user", f.slug, f.posts, f.threads FROM "Users_by_Forum" uf
+					JOIN "Forum" f ON f.slug = uf.forum
+					WHERE uf."user" = ? ORDER BY f.slug`
+	selectNickname    = `SELECT nickname FROM "User" WHERE nickname = ?`
+	selectEmail       = `SELECT email FROM "User" WHERE nickname = ?`
+	insertPlaceholder = `INSERT INTO "User" (nickname, fullname, about, email) VALUES (?, ?, '', ?)`
+	// Действующий псевдоним держит nickname до expires, как drop_user_alias из
+	// миграции 0015; ?3 сам пользователь, которому свой псевдоним не мешает.
+	selectAliasTaken = `SELECT EXISTS (SELECT 1 FROM "User_alias" WHERE alias = ?1 AND expires > ?2 AND nickname <> ?3)`
+	insertUserAlias  = `INSERT INTO "User_alias" (alias, nickname, expires) SELECT ?1, ?2, ?3 WHERE ?1 <> ?2 COLLATE CITEXT
+					ON CONFLICT (alias) DO UPDATE SET nickname = excluded.nickname, expires = excluded.expires`
+	selectIsAdmin = `SELECT EXISTS (SELECT 1 FROM "User_admin" WHERE nickname = ?)`
+	insertAdmin   = `INSERT INTO "User_admin" (nickname) SELECT nickname FROM "User" WHERE nickname = ? ON CONFLICT DO NOTHING`
+	deleteAdmin   = `DELETE FROM "User_admin" WHERE nickname = ?`
+	selectAdmins  = `SELECT u.nickname, u.fullname, u.about, u.email FROM "User_admin" a
+					JOIN "User" u ON u.nickname = a.nickname ORDER BY u.nickname`
+)
+
+// deleteUser повторяет функцию delete_user из миграций Postgres: ?1 удаляемый
+// nickname, ?2 nickname заглушки.
+var deleteUser = []string{
+	`UPDATE "Thread" SET votes = votes - (SELECT v.value FROM "Vote" v WHERE v.threadid = "Thread".id AND v."user" = ?1)
+		WHERE id IN (SELECT threadid FROM "Vote" WHERE "user" = ?1)`,
+	`DELETE FROM "Vote" WHERE "user" = ?1`,
+	`UPDATE "Forum" SET "user" = ?2 WHERE "user" = ?1`,
+	`UPDATE "Thread" SET author = ?2 WHERE author = ?1`,
+	`UPDATE "Post" SET author = ?2 WHERE author = ?1`,
+	`DELETE FROM "Users_by_Forum" WHERE "user" = ?1`,
+	`DELETE FROM "User" WHERE nickname = ?1`,
+}
+
+// renameUserRefs таблицы, где nickname хранится без ON UPDATE CASCADE.
+var renameUserRefs = []string{
+	`UPDATE "Forum" SET "user" = ?2 WHERE "user" = ?1`,
+	`UPDATE "Thread" SET author = ?2 WHERE author = ?1`,
+	`UPDATE "Post" SET author = ?2 WHERE author = ?1`,
+	`UPDATE "Users_by_Forum" SET "user" = ?2 WHERE "user" = ?1`,
+	`UPDATE "Vote" SET "user" = ?2 WHERE "user" = ?1`,
+}
+
+type UserRepository struct {
+	DB *sql.DB
+}
+
+func (u *UserRepository) AddUser(ctx context.Context, user models.User) ([]models.User, error) {
+	err := u.insertUser(ctx, user)
+	if err == nil {
+		return []models.User{user}, nil
+	}
+
+	logger.FromContext(ctx).Debug(err)
+	if err = fromSqlite(err, models.MissingUser); !errs.Is(err, errs.KindConflict) {
+		return nil, err
+	}
+
+	rows, err := u.DB.QueryContext(ctx, selectUser, user.Nickname, user.Email, toMicros(time.Now()))
+	if err != nil {
+		return nil, fromSqlite(err, models.MissingUser)
+	}
+	defer rows.Close()
+
+	var users []models.User
+	for rows.Next() {
+		var existing models.User
+		if err = rows.Scan(&existing.Nickname, &existing.Fullname, &existing.About, &existing.Email); err != nil {
+			return nil, fromSqlite(err, models.MissingUser)
+		}
+		users = append(users, existing)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fromSqlite(err, models.MissingUser)
+	}
+
+	return users, errs.Conflict(models.ErrUserExists)
+}
+
+// insertUser добавляет пользователя вместе с хэшем пароля, если он есть.
+func (u *UserRepository) insertUser(ctx context.Context, user models.User) error {
+	tx, err := u.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = checkAlias(ctx, tx, user.Nickname, ""); err != nil {
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, insertUser, user.Nickname, user.Fullname, user.About, user.Email); err != nil {
+		return err
+	}
+	if user.PasswordHash != "" {
+		if _, err = tx.ExecContext(ctx, upsertUserPassword, user.Nickname, user.PasswordHash); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// checkAlias возвращает Conflict, если nickname действующий псевдоним
+// пользователя, отличного от owner.
+func checkAlias(ctx context.Context, tx *sql.Tx, nickname string, owner string) error {
+	var taken bool
+	if err := tx.QueryRowContext(ctx, selectAliasTaken, nickname, toMicros(time.Now()), owner).Scan(&taken); err != nil {
+		return fromSqlite(err, models.MissingUser)
+	}
+	if taken {
+		return errs.Conflict(models.ErrUserNick)
+	}
+	return nil
+}
+
+func (u *UserRepository) ChangeUser(ctx context.Context, user models.User) (models.User, error) {
+	tx, err := u.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return models.User{}, fromSqlite(err, models.MissingUser)
+	}
+	defer tx.Rollback()
+
+	var changed models.User
+	err = tx.QueryRowContext(ctx, updateUser, user.Fullname, user.About, user.Email, user.Nickname).
+		Scan(&changed.Nickname, &changed.Fullname, &changed.About, &changed.Email)
+	if err != nil {
+		logger.FromContext(ctx).Debug(err)
+		if err = fromSqlite(err, models.MissingUser); errs.Is(err, errs.KindConflict) {
+			return models.User{}, errs.Wrap(errs.KindConflict, models.ErrUserEmail, err)
+		}
+		return models.User{}, err
+	}
+	if user.PasswordHash != "" {
+		if _, err = tx.ExecContext(ctx, upsertUserPassword, changed.Nickname, user.PasswordHash); err != nil {
+			logger.FromContext(ctx).Debug(err)
+			return models.User{}, fromSqlite(err, models.MissingUser)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return models.User{}, fromSqlite(err, models.MissingUser)
+	}
+	return changed, nil
+}
+
+func (u UserRepository) GetUser(ctx context.Context, nickname string) (models.User, error) {
+	var user models.User
+	err := u.DB.QueryRowContext(ctx, selectUserByNick, nickname, toMicros(time.Now())).Scan(&user.Nickname, &user.Fullname, &user.About, &user.Email)
+	if err != nil {
+		logger.FromContext(ctx).Debug(err)
+		return models.User{}, fromSqlite(err, models.MissingUser)
+	}
+
+	return user, nil
+}
+
+func (u UserRepository) GetUserCredentials(ctx context.Context, nickname string) (models.User, error) {
+	var user models.User
+	err := u.DB.QueryRowContext(ctx, selectUserCredentials, nickname, toMicros(time.Now())).
+		Scan(&user.Nickname, &user.Fullname, &user.About, &user.Email, &user.PasswordHash)
+	if err != nil {
+		logger.FromContext(ctx).Debug(err)
+		return models.User{}, fromSqlite(err, models.MissingUser)
+	}
+
+	return user, nil
+}
+
+func (u UserRepository) FindUsers(ctx context.Context, params models.UserSearch) ([]models.User, error) {
+	if err := checkLimit(params.Limit); err != nil {
+		return nil, err
+	}
+
+	query := selectUsers
+	if params.Desc {
+		query = selectUsersDesc
+	}
+	rows, err := u.DB.QueryContext(ctx, query, utils.LikePrefix(params.Query), params.Since, params.Limit)
+	if err != nil {
+		logger.FromContext(ctx).Debug(err)
+		return nil, fromSqlite(err, models.MissingUser)
+	}
+	defer rows.Close()
+
+	var users []models.User
+	for rows.Next() {
+		var user models.User
+		if err = rows.Scan(&user.Nickname, &user.Fullname, &user.About, &user.Email); err != nil {
+			return nil, fromSqlite(err, models.MissingUser)
+		}
+		users = append(users, user)
+	}
+	return users, fromSqlite(rows.Err(), models.MissingUser)
+}
+
+func (u UserRepository) CountUsers(ctx context.Context, query string) (int64, error) {
+	var count int64
+	err := u.DB.QueryRowContext(ctx, countUsers, utils.LikePrefix(query)).Scan(&count)
+	if err != nil {
+		logger.FromContext(ctx).Debug(err)
+	}
+	return count, fromSqlite(err, models.MissingUser)
+}
+
+func (u UserRepository) GetUserStats(ctx context.Context, nickname string) (models.UserStats, error) {
+	var stats models.UserStats
+	var first, last sql.NullInt64
+
+	err := u.DB.QueryRowContext(ctx, selectUserStats, nickname).Scan(&stats.Nickname, &stats.Posts, &stats.Threads,
+		&stats.VotesCast, &stats.VotesReceived, &stats.Forums, &first, &last)
+	if err != nil {
+		logger.FromContext(ctx).Debug(err)
+		return models.UserStats{}, fromSqlite(err, models.MissingUser)
+	}
+
+	if first.Valid {
+		t := fromMicros(first.Int64)
+		stats.FirstActivity = &t
+	}
+	if last.Valid {
+		t := fromMicros(last.Int64)
+		stats.LastActivity = &t
+	}
+	return stats, nil
+}
+
+// RenameUser меняет nickname во всех таблицах одной транзакцией. Внешние ключи
+// проверяются при COMMIT, когда ссылки уже указывают на новый nickname.
+func (u UserRepository) RenameUser(ctx context.Context, nickname string, newNickname string, aliasExpires time.Time) (models.User, error) {
+	tx, err := u.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return models.User{}, fromSqlite(err, models.MissingUser)
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.ExecContext(ctx, `PRAGMA defer_foreign_keys = ON`); err != nil {
+		return models.User{}, fromSqlite(err, models.MissingUser)
+	}
+
+	if err = checkAlias(ctx, tx, newNickname, nickname); err != nil {
+		return models.User{}, errs.Wrap(errs.KindConflict, models.ErrUserNick, err)
+	}
+
+	var user models.User
+	err = tx.QueryRowContext(ctx, renameUser, nickname, newNickname).Scan(&user.Nickname, &user.Fullname, &user.About, &user.Email)
+	if err != nil {
+		logger.FromContext(ctx).Debug(err)
+		if err = fromSqlite(err, models.MissingUser); errs.Is(err, errs.KindConflict) {
+			return models.User{}, errs.Wrap(errs.KindConflict, models.ErrUserNick, err)
+		}
+		return models.User{}, err
+	}
+
+	for _, query := range renameUserRefs {
+		if _, err = tx.ExecContext(ctx, query, nickname, user.Nickname); err != nil {
+			logger.FromContext(ctx).Debug(err)
+			return models.User{}, fromSqlite(err, models.MissingUser)
+		}
+	}
+	if _, err = tx.ExecContext(ctx, insertUserAlias, nickname, user.Nickname, toMicros(aliasExpires)); err != nil {
+		logger.FromContext(ctx).Debug(err)
+		return models.User{}, fromSqlite(err, models.MissingUser)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return models.User{}, fromSqlite(err, models.MissingUser)
+	}
+	return user, nil
+}
+
+func (u UserRepository) DeleteUser(ctx context.Context, nickname string) error {
+	tx, err := u.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fromSqlite(err, models.MissingUser)
+	}
+	defer tx.Rollback()
+
+	var nick string
+	if err = tx.QueryRowContext(ctx, selectNickname, nickname).Scan(&nick); err != nil {
+		logger.FromContext(ctx).Debug(err)
+		return fromSqlite(err, models.MissingUser)
+	}
+
+	if err = claimPlaceholder(ctx, tx); err != nil {
+		logger.FromContext(ctx).Debug(err)
+		return fromSqlite(err, models.MissingUser)
+	}
+	for _, query := range deleteUser {
+		if _, err = tx.ExecContext(ctx, query, nick, models.DeletedUser); err != nil {
+			logger.FromContext(ctx).Debug(err)
+			return fromSqlite(err, models.MissingUser)
+		}
+	}
+
+	return fromSqlite(tx.Commit(), models.MissingUser)
+}
+
+// claimPlaceholder создаёт заглушку удалённых пользователей, если её ещё нет.
+// Записи переходят только к самой заглушке, поэтому аккаунт с её nickname, но
+// другим email, даёт ошибку, как в delete_user из миграции 0016.
+func claimPlaceholder(ctx context.Context, tx *sql.Tx) error {
+	var email string
+	err := tx.QueryRowContext(ctx, selectEmail, models.DeletedUser).Scan(&email)
+	switch {
+	case err == sql.ErrNoRows:
+		_, err = tx.ExecContext(ctx, insertPlaceholder, models.DeletedUser, models.DeletedUserFullname, models.DeletedUserEmail)
+		return err
+	case err != nil:
+		return err
+	case !strings.EqualFold(email, models.DeletedUserEmail):
+		return errs.New(errs.KindInternal, models.ErrNotPlaceholder)
+	}
+	return nil
+}
+
+// export выполняет запрос и передаёт каждую строку в scan, пока строки не
+// кончатся или scan не вернёт ошибку.
+func (u UserRepository) export(ctx context.Context, query string, nickname string, scan func(rows *sql.Rows) error) error {
+	rows, err := u.DB.QueryContext(ctx, query, nickname)
+	if err != nil {
+		logger.FromContext(ctx).Debug(err)
+		return fromSqlite(err, models.MissingUser)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err = scan(rows); err != nil {
+			return fromSqlite(err, models.MissingUser)
+		}
+	}
+	return fromSqlite(rows.Err(), models.MissingUser)
+}
+
+func (u UserRepository) ExportThreads(ctx context.Context, nickname string, fn func(models.Thread) error) error {
+	return u.export(ctx, exportUserThreads, nickname, func(rows *sql.Rows) error {
+		thread, err := scanThread(rows)
+		if err != nil {
+			return err
+		}
+		if utils.IsValidUUID(thread.Slug) {
+			thread.Slug = ""
+		}
+		return fn(thread)
+	})
+}
+
+func (u UserRepository) ExportPosts(ctx context.Context, nickname string, fn func(models.UserExportPost) error) error {
+	return u.export(ctx, exportUserPosts, nickname, func(rows *sql.Rows) error {
+		var post models.UserExportPost
+		var created int64
+		err := rows.Scan(&post.Id, &post.Parent, &post.Author, &post.Message, &post.IsEdited, &post.Forum, &post.Thread, &created,
+			&post.ThreadTitle, &post.ThreadSlug, &post.ForumTitle)
+		if err != nil {
+			return err
+		}
+		post.Created = fromMicros(created)
+		if utils.IsValidUUID(post.ThreadSlug) {
+			post.ThreadSlug = ""
+		}
+		return fn(post)
+	})
+}
+
+func (u UserRepository) ExportVotes(ctx context.Context, nickname string, fn func(models.UserExportVote) error) error {
+	return u.export(ctx, exportUserVotes, nickname, func(rows *sql.Rows) error {
+		var vote models.UserExportVote
+		if err := rows.Scan(&vote.Thread, &vote.ThreadSlug, &vote.Forum, &vote.Voice); err != nil {
+			return err
+		}
+		if utils.IsValidUUID(vote.ThreadSlug) {
+			vote.ThreadSlug = ""
+		}
+		return fn(vote)
+	})
+}
+
+func (u UserRepository) ExportForums(ctx context.Context, nickname string, fn func(models.Forum) error) error {
+	return u.export(ctx, exportUserForums, nickname, func(rows *sql.Rows) error {
+		var forum models.Forum
+		if err := rows.Scan(&forum.Title, &forum.User, &forum.Slug, &forum.Posts, &forum.Threads); err != nil {
+			return err
+		}
+		return fn(forum)
+	})
+}
+
+func (u UserRepository) IsAdmin(ctx context.Context, nickname string) (bool, error) {
+	var admin bool
+	err := u.DB.QueryRowContext(ctx, selectIsAdmin, nickname).Scan(&admin)
+	return admin, fromSqlite(err, models.MissingUser)
+}
+
+func (u UserRepository) SetAdmin(ctx context.Context, nickname string, admin bool) error {
+	query := deleteAdmin
+	if admin {
+		query = insertAdmin
+	}
+
+	tx, err := u.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fromSqlite(err, models.MissingUser)
+	}
+	defer tx.Rollback()
+
+	if err = tx.QueryRowContext(ctx, selectNickname, nickname).Scan(&nickname); err != nil {
+		return fromSqlite(err, models.MissingUser)
+	}
+	if _, err = tx.ExecContext(ctx, query, nickname); err != nil {
+		logger.FromContext(ctx).Debug(err)
+		return fromSqlite(err, models.MissingUser)
+	}
+	return fromSqlite(tx.Commit(), models.MissingUser)
+}
+
+func (u UserRepository) FindAdmins(ctx context.Context) ([]models.User, error) {
+	rows, err := u.DB.QueryContext(ctx, selectAdmins)
+	if err != nil {
+		return nil, fromSqlite(err, models.MissingUser)
+	}
+	defer rows.Close()
+
+	users := []models.User{}
+	for rows.Next() {
+		var user models.User
+		if err = rows.Scan(&user.Nickname, &user.Fullname, &user.About, &user.Email); err != nil {
+			return nil, fromSqlite(err, models.MissingUser)
+		}
+		users = append(users, user)
+	}
+	return users, fromSqlite(rows.Err(), models.MissingUser)
+}
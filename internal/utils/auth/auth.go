@@ -0,0 +1,141 @@
+// Package auth токены сессий, ключи API и пользователь, от имени которого
+// выполняется запрос.
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"forum/internal/utils/errs"
+	"forum/pkg/models"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Tokens выдаёт и проверяет токены вида base64(nickname).expires.base64(HMAC-SHA256).
+// В подпись входит хэш пароля: смена пароля отзывает выданные токены, а тот,
+// кто займёт освободившийся nickname, не получит чужие сессии.
+type Tokens struct {
+	Secret []byte
+	TTL    time.Duration
+}
+
+func (t Tokens) Issue(user models.User, now time.Time) models.UserSession {
+	expires := now.Add(t.TTL).Truncate(time.Second)
+	payload := base64.RawURLEncoding.EncodeToString([]byte(user.Nickname)) + "." + strconv.FormatInt(expires.Unix(), 10)
+	return models.UserSession{
+		Nickname: user.Nickname,
+		Token:    payload + "." + t.sign(payload, user.PasswordHash),
+		Expires:  expires,
+	}
+}
+
+// Nickname разбирает неистёкший токен; подпись проверяет Verify, когда найден
+// хэш пароля пользователя.
+func (t Tokens) Nickname(token string, now time.Time) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", errs.Unauthorized(models.ErrBadToken)
+	}
+	nickname, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return "", errs.Unauthorized(models.ErrBadToken)
+	}
+	expires, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || !now.Before(time.Unix(expires, 0)) {
+		return "", errs.Unauthorized(models.ErrBadToken)
+	}
+	return string(nickname), nil
+}
+
+func (t Tokens) Verify(token string, user models.User) bool {
+	dot := strings.LastIndex(token, ".")
+	if dot < 0 || user.PasswordHash == "" {
+		return false
+	}
+	return hmac.Equal([]byte(token[dot+1:]), []byte(t.sign(token[:dot], user.PasswordHash)))
+}
+
+func (t Tokens) sign(payload string, passwordHash string) string {
+	mac := hmac.New(sha256.New, t.Secret)
+	mac.Write([]byte(payload))
+	mac.Write([]byte{0})
+	mac.Write([]byte(passwordHash))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// NewKey новый ключ API и его хэш для хранения.
+func NewKey() (key string, hash string, err error) {
+	secret := make([]byte, 32)
+	if _, err = rand.Read(secret); err != nil {
+		return "", "", err
+	}
+	key = models.APIKeyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+	return key, HashKey(key), nil
+}
+
+// HashKey SHA-256 ключа API в hex, по которому ключ ищется в хранилище.
+func HashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// IsKey отличает ключ API от токена сессии.
+func IsKey(token string) bool {
+	return strings.HasPrefix(token, models.APIKeyPrefix)
+}
+
+// Caller пользователь, от имени которого выполняется запрос.
+type Caller struct {
+	Nickname string
+	// Области ключа API; nil, если пользователь вошёл по паролю.
+	Scopes []string
+}
+
+// Allows разрешена ли вызывающему область scope.
+func (c Caller) Allows(scope string) bool {
+	if c.Scopes == nil {
+		return true
+	}
+	for _, s := range c.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+type ctxKey struct{}
+
+// WithCaller добавляет в контекст аутентифицированного пользователя.
+func WithCaller(ctx context.Context, caller Caller) context.Context {
+	return context.WithValue(ctx, ctxKey{}, caller)
+}
+
+// FromContext аутентифицированный пользователь; false для анонимного запроса.
+func FromContext(ctx context.Context) (Caller, bool) {
+	caller, ok := ctx.Value(ctxKey{}).(Caller)
+	return caller, ok
+}
+
+// Check запрещает запись от имени nickname другому пользователю. Анонимные
+// запросы доходят сюда, только если аутентификация не обязательна.
+func Check(ctx context.Context, nickname string) error {
+	caller, ok := FromContext(ctx)
+	if !ok || strings.EqualFold(caller.Nickname, nickname) {
+		return nil
+	}
+	return errs.Forbidden(models.ErrNotCaller)
+}
+
+// Require как Check, но анонимный запрос отклоняется всегда.
+func Require(ctx context.Context, nickname string) error {
+	if _, ok := FromContext(ctx); !ok {
+		return errs.Unauthorized(models.ErrNoToken)
+	}
+	return Check(ctx, nickname)
+}
@@ -0,0 +1,169 @@
+package errs
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+
+	"github.com/jackc/pgx"
+)
+
+// Kind классифицирует ошибку доменного слоя, чтобы delivery мог выбрать HTTP-статус.
+type Kind int
+
+const (
+	KindInternal Kind = iota
+	KindNotFound
+	KindConflict
+	KindInvalid
+	KindUnavailable
+	KindUnauthorized
+	KindForbidden
+)
+
+func (k Kind) String() string {
+	switch k {
+	case KindNotFound:
+		return "not found"
+	case KindConflict:
+		return "conflict"
+	case KindInvalid:
+		return "invalid input"
+	case KindUnavailable:
+		return "service unavailable"
+	case KindUnauthorized:
+		return "unauthorized"
+	case KindForbidden:
+		return "forbidden"
+	default:
+		return "internal error"
+	}
+}
+
+// Error ошибка, которая возвращается репозиториями и юзкейсами.
+type Error struct {
+	Kind    Kind
+	Message string
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Message != "" && e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	if e.Message != "" {
+		return e.Message
+	}
+	if e.Err != nil {
+		return e.Err.Error()
+	}
+	return e.Kind.String()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func New(kind Kind, message string) error {
+	return &Error{Kind: kind, Message: message}
+}
+
+func Wrap(kind Kind, message string, err error) error {
+	return &Error{Kind: kind, Message: message, Err: err}
+}
+
+func NotFound(message string) error {
+	return New(KindNotFound, message)
+}
+
+func Conflict(message string) error {
+	return New(KindConflict, message)
+}
+
+func Invalid(message string) error {
+	return New(KindInvalid, message)
+}
+
+func Unauthorized(message string) error {
+	return New(KindUnauthorized, message)
+}
+
+func Forbidden(message string) error {
+	return New(KindForbidden, message)
+}
+
+func Unavailable(err error) error {
+	return Wrap(KindUnavailable, "", err)
+}
+
+func Internal(err error) error {
+	return Wrap(KindInternal, "", err)
+}
+
+// KindOf возвращает тип ошибки; ошибки не из этого пакета считаются внутренними.
+func KindOf(err error) Kind {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Kind
+	}
+	return KindInternal
+}
+
+func Is(err error, kind Kind) bool {
+	return err != nil && KindOf(err) == kind
+}
+
+// Message возвращает текст, который можно отдать клиенту: подробности
+// внутренних ошибок и ошибок БД наружу не уходят.
+func Message(err error) string {
+	var e *Error
+	if !errors.As(err, &e) {
+		return KindInternal.String()
+	}
+	if e.Kind == KindInternal || e.Kind == KindUnavailable || e.Message == "" {
+		return e.Kind.String()
+	}
+	return e.Message
+}
+
+// FromPgx переводит ошибку pgx в доменную. notFound используется как текст
+// ошибки при отсутствии строки или нарушении внешнего ключа.
+func FromPgx(err error, notFound string) error {
+	if err == nil {
+		return nil
+	}
+
+	var e *Error
+	if errors.As(err, &e) {
+		return err
+	}
+
+	if err == pgx.ErrNoRows {
+		return NotFound(notFound)
+	}
+
+	if pgErr, ok := err.(pgx.PgError); ok {
+		switch {
+		// foreign_key_violation, not_null_violation (подзапрос по несуществующему ключу вернул NULL)
+		case pgErr.Code == "23503" || pgErr.Code == "23502":
+			return Wrap(KindNotFound, notFound, err)
+		case pgErr.Code == "23505":
+			return Wrap(KindConflict, "already exists", err)
+		case strings.HasPrefix(pgErr.Code, "22"):
+			return Wrap(KindInvalid, pgErr.Message, err)
+		case strings.HasPrefix(pgErr.Code, "08"), strings.HasPrefix(pgErr.Code, "53"),
+			strings.HasPrefix(pgErr.Code, "57P"):
+			return Unavailable(err)
+		}
+		return Internal(err)
+	}
+
+	var netErr net.Error
+	if err == pgx.ErrAcquireTimeout || err == pgx.ErrDeadConn || err == pgx.ErrClosedPool ||
+		errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) || errors.As(err, &netErr) {
+		return Unavailable(err)
+	}
+
+	return Internal(err)
+}
@@ -1,8 +1,10 @@
 package logger
 
 import (
+	"context"
+	"forum/internal/utils/errs"
 	"github.com/sirupsen/logrus"
-	"log"
+	"os"
 )
 
 type Logger struct {
@@ -14,12 +16,63 @@ type LoggerInterface interface {
 	LogError(data interface{})
 }
 
+// New создаёт логгер с форматом "json" или "logfmt".
+func New(level string, format string) (*Logger, error) {
+	lvl, err := logrus.ParseLevel(level)
+	if err != nil {
+		return nil, err
+	}
+
+	base := logrus.New()
+	base.SetOutput(os.Stdout)
+	base.SetLevel(lvl)
+	if format == "json" {
+		base.SetFormatter(&logrus.JSONFormatter{})
+	} else {
+		base.SetFormatter(&logrus.TextFormatter{DisableColors: true, FullTimestamp: true})
+	}
+
+	return &Logger{Logger: logrus.NewEntry(base)}, nil
+}
+
 func (l *Logger) LogInfo(data interface{}) {
-	log.Println(data)
-	//l.Logger.Info(data)
+	l.Logger.Info(data)
 }
 
 func (l *Logger) LogError(data interface{}) {
-	log.Println(data)
-	//l.Logger.Error(data)
+	l.Logger.Error(data)
+}
+
+// Flush сбрасывает буферы вывода логгера, если он пишет в файл.
+func (l *Logger) Flush() {
+	if f, ok := l.Logger.Logger.Out.(*os.File); ok {
+		_ = f.Sync()
+	}
+}
+
+type ctxKey struct{}
+
+// WithContext кладёт логгер запроса (с request_id и т.п.) в контекст.
+func WithContext(ctx context.Context, entry *logrus.Entry) context.Context {
+	return context.WithValue(ctx, ctxKey{}, entry)
+}
+
+// FromContext возвращает логгер запроса или стандартный логгер logrus, если его нет.
+func FromContext(ctx context.Context) *logrus.Entry {
+	if entry, ok := ctx.Value(ctxKey{}).(*logrus.Entry); ok {
+		return entry
+	}
+	return logrus.NewEntry(logrus.StandardLogger())
+}
+
+// ErrorFunc выбирает уровень для ошибки: внутренние и ошибки недоступности
+// пишутся как error, ошибки клиента как warning.
+func ErrorFunc(ctx context.Context, err error) func(args ...interface{}) {
+	entry := FromContext(ctx).WithField("error_kind", errs.KindOf(err).String())
+	switch errs.KindOf(err) {
+	case errs.KindInternal, errs.KindUnavailable:
+		return entry.Error
+	default:
+		return entry.Warn
+	}
 }
@@ -0,0 +1,142 @@
+// Package pgxtime замеряет время запросов к пулу pgx без логгера драйвера:
+// на уровне Info pgx на каждый запрос собирает запись с копией аргументов.
+package pgxtime
+
+import (
+	"context"
+	"github.com/jackc/pgx"
+	"time"
+)
+
+// Observe получает имя подготовленного запроса или его текст, время от отправки
+// до закрытия результата и ошибку запроса.
+type Observe func(sql string, elapsed time.Duration, err error)
+
+// Pool *pgx.ConnPool, у которого Query, QueryEx, QueryRowEx, ExecEx и BeginEx
+// сообщают о каждом запросе в Observe. Остальные методы как у пула.
+type Pool struct {
+	*pgx.ConnPool
+	Observe Observe
+}
+
+func (p *Pool) observe(sql string, started time.Time, err error) {
+	if p.Observe != nil {
+		p.Observe(sql, time.Since(started), err)
+	}
+}
+
+func (p *Pool) Query(sql string, args ...interface{}) (*Rows, error) {
+	return p.QueryEx(context.Background(), sql, nil, args...)
+}
+
+func (p *Pool) QueryEx(ctx context.Context, sql string, options *pgx.QueryExOptions, args ...interface{}) (*Rows, error) {
+	started := time.Now()
+	rows, err := p.ConnPool.QueryEx(ctx, sql, options, args...)
+	return p.rows(rows, sql, started, err), err
+}
+
+func (p *Pool) QueryRowEx(ctx context.Context, sql string, options *pgx.QueryExOptions, args ...interface{}) *Row {
+	rows, _ := p.QueryEx(ctx, sql, options, args...)
+	return (*Row)(rows)
+}
+
+func (p *Pool) ExecEx(ctx context.Context, sql string, options *pgx.QueryExOptions, args ...interface{}) (pgx.CommandTag, error) {
+	started := time.Now()
+	tag, err := p.ConnPool.ExecEx(ctx, sql, options, args...)
+	p.observe(sql, started, err)
+	return tag, err
+}
+
+func (p *Pool) BeginEx(ctx context.Context, options *pgx.TxOptions) (*Tx, error) {
+	tx, err := p.ConnPool.BeginEx(ctx, options)
+	if err != nil {
+		return nil, err
+	}
+	return &Tx{Tx: tx, pool: p}, nil
+}
+
+// rows оборачивает результат; если запрос не отправился, замер закрывается сразу.
+func (p *Pool) rows(rows *pgx.Rows, sql string, started time.Time, err error) *Rows {
+	wrapped := &Rows{Rows: rows, pool: p, sql: sql, started: started}
+	if err != nil {
+		wrapped.done = true
+		p.observe(sql, started, err)
+	}
+	return wrapped
+}
+
+// Tx *pgx.Tx, запросы которого замеряются так же, как запросы пула.
+type Tx struct {
+	*pgx.Tx
+	pool *Pool
+}
+
+func (tx *Tx) QueryEx(ctx context.Context, sql string, options *pgx.QueryExOptions, args ...interface{}) (*Rows, error) {
+	started := time.Now()
+	rows, err := tx.Tx.QueryEx(ctx, sql, options, args...)
+	return tx.pool.rows(rows, sql, started, err), err
+}
+
+func (tx *Tx) QueryRowEx(ctx context.Context, sql string, options *pgx.QueryExOptions, args ...interface{}) *Row {
+	rows, _ := tx.QueryEx(ctx, sql, options, args...)
+	return (*Row)(rows)
+}
+
+func (tx *Tx) ExecEx(ctx context.Context, sql string, options *pgx.QueryExOptions, args ...interface{}) (pgx.CommandTag, error) {
+	started := time.Now()
+	tag, err := tx.Tx.ExecEx(ctx, sql, options, args...)
+	tx.pool.observe(sql, started, err)
+	return tag, err
+}
+
+// Rows *pgx.Rows; запрос замеряется, когда строки кончились или Close.
+type Rows struct {
+	*pgx.Rows
+	pool    *Pool
+	sql     string
+	started time.Time
+	done    bool
+}
+
+func (r *Rows) Next() bool {
+	if r.Rows.Next() {
+		return true
+	}
+	r.finish()
+	return false
+}
+
+func (r *Rows) Close() {
+	r.Rows.Close()
+	r.finish()
+}
+
+func (r *Rows) finish() {
+	if r.done {
+		return
+	}
+	r.done = true
+	r.pool.observe(r.sql, r.started, r.Rows.Err())
+}
+
+// Row результат QueryRowEx, как *pgx.Row.
+type Row Rows
+
+// Scan как у *pgx.Row: pgx.ErrNoRows, если строк нет.
+func (r *Row) Scan(dest ...interface{}) error {
+	rows := (*Rows)(r)
+	if rows.Err() != nil {
+		rows.finish()
+		return rows.Err()
+	}
+	if !rows.Next() {
+		if rows.Err() == nil {
+			return pgx.ErrNoRows
+		}
+		return rows.Err()
+	}
+
+	_ = rows.Scan(dest...)
+	rows.Close()
+	return rows.Err()
+}
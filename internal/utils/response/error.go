@@ -2,10 +2,14 @@ package response
 
 import (
 	"encoding/json"
+	"forum/internal/utils/errs"
 	"log"
 	"net/http"
 )
 
+// TotalCountHeader общее число записей для постраничных списков.
+const TotalCountHeader = "X-Total-Count"
+
 type ErrorResponse struct {
 	Err string `json:"message"`
 }
@@ -40,6 +44,30 @@ func ResponseFunc(w http.ResponseWriter, code int, body interface{}) responsefun
 	}
 }
 
+// StatusCode единственное место, где доменная ошибка превращается в HTTP-статус.
+func StatusCode(err error) int {
+	switch errs.KindOf(err) {
+	case errs.KindNotFound:
+		return http.StatusNotFound
+	case errs.KindConflict:
+		return http.StatusConflict
+	case errs.KindInvalid:
+		return http.StatusBadRequest
+	case errs.KindUnauthorized:
+		return http.StatusUnauthorized
+	case errs.KindForbidden:
+		return http.StatusForbidden
+	case errs.KindUnavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func ErrorFunc(w http.ResponseWriter, err error) responsefunc {
+	return ResponseFunc(w, StatusCode(err), ErrorResponse{Err: errs.Message(err)})
+}
+
 func Process(logfunc logfunc, responsefunc responsefunc) {
 	logfunc()
 	responsefunc()
@@ -1,12 +1,15 @@
 package utils
 
 import (
+	"forum/internal/utils/errs"
 	"forum/pkg/models"
 	"github.com/google/uuid"
 	"github.com/gorilla/schema"
 	"github.com/jackc/pgx"
 	"log"
 	"net/url"
+	"strconv"
+	"strings"
 )
 
 func GetDataFromPath(param string, vars map[string]string) (string, bool) {
@@ -23,7 +26,7 @@ func PgxErrorCode(err error) string {
 	return pgerr.Code
 }
 
-func ParseJsonToSearchParams(values url.Values) (models.ParamsForSearch, bool) {
+func ParseJsonToSearchParams(values url.Values) (models.ParamsForSearch, error) {
 	var params models.ParamsForSearch
 
 	decoder := schema.NewDecoder()
@@ -32,14 +35,14 @@ func ParseJsonToSearchParams(values url.Values) (models.ParamsForSearch, bool) {
 
 	if err != nil {
 		log.Println(err)
-		return params, false
+		return params, errs.Wrap(errs.KindInvalid, "Invalid query parameters", err)
 	}
 
 	if params.Limit == 0 {
 		params.Limit = 100
 	}
 
-	return params, true
+	return params, nil
 }
 
 func IsValidUUID(u string) bool {
@@ -47,7 +50,7 @@ func IsValidUUID(u string) bool {
 	return err == nil
 }
 
-func ParseJsonToGetPostsParams(values url.Values) (models.ParamsForGetPosts, bool) {
+func ParseJsonToGetPostsParams(values url.Values) (models.ParamsForGetPosts, error) {
 	var params models.ParamsForGetPosts
 
 	decoder := schema.NewDecoder()
@@ -56,12 +59,113 @@ func ParseJsonToGetPostsParams(values url.Values) (models.ParamsForGetPosts, boo
 
 	if err != nil {
 		log.Println(err)
-		return params, false
+		return params, errs.Wrap(errs.KindInvalid, "Invalid query parameters", err)
 	}
 
 	if params.Limit == 0 {
 		params.Limit = 100
 	}
 
-	return params, true
+	return params, nil
+}
+
+func ParseJsonToUserSearch(values url.Values) (models.UserSearch, error) {
+	var params models.UserSearch
+
+	decoder := schema.NewDecoder()
+	decoder.IgnoreUnknownKeys(true)
+	err := decoder.Decode(&params, values)
+
+	if err != nil {
+		log.Println(err)
+		return params, errs.Wrap(errs.KindInvalid, "Invalid query parameters", err)
+	}
+
+	if params.Limit == 0 {
+		params.Limit = 100
+	}
+
+	return params, nil
+}
+
+func ParseJsonToForumSearch(values url.Values) (models.ForumSearch, error) {
+	var params models.ForumSearch
+
+	decoder := schema.NewDecoder()
+	decoder.IgnoreUnknownKeys(true)
+	err := decoder.Decode(&params, values)
+
+	if err != nil {
+		log.Println(err)
+		return params, errs.Wrap(errs.KindInvalid, "Invalid query parameters", err)
+	}
+
+	if params.Limit == 0 {
+		params.Limit = 100
+	}
+	if params.Sort == "" {
+		params.Sort = models.ForumSortSlug
+	}
+
+	return params, nil
+}
+
+// LikePrefix шаблон LIKE для поиска по префиксу без учёта регистра: спецсимволы
+// экранируются обратной косой чертой, сравнивать нужно с lower(column).
+func LikePrefix(prefix string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return replacer.Replace(strings.ToLower(prefix)) + "%"
+}
+
+func ParseJsonToUserPostsParams(values url.Values) (models.UserPostsParams, error) {
+	var params models.UserPostsParams
+
+	decoder := schema.NewDecoder()
+	decoder.IgnoreUnknownKeys(true)
+	err := decoder.Decode(&params, values)
+
+	if err != nil {
+		log.Println(err)
+		return params, errs.Wrap(errs.KindInvalid, "Invalid query parameters", err)
+	}
+
+	if params.Limit == 0 {
+		params.Limit = 100
+	}
+
+	return params, nil
+}
+
+func ParseJsonToUserThreadsParams(values url.Values) (models.UserThreadsParams, error) {
+	var params models.UserThreadsParams
+
+	decoder := schema.NewDecoder()
+	decoder.IgnoreUnknownKeys(true)
+	err := decoder.Decode(&params, values)
+
+	if err != nil {
+		log.Println(err)
+		return params, errs.Wrap(errs.KindInvalid, "Invalid query parameters", err)
+	}
+
+	if params.Limit == 0 {
+		params.Limit = 100
+	}
+
+	return params, nil
+}
+
+// ParseDryRun флаг dry_run из строки запроса; без параметра false.
+func ParseDryRun(values url.Values) (bool, error) {
+	value := values.Get("dry_run")
+	if value == "" {
+		return false, nil
+	}
+
+	dryRun, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Println(err)
+		return false, errs.Wrap(errs.KindInvalid, "Invalid query parameters", err)
+	}
+	return dryRun, nil
 }
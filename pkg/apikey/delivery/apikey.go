@@ -0,0 +1,79 @@
+package delivery
+
+import (
+	"forum/internal/utils/logger"
+	"forum/internal/utils/response"
+	"forum/internal/utils/utils"
+	"forum/pkg/apikey/usecase"
+	"github.com/gorilla/mux"
+	"net/http"
+)
+
+func (k KeyDelivery) SetHandlersForKeys(router *mux.Router) {
+	router.HandleFunc("/user/{nickname}/keys", k.CreateKey).Methods(http.MethodPost)
+	router.HandleFunc("/user/{nickname}/keys", k.GetKeys).Methods(http.MethodGet)
+	router.HandleFunc("/user/{nickname}/keys/{id}", k.DeleteKey).Methods(http.MethodDelete)
+}
+
+type KeyDeliveryInterface interface {
+	CreateKey(w http.ResponseWriter, r *http.Request)
+	GetKeys(w http.ResponseWriter, r *http.Request)
+	DeleteKey(w http.ResponseWriter, r *http.Request)
+}
+
+type KeyDelivery struct {
+	Usecase usecase.KeyUsecaseInterface
+}
+
+func (k KeyDelivery) CreateKey(w http.ResponseWriter, r *http.Request) {
+	nickname, ok := utils.GetDataFromPath("nickname", mux.Vars(r))
+	if !ok {
+		return
+	}
+
+	key, err := k.Usecase.ParseJsonToKey(r.Body)
+	if err != nil {
+		response.Process(response.LoggerFunc(err.Error(), logger.ErrorFunc(r.Context(), err)), response.ErrorFunc(w, err))
+		return
+	}
+
+	created, err := k.Usecase.CreateKey(r.Context(), nickname, key)
+	if err != nil {
+		response.Process(response.LoggerFunc(err.Error(), logger.ErrorFunc(r.Context(), err)), response.ErrorFunc(w, err))
+		return
+	}
+	response.Process(response.LoggerFunc("Created API key", logger.FromContext(r.Context()).Debug), response.ResponseFunc(w, http.StatusCreated, created))
+}
+
+func (k KeyDelivery) GetKeys(w http.ResponseWriter, r *http.Request) {
+	nickname, ok := utils.GetDataFromPath("nickname", mux.Vars(r))
+	if !ok {
+		return
+	}
+
+	keys, err := k.Usecase.FindKeys(r.Context(), nickname)
+	if err != nil {
+		response.Process(response.LoggerFunc(err.Error(), logger.ErrorFunc(r.Context(), err)), response.ErrorFunc(w, err))
+		return
+	}
+	response.Process(response.LoggerFunc("Get API keys", logger.FromContext(r.Context()).Debug), response.ResponseFunc(w, http.StatusOK, keys))
+}
+
+func (k KeyDelivery) DeleteKey(w http.ResponseWriter, r *http.Request) {
+	nickname, ok := utils.GetDataFromPath("nickname", mux.Vars(r))
+	if !ok {
+		return
+	}
+	id, ok := utils.GetDataFromPath("id", mux.Vars(r))
+	if !ok {
+		return
+	}
+
+	if err := k.Usecase.DeleteKey(r.Context(), nickname, id); err != nil {
+		response.Process(response.LoggerFunc(err.Error(), logger.ErrorFunc(r.Context(), err)), response.ErrorFunc(w, err))
+		return
+	}
+
+	logger.FromContext(r.Context()).Debug("Revoked API key")
+	w.WriteHeader(http.StatusNoContent)
+}
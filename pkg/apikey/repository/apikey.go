@@ -0,0 +1,113 @@
+package repository
+
+import (
+	"context"
+	"forum/internal/utils/errs"
+	"forum/internal/utils/logger"
+	"forum/internal/utils/pgxtime"
+	"forum/pkg/models"
+	"github.com/jackc/pgx/pgtype"
+	"strings"
+	"time"
+)
+
+const (
+	InsertKey = `INSERT INTO parkmaildb."User_key" (nickname, name, hash, scopes, created) VALUES ($1, $2, $3, $4, $5)
+					RETURNING id, nickname`
+	SelectKeys = `SELECT id, nickname, name, scopes, created, last_used FROM parkmaildb."User_key"
+					WHERE nickname = $1 ORDER BY id`
+	SelectKeyByHash = `SELECT id, nickname, name, scopes, created, last_used FROM parkmaildb."User_key" WHERE hash = $1`
+	DeleteKey       = `DELETE FROM parkmaildb."User_key" WHERE nickname = $1 AND id = $2`
+	UpdateKeyUsed   = `UPDATE parkmaildb."User_key" SET last_used = $2 WHERE id = $1`
+)
+
+type KeyRepositoryInterface interface {
+	// AddKey сохраняет ключ с заполненным Hash и возвращает его с Id.
+	AddKey(ctx context.Context, key models.APIKey) (models.APIKey, error)
+	FindKeys(ctx context.Context, nickname string) ([]models.APIKey, error)
+	GetKeyByHash(ctx context.Context, hash string) (models.APIKey, error)
+	// DeleteKey отзывает ключ id, если он принадлежит nickname.
+	DeleteKey(ctx context.Context, nickname string, id int) error
+	TouchKey(ctx context.Context, id int, used time.Time) error
+}
+
+type KeyRepository struct {
+	DB *pgxtime.Pool
+}
+
+func (k KeyRepository) AddKey(ctx context.Context, key models.APIKey) (models.APIKey, error) {
+	err := k.DB.QueryRowEx(ctx, "InsertKey", nil, key.Nickname, key.Name, key.Hash, strings.Join(key.Scopes, ","), key.Created).
+		Scan(&key.Id, &key.Nickname)
+	if err != nil {
+		logger.FromContext(ctx).Debug(err)
+		return models.APIKey{}, errs.FromPgx(err, models.MissingUser)
+	}
+	return key, nil
+}
+
+type keyScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanKey(row keyScanner) (models.APIKey, error) {
+	var key models.APIKey
+	var scopes string
+	var used pgtype.Timestamptz
+
+	if err := row.Scan(&key.Id, &key.Nickname, &key.Name, &scopes, &key.Created, &used); err != nil {
+		return models.APIKey{}, err
+	}
+	key.Scopes = strings.Split(scopes, ",")
+	if used.Status == pgtype.Present {
+		key.LastUsed = &used.Time
+	}
+	return key, nil
+}
+
+func (k KeyRepository) FindKeys(ctx context.Context, nickname string) ([]models.APIKey, error) {
+	rows, err := k.DB.QueryEx(ctx, "SelectKeys", nil, nickname)
+	if err != nil {
+		logger.FromContext(ctx).Debug(err)
+		return nil, errs.FromPgx(err, models.MissingUser)
+	}
+	defer rows.Close()
+
+	keys := []models.APIKey{}
+	for rows.Next() {
+		key, err := scanKey(rows)
+		if err != nil {
+			logger.FromContext(ctx).Debug(err)
+			return nil, errs.FromPgx(err, models.MissingUser)
+		}
+		keys = append(keys, key)
+	}
+	return keys, errs.FromPgx(rows.Err(), models.MissingUser)
+}
+
+func (k KeyRepository) GetKeyByHash(ctx context.Context, hash string) (models.APIKey, error) {
+	key, err := scanKey(k.DB.QueryRowEx(ctx, "SelectKeyByHash", nil, hash))
+	if err != nil {
+		return models.APIKey{}, errs.FromPgx(err, models.MissingKey)
+	}
+	return key, nil
+}
+
+func (k KeyRepository) DeleteKey(ctx context.Context, nickname string, id int) error {
+	tag, err := k.DB.ExecEx(ctx, "DeleteKey", nil, nickname, id)
+	if err != nil {
+		logger.FromContext(ctx).Debug(err)
+		return errs.FromPgx(err, models.MissingKey)
+	}
+	if tag.RowsAffected() == 0 {
+		return errs.NotFound(models.MissingKey)
+	}
+	return nil
+}
+
+func (k KeyRepository) TouchKey(ctx context.Context, id int, used time.Time) error {
+	_, err := k.DB.ExecEx(ctx, "UpdateKeyUsed", nil, id, used)
+	if err != nil {
+		logger.FromContext(ctx).Debug(err)
+	}
+	return errs.FromPgx(err, models.MissingKey)
+}
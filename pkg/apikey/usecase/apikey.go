@@ -0,0 +1,153 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"forum/internal/utils/auth"
+	"forum/internal/utils/errs"
+	"forum/pkg/apikey/repository"
+	"forum/pkg/models"
+	"forum/pkg/user/repostitory"
+	"io"
+	"log"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+// touchInterval как часто обновляется LastUsed: запись на каждый запрос бота не нужна.
+const touchInterval = time.Minute
+
+type KeyUsecaseInterface interface {
+	ParseJsonToKey(body io.ReadCloser) (models.APIKey, error)
+	CreateKey(ctx context.Context, nickname string, key models.APIKey) (models.APIKey, error)
+	FindKeys(ctx context.Context, nickname string) ([]models.APIKey, error)
+	DeleteKey(ctx context.Context, nickname string, id string) error
+	Authenticate(ctx context.Context, key string) (models.APIKey, error)
+}
+
+type KeyUsecase struct {
+	DB     repository.KeyRepositoryInterface
+	UserDB repostitory.UserRepositoryInterface
+}
+
+func (KeyUsecase) ParseJsonToKey(body io.ReadCloser) (models.APIKey, error) {
+	defer body.Close()
+
+	var key models.APIKey
+	if err := json.NewDecoder(body).Decode(&key); err != nil {
+		return key, errs.Wrap(errs.KindInvalid, models.ErrBadBody, err)
+	}
+	return key, nil
+}
+
+// owner текущий nickname владельца ключей. Управлять ключами может только
+// сам пользователь, анонимно нельзя даже без обязательной аутентификации.
+func (k KeyUsecase) owner(ctx context.Context, nickname string) (string, error) {
+	user, err := k.UserDB.GetUser(ctx, nickname)
+	if err != nil {
+		return "", err
+	}
+	return user.Nickname, auth.Require(ctx, user.Nickname)
+}
+
+// checkScopes проверяет области и раскладывает их в порядке models.Scopes без повторов.
+func checkScopes(scopes []string) ([]string, error) {
+	requested := make(map[string]bool, len(scopes))
+	for _, scope := range scopes {
+		requested[scope] = true
+	}
+
+	var checked []string
+	for _, scope := range models.Scopes {
+		if requested[scope] {
+			checked = append(checked, scope)
+			delete(requested, scope)
+		}
+	}
+	if len(requested) > 0 {
+		return nil, errs.Invalid(models.ErrKeyScope)
+	}
+	if len(checked) == 0 {
+		return nil, errs.Invalid(models.ErrKeyScopes)
+	}
+	return checked, nil
+}
+
+// CreateKey создаёт ключ; сам ключ есть только в возвращённом значении.
+func (k KeyUsecase) CreateKey(ctx context.Context, nickname string, key models.APIKey) (models.APIKey, error) {
+	if length := utf8.RuneCountInString(key.Name); length == 0 || length > 100 {
+		return models.APIKey{}, errs.Invalid(models.ErrKeyName)
+	}
+	scopes, err := checkScopes(key.Scopes)
+	if err != nil {
+		return models.APIKey{}, err
+	}
+	owner, err := k.owner(ctx, nickname)
+	if err != nil {
+		return models.APIKey{}, err
+	}
+
+	secret, hash, err := auth.NewKey()
+	if err != nil {
+		return models.APIKey{}, errs.Internal(err)
+	}
+	created, err := k.DB.AddKey(ctx, models.APIKey{
+		Nickname: owner,
+		Name:     key.Name,
+		Scopes:   scopes,
+		Created:  time.Now().UTC().Truncate(time.Microsecond),
+		Hash:     hash,
+	})
+	if err != nil {
+		return models.APIKey{}, err
+	}
+	created.Key = secret
+	return created, nil
+}
+
+func (k KeyUsecase) FindKeys(ctx context.Context, nickname string) ([]models.APIKey, error) {
+	owner, err := k.owner(ctx, nickname)
+	if err != nil {
+		return nil, err
+	}
+	return k.DB.FindKeys(ctx, owner)
+}
+
+// DeleteKey отзывает ключ: следующий запрос с ним получит 401.
+func (k KeyUsecase) DeleteKey(ctx context.Context, nickname string, id string) error {
+	keyId, err := strconv.Atoi(id)
+	if err != nil {
+		return errs.Wrap(errs.KindInvalid, models.ErrBadId, err)
+	}
+	owner, err := k.owner(ctx, nickname)
+	if err != nil {
+		return err
+	}
+	return k.DB.DeleteKey(ctx, owner, keyId)
+}
+
+// Authenticate ключ API по его значению из заголовка Authorization.
+func (k KeyUsecase) Authenticate(ctx context.Context, key string) (models.APIKey, error) {
+	if !auth.IsKey(key) {
+		return models.APIKey{}, errs.Unauthorized(models.ErrBadKey)
+	}
+	found, err := k.DB.GetKeyByHash(ctx, auth.HashKey(key))
+	if errs.Is(err, errs.KindNotFound) {
+		return models.APIKey{}, errs.Unauthorized(models.ErrBadKey)
+	}
+	if err != nil {
+		return models.APIKey{}, err
+	}
+
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	if found.LastUsed == nil || now.Sub(*found.LastUsed) >= touchInterval {
+		// неудачная отметка не должна отклонять сам запрос
+		if err = k.DB.TouchKey(ctx, found.Id, now); err != nil {
+			log.Println(err)
+		} else {
+			found.LastUsed = &now
+		}
+	}
+	return found, nil
+}
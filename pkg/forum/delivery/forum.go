@@ -1,14 +1,16 @@
 package delivery
 
 import (
+	"forum/internal/utils/errs"
+	"forum/internal/utils/logger"
 	"forum/internal/utils/response"
 	"forum/internal/utils/utils"
 	"forum/pkg/forum/usecase"
 	"forum/pkg/models"
 	usecase2 "forum/pkg/thread/usecase"
 	"github.com/gorilla/mux"
-	"log"
 	"net/http"
+	"strconv"
 )
 
 type ForumDeliveryInterface interface {
@@ -17,6 +19,11 @@ type ForumDeliveryInterface interface {
 	CreateThread(w http.ResponseWriter, r *http.Request)
 	GetThreadsOfForum(w http.ResponseWriter, r *http.Request)
 	GetUsersOfForum(w http.ResponseWriter, r *http.Request)
+	GetForums(w http.ResponseWriter, r *http.Request)
+	GetRole(w http.ResponseWriter, r *http.Request)
+	GetModerators(w http.ResponseWriter, r *http.Request)
+	AddModerator(w http.ResponseWriter, r *http.Request)
+	RemoveModerator(w http.ResponseWriter, r *http.Request)
 }
 
 type ForumDelivery struct {
@@ -25,27 +32,54 @@ type ForumDelivery struct {
 }
 
 func (u ForumDelivery) SetHandlersForForum(router *mux.Router) {
+	router.HandleFunc("/forums", u.GetForums).Methods(http.MethodGet)
 	router.HandleFunc("/forum/create", u.CreateForum).Methods(http.MethodPost)
 	router.HandleFunc("/forum/{slug}/details", u.GetForumInfo).Methods(http.MethodGet)
 	router.HandleFunc("/forum/{slug}/create", u.CreateThread).Methods(http.MethodPost)
 	router.HandleFunc("/forum/{slug}/users", u.GetUsersOfForum).Methods(http.MethodGet)
 	router.HandleFunc("/forum/{slug}/threads", u.GetThreadsOfForum).Methods(http.MethodGet)
+	router.HandleFunc("/forum/{slug}/role/{nickname}", u.GetRole).Methods(http.MethodGet)
+	router.HandleFunc("/forum/{slug}/moderators", u.GetModerators).Methods(http.MethodGet)
+	router.HandleFunc("/forum/{slug}/moderators/{nickname}", u.AddModerator).Methods(http.MethodPost)
+	router.HandleFunc("/forum/{slug}/moderators/{nickname}", u.RemoveModerator).Methods(http.MethodDelete)
+}
+
+// GetForums список всех форумов; общее число подходящих под query в X-Total-Count.
+func (d ForumDelivery) GetForums(w http.ResponseWriter, r *http.Request) {
+	params, err := utils.ParseJsonToForumSearch(r.URL.Query())
+	if err != nil {
+		response.Process(response.LoggerFunc(err.Error(), logger.ErrorFunc(r.Context(), err)), response.ErrorFunc(w, err))
+		return
+	}
+
+	forums, total, err := d.ForumUsecase.FindForums(r.Context(), params)
+	if err != nil {
+		response.Process(response.LoggerFunc(err.Error(), logger.ErrorFunc(r.Context(), err)), response.ErrorFunc(w, err))
+		return
+	}
+
+	w.Header().Set(response.TotalCountHeader, strconv.FormatInt(total, 10))
+	response.Process(response.LoggerFunc("Return forums", logger.FromContext(r.Context()).Debug), response.ResponseFunc(w, http.StatusOK, forums))
 }
 
 func (d ForumDelivery) CreateForum(w http.ResponseWriter, r *http.Request) {
 	forum, err := d.ForumUsecase.ParseJsonToForum(r.Body)
 	if err != nil {
+		response.Process(response.LoggerFunc(err.Error(), logger.ErrorFunc(r.Context(), err)), response.ErrorFunc(w, err))
 		return
 	}
 
-	forum, code, err := d.ForumUsecase.CreateForum(forum)
+	forum, err = d.ForumUsecase.CreateForum(r.Context(), forum)
+	if errs.Is(err, errs.KindConflict) {
+		response.Process(response.LoggerFunc("Найден форум", logger.FromContext(r.Context()).Debug), response.ResponseFunc(w, http.StatusConflict, forum))
+		return
+	}
 	if err != nil {
-		ans := response.ErrorResponse{Err: err.Error()}
-		response.Process(response.LoggerFunc(ans.Error(), log.Println), response.ResponseFunc(w, code, ans))
+		response.Process(response.LoggerFunc(err.Error(), logger.ErrorFunc(r.Context(), err)), response.ErrorFunc(w, err))
 		return
 	}
 
-	response.Process(response.LoggerFunc("Создан/Найден форум", log.Println), response.ResponseFunc(w, code, forum))
+	response.Process(response.LoggerFunc("Создан форум", logger.FromContext(r.Context()).Debug), response.ResponseFunc(w, http.StatusCreated, forum))
 }
 
 func (d ForumDelivery) GetForumInfo(w http.ResponseWriter, r *http.Request) {
@@ -54,30 +88,33 @@ func (d ForumDelivery) GetForumInfo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	forum, err := d.ForumUsecase.GetInfoBySlug(slug)
+	forum, err := d.ForumUsecase.GetInfoBySlug(r.Context(), slug)
 	if err != nil {
-		ans := response.ErrorResponse{Err: err.Error()}
-		response.Process(response.LoggerFunc(ans.Error(), log.Println), response.ResponseFunc(w, http.StatusNotFound, ans))
+		response.Process(response.LoggerFunc(err.Error(), logger.ErrorFunc(r.Context(), err)), response.ErrorFunc(w, err))
 		return
 	}
 
-	response.Process(response.LoggerFunc("Вернули форум", log.Println), response.ResponseFunc(w, http.StatusOK, forum))
+	response.Process(response.LoggerFunc("Вернули форум", logger.FromContext(r.Context()).Debug), response.ResponseFunc(w, http.StatusOK, forum))
 }
 
 func (d ForumDelivery) CreateThread(w http.ResponseWriter, r *http.Request) {
-	thread, ok := d.ThreadUsecase.GetThreadByRequest(r.Body, mux.Vars(r))
-	if !ok {
+	thread, err := d.ThreadUsecase.GetThreadByRequest(r.Body, mux.Vars(r))
+	if err != nil {
+		response.Process(response.LoggerFunc(err.Error(), logger.ErrorFunc(r.Context(), err)), response.ErrorFunc(w, err))
 		return
 	}
 
-	thread, code, err := d.ThreadUsecase.CreateThread(thread)
+	thread, err = d.ThreadUsecase.CreateThread(r.Context(), thread)
+	if errs.Is(err, errs.KindConflict) {
+		response.Process(response.LoggerFunc("Найдена ветка", logger.FromContext(r.Context()).Debug), response.ResponseFunc(w, http.StatusConflict, thread))
+		return
+	}
 	if err != nil {
-		ans := response.ErrorResponse{Err: err.Error()}
-		response.Process(response.LoggerFunc(ans.Error(), log.Println), response.ResponseFunc(w, code, ans))
+		response.Process(response.LoggerFunc(err.Error(), logger.ErrorFunc(r.Context(), err)), response.ErrorFunc(w, err))
 		return
 	}
 
-	response.Process(response.LoggerFunc("Создана/Найдена ветка", log.Println), response.ResponseFunc(w, code, thread))
+	response.Process(response.LoggerFunc("Создана ветка", logger.FromContext(r.Context()).Debug), response.ResponseFunc(w, http.StatusCreated, thread))
 }
 
 func (d ForumDelivery) GetThreadsOfForum(w http.ResponseWriter, r *http.Request) {
@@ -86,42 +123,114 @@ func (d ForumDelivery) GetThreadsOfForum(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	params, ok := utils.ParseJsonToSearchParams(r.URL.Query())
+	params, err := utils.ParseJsonToSearchParams(r.URL.Query())
+	if err != nil {
+		response.Process(response.LoggerFunc(err.Error(), logger.ErrorFunc(r.Context(), err)), response.ErrorFunc(w, err))
+		return
+	}
+
+	threads, err := d.ThreadUsecase.FindThreadsByParams(r.Context(), slug, params)
+	if err != nil {
+		response.Process(response.LoggerFunc(err.Error(), logger.ErrorFunc(r.Context(), err)), response.ErrorFunc(w, err))
+		return
+	}
+
+	response.Process(response.LoggerFunc("Return All threads By Forum", logger.FromContext(r.Context()).Debug), response.ResponseFunc(w, http.StatusOK, threads))
+}
+
+func (d ForumDelivery) GetUsersOfForum(w http.ResponseWriter, r *http.Request) {
+	slug, ok := utils.GetDataFromPath("slug", mux.Vars(r))
 	if !ok {
 		return
 	}
 
-	threads, ok := d.ThreadUsecase.FindThreadsByParams(slug, params)
+	params, err := utils.ParseJsonToSearchParams(r.URL.Query())
+	if err != nil {
+		response.Process(response.LoggerFunc(err.Error(), logger.ErrorFunc(r.Context(), err)), response.ErrorFunc(w, err))
+		return
+	}
+
+	users, err := d.ForumUsecase.FindUsersOfForum(r.Context(), slug, params)
+	if err != nil {
+		response.Process(response.LoggerFunc(err.Error(), logger.ErrorFunc(r.Context(), err)), response.ErrorFunc(w, err))
+		return
+	}
+
+	if users == nil {
+		users = make([]models.User, 0)
+	}
+
+	response.Process(response.LoggerFunc("Return All users By Forum", logger.FromContext(r.Context()).Debug), response.ResponseFunc(w, http.StatusOK, users))
+}
+
+func (d ForumDelivery) GetRole(w http.ResponseWriter, r *http.Request) {
+	slug, ok := utils.GetDataFromPath("slug", mux.Vars(r))
+	if !ok {
+		return
+	}
+	nickname, ok := utils.GetDataFromPath("nickname", mux.Vars(r))
 	if !ok {
-		ans := response.ErrorResponse{Err: models.ErrThreadNotfound}
-		response.Process(response.LoggerFunc(ans.Error(), log.Println), response.ResponseFunc(w, http.StatusNotFound, ans))
 		return
 	}
 
-	response.Process(response.LoggerFunc("Return All threads By Forum", log.Println), response.ResponseFunc(w, http.StatusOK, threads))
+	role, err := d.ForumUsecase.GetRole(r.Context(), slug, nickname)
+	if err != nil {
+		response.Process(response.LoggerFunc(err.Error(), logger.ErrorFunc(r.Context(), err)), response.ErrorFunc(w, err))
+		return
+	}
+
+	response.Process(response.LoggerFunc("Return role in forum", logger.FromContext(r.Context()).Debug), response.ResponseFunc(w, http.StatusOK, role))
 }
 
-func (d ForumDelivery) GetUsersOfForum(w http.ResponseWriter, r *http.Request) {
+func (d ForumDelivery) GetModerators(w http.ResponseWriter, r *http.Request) {
 	slug, ok := utils.GetDataFromPath("slug", mux.Vars(r))
 	if !ok {
 		return
 	}
 
-	params, ok := utils.ParseJsonToSearchParams(r.URL.Query())
+	users, err := d.ForumUsecase.FindModerators(r.Context(), slug)
+	if err != nil {
+		response.Process(response.LoggerFunc(err.Error(), logger.ErrorFunc(r.Context(), err)), response.ErrorFunc(w, err))
+		return
+	}
+
+	response.Process(response.LoggerFunc("Return moderators of forum", logger.FromContext(r.Context()).Debug), response.ResponseFunc(w, http.StatusOK, users))
+}
+
+func (d ForumDelivery) AddModerator(w http.ResponseWriter, r *http.Request) {
+	slug, ok := utils.GetDataFromPath("slug", mux.Vars(r))
+	if !ok {
+		return
+	}
+	nickname, ok := utils.GetDataFromPath("nickname", mux.Vars(r))
 	if !ok {
 		return
 	}
 
-	users, ok := d.ForumUsecase.FindUsersOfForum(slug, params)
+	user, err := d.ForumUsecase.AddModerator(r.Context(), slug, nickname)
+	if err != nil {
+		response.Process(response.LoggerFunc(err.Error(), logger.ErrorFunc(r.Context(), err)), response.ErrorFunc(w, err))
+		return
+	}
+
+	response.Process(response.LoggerFunc("Appointed moderator", logger.FromContext(r.Context()).Debug), response.ResponseFunc(w, http.StatusOK, user))
+}
+
+func (d ForumDelivery) RemoveModerator(w http.ResponseWriter, r *http.Request) {
+	slug, ok := utils.GetDataFromPath("slug", mux.Vars(r))
+	if !ok {
+		return
+	}
+	nickname, ok := utils.GetDataFromPath("nickname", mux.Vars(r))
 	if !ok {
-		ans := response.ErrorResponse{Err: models.ErrForumNotFound}
-		response.Process(response.LoggerFunc(ans.Error(), log.Println), response.ResponseFunc(w, http.StatusNotFound, ans))
 		return
 	}
 
-	if users == nil {
-		users = make([]models.User, 0)
+	if err := d.ForumUsecase.RemoveModerator(r.Context(), slug, nickname); err != nil {
+		response.Process(response.LoggerFunc(err.Error(), logger.ErrorFunc(r.Context(), err)), response.ErrorFunc(w, err))
+		return
 	}
 
-	response.Process(response.LoggerFunc("Return All users By Forum", log.Println), response.ResponseFunc(w, http.StatusOK, users))
+	logger.FromContext(r.Context()).Debug("Removed moderator")
+	w.WriteHeader(http.StatusNoContent)
 }
@@ -1,9 +1,12 @@
 package repository
 
 import (
+	"context"
+	"forum/internal/utils/errs"
+	"forum/internal/utils/logger"
+	"forum/internal/utils/pgxtime"
+	"forum/internal/utils/utils"
 	"forum/pkg/models"
-	"github.com/jackc/pgx"
-	"log"
 )
 
 const (
@@ -13,70 +16,192 @@ const (
 	SelectUsersByForumSince     = `SELECT U.nickname, U.fullname, U.about, U.email FROM parkmaildb."Users_by_Forum" users INNER JOIN parkmaildb."User" U on U.nickname = users."user" AND users.forum = $1 AND U.nickname > $2 ORDER BY users."user" LIMIT $3`
 	InsertForum                 = `INSERT INTO parkmaildb."Forum" (title, "user", slug, posts, threads) VALUES ($1, (SELECT nickname FROM parkmaildb."User" WHERE nickname = $2),$3,0,0) RETURNING "user"`
 	SelectForum                 = `SELECT f.slug, f.title, f."user", f.posts, f.threads from parkmaildb."Forum" f WHERE slug = $1`
+	InsertModerator             = `INSERT INTO parkmaildb."Forum_moderator" (forum, "user") VALUES ($1, $2) ON CONFLICT DO NOTHING`
+	DeleteModerator             = `DELETE FROM parkmaildb."Forum_moderator" WHERE forum = $1 AND "user" = $2`
+	SelectModerators            = `SELECT U.nickname, U.fullname, U.about, U.email FROM parkmaildb."Forum_moderator" m INNER JOIN parkmaildb."User" U on U.nickname = m."user" AND m.forum = $1 ORDER BY U.nickname`
+	SelectIsModerator           = `SELECT EXISTS (SELECT 1 FROM parkmaildb."Forum_moderator" WHERE forum = $1 AND "user" = $2)`
+	CountForums                 = `SELECT COUNT(*) FROM parkmaildb."Forum" WHERE lower(title) LIKE $1`
 )
 
+// $1 шаблон из utils.LikePrefix, $2 slug последнего форума предыдущей страницы или пустая строка;
+// по счётчикам и порядку создания страница продолжается с позиции этого форума.
+const (
+	selectForums = `SELECT f.slug, f.title, f."user", f.posts, f.threads FROM parkmaildb."Forum" f
+					WHERE lower(f.title) LIKE $1 AND `
+
+	SelectForumsBySlug        = selectForums + `($2::citext = '' OR f.slug > $2::citext) ORDER BY f.slug LIMIT $3`
+	SelectForumsBySlugDesc    = selectForums + `($2::citext = '' OR f.slug < $2::citext) ORDER BY f.slug DESC LIMIT $3`
+	SelectForumsByPosts       = selectForums + `($2::citext = '' OR (f.posts, f.slug) > (SELECT s.posts, s.slug FROM parkmaildb."Forum" s WHERE s.slug = $2::citext)) ORDER BY f.posts, f.slug LIMIT $3`
+	SelectForumsByPostsDesc   = selectForums + `($2::citext = '' OR (f.posts, f.slug) < (SELECT s.posts, s.slug FROM parkmaildb."Forum" s WHERE s.slug = $2::citext)) ORDER BY f.posts DESC, f.slug DESC LIMIT $3`
+	SelectForumsByThreads     = selectForums + `($2::citext = '' OR (f.threads, f.slug) > (SELECT s.threads, s.slug FROM parkmaildb."Forum" s WHERE s.slug = $2::citext)) ORDER BY f.threads, f.slug LIMIT $3`
+	SelectForumsByThreadsDesc = selectForums + `($2::citext = '' OR (f.threads, f.slug) < (SELECT s.threads, s.slug FROM parkmaildb."Forum" s WHERE s.slug = $2::citext)) ORDER BY f.threads DESC, f.slug DESC LIMIT $3`
+	SelectForumsByCreated     = selectForums + `($2::citext = '' OR f.id > (SELECT s.id FROM parkmaildb."Forum" s WHERE s.slug = $2::citext)) ORDER BY f.id LIMIT $3`
+	SelectForumsByCreatedDesc = selectForums + `($2::citext = '' OR f.id < (SELECT s.id FROM parkmaildb."Forum" s WHERE s.slug = $2::citext)) ORDER BY f.id DESC LIMIT $3`
+)
+
+// forumsQueries имена запросов FindForums для каждого порядка: по возрастанию и по убыванию.
+var forumsQueries = map[string][2]string{
+	models.ForumSortSlug:    {"SelectForumsBySlug", "SelectForumsBySlugDesc"},
+	models.ForumSortPosts:   {"SelectForumsByPosts", "SelectForumsByPostsDesc"},
+	models.ForumSortThreads: {"SelectForumsByThreads", "SelectForumsByThreadsDesc"},
+	models.ForumSortCreated: {"SelectForumsByCreated", "SelectForumsByCreatedDesc"},
+}
+
 type ForumRepositoryInterface interface {
-	CreateForum(forum models.Forum) (models.Forum, error)
-	GetForumInfo(slug string) (models.Forum, bool)
-	FindUsers(slug string, params models.ParamsForSearch) ([]models.User, bool)
+	CreateForum(ctx context.Context, forum models.Forum) (models.Forum, error)
+	GetForumInfo(ctx context.Context, slug string) (models.Forum, error)
+	FindUsers(ctx context.Context, slug string, params models.ParamsForSearch) ([]models.User, error)
+	// AddModerator назначает модератора; повторное назначение ничего не меняет.
+	AddModerator(ctx context.Context, slug string, nickname string) error
+	RemoveModerator(ctx context.Context, slug string, nickname string) error
+	FindModerators(ctx context.Context, slug string) ([]models.User, error)
+	IsModerator(ctx context.Context, slug string, nickname string) (bool, error)
+	// FindForums страница всех форумов; params.Since должен существовать.
+	FindForums(ctx context.Context, params models.ForumSearch) ([]models.Forum, error)
+	CountForums(ctx context.Context, query string) (int64, error)
 }
 
 type ForumRepository struct {
-	DB *pgx.ConnPool
+	DB *pgxtime.Pool
 }
 
-func (r ForumRepository) FindUsers(slug string, params models.ParamsForSearch) ([]models.User, bool) {
-	var rows *pgx.Rows
+func (r ForumRepository) FindUsers(ctx context.Context, slug string, params models.ParamsForSearch) ([]models.User, error) {
+	var rows *pgxtime.Rows
 	var err error
 
 	if params.Since == "" {
 		if params.Desc {
-			rows, err = r.DB.Query("SelectUsersByForumDesc", slug, params.Limit)
+			rows, err = r.DB.QueryEx(ctx, "SelectUsersByForumDesc", nil, slug, params.Limit)
 		} else {
-			rows, err = r.DB.Query("SelectUsersByForum", slug, params.Limit)
+			rows, err = r.DB.QueryEx(ctx, "SelectUsersByForum", nil, slug, params.Limit)
 		}
 	} else {
 		if params.Desc {
-			rows, err = r.DB.Query("SelectUsersByForumSinceDesc", slug, params.Since, params.Limit)
+			rows, err = r.DB.QueryEx(ctx, "SelectUsersByForumSinceDesc", nil, slug, params.Since, params.Limit)
 		} else {
-			rows, err = r.DB.Query("SelectUsersByForumSince", slug, params.Since, params.Limit)
+			rows, err = r.DB.QueryEx(ctx, "SelectUsersByForumSince", nil, slug, params.Since, params.Limit)
 		}
 	}
 
 	var users []models.User
 	if err != nil {
-		log.Println(err)
-		rows.Close()
-		return users, false
+		logger.FromContext(ctx).Debug(err)
+		return nil, errs.FromPgx(err, models.ErrForumNotFound)
 	}
 
 	for rows.Next() {
 		var user models.User
 		err := rows.Scan(&user.Nickname, &user.Fullname, &user.About, &user.Email)
 		if err != nil {
-			log.Println(err)
+			logger.FromContext(ctx).Debug(err)
 			rows.Close()
-			return []models.User{}, false
+			return nil, errs.FromPgx(err, models.ErrForumNotFound)
 		}
 		users = append(users, user)
 	}
 	rows.Close()
-	return users, true
+	return users, errs.FromPgx(rows.Err(), models.ErrForumNotFound)
 }
 
-func (r ForumRepository) CreateForum(forum models.Forum) (models.Forum, error) {
-	err := r.DB.QueryRow("InsertForum", forum.Title, forum.User, forum.Slug).Scan(&forum.User)
-	return forum, err
+func (r ForumRepository) CreateForum(ctx context.Context, forum models.Forum) (models.Forum, error) {
+	err := r.DB.QueryRowEx(ctx, "InsertForum", nil, forum.Title, forum.User, forum.Slug).Scan(&forum.User)
+	return forum, errs.FromPgx(err, models.ErrUserUnknown)
 }
 
-func (r ForumRepository) GetForumInfo(slug string) (models.Forum, bool) {
+func (r ForumRepository) GetForumInfo(ctx context.Context, slug string) (models.Forum, error) {
 	var forum models.Forum = models.Forum{Slug: slug}
-	err := r.DB.QueryRow("SelectForum", forum.Slug).Scan(&forum.Slug, &forum.Title, &forum.User, &forum.Posts, &forum.Threads)
+	err := r.DB.QueryRowEx(ctx, "SelectForum", nil, forum.Slug).Scan(&forum.Slug, &forum.Title, &forum.User, &forum.Posts, &forum.Threads)
+
+	if err != nil {
+		logger.FromContext(ctx).Debug(err)
+		return models.Forum{}, errs.FromPgx(err, models.ErrForumNotFound)
+	}
+
+	return forum, nil
+}
+
+func (r ForumRepository) AddModerator(ctx context.Context, slug string, nickname string) error {
+	_, err := r.DB.ExecEx(ctx, "InsertModerator", nil, slug, nickname)
+	if err != nil {
+		logger.FromContext(ctx).Debug(err)
+	}
+	return errs.FromPgx(err, models.ErrForumNotFound)
+}
+
+func (r ForumRepository) RemoveModerator(ctx context.Context, slug string, nickname string) error {
+	tag, err := r.DB.ExecEx(ctx, "DeleteModerator", nil, slug, nickname)
+	if err != nil {
+		logger.FromContext(ctx).Debug(err)
+		return errs.FromPgx(err, models.ErrNotAppointed)
+	}
+	if tag.RowsAffected() == 0 {
+		return errs.NotFound(models.ErrNotAppointed)
+	}
+	return nil
+}
+
+func (r ForumRepository) FindModerators(ctx context.Context, slug string) ([]models.User, error) {
+	rows, err := r.DB.QueryEx(ctx, "SelectModerators", nil, slug)
+	if err != nil {
+		logger.FromContext(ctx).Debug(err)
+		return nil, errs.FromPgx(err, models.ErrForumNotFound)
+	}
+	defer rows.Close()
+
+	users := []models.User{}
+	for rows.Next() {
+		var user models.User
+		if err = rows.Scan(&user.Nickname, &user.Fullname, &user.About, &user.Email); err != nil {
+			logger.FromContext(ctx).Debug(err)
+			return nil, errs.FromPgx(err, models.ErrForumNotFound)
+		}
+		users = append(users, user)
+	}
+	return users, errs.FromPgx(rows.Err(), models.ErrForumNotFound)
+}
+
+func (r ForumRepository) IsModerator(ctx context.Context, slug string, nickname string) (bool, error) {
+	var moderator bool
+	err := r.DB.QueryRowEx(ctx, "SelectIsModerator", nil, slug, nickname).Scan(&moderator)
+	if err != nil {
+		logger.FromContext(ctx).Debug(err)
+	}
+	return moderator, errs.FromPgx(err, models.ErrForumNotFound)
+}
+
+func (r ForumRepository) FindForums(ctx context.Context, params models.ForumSearch) ([]models.Forum, error) {
+	queries, ok := forumsQueries[params.Sort]
+	if !ok {
+		return nil, errs.Invalid(models.ErrForumSort)
+	}
+	query := queries[0]
+	if params.Desc {
+		query = queries[1]
+	}
 
+	rows, err := r.DB.QueryEx(ctx, query, nil, utils.LikePrefix(params.Query), params.Since, params.Limit)
 	if err != nil {
-		log.Println(err)
-		return models.Forum{}, false
+		logger.FromContext(ctx).Debug(err)
+		return nil, errs.FromPgx(err, models.ErrForumNotFound)
 	}
+	defer rows.Close()
 
-	return forum, true
+	forums := []models.Forum{}
+	for rows.Next() {
+		var forum models.Forum
+		if err = rows.Scan(&forum.Slug, &forum.Title, &forum.User, &forum.Posts, &forum.Threads); err != nil {
+			return nil, errs.FromPgx(err, models.ErrForumNotFound)
+		}
+		forums = append(forums, forum)
+	}
+	return forums, errs.FromPgx(rows.Err(), models.ErrForumNotFound)
+}
+
+func (r ForumRepository) CountForums(ctx context.Context, query string) (int64, error) {
+	var count int64
+	err := r.DB.QueryRowEx(ctx, "CountForums", nil, utils.LikePrefix(query)).Scan(&count)
+	if err != nil {
+		logger.FromContext(ctx).Debug(err)
+	}
+	return count, errs.FromPgx(err, models.ErrForumNotFound)
 }
@@ -1,71 +1,167 @@
 package usecase
 
 import (
+	"context"
 	"encoding/json"
-	"forum/internal/utils/utils"
+	"forum/internal/utils/errs"
 	"forum/pkg/forum/repository"
 	"forum/pkg/models"
-	"github.com/pkg/errors"
+	"forum/pkg/user/repostitory"
 	"io"
 	"log"
-	"net/http"
+	"strings"
 )
 
 type ForumUsecaseInterface interface {
 	ParseJsonToForum(body io.ReadCloser) (models.Forum, error)
-	CreateForum(forum models.Forum) (models.Forum, int, error)
-	GetInfoBySlug(slug string) (models.Forum, error)
-	FindUsersOfForum(slug string, params models.ParamsForSearch) ([]models.User, bool)
+	CreateForum(ctx context.Context, forum models.Forum) (models.Forum, error)
+	GetInfoBySlug(ctx context.Context, slug string) (models.Forum, error)
+	FindUsersOfForum(ctx context.Context, slug string, params models.ParamsForSearch) ([]models.User, error)
+	FindForums(ctx context.Context, params models.ForumSearch) ([]models.Forum, int64, error)
+	GetRole(ctx context.Context, slug string, nickname string) (models.ForumRole, error)
+	FindModerators(ctx context.Context, slug string) ([]models.User, error)
+	AddModerator(ctx context.Context, slug string, nickname string) (models.User, error)
+	RemoveModerator(ctx context.Context, slug string, nickname string) error
 }
 
 type ForumUsecase struct {
-	DB repository.ForumRepositoryInterface
+	DB          repository.ForumRepositoryInterface
+	UserDB      repostitory.UserRepositoryInterface
+	Permissions Permissions
 }
 
-func (u ForumUsecase) FindUsersOfForum(slug string, params models.ParamsForSearch) ([]models.User, bool) {
-	users, ok := u.DB.FindUsers(slug, params)
-	if !ok || len(users) == 0 {
-		_, ok = u.DB.GetForumInfo(slug)
-		if !ok {
-			return nil, false
+func (u ForumUsecase) FindUsersOfForum(ctx context.Context, slug string, params models.ParamsForSearch) ([]models.User, error) {
+	users, err := u.DB.FindUsers(ctx, slug, params)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(users) == 0 {
+		if _, err = u.DB.GetForumInfo(ctx, slug); err != nil {
+			return nil, err
 		}
 		var re []models.User
-		return re, true
+		return re, nil
 	}
 
-	return users, true
+	return users, nil
 }
 
-func (u ForumUsecase) GetInfoBySlug(slug string) (models.Forum, error) {
-	forum, ok := u.DB.GetForumInfo(slug)
-	if !ok {
-		return models.Forum{}, errors.New(models.ErrForumNotFound)
+// FindForums страница всех форумов и общее число подходящих под params.Query.
+// Форум params.Since должен существовать: страница продолжается с его позиции.
+func (u ForumUsecase) FindForums(ctx context.Context, params models.ForumSearch) ([]models.Forum, int64, error) {
+	switch params.Sort {
+	case models.ForumSortSlug, models.ForumSortPosts, models.ForumSortThreads, models.ForumSortCreated:
+	default:
+		return nil, 0, errs.Invalid(models.ErrForumSort)
+	}
+	if params.Since != "" {
+		if _, err := u.DB.GetForumInfo(ctx, params.Since); err != nil {
+			return nil, 0, err
+		}
 	}
 
-	return forum, nil
+	total, err := u.DB.CountForums(ctx, params.Query)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	forums, err := u.DB.FindForums(ctx, params)
+	if err != nil {
+		return nil, 0, err
+	}
+	return forums, total, nil
 }
 
-func (u ForumUsecase) CreateForum(forum models.Forum) (models.Forum, int, error) {
-	log.Println(forum.User)
+func (u ForumUsecase) GetInfoBySlug(ctx context.Context, slug string) (models.Forum, error) {
+	return u.DB.GetForumInfo(ctx, slug)
+}
+
+// CreateForum при конфликте возвращает уже существующий форум вместе с ошибкой KindConflict.
+func (u ForumUsecase) CreateForum(ctx context.Context, forum models.Forum) (models.Forum, error) {
 	var err error
-	forum, err = u.DB.CreateForum(forum)
+	if forum.User, err = u.Permissions.CheckAuthor(ctx, forum.User); err != nil {
+		return models.Forum{}, err
+	}
+
+	created, err := u.DB.CreateForum(ctx, forum)
 	if err == nil {
-		log.Println(forum.User)
-		return forum, http.StatusCreated, nil
+		return created, nil
 	}
 
 	log.Println(err)
-	code := utils.PgxErrorCode(err)
-	if code == "23503" { //ошибка отсутствия связей
-		return models.Forum{}, http.StatusNotFound, errors.New(models.ErrUserUnknown)
+	if !errs.Is(err, errs.KindConflict) {
+		return models.Forum{}, err
+	}
+
+	existing, err := u.DB.GetForumInfo(ctx, forum.Slug)
+	if err != nil {
+		return models.Forum{}, err
+	}
+
+	return existing, errs.Conflict(models.ErrForumExists)
+}
+
+// GetRole роль пользователя на форуме; nickname может быть старым псевдонимом.
+func (u ForumUsecase) GetRole(ctx context.Context, slug string, nickname string) (models.ForumRole, error) {
+	forum, err := u.DB.GetForumInfo(ctx, slug)
+	if err != nil {
+		return models.ForumRole{}, err
+	}
+	user, err := u.UserDB.GetUser(ctx, nickname)
+	if err != nil {
+		return models.ForumRole{}, err
 	}
 
-	forum, ok := u.DB.GetForumInfo(forum.Slug)
-	if !ok {
-		return models.Forum{}, http.StatusNotFound, errors.New(models.ErrUserUnknown)
+	role, err := u.Permissions.Role(ctx, forum, user.Nickname)
+	if err != nil {
+		return models.ForumRole{}, err
 	}
+	return models.ForumRole{Forum: forum.Slug, Nickname: user.Nickname, Role: role}, nil
+}
 
-	return forum, http.StatusConflict, nil
+func (u ForumUsecase) FindModerators(ctx context.Context, slug string) ([]models.User, error) {
+	forum, err := u.DB.GetForumInfo(ctx, slug)
+	if err != nil {
+		return nil, err
+	}
+	return u.DB.FindModerators(ctx, forum.Slug)
+}
+
+// moderator находит форум и пользователя и проверяет, что вызывающий может
+// менять модераторов этого форума.
+func (u ForumUsecase) moderator(ctx context.Context, slug string, nickname string) (models.Forum, models.User, error) {
+	forum, err := u.DB.GetForumInfo(ctx, slug)
+	if err != nil {
+		return models.Forum{}, models.User{}, err
+	}
+	if err = u.Permissions.CheckOwner(ctx, forum); err != nil {
+		return models.Forum{}, models.User{}, err
+	}
+	user, err := u.UserDB.GetUser(ctx, nickname)
+	if err != nil {
+		return models.Forum{}, models.User{}, err
+	}
+	return forum, user, nil
+}
+
+func (u ForumUsecase) AddModerator(ctx context.Context, slug string, nickname string) (models.User, error) {
+	if strings.EqualFold(nickname, models.DeletedUser) {
+		return models.User{}, errs.Invalid(models.ErrNickReserved)
+	}
+	forum, user, err := u.moderator(ctx, slug, nickname)
+	if err != nil {
+		return models.User{}, err
+	}
+	return user, u.DB.AddModerator(ctx, forum.Slug, user.Nickname)
+}
+
+func (u ForumUsecase) RemoveModerator(ctx context.Context, slug string, nickname string) error {
+	forum, user, err := u.moderator(ctx, slug, nickname)
+	if err != nil {
+		return err
+	}
+	return u.DB.RemoveModerator(ctx, forum.Slug, user.Nickname)
 }
 
 func (u ForumUsecase) ParseJsonToForum(body io.ReadCloser) (models.Forum, error) {
@@ -77,9 +173,10 @@ func (u ForumUsecase) ParseJsonToForum(body io.ReadCloser) (models.Forum, error)
 
 	if err != nil {
 		log.Println(err)
+		return forum, errs.Wrap(errs.KindInvalid, models.ErrBadBody, err)
 	}
 
 	forum.Posts = 0
 	forum.Threads = 0
-	return forum, err
+	return forum, nil
 }
@@ -0,0 +1,126 @@
+package usecase
+
+import (
+	"context"
+	"forum/internal/utils/auth"
+	"forum/internal/utils/errs"
+	"forum/pkg/forum/repository"
+	"forum/pkg/models"
+	"forum/pkg/user/repostitory"
+	"strings"
+)
+
+// Permissions определяет роль пользователя на форуме и проверяет права
+// вызывающего (auth.FromContext) на правку чужих записей и модерацию.
+type Permissions struct {
+	DB repository.ForumRepositoryInterface
+	// Роль администратора сайта хранится на аккаунте (UserDB.IsAdmin), а не
+	// сравнивается с nickname: освободившийся nickname её не передаёт.
+	UserDB repostitory.UserRepositoryInterface
+}
+
+// Role старшая роль nickname на форуме.
+func (p Permissions) Role(ctx context.Context, forum models.Forum, nickname string) (string, error) {
+	admin, err := p.UserDB.IsAdmin(ctx, nickname)
+	switch {
+	case err != nil:
+		return "", err
+	case admin:
+		return models.RoleAdmin, nil
+	case strings.EqualFold(forum.User, nickname):
+		return models.RoleOwner, nil
+	}
+
+	moderator, err := p.DB.IsModerator(ctx, forum.Slug, nickname)
+	if err != nil {
+		return "", err
+	}
+	if moderator {
+		return models.RoleModerator, nil
+	}
+	return models.RoleMember, nil
+}
+
+// CheckAuthor находит автора новой записи, в том числе по старому nickname, и
+// проверяет, что пишет он сам. Возвращает текущий nickname: запись
+// сохраняется под ним, а не под псевдонимом.
+func (p Permissions) CheckAuthor(ctx context.Context, nickname string) (string, error) {
+	user, err := p.UserDB.GetUser(ctx, nickname)
+	if err != nil {
+		return "", err
+	}
+	if err = auth.Check(ctx, user.Nickname); err != nil {
+		return "", err
+	}
+	return user.Nickname, nil
+}
+
+// CheckEdit разрешает править запись форума slug её автору и модераторам
+// форума; ключу API для чужой записи нужна область moderate. Анонимные
+// запросы доходят сюда, только если аутентификация не обязательна.
+func (p Permissions) CheckEdit(ctx context.Context, slug string, author string) error {
+	caller, ok := auth.FromContext(ctx)
+	if !ok || strings.EqualFold(caller.Nickname, author) {
+		return nil
+	}
+	return p.CheckModerate(ctx, slug)
+}
+
+// CheckModerate разрешает действие модератору форума slug, его владельцу и
+// администраторам сайта.
+func (p Permissions) CheckModerate(ctx context.Context, slug string) error {
+	caller, ok := auth.FromContext(ctx)
+	if !ok {
+		return nil
+	}
+	if !caller.Allows(models.ScopeModerate) {
+		return errs.Forbidden(models.ErrKeyNoScope)
+	}
+
+	forum, err := p.DB.GetForumInfo(ctx, slug)
+	if err != nil {
+		return err
+	}
+	role, err := p.Role(ctx, forum, caller.Nickname)
+	if err != nil {
+		return err
+	}
+	if role == models.RoleMember {
+		return errs.Forbidden(models.ErrNotModerator)
+	}
+	return nil
+}
+
+// CheckOwner разрешает назначать модераторов форума только владельцу и
+// администраторам сайта, анонимно нельзя даже без обязательной аутентификации.
+func (p Permissions) CheckOwner(ctx context.Context, forum models.Forum) error {
+	caller, ok := auth.FromContext(ctx)
+	if !ok {
+		return errs.Unauthorized(models.ErrNoToken)
+	}
+	if strings.EqualFold(forum.User, caller.Nickname) {
+		return nil
+	}
+	admin, err := p.UserDB.IsAdmin(ctx, caller.Nickname)
+	if err != nil || admin {
+		return err
+	}
+	return errs.Forbidden(models.ErrNotOwner)
+}
+
+// CheckAdmin разрешает действие только администраторам сайта; ключу API
+// нужна область admin.
+func (p Permissions) CheckAdmin(ctx context.Context) error {
+	caller, ok := auth.FromContext(ctx)
+	if !ok {
+		return errs.Unauthorized(models.ErrNoToken)
+	}
+	if !caller.Allows(models.ScopeAdmin) {
+		return errs.Forbidden(models.ErrKeyNoScope)
+	}
+	admin, err := p.UserDB.IsAdmin(ctx, caller.Nickname)
+	if err != nil || admin {
+		return err
+	}
+	return errs.Forbidden(models.ErrNotAdmin)
+}
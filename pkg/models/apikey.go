@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+// APIKey ключ API пользователя для ботов и интеграций. Передаётся в заголовке
+// "Authorization: Bearer <key>" вместо токена сессии.
+type APIKey struct {
+	Id       int    `json:"id"`
+	Nickname string `json:"nickname"`
+	Name     string `json:"name"`
+	// Что разрешено ключу: Scope*.
+	Scopes   []string   `json:"scopes"`
+	Created  time.Time  `json:"created"`
+	LastUsed *time.Time `json:"lastUsed,omitempty"`
+	// Сам ключ отдаётся один раз, в ответе на создание.
+	Key string `json:"key,omitempty"`
+	// SHA-256 ключа, который хранит репозиторий.
+	Hash string `json:"-"`
+}
+
+// APIKeyPrefix начало каждого ключа; по нему ключ отличается от токена сессии.
+const APIKeyPrefix = "fk_"
+
+// Области ключей API. Токену сессии разрешено всё.
+const (
+	ScopeRead     = "read"     // GET-запросы
+	ScopePost     = "post"     // форумы, ветки и сообщения
+	ScopeVote     = "vote"     // голоса
+	ScopeModerate = "moderate" // модерация
+	ScopeAdmin    = "admin"    // профиль, ключи и остальная запись
+)
+
+// Scopes все области в порядке, в котором они хранятся у ключа.
+var Scopes = []string{ScopeRead, ScopePost, ScopeVote, ScopeModerate, ScopeAdmin}
+
+const (
+	MissingKey    = "Can't find API key"
+	ErrKeyName    = "API key name must be 1 to 100 characters"
+	ErrKeyScopes  = "API key needs at least one of the scopes: read, post, vote, moderate, admin"
+	ErrKeyScope   = "Unknown API key scope"
+	ErrBadKey     = "Invalid API key"
+	ErrKeyNoScope = "API key has no scope for this request"
+)
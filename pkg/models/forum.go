@@ -14,6 +14,43 @@ type Forum struct {
 	Threads int64 `json:"threads"`
 }
 
+// Роли пользователя на форуме, от старшей к младшей.
+const (
+	RoleAdmin     = "admin"     // администратор сайта из User_admin
+	RoleOwner     = "owner"     // Forum.User
+	RoleModerator = "moderator" // назначен владельцем форума
+	RoleMember    = "member"    // все остальные
+)
+
+// ForumRole роль пользователя на форуме.
+type ForumRole struct {
+	Forum    string `json:"forum"`
+	Nickname string `json:"nickname"`
+	Role     string `json:"role"`
+}
+
+// ForumSearch параметры списка всех форумов.
+type ForumSearch struct {
+	// Максимальное кол-во возвращаемых записей.
+	Limit int `json:"limit"`
+	// Slug, после которого начинается страница (последний на предыдущей).
+	Since string `json:"since"`
+	// Порядок: ForumSortSlug (по умолчанию), ForumSortPosts, ForumSortThreads
+	// или ForumSortCreated; форумы с равными счётчиками идут по slug.
+	Sort string `json:"sort"`
+	// Флаг сортировки по убыванию.
+	Desc bool `json:"desc"`
+	// Префикс названия, регистр не учитывается.
+	Query string `json:"query"`
+}
+
+const (
+	ForumSortSlug    = "slug"
+	ForumSortPosts   = "posts"
+	ForumSortThreads = "threads"
+	ForumSortCreated = "created" // порядок создания
+)
+
 type ParamsForSearch struct {
 	// Максимальное кол-во возвращаемых записей.
 	Limit int `json:"limit"`
@@ -35,4 +72,13 @@ const (
 	ErrForumNotFound  = "Can't find forum"
 	ErrPostNotFound   = "Can't find post"
 	ErrThreadNotfound = "Can't find thread"
+	ErrForumExists    = "Forum already exists"
+	ErrThreadExists   = "Thread already exists"
+	ErrParentMissing  = "Parent post was created in another thread"
+	ErrBadId          = "Id must be a number"
+	ErrBadBody        = "Can't parse request body"
+	ErrNotModerator   = "Only the author or a moderator of this forum can do this"
+	ErrNotOwner       = "Only the forum owner can appoint moderators"
+	ErrNotAppointed   = "User is not a moderator of this forum"
+	ErrForumSort      = "Unknown forum sort order"
 )
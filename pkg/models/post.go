@@ -26,6 +26,16 @@ type PostParams struct {
 	Desc  bool   `json:"desc"`
 }
 
+// UserPostsParams параметры списка сообщений пользователя по всем форумам.
+type UserPostsParams struct {
+	Limit int `json:"limit"`
+	// id сообщения, после которого начинается страница.
+	Since int  `json:"since"`
+	Desc  bool `json:"desc"`
+	// Slug форума, пустой — все форумы.
+	Forum string `json:"forum"`
+}
+
 type FullPostParams struct {
 	User   bool `json:"user"`
 	Forum  bool `json:"forum"`
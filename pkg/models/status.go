@@ -15,3 +15,26 @@ func StatusInit() Status {
 		Post:   0,
 	}
 }
+
+// Clean что удаляет /service/clear.
+type Clean struct {
+	// Slug форума, который удаляется со всеми ветками, сообщениями и голосами;
+	// пустой очищает всё хранилище.
+	Forum string
+	// Только посчитать записи, ничего не удаляя; задаётся параметром dry_run.
+	DryRun bool
+}
+
+// CleanReport сколько записей удалила очистка, а при DryRun сколько удалит.
+type CleanReport struct {
+	Forum  string `json:"forum,omitempty"`
+	DryRun bool   `json:"dryRun"`
+	// При очистке одного форума пользователи не удаляются.
+	Users   int64 `json:"users"`
+	Forums  int64 `json:"forums"`
+	Threads int64 `json:"threads"`
+	Posts   int64 `json:"posts"`
+	Votes   int64 `json:"votes"`
+}
+
+const ErrNotAdmin = "Only site administrators can do this"
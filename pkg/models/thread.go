@@ -37,3 +37,16 @@ type Vote struct {
 	// Отданный голос.
 	Voice float32 `json:"voice"`
 }
+
+// UserThreadsParams параметры списка веток пользователя по всем форумам.
+type UserThreadsParams struct {
+	// Максимальное кол-во возвращаемых записей.
+	Limit int `json:"limit"`
+	// Дата создания, с которой начинается страница, включительно, как в списке веток форума:
+	// ветки с одинаковой датой не теряются на границе страниц.
+	Since string `json:"since"`
+	// Флаг сортировки по убыванию.
+	Desc bool `json:"desc"`
+	// Slug форума, пустой — все форумы.
+	Forum string `json:"forum"`
+}
@@ -1,12 +1,142 @@
 package models
 
+import "time"
+
 type User struct {
 	Nickname string `json:"nickname"`
 	Fullname string `json:"fullname"`
 	About    string `json:"about,omitempty"`
 	Email    string `json:"email"`
+	// Пароль из тела регистрации или изменения профиля; в ответах не отдаётся.
+	Password string `json:"password,omitempty"`
+	// Хэш пароля (bcrypt), который хранит репозиторий; пустой, если пароля нет.
+	PasswordHash string `json:"-"`
+}
+
+// UserLogin тело запроса на вход.
+type UserLogin struct {
+	Password string `json:"password"`
+}
+
+// UserSession токен, который выдаётся при входе и передаётся в заголовке
+// "Authorization: Bearer <token>".
+type UserSession struct {
+	Nickname string    `json:"nickname"`
+	Token    string    `json:"token"`
+	Expires  time.Time `json:"expires"`
+}
+
+// UserSearch параметры списка всех пользователей.
+type UserSearch struct {
+	// Максимальное кол-во возвращаемых записей.
+	Limit int `json:"limit"`
+	// Nickname, после которого начинается страница (последний на предыдущей).
+	Since string `json:"since"`
+	// Флаг сортировки по убыванию.
+	Desc bool `json:"desc"`
+	// Префикс nickname или fullname, регистр не учитывается.
+	Query string `json:"query"`
+}
+
+// UserStats Активность пользователя на всех форумах.
+type UserStats struct {
+	Nickname string `json:"nickname"`
+	// Кол-во сообщений пользователя.
+	Posts int64 `json:"posts"`
+	// Кол-во созданных им веток обсуждения.
+	Threads int64 `json:"threads"`
+	// Кол-во веток, за которые он голосовал.
+	VotesCast int64 `json:"votesCast"`
+	// Сумма голосов за его ветки.
+	VotesReceived int64 `json:"votesReceived"`
+	// Кол-во форумов, в которых он создавал ветки или писал сообщения.
+	Forums int64 `json:"forums"`
+	// Время первой и последней ветки или сообщения; нет, если их не было.
+	FirstActivity *time.Time `json:"firstActivity,omitempty"`
+	LastActivity  *time.Time `json:"lastActivity,omitempty"`
+}
+
+// UserExportPost сообщение в выгрузке данных пользователя вместе с веткой и форумом.
+type UserExportPost struct {
+	Post
+	ThreadTitle string `json:"threadTitle"`
+	ThreadSlug  string `json:"threadSlug,omitempty"`
+	ForumTitle  string `json:"forumTitle"`
+}
+
+// UserExportVote голос в выгрузке данных пользователя.
+type UserExportVote struct {
+	Thread     int64  `json:"thread"`
+	ThreadSlug string `json:"threadSlug,omitempty"`
+	Forum      string `json:"forum"`
+	Voice      int32  `json:"voice"`
 }
 
+// UserRename тело запроса на смену nickname.
+type UserRename struct {
+	Nickname string `json:"nickname"`
+}
+
+// UserMerge тело запроса на слияние аккаунта From в аккаунт Into.
+type UserMerge struct {
+	Into string `json:"into"`
+	From string `json:"from"`
+	// Чей голос остаётся, если оба голосовали за одну ветку: MergeVotesKeep
+	// (по умолчанию), MergeVotesReplace или MergeVotesDrop.
+	Votes string `json:"votes"`
+	// Только посчитать изменения, ничего не меняя; задаётся параметром dry_run.
+	DryRun bool `json:"-"`
+}
+
+const (
+	MergeVotesKeep    = "keep"    // остаётся голос Into
+	MergeVotesReplace = "replace" // голос From заменяет голос Into
+	MergeVotesDrop    = "drop"    // снимаются оба голоса
+)
+
+// UserMergeReport что изменило слияние, а при DryRun что изменит.
+type UserMergeReport struct {
+	Into   string `json:"into"`
+	From   string `json:"from"`
+	Votes  string `json:"votes"`
+	DryRun bool   `json:"dryRun"`
+	// Кол-во веток и сообщений From, которые переходят к Into.
+	Threads int64 `json:"threads"`
+	Posts   int64 `json:"posts"`
+	// Кол-во форумов, созданных From.
+	Forums int64 `json:"forums"`
+	// Кол-во форумов, в списке пользователей которых появится Into.
+	Memberships int64 `json:"memberships"`
+	// Кол-во голосов From, перенесённых без конфликта.
+	VotesMoved int64 `json:"votesMoved"`
+	// Кол-во веток, за которые голосовали оба.
+	VoteConflicts int64 `json:"voteConflicts"`
+}
+
+const (
+	MissingUser     = "Can't find user with id #42\n"
+	ErrUserExists   = "User already exists"
+	ErrUserEmail    = "This email is already registered by another user"
+	ErrUserNick     = "This nickname is already taken by another user"
+	ErrEmptyNick    = "Nickname must not be empty"
+	ErrNickReserved = "This nickname is reserved"
+	ErrMailReserved = "This email is reserved"
+	ErrMergeSelf    = "Can't merge a user into itself"
+	ErrMergeVotes   = "Unknown vote merge policy"
+	ErrBadLogin     = "Wrong nickname or password"
+	ErrNoPassword   = "Password must not be empty"
+	ErrLongPassword = "Password must not be longer than 72 bytes"
+	ErrBadToken     = "Invalid or expired token"
+	ErrNoToken      = "Authentication required"
+	ErrNotCaller    = "Can't act on behalf of another user"
+)
+
+// Автор-заглушка, которому переходят форумы, ветки и сообщения удалённых
+// пользователей. Создаётся при первом удалении; nickname и email занять нельзя,
+// по email хранилище отличает заглушку от аккаунта с тем же nickname.
 const (
-	MissingUser = "Can't find user with id #42\n"
+	DeletedUser         = "deleted"
+	DeletedUserFullname = "Deleted user"
+	DeletedUserEmail    = "deleted@invalid"
+	ErrNotPlaceholder   = "User " + DeletedUser + " is a real account, not the placeholder for deleted users"
 )
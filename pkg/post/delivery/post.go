@@ -1,12 +1,11 @@
 package delivery
 
 import (
+	"forum/internal/utils/logger"
 	"forum/internal/utils/response"
 	"forum/internal/utils/utils"
-	"forum/pkg/models"
 	"forum/pkg/post/usecase"
 	"github.com/gorilla/mux"
-	"log"
 	"net/http"
 )
 
@@ -33,14 +32,13 @@ func (u PostDelivery) GetInfoByPost(w http.ResponseWriter, r *http.Request) {
 
 	params := u.Usecase.GetParamsByQuery(r.URL.Query())
 
-	info, ok := u.Usecase.GetAllInfo(params, id)
-	if !ok {
-		ans := response.ErrorResponse{Err: models.ErrPostNotFound}
-		response.Process(response.LoggerFunc(ans.Error(), log.Println), response.ResponseFunc(w, http.StatusNotFound, ans))
+	info, err := u.Usecase.GetAllInfo(r.Context(), params, id)
+	if err != nil {
+		response.Process(response.LoggerFunc(err.Error(), logger.ErrorFunc(r.Context(), err)), response.ErrorFunc(w, err))
 		return
 	}
 
-	response.Process(response.LoggerFunc("Get All info by post", log.Println), response.ResponseFunc(w, http.StatusOK, info))
+	response.Process(response.LoggerFunc("Get All info by post", logger.FromContext(r.Context()).Debug), response.ResponseFunc(w, http.StatusOK, info))
 }
 
 func (u PostDelivery) ChangePost(w http.ResponseWriter, r *http.Request) {
@@ -52,15 +50,14 @@ func (u PostDelivery) ChangePost(w http.ResponseWriter, r *http.Request) {
 
 	updateMessage, err := u.Usecase.ParseJsonToPostUpdate(r.Body)
 	if err != nil {
-		w.WriteHeader(400)
+		response.Process(response.LoggerFunc(err.Error(), logger.ErrorFunc(r.Context(), err)), response.ErrorFunc(w, err))
 		return
 	}
 
-	message, ok := u.Usecase.ChangeMessage(updateMessage, id)
-	if !ok {
-		ans := response.ErrorResponse{Err: models.ErrPostNotFound}
-		response.Process(response.LoggerFunc(ans.Error(), log.Println), response.ResponseFunc(w, http.StatusNotFound, ans))
+	message, err := u.Usecase.ChangeMessage(r.Context(), updateMessage, id)
+	if err != nil {
+		response.Process(response.LoggerFunc(err.Error(), logger.ErrorFunc(r.Context(), err)), response.ErrorFunc(w, err))
 		return
 	}
-	response.Process(response.LoggerFunc("Change Message", log.Println), response.ResponseFunc(w, http.StatusOK, message))
+	response.Process(response.LoggerFunc("Change Message", logger.FromContext(r.Context()).Debug), response.ResponseFunc(w, http.StatusOK, message))
 }
@@ -1,67 +1,71 @@
 package repository
 
 import (
+	"context"
 	"fmt"
+	"forum/internal/utils/errs"
+	"forum/internal/utils/logger"
+	"forum/internal/utils/pgxtime"
 	"forum/internal/utils/utils"
 	"forum/pkg/models"
 	"github.com/jackc/pgx"
-	"github.com/pkg/errors"
-	"log"
 	"strings"
 )
 
 type PostRepositoryInterface interface {
-	AddPosts(posts models.Posts, threadId int, forumName string) (models.Posts, error)
-	ChangePost(updateMessage models.PostUpdate, id int) (models.Post, bool)
-	GetAllInfo(params models.FullPostParams, id int) (models.FullPost, bool)
-	GetAllPostByThread(id int, limit int, since int, desc bool) ([]models.Post, bool)
-	GetPostsTree(id int, limit int, since int, desc bool) ([]models.Post, bool)
-	GetPostsParentTree(id int, limit int, since int, desc bool) ([]models.Post, bool)
+	AddPosts(ctx context.Context, posts models.Posts, threadId int, forumName string) (models.Posts, error)
+	ChangePost(ctx context.Context, updateMessage models.PostUpdate, id int) (models.Post, error)
+	GetAllInfo(ctx context.Context, params models.FullPostParams, id int) (models.FullPost, error)
+	GetAllPostByThread(ctx context.Context, id int, limit int, since int, desc bool) ([]models.Post, error)
+	GetPostsTree(ctx context.Context, id int, limit int, since int, desc bool) ([]models.Post, error)
+	GetPostsParentTree(ctx context.Context, id int, limit int, since int, desc bool) ([]models.Post, error)
+	FindPostsByUser(ctx context.Context, nickname string, params models.UserPostsParams) ([]models.Post, error)
 }
 
 type PostRepository struct {
-	DB *pgx.ConnPool
+	DB *pgxtime.Pool
 }
 
-func (p PostRepository) ParseRowsToPost(rows *pgx.Rows) ([]models.Post, bool) {
+func (p PostRepository) ParseRowsToPost(ctx context.Context, rows *pgxtime.Rows) ([]models.Post, error) {
 	var posts []models.Post
 	for rows.Next() {
 		var post models.Post
 		err := rows.Scan(&post.Id, &post.Parent, &post.Author, &post.Message, &post.IsEdited, &post.Forum, &post.Thread, &post.Created)
 		if err != nil {
-			log.Println(err)
+			logger.FromContext(ctx).Debug(err)
 			rows.Close()
-			return posts, false
+			return nil, errs.FromPgx(err, models.ErrPostNotFound)
 		}
 		posts = append(posts, post)
 	}
 
 	rows.Close()
-	return posts, true
+	return posts, errs.FromPgx(rows.Err(), models.ErrPostNotFound)
 }
 
-func (p PostRepository) GetPostsTree(id int, limit int, since int, desc bool) ([]models.Post, bool) {
-	var rows *pgx.Rows
+func (p PostRepository) GetPostsTree(ctx context.Context, id int, limit int, since int, desc bool) ([]models.Post, error) {
+	var rows *pgxtime.Rows
 	var err error
 
 	if since == 0 {
 		if desc {
-			rows, err = p.DB.Query("GetPostsTreeDesc", id, limit)
+			rows, err = p.DB.QueryEx(ctx, "GetPostsTreeDesc", nil, id, limit)
 		} else {
-			rows, err = p.DB.Query("GetPostsTree", id, limit)
+			rows, err = p.DB.QueryEx(ctx, "GetPostsTree", nil, id, limit)
 		}
 	} else {
 		if desc {
-			rows, err = p.DB.Query("GetPostsTreeSinceDesc", id, since, limit)
+			rows, err = p.DB.QueryEx(ctx, "GetPostsTreeSinceDesc", nil, id, since, limit)
 		} else {
-			rows, err = p.DB.Query("GetPostsTreeSince", id, since, limit)
+			rows, err = p.DB.QueryEx(ctx, "GetPostsTreeSince", nil, id, since, limit)
 		}
 	}
 	if err != nil {
-		return []models.Post{}, false
+		logger.FromContext(ctx).Debug(err)
+		return nil, errs.FromPgx(err, models.ErrThreadNotfound)
 	}
 
-	return p.ParseRowsToPost(rows)
+	return p.ParseRowsToPost(ctx, rows)
 }
 
 const (
@@ -80,6 +84,12 @@ const (
 	GetPostsFlatSinceDesc = `SELECT id, parent, author, message, isedited, forum, thread, created FROM parkmaildb."Post" WHERE thread = $1 AND id < $2 ORDER BY id DESC LIMIT $3`
 	GetPostsFlatSince     = `SELECT id, parent, author, message, isedited, forum, thread, created FROM parkmaildb."Post" WHERE thread = $1 AND id > $2 ORDER BY id LIMIT $3`
 
+	// $2 slug форума или '' для всех форумов.
+	SelectPostsByUserDesc      = `SELECT id, parent, author, message, isedited, forum, thread, created FROM parkmaildb."Post" WHERE author = $1 AND ($2::citext = '' OR forum = $2::citext) ORDER BY id DESC LIMIT $3`
+	SelectPostsByUser          = `SELECT id, parent, author, message, isedited, forum, thread, created FROM parkmaildb."Post" WHERE author = $1 AND ($2::citext = '' OR forum = $2::citext) ORDER BY id LIMIT $3`
+	SelectPostsByUserSinceDesc = `SELECT id, parent, author, message, isedited, forum, thread, created FROM parkmaildb."Post" WHERE author = $1 AND ($2::citext = '' OR forum = $2::citext) AND id < $3 ORDER BY id DESC LIMIT $4`
+	SelectPostsByUserSince     = `SELECT id, parent, author, message, isedited, forum, thread, created FROM parkmaildb."Post" WHERE author = $1 AND ($2::citext = '' OR forum = $2::citext) AND id > $3 ORDER BY id LIMIT $4`
+
 	SelectPostInfo       = `SELECT id, parent, author, message, isedited, forum, thread, created FROM parkmaildb."Post" WHERE id = $1`
 	SelectPostInfoUser   = `SELECT nickname, fullname, about, email FROM parkmaildb."User" WHERE nickname = $1`
 	SelectPostInfoThread = `SELECT id, title, author, forum, message, votes, slug, created FROM parkmaildb."Thread" WHERE id = $1`
@@ -89,57 +99,85 @@ const (
 	GetPostParent = `SELECT id FROM parkmaildb."Post" WHERE thread = $1 AND id = $2`
 )
 
-func (p PostRepository) GetPostsParentTree(id int, limit int, since int, desc bool) ([]models.Post, bool) {
-	var rows *pgx.Rows
+func (p PostRepository) GetPostsParentTree(ctx context.Context, id int, limit int, since int, desc bool) ([]models.Post, error) {
+	var rows *pgxtime.Rows
 	var err error
 
 	if since == 0 {
 		if desc {
-			rows, err = p.DB.Query("GetPostsParentDesc", id, limit)
+			rows, err = p.DB.QueryEx(ctx, "GetPostsParentDesc", nil, id, limit)
 		} else {
-			rows, err = p.DB.Query("GetPostsParent", id, limit)
+			rows, err = p.DB.QueryEx(ctx, "GetPostsParent", nil, id, limit)
 		}
 	} else {
 		if desc {
-			rows, err = p.DB.Query("GetPostsParentSinceDesc", id, since, limit)
+			rows, err = p.DB.QueryEx(ctx, "GetPostsParentSinceDesc", nil, id, since, limit)
 		} else {
-			rows, err = p.DB.Query("GetPostsParentSince", id, since, limit)
+			rows, err = p.DB.QueryEx(ctx, "GetPostsParentSince", nil, id, since, limit)
 		}
 	}
 
 	if err != nil {
-		return []models.Post{}, false
+		logger.FromContext(ctx).Debug(err)
+		return nil, errs.FromPgx(err, models.ErrThreadNotfound)
 	}
 
-	return p.ParseRowsToPost(rows)
+	return p.ParseRowsToPost(ctx, rows)
 }
 
-func (p PostRepository) GetAllPostByThread(id int, limit int, since int, desc bool) ([]models.Post, bool) {
-	var rows *pgx.Rows
+func (p PostRepository) FindPostsByUser(ctx context.Context, nickname string, params models.UserPostsParams) ([]models.Post, error) {
+	var rows *pgxtime.Rows
+	var err error
+
+	if params.Since == 0 {
+		if params.Desc {
+			rows, err = p.DB.QueryEx(ctx, "SelectPostsByUserDesc", nil, nickname, params.Forum, params.Limit)
+		} else {
+			rows, err = p.DB.QueryEx(ctx, "SelectPostsByUser", nil, nickname, params.Forum, params.Limit)
+		}
+	} else {
+		if params.Desc {
+			rows, err = p.DB.QueryEx(ctx, "SelectPostsByUserSinceDesc", nil, nickname, params.Forum, params.Since, params.Limit)
+		} else {
+			rows, err = p.DB.QueryEx(ctx, "SelectPostsByUserSince", nil, nickname, params.Forum, params.Since, params.Limit)
+		}
+	}
+
+	if err != nil {
+		logger.FromContext(ctx).Debug(err)
+		return nil, errs.FromPgx(err, models.MissingUser)
+	}
+
+	return p.ParseRowsToPost(ctx, rows)
+}
+
+func (p PostRepository) GetAllPostByThread(ctx context.Context, id int, limit int, since int, desc bool) ([]models.Post, error) {
+	var rows *pgxtime.Rows
 	var err error
 
 	if since == 0 {
 		if desc {
-			rows, err = p.DB.Query("GetPostsFlatDesc", id, limit)
+			rows, err = p.DB.QueryEx(ctx, "GetPostsFlatDesc", nil, id, limit)
 		} else {
-			rows, err = p.DB.Query("GetPostsFlat", id, limit)
+			rows, err = p.DB.QueryEx(ctx, "GetPostsFlat", nil, id, limit)
 		}
 	} else {
 		if desc {
-			rows, err = p.DB.Query("GetPostsFlatSinceDesc", id, since, limit)
+			rows, err = p.DB.QueryEx(ctx, "GetPostsFlatSinceDesc", nil, id, since, limit)
 		} else {
-			rows, err = p.DB.Query("GetPostsFlatSince", id, since, limit)
+			rows, err = p.DB.QueryEx(ctx, "GetPostsFlatSince", nil, id, since, limit)
 		}
 	}
 
 	if err != nil {
-		return []models.Post{}, false
+		logger.FromContext(ctx).Debug(err)
+		return nil, errs.FromPgx(err, models.ErrThreadNotfound)
 	}
 
-	return p.ParseRowsToPost(rows)
+	return p.ParseRowsToPost(ctx, rows)
 }
 
-func (p PostRepository) GetAllInfo(params models.FullPostParams, id int) (models.FullPost, bool) {
+func (p PostRepository) GetAllInfo(ctx context.Context, params models.FullPostParams, id int) (models.FullPost, error) {
 	var info models.FullPost
 
 	post := models.Post{}
@@ -147,28 +185,28 @@ func (p PostRepository) GetAllInfo(params models.FullPostParams, id int) (models
 	forum := models.Forum{}
 	thread := models.Thread{}
 
-	err := p.DB.QueryRow("SelectPostInfo", id).
+	err := p.DB.QueryRowEx(ctx, "SelectPostInfo", nil, id).
 		Scan(&post.Id, &post.Parent, &post.Author, &post.Message, &post.IsEdited, &post.Forum, &post.Thread, &post.Created)
 	if err != nil {
-		log.Println(err)
-		return models.FullPost{}, false
+		logger.FromContext(ctx).Debug(err)
+		return models.FullPost{}, errs.FromPgx(err, models.ErrPostNotFound)
 	}
 	info.Post = &post
 
 	if params.User {
-		err = p.DB.QueryRow("SelectPostInfoUser", post.Author).
+		err = p.DB.QueryRowEx(ctx, "SelectPostInfoUser", nil, post.Author).
 			Scan(&user.Nickname, &user.Fullname, &user.About, &user.Email)
 		if err != nil {
-			return models.FullPost{}, false
+			return models.FullPost{}, errs.FromPgx(err, models.MissingUser)
 		}
 		info.Author = &user
 	}
 
 	if params.Thread {
-		err = p.DB.QueryRow("SelectPostInfoThread", post.Thread).
+		err = p.DB.QueryRowEx(ctx, "SelectPostInfoThread", nil, post.Thread).
 			Scan(&thread.Id, &thread.Title, &thread.Author, &thread.Forum, &thread.Message, &thread.Votes, &thread.Slug, &thread.Created)
 		if err != nil {
-			return models.FullPost{}, false
+			return models.FullPost{}, errs.FromPgx(err, models.ErrThreadNotfound)
 		}
 		if utils.IsValidUUID(thread.Slug) {
 			thread.Slug = ""
@@ -178,31 +216,31 @@ func (p PostRepository) GetAllInfo(params models.FullPostParams, id int) (models
 	}
 
 	if params.Forum {
-		err = p.DB.QueryRow("SelectPostInfoForum", post.Forum).
+		err = p.DB.QueryRowEx(ctx, "SelectPostInfoForum", nil, post.Forum).
 			Scan(&forum.Title, &forum.User, &forum.Slug, &forum.Posts, &forum.Threads)
 		if err != nil {
-			return models.FullPost{}, false
+			return models.FullPost{}, errs.FromPgx(err, models.ErrForumNotFound)
 		}
 		info.Forum = &forum
 	}
 
-	return info, true
+	return info, nil
 }
 
-func (p PostRepository) ChangePost(updateMessage models.PostUpdate, id int) (models.Post, bool) {
+func (p PostRepository) ChangePost(ctx context.Context, updateMessage models.PostUpdate, id int) (models.Post, error) {
 	var post models.Post
-	err := p.DB.QueryRow("UpdatePost", updateMessage.Message, id).
+	err := p.DB.QueryRowEx(ctx, "UpdatePost", nil, updateMessage.Message, id).
 		Scan(&post.Id, &post.Parent, &post.Author, &post.Message, &post.IsEdited, &post.Forum, &post.Thread, &post.Created)
 
 	if err != nil {
-		log.Println(err)
-		return models.Post{}, false
+		logger.FromContext(ctx).Debug(err)
+		return models.Post{}, errs.FromPgx(err, models.ErrPostNotFound)
 	}
 
-	return post, true
+	return post, nil
 }
 
-func (p PostRepository) AddPosts(posts models.Posts, threadId int, forumName string) (models.Posts, error) {
+func (p PostRepository) AddPosts(ctx context.Context, posts models.Posts, threadId int, forumName string) (models.Posts, error) {
 	var insertedPosts models.Posts
 
 	var sqlValues []interface{}
@@ -215,9 +253,12 @@ func (p PostRepository) AddPosts(posts models.Posts, threadId int, forumName str
 	for i, post := range posts {
 		if post.Parent != 0 {
 			id := -1
-			err := p.DB.QueryRow("GetPostParent", threadId, post.Parent).Scan(&id)
+			err := p.DB.QueryRowEx(ctx, "GetPostParent", nil, threadId, post.Parent).Scan(&id)
 			if err == pgx.ErrNoRows {
-				return nil, errors.New("Cant Find Parent")
+				return nil, errs.Conflict(models.ErrParentMissing)
+			}
+			if err != nil {
+				return nil, errs.FromPgx(err, models.ErrParentMissing)
 			}
 		}
 
@@ -230,10 +271,11 @@ func (p PostRepository) AddPosts(posts models.Posts, threadId int, forumName str
 	sqlQuery = strings.TrimSuffix(sqlQuery, ",")
 	sqlQuery += ` RETURNING id, parent, author, message, isedited, forum, thread, created;`
 
-	rows, err := p.DB.Query(sqlQuery, sqlValues...)
+	rows, err := p.DB.QueryEx(ctx, sqlQuery, nil, sqlValues...)
 
 	if err != nil {
-		return nil, errors.New("Cant Find Parent")
+		logger.FromContext(ctx).Debug(err)
+		return nil, errs.FromPgx(err, models.ErrUserUnknown)
 	}
 
 	defer rows.Close()
@@ -242,15 +284,20 @@ func (p PostRepository) AddPosts(posts models.Posts, threadId int, forumName str
 		post := models.Post{}
 
 		err := rows.Scan(&post.Id, &post.Parent, &post.Author, &post.Message, &post.IsEdited, &post.Forum, &post.Thread, &post.Created)
-		if err != nil || post.Author == "" {
-			return nil, err
+		if err != nil {
+			return nil, errs.FromPgx(err, models.ErrUserUnknown)
 		}
 
 		insertedPosts = append(insertedPosts, post)
 	}
 
+	if err = rows.Err(); err != nil {
+		logger.FromContext(ctx).Debug(err)
+		return nil, errs.FromPgx(err, models.ErrUserUnknown)
+	}
+
 	if len(insertedPosts) == 0 {
-		return nil, errors.New(models.ErrUserUnknown)
+		return nil, errs.NotFound(models.ErrUserUnknown)
 	}
 
 	return insertedPosts, nil
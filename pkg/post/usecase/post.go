@@ -1,15 +1,19 @@
 package usecase
 
 import (
+	"context"
 	"encoding/json"
-	"forum/internal/utils/utils"
+	"forum/internal/utils/auth"
+	"forum/internal/utils/errs"
+	usecase2 "forum/pkg/forum/usecase"
 	"forum/pkg/models"
 	"forum/pkg/post/repository"
 	repository2 "forum/pkg/thread/repository"
-	"github.com/pkg/errors"
+	"forum/pkg/user/repostitory"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 	"io"
 	"log"
-	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
@@ -19,69 +23,87 @@ import (
 type PostUsecaseInterface interface {
 	ParseJsonToPosts(body io.ReadCloser) ([]models.Post, error)
 	ParseJsonToPostUpdate(body io.ReadCloser) (models.PostUpdate, error)
-	CreatePosts(posts models.Posts, threadId int, forumName string) ([]models.Post, int, error)
-	ChangeMessage(updateMessage models.PostUpdate, id string) (models.Post, bool)
+	CreatePosts(ctx context.Context, posts models.Posts, threadId int, forumName string) ([]models.Post, error)
+	ChangeMessage(ctx context.Context, updateMessage models.PostUpdate, id string) (models.Post, error)
 	GetParamsByQuery(query url.Values) models.FullPostParams
-	GetAllInfo(params models.FullPostParams, id string) (models.FullPost, bool)
-	GetPostByThread(slugOrId string, limit int, since int, sort string, desc bool) ([]models.Post, bool)
+	GetAllInfo(ctx context.Context, params models.FullPostParams, id string) (models.FullPost, error)
+	GetPostByThread(ctx context.Context, slugOrId string, limit int, since int, sort string, desc bool) ([]models.Post, error)
+	FindPostsByUser(ctx context.Context, nickname string, params models.UserPostsParams) ([]models.Post, error)
 }
 
+var postsCreated = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "forum_posts_created_total",
+	Help: "Posts created through the API.",
+})
+
 type PostUsecase struct {
 	PostDB   repository.PostRepositoryInterface
 	ThreadDB repository2.ThreadRepositoryInterface
+	UserDB   repostitory.UserRepositoryInterface
+	// Права на правку чужих сообщений.
+	Permissions usecase2.Permissions
 }
 
-func (u PostUsecase) GetPostByThread(slugOrId string, limit int, since int, sort string, desc bool) ([]models.Post, bool) {
+func (u PostUsecase) GetPostByThread(ctx context.Context, slugOrId string, limit int, since int, sort string, desc bool) ([]models.Post, error) {
 	id, err := strconv.Atoi(slugOrId)
 	if err != nil {
-		var ok bool
-		id, ok = u.ThreadDB.GetThreadIdBySlug(slugOrId)
-		if !ok {
-			var re []models.Post
-			return re, false
-		}
+		id, err = u.ThreadDB.GetThreadIdBySlug(ctx, slugOrId)
 	} else {
-		_, ok := u.ThreadDB.GetThreadInfoById(id)
-		if !ok {
-			return nil, false
-		}
+		_, err = u.ThreadDB.GetThreadInfoById(ctx, id)
+	}
+	if err != nil {
+		return nil, err
 	}
 
 	if limit <= 0 {
 		limit = 100
 	}
 
-	var ok bool
 	var posts []models.Post
 	switch sort {
 	case "tree":
-		posts, ok = u.PostDB.GetPostsTree(id, limit, since, desc)
+		posts, err = u.PostDB.GetPostsTree(ctx, id, limit, since, desc)
 	case "parent_tree":
-		log.Println("parent_tree")
-		posts, ok = u.PostDB.GetPostsParentTree(id, limit, since, desc)
+		posts, err = u.PostDB.GetPostsParentTree(ctx, id, limit, since, desc)
 	default:
-		posts, ok = u.PostDB.GetAllPostByThread(id, limit, since, desc)
+		posts, err = u.PostDB.GetAllPostByThread(ctx, id, limit, since, desc)
 	}
 
-	if !ok {
-		var re []models.Post
-		return re, false
+	if err != nil {
+		return nil, err
+	}
+	return posts, nil
+}
+
+func (u PostUsecase) FindPostsByUser(ctx context.Context, nickname string, params models.UserPostsParams) ([]models.Post, error) {
+	posts, err := u.PostDB.FindPostsByUser(ctx, nickname, params)
+	if err != nil {
+		return nil, err
 	}
+
 	if posts == nil {
-		var re []models.Post
-		return re, true
+		user, err := u.UserDB.GetUser(ctx, nickname)
+		if err != nil {
+			return nil, err
+		}
+		// nickname мог оказаться старым псевдонимом пользователя
+		if !strings.EqualFold(user.Nickname, nickname) {
+			return u.FindPostsByUser(ctx, user.Nickname, params)
+		}
+		posts = make([]models.Post, 0)
 	}
-	return posts, true
+
+	return posts, nil
 }
 
-func (u PostUsecase) GetAllInfo(params models.FullPostParams, id string) (models.FullPost, bool) {
+func (u PostUsecase) GetAllInfo(ctx context.Context, params models.FullPostParams, id string) (models.FullPost, error) {
 	intId, err := strconv.Atoi(id)
 	if err != nil {
 		log.Println(err)
-		return models.FullPost{}, false
+		return models.FullPost{}, errs.Wrap(errs.KindInvalid, models.ErrBadId, err)
 	}
 
-	return u.PostDB.GetAllInfo(params, intId)
+	return u.PostDB.GetAllInfo(ctx, params, intId)
 }
 
 func (u PostUsecase) GetParamsByQuery(query url.Values) models.FullPostParams {
@@ -107,14 +129,24 @@ func (u PostUsecase) GetParamsByQuery(query url.Values) models.FullPostParams {
 	return postParams
 }
 
-func (u PostUsecase) ChangeMessage(updateMessage models.PostUpdate, id string) (models.Post, bool) {
+func (u PostUsecase) ChangeMessage(ctx context.Context, updateMessage models.PostUpdate, id string) (models.Post, error) {
 	intId, err := strconv.Atoi(id)
 	if err != nil {
 		log.Println(err)
-		return models.Post{}, false
+		return models.Post{}, errs.Wrap(errs.KindInvalid, models.ErrBadId, err)
 	}
 
-	return u.PostDB.ChangePost(updateMessage, intId)
+	// аутентифицированный пользователь правит только свои сообщения, если он не модератор форума
+	if _, ok := auth.FromContext(ctx); ok {
+		info, err := u.PostDB.GetAllInfo(ctx, models.FullPostParams{}, intId)
+		if err != nil {
+			return models.Post{}, err
+		}
+		if err = u.Permissions.CheckEdit(ctx, info.Post.Forum, info.Post.Author); err != nil {
+			return models.Post{}, err
+		}
+	}
+	return u.PostDB.ChangePost(ctx, updateMessage, intId)
 }
 
 func (u PostUsecase) ParseJsonToPostUpdate(body io.ReadCloser) (models.PostUpdate, error) {
@@ -125,26 +157,38 @@ func (u PostUsecase) ParseJsonToPostUpdate(body io.ReadCloser) (models.PostUpdat
 	err := decoder.Decode(&postUpdate)
 	if err != nil {
 		log.Println(err)
+		return postUpdate, errs.Wrap(errs.KindInvalid, models.ErrBadBody, err)
 	}
 
-	return postUpdate, err
+	return postUpdate, nil
 }
 
-func (u PostUsecase) CreatePosts(posts models.Posts, threadId int, forumName string) ([]models.Post, int, error) {
-	addPosts, err := u.PostDB.AddPosts(posts, threadId, forumName)
-	if err == nil {
-		if addPosts == nil {
-			addPosts = []models.Post{}
+func (u PostUsecase) CreatePosts(ctx context.Context, posts models.Posts, threadId int, forumName string) ([]models.Post, error) {
+	// авторы пачки обычно повторяются, каждого ищем один раз
+	authors := make(map[string]string)
+	for i, post := range posts {
+		key := strings.ToLower(post.Author)
+		author, ok := authors[key]
+		if !ok {
+			var err error
+			if author, err = u.Permissions.CheckAuthor(ctx, post.Author); err != nil {
+				return []models.Post{}, err
+			}
+			authors[key] = author
 		}
-		return addPosts, http.StatusCreated, nil
+		posts[i].Author = author
 	}
 
-	code := utils.PgxErrorCode(err)
-	if code == "23503" || err.Error() == models.ErrUserUnknown {
-		return []models.Post{}, http.StatusNotFound, errors.New(models.ErrUserUnknown)
+	addPosts, err := u.PostDB.AddPosts(ctx, posts, threadId, forumName)
+	if err != nil {
+		return []models.Post{}, err
 	}
 
-	return []models.Post{}, http.StatusConflict, errors.New("Parent Post is Missing")
+	if addPosts == nil {
+		addPosts = []models.Post{}
+	}
+	postsCreated.Add(float64(len(addPosts)))
+	return addPosts, nil
 }
 
 func (u PostUsecase) ParseJsonToPosts(body io.ReadCloser) ([]models.Post, error) {
@@ -155,6 +199,7 @@ func (u PostUsecase) ParseJsonToPosts(body io.ReadCloser) ([]models.Post, error)
 	err := decoder.Decode(&posts)
 	if err != nil {
 		log.Println(err)
+		return posts, errs.Wrap(errs.KindInvalid, models.ErrBadBody, err)
 	}
 
 	now := time.Now()
@@ -162,5 +207,5 @@ func (u PostUsecase) ParseJsonToPosts(body io.ReadCloser) ([]models.Post, error)
 		post.Created = now
 	}
 
-	return posts, err
+	return posts, nil
 }
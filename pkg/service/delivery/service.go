@@ -1,37 +1,76 @@
 package delivery
 
 import (
+	"forum/internal/utils/logger"
 	"forum/internal/utils/response"
+	"forum/internal/utils/utils"
+	"forum/pkg/models"
 	"forum/pkg/service/usecase"
 	"github.com/gorilla/mux"
-	"log"
 	"net/http"
 )
 
 type ServiceDeliveryInterface interface {
 	CleanDB(w http.ResponseWriter, r *http.Request)
 	GetFullInfo(w http.ResponseWriter, r *http.Request)
+	MergeUsers(w http.ResponseWriter, r *http.Request)
 }
 
 type ServiceDelivery struct {
 	Usecase usecase.ServiceUsecaseInterface
+	// Регистрировать clear и merge; без них на эти пути отвечает 404.
+	Enabled bool
 }
 
 func (u ServiceDelivery) SetHandlersForService(router *mux.Router) {
-	router.HandleFunc("/service/clear", u.CleanDB).Methods(http.MethodPost)
 	router.HandleFunc("/service/status", u.GetFullInfo).Methods(http.MethodGet)
+	if !u.Enabled {
+		return
+	}
+	router.HandleFunc("/service/clear", u.CleanDB).Methods(http.MethodPost)
+	router.HandleFunc("/service/merge", u.MergeUsers).Methods(http.MethodPost)
 }
 
 func (u ServiceDelivery) CleanDB(w http.ResponseWriter, r *http.Request) {
-	ok := u.Usecase.CleanDb()
-	if !ok {
-		w.WriteHeader(500)
+	clean := models.Clean{Forum: r.URL.Query().Get("forum")}
+	var err error
+	clean.DryRun, err = utils.ParseDryRun(r.URL.Query())
+	if err != nil {
+		response.Process(response.LoggerFunc(err.Error(), logger.ErrorFunc(r.Context(), err)), response.ErrorFunc(w, err))
 		return
 	}
-	w.WriteHeader(200)
+
+	report, err := u.Usecase.CleanDb(r.Context(), clean)
+	if err != nil {
+		response.Process(response.LoggerFunc(err.Error(), logger.ErrorFunc(r.Context(), err)), response.ErrorFunc(w, err))
+		return
+	}
+	response.Process(response.LoggerFunc("CLEAN DB", logger.FromContext(r.Context()).Debug), response.ResponseFunc(w, http.StatusOK, report))
 }
 
 func (u ServiceDelivery) GetFullInfo(w http.ResponseWriter, r *http.Request) {
-	status := u.Usecase.GetStatus()
-	response.Process(response.LoggerFunc("GET STATUS", log.Println), response.ResponseFunc(w, http.StatusOK, status))
+	status, err := u.Usecase.GetStatus(r.Context())
+	if err != nil {
+		response.Process(response.LoggerFunc(err.Error(), logger.ErrorFunc(r.Context(), err)), response.ErrorFunc(w, err))
+		return
+	}
+	response.Process(response.LoggerFunc("GET STATUS", logger.FromContext(r.Context()).Debug), response.ResponseFunc(w, http.StatusOK, status))
+}
+
+func (u ServiceDelivery) MergeUsers(w http.ResponseWriter, r *http.Request) {
+	merge, err := u.Usecase.ParseJsonToUserMerge(r.Body)
+	if err == nil {
+		merge.DryRun, err = utils.ParseDryRun(r.URL.Query())
+	}
+	if err != nil {
+		response.Process(response.LoggerFunc(err.Error(), logger.ErrorFunc(r.Context(), err)), response.ErrorFunc(w, err))
+		return
+	}
+
+	report, err := u.Usecase.MergeUsers(r.Context(), merge)
+	if err != nil {
+		response.Process(response.LoggerFunc(err.Error(), logger.ErrorFunc(r.Context(), err)), response.ErrorFunc(w, err))
+		return
+	}
+	response.Process(response.LoggerFunc("MERGE USERS", logger.FromContext(r.Context()).Debug), response.ResponseFunc(w, http.StatusOK, report))
 }
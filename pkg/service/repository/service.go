@@ -1,47 +1,108 @@
 package repository
 
 import (
+	"context"
+	"forum/internal/utils/errs"
+	"forum/internal/utils/logger"
+	"forum/internal/utils/pgxtime"
 	"forum/pkg/models"
-	"github.com/jackc/pgx"
-	"log"
 )
 
 const (
-	CleanDB      = `TRUNCATE parkmaildb."Thread", parkmaildb."Forum", parkmaildb."User", parkmaildb."Vote", parkmaildb."Post", parkmaildb."Users_by_Forum"`
+	CleanDB      = `TRUNCATE parkmaildb."Thread", parkmaildb."Forum", parkmaildb."User", parkmaildb."User_alias", parkmaildb."User_password", parkmaildb."User_key", parkmaildb."Vote", parkmaildb."Post", parkmaildb."Users_by_Forum", parkmaildb."Forum_moderator", parkmaildb."User_admin"`
 	StatusPost   = `SELECT COUNT(*) FROM parkmaildb."Post"`
 	StatusUser   = `SELECT COUNT(*) FROM parkmaildb."User"`
 	StatusForum  = `SELECT COUNT(*) FROM parkmaildb."Forum"`
 	StatusThread = `SELECT COUNT(*) FROM parkmaildb."Thread"`
+	MergeUsers   = `SELECT merged_threads, merged_posts, merged_forums, merged_memberships, merged_votes, vote_conflicts
+					FROM merge_users($1, $2, $3, $4)`
+	CleanCount = `SELECT (SELECT COUNT(*) FROM parkmaildb."User"), (SELECT COUNT(*) FROM parkmaildb."Forum"),
+					(SELECT COUNT(*) FROM parkmaildb."Thread"), (SELECT COUNT(*) FROM parkmaildb."Post"),
+					(SELECT COUNT(*) FROM parkmaildb."Vote")`
+	CleanForum = `SELECT cleaned_forum, cleaned_threads, cleaned_posts, cleaned_votes FROM clean_forum($1, $2)`
 )
 
 type ServiceRepositoryInterface interface {
-	CleanDB() bool
+	// CleanDb удаляет всё хранилище или форум clean.Forum одной транзакцией;
+	// с clean.DryRun только считает.
+	CleanDb(ctx context.Context, clean models.Clean) (models.CleanReport, error)
+	GetStatus(ctx context.Context) (models.Status, error)
+	// MergeUsers переносит всё, что принадлежит merge.From, к merge.Into и
+	// удаляет merge.From одной транзакцией; с merge.DryRun только считает.
+	MergeUsers(ctx context.Context, merge models.UserMerge) (models.UserMergeReport, error)
 }
 
 type ServiceRepository struct {
 	Status *models.Status
-	DB     *pgx.ConnPool
+	DB     *pgxtime.Pool
 }
 
-func (r ServiceRepository) CleanDb() bool {
-	_, err := r.DB.Exec("CleanDB")
+func (r ServiceRepository) CleanDb(ctx context.Context, clean models.Clean) (models.CleanReport, error) {
+	report := models.CleanReport{DryRun: clean.DryRun}
+	if clean.Forum != "" {
+		report.Forums = 1
+		err := r.DB.QueryRowEx(ctx, "CleanForum", nil, clean.Forum, clean.DryRun).
+			Scan(&report.Forum, &report.Threads, &report.Posts, &report.Votes)
+		if err != nil {
+			logger.FromContext(ctx).Debug(err)
+			return models.CleanReport{}, errs.FromPgx(err, models.ErrForumNotFound)
+		}
+		return report, nil
+	}
+
+	tx, err := r.DB.BeginEx(ctx, nil)
 	if err != nil {
-		log.Println(err)
-		return false
+		return models.CleanReport{}, errs.FromPgx(err, "")
 	}
+	defer tx.Rollback()
 
-	return true
+	err = tx.QueryRowEx(ctx, "CleanCount", nil).
+		Scan(&report.Users, &report.Forums, &report.Threads, &report.Posts, &report.Votes)
+	if err != nil {
+		logger.FromContext(ctx).Debug(err)
+		return models.CleanReport{}, errs.FromPgx(err, "")
+	}
+	if clean.DryRun {
+		return report, nil
+	}
+
+	if _, err = tx.ExecEx(ctx, "CleanDB", nil); err != nil {
+		logger.FromContext(ctx).Debug(err)
+		return models.CleanReport{}, errs.FromPgx(err, "")
+	}
+	if err = tx.Commit(); err != nil {
+		return models.CleanReport{}, errs.FromPgx(err, "")
+	}
+	return report, nil
 }
 
-func (r ServiceRepository) GetStatus() models.Status {
+func (r ServiceRepository) GetStatus(ctx context.Context) (models.Status, error) {
 	status := models.Status{}
 
-	err := r.DB.QueryRow("StatusPost").Scan(&status.Post)
-	err = r.DB.QueryRow("StatusUser").Scan(&status.User)
-	err = r.DB.QueryRow("StatusForum").Scan(&status.Forum)
-	err = r.DB.QueryRow("StatusThread").Scan(&status.Thread)
+	for name, dst := range map[string]*int32{
+		"StatusPost":   &status.Post,
+		"StatusUser":   &status.User,
+		"StatusForum":  &status.Forum,
+		"StatusThread": &status.Thread,
+	} {
+		if err := r.DB.QueryRowEx(ctx, name, nil).Scan(dst); err != nil {
+			logger.FromContext(ctx).Debug(err)
+			return models.Status{}, errs.FromPgx(err, "")
+		}
+	}
+
+	return status, nil
+}
+
+func (r ServiceRepository) MergeUsers(ctx context.Context, merge models.UserMerge) (models.UserMergeReport, error) {
+	report := models.UserMergeReport{Into: merge.Into, From: merge.From, Votes: merge.Votes, DryRun: merge.DryRun}
+
+	err := r.DB.QueryRowEx(ctx, "MergeUsers", nil, merge.Into, merge.From, merge.Votes, merge.DryRun).
+		Scan(&report.Threads, &report.Posts, &report.Forums, &report.Memberships, &report.VotesMoved, &report.VoteConflicts)
 	if err != nil {
-		log.Println(err)
+		logger.FromContext(ctx).Debug(err)
+		return models.UserMergeReport{}, errs.FromPgx(err, models.MissingUser)
 	}
-	return status
+
+	return report, nil
 }
@@ -1,23 +1,85 @@
 package usecase
 
 import (
+	"context"
+	"encoding/json"
+	"forum/internal/utils/errs"
+	usecase2 "forum/pkg/forum/usecase"
 	"forum/pkg/models"
 	"forum/pkg/service/repository"
+	"forum/pkg/user/repostitory"
+	"io"
+	"strings"
 )
 
 type ServiceUsecaseInterface interface {
-	CleanDb() bool
-	GetStatus() models.Status
+	CleanDb(ctx context.Context, clean models.Clean) (models.CleanReport, error)
+	GetStatus(ctx context.Context) (models.Status, error)
+	ParseJsonToUserMerge(body io.ReadCloser) (models.UserMerge, error)
+	MergeUsers(ctx context.Context, merge models.UserMerge) (models.UserMergeReport, error)
 }
 
-func (s ServiceUsecase) GetStatus() models.Status {
-	return s.DB.GetStatus()
+func (s ServiceUsecase) GetStatus(ctx context.Context) (models.Status, error) {
+	return s.DB.GetStatus(ctx)
 }
 
-func (s ServiceUsecase) CleanDb() bool {
-	return s.DB.CleanDb()
+// CleanDb очищает хранилище или один форум; доступно только администраторам сайта.
+func (s ServiceUsecase) CleanDb(ctx context.Context, clean models.Clean) (models.CleanReport, error) {
+	if err := s.Permissions.CheckAdmin(ctx); err != nil {
+		return models.CleanReport{}, err
+	}
+	return s.DB.CleanDb(ctx, clean)
+}
+
+func (ServiceUsecase) ParseJsonToUserMerge(body io.ReadCloser) (models.UserMerge, error) {
+	defer body.Close()
+
+	var merge models.UserMerge
+	if err := json.NewDecoder(body).Decode(&merge); err != nil {
+		return merge, errs.Wrap(errs.KindInvalid, models.ErrBadBody, err)
+	}
+	return merge, nil
+}
+
+// MergeUsers сливает аккаунт merge.From в merge.Into. Старые nickname
+// принимаются, пока действуют их псевдонимы. Доступно только администраторам сайта.
+func (s ServiceUsecase) MergeUsers(ctx context.Context, merge models.UserMerge) (models.UserMergeReport, error) {
+	if err := s.Permissions.CheckAdmin(ctx); err != nil {
+		return models.UserMergeReport{}, err
+	}
+	switch merge.Votes {
+	case "":
+		merge.Votes = models.MergeVotesKeep
+	case models.MergeVotesKeep, models.MergeVotesReplace, models.MergeVotesDrop:
+	default:
+		return models.UserMergeReport{}, errs.Invalid(models.ErrMergeVotes)
+	}
+	if merge.Into == "" || merge.From == "" {
+		return models.UserMergeReport{}, errs.Invalid(models.ErrEmptyNick)
+	}
+
+	into, err := s.UserDB.GetUser(ctx, merge.Into)
+	if err != nil {
+		return models.UserMergeReport{}, err
+	}
+	from, err := s.UserDB.GetUser(ctx, merge.From)
+	if err != nil {
+		return models.UserMergeReport{}, err
+	}
+	if strings.EqualFold(into.Nickname, from.Nickname) {
+		return models.UserMergeReport{}, errs.Invalid(models.ErrMergeSelf)
+	}
+	// заглушка удалённых пользователей не сливается ни с кем
+	if strings.EqualFold(into.Nickname, models.DeletedUser) || strings.EqualFold(from.Nickname, models.DeletedUser) {
+		return models.UserMergeReport{}, errs.Invalid(models.ErrNickReserved)
+	}
+
+	merge.Into, merge.From = into.Nickname, from.Nickname
+	return s.DB.MergeUsers(ctx, merge)
 }
 
 type ServiceUsecase struct {
-	DB repository.ServiceRepository
+	DB          repository.ServiceRepositoryInterface
+	UserDB      repostitory.UserRepositoryInterface
+	Permissions usecase2.Permissions
 }
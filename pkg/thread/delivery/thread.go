@@ -1,13 +1,13 @@
 package delivery
 
 import (
+	"forum/internal/utils/logger"
 	"forum/internal/utils/response"
 	"forum/internal/utils/utils"
 	"forum/pkg/models"
 	usecase2 "forum/pkg/post/usecase"
 	"forum/pkg/thread/usecase"
 	"github.com/gorilla/mux"
-	"log"
 	"net/http"
 )
 
@@ -35,20 +35,19 @@ type ThreadDelivery struct {
 func (u ThreadDelivery) GetAllPostByThread(w http.ResponseWriter, r *http.Request) {
 	slugOrId, ok := utils.GetDataFromPath("slug_or_id", mux.Vars(r))
 	if !ok {
-		log.Println("Cant parse url")
+		logger.FromContext(r.Context()).Warn("Cant parse url")
 		return
 	}
 
-	params, ok := utils.ParseJsonToGetPostsParams(r.URL.Query())
-	if !ok {
-		log.Println("Cant parse url params")
+	params, err := utils.ParseJsonToGetPostsParams(r.URL.Query())
+	if err != nil {
+		response.Process(response.LoggerFunc(err.Error(), logger.ErrorFunc(r.Context(), err)), response.ErrorFunc(w, err))
 		return
 	}
 
-	posts, ok := u.PostUsecase.GetPostByThread(slugOrId, params.Limit, params.Since, params.Sort, params.Desc)
-	if !ok {
-		ans := response.ErrorResponse{Err: models.ErrThreadNotfound}
-		response.Process(response.LoggerFunc(ans.Error(), log.Println), response.ResponseFunc(w, http.StatusNotFound, ans))
+	posts, err := u.PostUsecase.GetPostByThread(r.Context(), slugOrId, params.Limit, params.Since, params.Sort, params.Desc)
+	if err != nil {
+		response.Process(response.LoggerFunc(err.Error(), logger.ErrorFunc(r.Context(), err)), response.ErrorFunc(w, err))
 		return
 	}
 
@@ -56,36 +55,34 @@ func (u ThreadDelivery) GetAllPostByThread(w http.ResponseWriter, r *http.Reques
 		posts = make([]models.Post, 0)
 	}
 
-	response.Process(response.LoggerFunc("Найдены посты по ветке", log.Println), response.ResponseFunc(w, http.StatusOK, posts))
+	response.Process(response.LoggerFunc("Найдены посты по ветке", logger.FromContext(r.Context()).Debug), response.ResponseFunc(w, http.StatusOK, posts))
 }
 
 func (u ThreadDelivery) CreatePost(w http.ResponseWriter, r *http.Request) {
 	slugOrId, ok := utils.GetDataFromPath("slug_or_id", mux.Vars(r))
 	if !ok {
-		log.Println("Cant parse urlc")
+		logger.FromContext(r.Context()).Warn("Cant parse urlc")
 		return
 	}
 
 	posts, err := u.PostUsecase.ParseJsonToPosts(r.Body)
 	if err != nil {
-		w.WriteHeader(400)
+		response.Process(response.LoggerFunc(err.Error(), logger.ErrorFunc(r.Context(), err)), response.ErrorFunc(w, err))
 		return
 	}
 
-	thread, ok := u.ThreadUsecase.GetThreadInfo(slugOrId)
-	if !ok {
-		ans := response.ErrorResponse{Err: models.ErrThreadNotfound}
-		response.Process(response.LoggerFunc(ans.Error(), log.Println), response.ResponseFunc(w, http.StatusNotFound, ans))
+	thread, err := u.ThreadUsecase.GetThreadInfo(r.Context(), slugOrId)
+	if err != nil {
+		response.Process(response.LoggerFunc(err.Error(), logger.ErrorFunc(r.Context(), err)), response.ErrorFunc(w, err))
 		return
 	}
 
-	posts, code, err := u.PostUsecase.CreatePosts(posts, int(thread.Id), thread.Forum)
+	posts, err = u.PostUsecase.CreatePosts(r.Context(), posts, int(thread.Id), thread.Forum)
 	if err != nil {
-		ans := response.ErrorResponse{Err: err.Error()}
-		response.Process(response.LoggerFunc(ans.Error(), log.Println), response.ResponseFunc(w, code, ans))
+		response.Process(response.LoggerFunc(err.Error(), logger.ErrorFunc(r.Context(), err)), response.ErrorFunc(w, err))
 		return
 	}
-	response.Process(response.LoggerFunc("Посты созданы", log.Println), response.ResponseFunc(w, code, posts))
+	response.Process(response.LoggerFunc("Посты созданы", logger.FromContext(r.Context()).Debug), response.ResponseFunc(w, http.StatusCreated, posts))
 }
 
 func (u ThreadDelivery) GetThreadInfo(w http.ResponseWriter, r *http.Request) {
@@ -94,14 +91,13 @@ func (u ThreadDelivery) GetThreadInfo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	thread, ok := u.ThreadUsecase.GetThreadInfo(slugOrId)
-	if !ok {
-		ans := response.ErrorResponse{Err: models.ErrThreadNotfound}
-		response.Process(response.LoggerFunc(ans.Error(), log.Println), response.ResponseFunc(w, http.StatusNotFound, ans))
+	thread, err := u.ThreadUsecase.GetThreadInfo(r.Context(), slugOrId)
+	if err != nil {
+		response.Process(response.LoggerFunc(err.Error(), logger.ErrorFunc(r.Context(), err)), response.ErrorFunc(w, err))
 		return
 	}
 
-	response.Process(response.LoggerFunc("Get info for thread", log.Println), response.ResponseFunc(w, http.StatusOK, thread))
+	response.Process(response.LoggerFunc("Get info for thread", logger.FromContext(r.Context()).Debug), response.ResponseFunc(w, http.StatusOK, thread))
 }
 
 func (u ThreadDelivery) VoteForThread(w http.ResponseWriter, r *http.Request) {
@@ -112,17 +108,17 @@ func (u ThreadDelivery) VoteForThread(w http.ResponseWriter, r *http.Request) {
 
 	vote, err := u.ThreadUsecase.ParseJsonToVote(r.Body)
 	if err != nil {
+		response.Process(response.LoggerFunc(err.Error(), logger.ErrorFunc(r.Context(), err)), response.ErrorFunc(w, err))
 		return
 	}
 
-	thread, ok := u.ThreadUsecase.SetVote(vote, slugOrId)
-	if !ok {
-		ans := response.ErrorResponse{Err: models.ErrThreadNotfound}
-		response.Process(response.LoggerFunc(ans.Error(), log.Println), response.ResponseFunc(w, http.StatusNotFound, ans))
+	thread, err := u.ThreadUsecase.SetVote(r.Context(), vote, slugOrId)
+	if err != nil {
+		response.Process(response.LoggerFunc(err.Error(), logger.ErrorFunc(r.Context(), err)), response.ErrorFunc(w, err))
 		return
 	}
 
-	response.Process(response.LoggerFunc("Add Vote to Thread", log.Println), response.ResponseFunc(w, http.StatusOK, thread))
+	response.Process(response.LoggerFunc("Add Vote to Thread", logger.FromContext(r.Context()).Debug), response.ResponseFunc(w, http.StatusOK, thread))
 
 }
 
@@ -134,16 +130,16 @@ func (u ThreadDelivery) UpdateThread(w http.ResponseWriter, r *http.Request) {
 
 	newThread, err := u.ThreadUsecase.ParseJsonToUpdateThread(r.Body)
 	if err != nil {
+		response.Process(response.LoggerFunc(err.Error(), logger.ErrorFunc(r.Context(), err)), response.ErrorFunc(w, err))
 		return
 	}
 
-	thread, ok := u.ThreadUsecase.UpdateThread(newThread, slugOrId)
-	if !ok {
-		ans := response.ErrorResponse{Err: models.ErrThreadNotfound}
-		response.Process(response.LoggerFunc(ans.Error(), log.Println), response.ResponseFunc(w, http.StatusNotFound, ans))
+	thread, err := u.ThreadUsecase.UpdateThread(r.Context(), newThread, slugOrId)
+	if err != nil {
+		response.Process(response.LoggerFunc(err.Error(), logger.ErrorFunc(r.Context(), err)), response.ErrorFunc(w, err))
 		return
 	}
 
-	response.Process(response.LoggerFunc("Update thread", log.Println), response.ResponseFunc(w, http.StatusOK, thread))
+	response.Process(response.LoggerFunc("Update thread", logger.FromContext(r.Context()).Debug), response.ResponseFunc(w, http.StatusOK, thread))
 
 }
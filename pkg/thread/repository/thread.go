@@ -1,11 +1,13 @@
 package repository
 
 import (
+	"context"
+	"forum/internal/utils/errs"
+	"forum/internal/utils/logger"
+	"forum/internal/utils/pgxtime"
 	"forum/internal/utils/utils"
 	"forum/pkg/models"
 	"github.com/gofrs/uuid"
-	"github.com/jackc/pgx"
-	"log"
 	"strconv"
 )
 
@@ -21,129 +23,125 @@ const (
 	SelectThread           = `SELECT t.id, t.title, t.author, t.forum, t.message, t.votes, t.slug, t.created FROM parkmaildb."Thread" t WHERE t.forum = $1 ORDER BY t.created LIMIT $2`
 	SelectThreadSinceDesc  = `SELECT t.id, t.title, t.author, t.forum, t.message, t.votes, t.slug, t.created FROM parkmaildb."Thread" t WHERE t.forum = $1 AND t.created <= $2 ORDER BY t.created DESC LIMIT $3`
 	SelectThreadSince      = `SELECT t.id, t.title, t.author, t.forum, t.message, t.votes, t.slug, t.created FROM parkmaildb."Thread" t WHERE t.forum = $1 AND t.created >= $2 ORDER BY t.created  LIMIT $3`
-	InsertThread           = `INSERT INTO parkmaildb."Thread" (title, author, forum, message, votes, slug, created) VALUES ($1,(SELECT nickname from parkmaildb."User" where nickname = $2),(SELECT slug from parkmaildb."Forum"  where slug = $3),$4,0,$5,$6) RETURNING id, forum, author, slug`
+	// $2 slug форума или '' для всех форумов; при равной дате порядок по id.
+	SelectThreadsByUserDesc      = `SELECT id, title, author, forum, message, votes, slug, created FROM parkmaildb."Thread" WHERE author = $1 AND ($2::citext = '' OR forum = $2::citext) ORDER BY created DESC, id DESC LIMIT $3`
+	SelectThreadsByUser          = `SELECT id, title, author, forum, message, votes, slug, created FROM parkmaildb."Thread" WHERE author = $1 AND ($2::citext = '' OR forum = $2::citext) ORDER BY created, id LIMIT $3`
+	SelectThreadsByUserSinceDesc = `SELECT id, title, author, forum, message, votes, slug, created FROM parkmaildb."Thread" WHERE author = $1 AND ($2::citext = '' OR forum = $2::citext) AND created <= $3 ORDER BY created DESC, id DESC LIMIT $4`
+	SelectThreadsByUserSince     = `SELECT id, title, author, forum, message, votes, slug, created FROM parkmaildb."Thread" WHERE author = $1 AND ($2::citext = '' OR forum = $2::citext) AND created >= $3 ORDER BY created, id LIMIT $4`
+	InsertThread                 = `INSERT INTO parkmaildb."Thread" (title, author, forum, message, votes, slug, created) VALUES ($1,(SELECT nickname from parkmaildb."User" where nickname = $2),(SELECT slug from parkmaildb."Forum"  where slug = $3),$4,0,$5,$6) RETURNING id, forum, author, slug`
 )
 
 type ThreadRepositoryInterface interface {
-	CreateThread(thread models.Thread) (models.Thread, error)
-	FindThreads(slug string, params models.ParamsForSearch) ([]models.Thread, bool)
-	GetThreadInfoBySlug(slug string) (models.Thread, bool)
-	GetThreadInfoById(id int) (models.Thread, bool)
-	UpdateThread(update models.ThreadUpdate, slugOrId string) (models.Thread, bool)
-	SetVote(vote models.Vote, id int) bool
-	GetThreadIdBySlug(slug string) (int, bool)
+	CreateThread(ctx context.Context, thread models.Thread) (models.Thread, error)
+	FindThreads(ctx context.Context, slug string, params models.ParamsForSearch) ([]models.Thread, error)
+	GetThreadInfoBySlug(ctx context.Context, slug string) (models.Thread, error)
+	GetThreadInfoById(ctx context.Context, id int) (models.Thread, error)
+	UpdateThread(ctx context.Context, update models.ThreadUpdate, slugOrId string) (models.Thread, error)
+	SetVote(ctx context.Context, vote models.Vote, id int) error
+	GetThreadIdBySlug(ctx context.Context, slug string) (int, error)
+	FindThreadsByUser(ctx context.Context, nickname string, params models.UserThreadsParams) ([]models.Thread, error)
 }
 
 type ThreadRepository struct {
-	DB *pgx.ConnPool
+	DB *pgxtime.Pool
 }
 
-func (r ThreadRepository) GetThreadIdBySlug(slug string) (int, bool) {
+func (r ThreadRepository) GetThreadIdBySlug(ctx context.Context, slug string) (int, error) {
 	id := -1
-	err := r.DB.QueryRow("SelectThreadIdBySlug", slug).Scan(&id)
+	err := r.DB.QueryRowEx(ctx, "SelectThreadIdBySlug", nil, slug).Scan(&id)
 	if err != nil {
-		log.Println(err)
-		return -1, false
+		logger.FromContext(ctx).Debug(err)
+		return -1, errs.FromPgx(err, models.ErrThreadNotfound)
 	}
 
-	log.Println(id)
-
-	return id, true
+	return id, nil
 }
 
-func (r ThreadRepository) SetVote(vote models.Vote, id int) bool {
-	_, err := r.DB.Exec("InsertVote", id, vote.Nickname, int32(vote.Voice))
+func (r ThreadRepository) SetVote(ctx context.Context, vote models.Vote, id int) error {
+	_, err := r.DB.ExecEx(ctx, "InsertVote", nil, id, vote.Nickname, int32(vote.Voice))
 	if err == nil {
-		log.Println("Add vote to thread")
-		return true
+		logger.FromContext(ctx).Debug("Add vote to thread")
+		return nil
 	}
 
-	log.Println(err)
-	code := utils.PgxErrorCode(err)
+	logger.FromContext(ctx).Debug(err)
 
 	// duplicate key value violates unique constraint "onlyonevote" (SQLSTATE 23505)
-	if code == "23505" {
-		_, err = r.DB.Exec("UpdateVote", int32(vote.Voice), id, vote.Nickname)
-		if err != nil {
-			return false
-		}
-	}
-
-	if code == "23503" {
-		return false
+	if utils.PgxErrorCode(err) == "23505" {
+		_, err = r.DB.ExecEx(ctx, "UpdateVote", nil, int32(vote.Voice), id, vote.Nickname)
 	}
 
-	return true
+	return errs.FromPgx(err, models.ErrThreadNotfound)
 }
 
-func (r ThreadRepository) UpdateThread(update models.ThreadUpdate, slugOrId string) (models.Thread, bool) {
+func (r ThreadRepository) UpdateThread(ctx context.Context, update models.ThreadUpdate, slugOrId string) (models.Thread, error) {
 	var thread models.Thread
 	id, err := strconv.Atoi(slugOrId)
 	if err != nil {
-		err = r.DB.QueryRow("UpdateThreadSlug", update.Title, update.Message, slugOrId).
+		err = r.DB.QueryRowEx(ctx, "UpdateThreadSlug", nil, update.Title, update.Message, slugOrId).
 			Scan(&thread.Id, &thread.Title, &thread.Author, &thread.Forum, &thread.Message, &thread.Votes, &thread.Slug, &thread.Created)
 	} else {
-		err = r.DB.QueryRow("UpdateThreadId", update.Title, update.Message, id).
+		err = r.DB.QueryRowEx(ctx, "UpdateThreadId", nil, update.Title, update.Message, id).
 			Scan(&thread.Id, &thread.Title, &thread.Author, &thread.Forum, &thread.Message, &thread.Votes, &thread.Slug, &thread.Created)
 	}
 
 	if err != nil {
-		return models.Thread{}, false
+		return models.Thread{}, errs.FromPgx(err, models.ErrThreadNotfound)
 	}
-	return thread, true
+	return thread, nil
 }
 
-func (r ThreadRepository) GetThreadInfoBySlug(slug string) (models.Thread, bool) {
+func (r ThreadRepository) GetThreadInfoBySlug(ctx context.Context, slug string) (models.Thread, error) {
 	var thread models.Thread
-	err := r.DB.QueryRow("SelectThreadInfoBySlug", slug).
+	err := r.DB.QueryRowEx(ctx, "SelectThreadInfoBySlug", nil, slug).
 		Scan(&thread.Id, &thread.Title, &thread.Author, &thread.Forum, &thread.Message, &thread.Votes, &thread.Slug, &thread.Created)
 	if err != nil {
-		return models.Thread{}, false
+		return models.Thread{}, errs.FromPgx(err, models.ErrThreadNotfound)
 	}
 
 	if utils.IsValidUUID(thread.Slug) {
 		thread.Slug = ""
 	}
 
-	return thread, true
+	return thread, nil
 }
 
-func (r ThreadRepository) GetThreadInfoById(id int) (models.Thread, bool) {
+func (r ThreadRepository) GetThreadInfoById(ctx context.Context, id int) (models.Thread, error) {
 	var thread models.Thread
-	err := r.DB.QueryRow("SelectThreadInfoById", id).
+	err := r.DB.QueryRowEx(ctx, "SelectThreadInfoById", nil, id).
 		Scan(&thread.Id, &thread.Title, &thread.Author, &thread.Forum, &thread.Message, &thread.Votes, &thread.Slug, &thread.Created)
 	if err != nil {
-		return models.Thread{}, false
+		return models.Thread{}, errs.FromPgx(err, models.ErrThreadNotfound)
 	}
 
 	if utils.IsValidUUID(thread.Slug) {
 		thread.Slug = ""
 	}
 
-	return thread, true
+	return thread, nil
 }
 
-func (r ThreadRepository) FindThreads(slug string, params models.ParamsForSearch) ([]models.Thread, bool) {
-	var rows *pgx.Rows
+func (r ThreadRepository) FindThreads(ctx context.Context, slug string, params models.ParamsForSearch) ([]models.Thread, error) {
+	var rows *pgxtime.Rows
 	var err error
 
 	if params.Since == "" {
 		if params.Desc {
-			rows, err = r.DB.Query("SelectThreadDesc", slug, params.Limit)
+			rows, err = r.DB.QueryEx(ctx, "SelectThreadDesc", nil, slug, params.Limit)
 		} else {
-			rows, err = r.DB.Query("SelectThread", slug, params.Limit)
+			rows, err = r.DB.QueryEx(ctx, "SelectThread", nil, slug, params.Limit)
 		}
 	} else {
 		if params.Desc {
-			rows, err = r.DB.Query("SelectThreadSinceDesc", slug, params.Since, params.Limit)
+			rows, err = r.DB.QueryEx(ctx, "SelectThreadSinceDesc", nil, slug, params.Since, params.Limit)
 		} else {
-			rows, err = r.DB.Query("SelectThreadSince", slug, params.Since, params.Limit)
+			rows, err = r.DB.QueryEx(ctx, "SelectThreadSince", nil, slug, params.Since, params.Limit)
 		}
 	}
 
 	if err != nil {
-		log.Println(err)
-		return nil, false
+		logger.FromContext(ctx).Debug(err)
+		return nil, errs.FromPgx(err, models.ErrForumNotFound)
 	}
 
 	var threads []models.Thread
@@ -152,9 +150,9 @@ func (r ThreadRepository) FindThreads(slug string, params models.ParamsForSearch
 		var thread models.Thread
 		err := rows.Scan(&thread.Id, &thread.Title, &thread.Author, &thread.Forum, &thread.Message, &thread.Votes, &thread.Slug, &thread.Created)
 		if err != nil {
-			log.Println(err)
+			logger.FromContext(ctx).Debug(err)
 			rows.Close()
-			return nil, false
+			return nil, errs.FromPgx(err, models.ErrForumNotFound)
 		}
 		if utils.IsValidUUID(thread.Slug) {
 			thread.Slug = ""
@@ -163,10 +161,50 @@ func (r ThreadRepository) FindThreads(slug string, params models.ParamsForSearch
 	}
 
 	rows.Close()
-	return threads, true
+	return threads, errs.FromPgx(rows.Err(), models.ErrForumNotFound)
+}
+
+func (r ThreadRepository) FindThreadsByUser(ctx context.Context, nickname string, params models.UserThreadsParams) ([]models.Thread, error) {
+	var rows *pgxtime.Rows
+	var err error
+
+	if params.Since == "" {
+		if params.Desc {
+			rows, err = r.DB.QueryEx(ctx, "SelectThreadsByUserDesc", nil, nickname, params.Forum, params.Limit)
+		} else {
+			rows, err = r.DB.QueryEx(ctx, "SelectThreadsByUser", nil, nickname, params.Forum, params.Limit)
+		}
+	} else {
+		if params.Desc {
+			rows, err = r.DB.QueryEx(ctx, "SelectThreadsByUserSinceDesc", nil, nickname, params.Forum, params.Since, params.Limit)
+		} else {
+			rows, err = r.DB.QueryEx(ctx, "SelectThreadsByUserSince", nil, nickname, params.Forum, params.Since, params.Limit)
+		}
+	}
+
+	if err != nil {
+		logger.FromContext(ctx).Debug(err)
+		return nil, errs.FromPgx(err, models.MissingUser)
+	}
+	defer rows.Close()
+
+	var threads []models.Thread
+	for rows.Next() {
+		var thread models.Thread
+		err = rows.Scan(&thread.Id, &thread.Title, &thread.Author, &thread.Forum, &thread.Message, &thread.Votes, &thread.Slug, &thread.Created)
+		if err != nil {
+			logger.FromContext(ctx).Debug(err)
+			return nil, errs.FromPgx(err, models.MissingUser)
+		}
+		if utils.IsValidUUID(thread.Slug) {
+			thread.Slug = ""
+		}
+		threads = append(threads, thread)
+	}
+	return threads, errs.FromPgx(rows.Err(), models.MissingUser)
 }
 
-func (r *ThreadRepository) CreateThread(thread models.Thread) (models.Thread, error) {
+func (r *ThreadRepository) CreateThread(ctx context.Context, thread models.Thread) (models.Thread, error) {
 	var err error
 
 	if thread.Slug == "" {
@@ -174,11 +212,11 @@ func (r *ThreadRepository) CreateThread(thread models.Thread) (models.Thread, er
 		thread.Slug = gen.String()
 	}
 
-	err = r.DB.QueryRow("InsertThread", thread.Title, thread.Author, thread.Forum, thread.Message, thread.Slug, thread.Created).
+	err = r.DB.QueryRowEx(ctx, "InsertThread", nil, thread.Title, thread.Author, thread.Forum, thread.Message, thread.Slug, thread.Created).
 		Scan(&thread.Id, &thread.Forum, &thread.Author, &thread.Slug)
 
 	if utils.IsValidUUID(thread.Slug) {
 		thread.Slug = ""
 	}
-	return thread, err
+	return thread, errs.FromPgx(err, models.ErrUserUnknown)
 }
@@ -1,71 +1,111 @@
 package usecase
 
 import (
+	"context"
 	"encoding/json"
+	"forum/internal/utils/auth"
+	"forum/internal/utils/errs"
 	"forum/internal/utils/utils"
 	repository2 "forum/pkg/forum/repository"
+	usecase2 "forum/pkg/forum/usecase"
 	"forum/pkg/models"
 	"forum/pkg/thread/repository"
-	"github.com/pkg/errors"
+	"forum/pkg/user/repostitory"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 	"io"
 	"log"
 	"math"
-	"net/http"
 	"strconv"
+	"strings"
 )
 
 type ThreadUsecaseInterface interface {
-	CreateThread(thread models.Thread) (models.Thread, int, error)
+	CreateThread(ctx context.Context, thread models.Thread) (models.Thread, error)
 	ParseJsonToThread(body io.ReadCloser) (models.Thread, error)
-	GetThreadByRequest(body io.ReadCloser, vars map[string]string) (models.Thread, bool)
-	FindThreadsByParams(slug string, params models.ParamsForSearch) ([]models.Thread, bool)
+	GetThreadByRequest(body io.ReadCloser, vars map[string]string) (models.Thread, error)
+	FindThreadsByParams(ctx context.Context, slug string, params models.ParamsForSearch) ([]models.Thread, error)
 	ParseJsonToUpdateThread(body io.ReadCloser) (models.ThreadUpdate, error)
-	UpdateThread(update models.ThreadUpdate, slugOrId string) (models.Thread, bool)
-	SetVote(vote models.Vote, slugOrId string) (models.Thread, bool)
+	UpdateThread(ctx context.Context, update models.ThreadUpdate, slugOrId string) (models.Thread, error)
+	SetVote(ctx context.Context, vote models.Vote, slugOrId string) (models.Thread, error)
 	ParseJsonToVote(body io.ReadCloser) (models.Vote, error)
-	GetThreadInfo(slugOrId string) (models.Thread, bool)
+	GetThreadInfo(ctx context.Context, slugOrId string) (models.Thread, error)
+	FindThreadsByUser(ctx context.Context, nickname string, params models.UserThreadsParams) ([]models.Thread, error)
 }
 
+var votesCast = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "forum_votes_cast_total",
+	Help: "Votes accepted through the API by voice.",
+}, []string{"voice"})
+
 type ThreadUsecase struct {
 	ThreadDB repository.ThreadRepositoryInterface
 	ForumDB  repository2.ForumRepositoryInterface
+	UserDB   repostitory.UserRepositoryInterface
+	// Права на правку чужих веток.
+	Permissions usecase2.Permissions
 }
 
-func (u ThreadUsecase) FindThreadsByParams(slug string, params models.ParamsForSearch) ([]models.Thread, bool) {
-	threads, ok := u.ThreadDB.FindThreads(slug, params)
-	if !ok {
-		return nil, false
+func (u ThreadUsecase) FindThreadsByParams(ctx context.Context, slug string, params models.ParamsForSearch) ([]models.Thread, error) {
+	threads, err := u.ThreadDB.FindThreads(ctx, slug, params)
+	if err != nil {
+		return nil, err
 	}
 
 	if threads == nil {
 		threads = make([]models.Thread, 0)
-		_, ok = u.ForumDB.GetForumInfo(slug)
-		if !ok {
-			return nil, false
+		if _, err = u.ForumDB.GetForumInfo(ctx, slug); err != nil {
+			return nil, err
+		}
+	}
+
+	return threads, nil
+}
+
+func (u ThreadUsecase) FindThreadsByUser(ctx context.Context, nickname string, params models.UserThreadsParams) ([]models.Thread, error) {
+	threads, err := u.ThreadDB.FindThreadsByUser(ctx, nickname, params)
+	if err != nil {
+		return nil, err
+	}
+
+	if threads == nil {
+		user, err := u.UserDB.GetUser(ctx, nickname)
+		if err != nil {
+			return nil, err
+		}
+		// nickname мог оказаться старым псевдонимом пользователя
+		if !strings.EqualFold(user.Nickname, nickname) {
+			return u.FindThreadsByUser(ctx, user.Nickname, params)
 		}
+		threads = make([]models.Thread, 0)
 	}
 
-	return threads, true
+	return threads, nil
 }
 
-func (u ThreadUsecase) CreateThread(thread models.Thread) (models.Thread, int, error) {
-	insertedThread, err := u.ThreadDB.CreateThread(thread)
+// CreateThread при конфликте slug возвращает уже существующую ветку вместе с ошибкой KindConflict.
+func (u ThreadUsecase) CreateThread(ctx context.Context, thread models.Thread) (models.Thread, error) {
+	var err error
+	if thread.Author, err = u.Permissions.CheckAuthor(ctx, thread.Author); err != nil {
+		return models.Thread{}, err
+	}
+
+	insertedThread, err := u.ThreadDB.CreateThread(ctx, thread)
 	if err == nil {
-		return insertedThread, http.StatusCreated, nil
+		return insertedThread, nil
 	}
 
 	log.Println(err)
-	code := utils.PgxErrorCode(err)
-	if code == "23503" { //ошибка отсутствия c юзером/форумом
-		return models.Thread{}, http.StatusNotFound, errors.New(models.ErrUserUnknown)
+	if !errs.Is(err, errs.KindConflict) { //ошибка отсутствия c юзером/форумом
+		return models.Thread{}, err
 	}
 
-	thread, ok := u.ThreadDB.GetThreadInfoBySlug(thread.Slug)
-	if !ok {
-		return models.Thread{}, http.StatusNotFound, errors.New(models.ErrForumNotFound)
+	existing, err := u.ThreadDB.GetThreadInfoBySlug(ctx, thread.Slug)
+	if err != nil {
+		return models.Thread{}, err
 	}
 
-	return thread, http.StatusConflict, nil
+	return existing, errs.Conflict(models.ErrThreadExists)
 }
 
 func (u ThreadUsecase) ParseJsonToThread(body io.ReadCloser) (models.Thread, error) {
@@ -77,38 +117,50 @@ func (u ThreadUsecase) ParseJsonToThread(body io.ReadCloser) (models.Thread, err
 
 	if err != nil {
 		log.Println(err)
+		return thread, errs.Wrap(errs.KindInvalid, models.ErrBadBody, err)
 	}
 
 	thread.Votes = 0
-	return thread, err
+	return thread, nil
 }
 
-func (u ThreadUsecase) GetThreadByRequest(body io.ReadCloser, vars map[string]string) (models.Thread, bool) {
+func (u ThreadUsecase) GetThreadByRequest(body io.ReadCloser, vars map[string]string) (models.Thread, error) {
 	thread, err := u.ParseJsonToThread(body)
 	if err != nil {
-		return models.Thread{}, false
+		return models.Thread{}, err
 	}
 
 	var ok bool
 	thread.Forum, ok = utils.GetDataFromPath("slug", vars)
 	if !ok {
-		return models.Thread{}, false
+		return models.Thread{}, errs.Invalid("Can't parse forum slug from url")
 	}
 
-	return thread, true
+	return thread, nil
 }
 
-func (u ThreadUsecase) GetThreadInfo(slugOrId string) (models.Thread, bool) {
+func (u ThreadUsecase) GetThreadInfo(ctx context.Context, slugOrId string) (models.Thread, error) {
 	id, err := strconv.Atoi(slugOrId)
 	if err != nil {
-		return u.ThreadDB.GetThreadInfoBySlug(slugOrId)
+		return u.ThreadDB.GetThreadInfoBySlug(ctx, slugOrId)
 	}
 
-	return u.ThreadDB.GetThreadInfoById(id)
+	return u.ThreadDB.GetThreadInfoById(ctx, id)
 }
 
-func (u ThreadUsecase) UpdateThread(update models.ThreadUpdate, slugOrId string) (models.Thread, bool) {
-	return u.ThreadDB.UpdateThread(update, slugOrId)
+// UpdateThread меняет ветку; аутентифицированный пользователь может править
+// только свои ветки, если он не модератор форума.
+func (u ThreadUsecase) UpdateThread(ctx context.Context, update models.ThreadUpdate, slugOrId string) (models.Thread, error) {
+	if _, ok := auth.FromContext(ctx); ok {
+		thread, err := u.GetThreadInfo(ctx, slugOrId)
+		if err != nil {
+			return models.Thread{}, err
+		}
+		if err = u.Permissions.CheckEdit(ctx, thread.Forum, thread.Author); err != nil {
+			return models.Thread{}, err
+		}
+	}
+	return u.ThreadDB.UpdateThread(ctx, update, slugOrId)
 }
 
 func (u ThreadUsecase) ParseJsonToUpdateThread(body io.ReadCloser) (models.ThreadUpdate, error) {
@@ -120,9 +172,10 @@ func (u ThreadUsecase) ParseJsonToUpdateThread(body io.ReadCloser) (models.Threa
 
 	if err != nil {
 		log.Println(err)
+		return thread, errs.Wrap(errs.KindInvalid, models.ErrBadBody, err)
 	}
 
-	return thread, err
+	return thread, nil
 }
 
 func (u ThreadUsecase) ParseJsonToVote(body io.ReadCloser) (models.Vote, error) {
@@ -134,36 +187,36 @@ func (u ThreadUsecase) ParseJsonToVote(body io.ReadCloser) (models.Vote, error)
 
 	if err != nil {
 		log.Println(err)
+		return vote, errs.Wrap(errs.KindInvalid, models.ErrBadBody, err)
 	}
 
 	if math.Abs(float64(vote.Voice)) != 1 {
-		err = errors.New("Voice Can be only -1 or 1")
+		err = errs.Invalid("Voice Can be only -1 or 1")
 		log.Println(err)
 		return vote, err
 	}
 
-	return vote, err
+	return vote, nil
 }
 
-func (u ThreadUsecase) SetVote(vote models.Vote, slugOrId string) (models.Thread, bool) {
+func (u ThreadUsecase) SetVote(ctx context.Context, vote models.Vote, slugOrId string) (models.Thread, error) {
+	var err error
+	if vote.Nickname, err = u.Permissions.CheckAuthor(ctx, vote.Nickname); err != nil {
+		return models.Thread{}, err
+	}
+
 	id, err := strconv.Atoi(slugOrId)
 	if err != nil {
-		var ok bool
-		id, ok = u.ThreadDB.GetThreadIdBySlug(slugOrId)
-		if !ok {
-			return models.Thread{}, false
+		id, err = u.ThreadDB.GetThreadIdBySlug(ctx, slugOrId)
+		if err != nil {
+			return models.Thread{}, err
 		}
 	}
 
-	ok := u.ThreadDB.SetVote(vote, id)
-	if !ok {
-		return models.Thread{}, false
-	}
-
-	thread, ok := u.ThreadDB.GetThreadInfoById(id)
-	if !ok {
-		return models.Thread{}, false
+	if err = u.ThreadDB.SetVote(ctx, vote, id); err != nil {
+		return models.Thread{}, err
 	}
+	votesCast.WithLabelValues(strconv.Itoa(int(vote.Voice))).Inc()
 
-	return thread, true
+	return u.ThreadDB.GetThreadInfoById(ctx, id)
 }
@@ -1,45 +1,74 @@
 package delivery
 
 import (
+	"forum/internal/utils/errs"
+	"forum/internal/utils/logger"
 	response "forum/internal/utils/response"
 	"forum/internal/utils/utils"
 	"forum/pkg/models"
+	usecase2 "forum/pkg/post/usecase"
+	usecase3 "forum/pkg/thread/usecase"
 	"forum/pkg/user/usecase"
 	"github.com/gorilla/mux"
-	"log"
+	"io"
+	"mime"
 	"net/http"
+	"strconv"
 )
 
 func (u UserDeliveryStruct) SetHandlersForUsers(router *mux.Router) {
 	router.HandleFunc("/user/{nickname}/create", u.CreateUser).Methods(http.MethodPost)
 	router.HandleFunc("/user/{nickname}/profile", u.GetUser).Methods(http.MethodGet)
 	router.HandleFunc("/user/{nickname}/profile", u.ChangeUser).Methods(http.MethodPost)
+	router.HandleFunc("/user/{nickname}/profile", u.DeleteUser).Methods(http.MethodDelete)
+	router.HandleFunc("/user/{nickname}/rename", u.RenameUser).Methods(http.MethodPost)
+	router.HandleFunc("/user/{nickname}/login", u.Login).Methods(http.MethodPost)
+	router.HandleFunc("/user/{nickname}/export", u.ExportUser).Methods(http.MethodGet)
+	router.HandleFunc("/user/{nickname}/stats", u.GetUserStats).Methods(http.MethodGet)
+	router.HandleFunc("/user/{nickname}/posts", u.GetUserPosts).Methods(http.MethodGet)
+	router.HandleFunc("/user/{nickname}/threads", u.GetUserThreads).Methods(http.MethodGet)
+	router.HandleFunc("/users", u.GetUsers).Methods(http.MethodGet)
 }
 
 type UserDeliveryInterface interface {
 	CreateUser(w http.ResponseWriter, r *http.Request)
 	GetUser(w http.ResponseWriter, r *http.Request)
 	ChangeUser(w http.ResponseWriter, r *http.Request)
+	GetUsers(w http.ResponseWriter, r *http.Request)
+	GetUserStats(w http.ResponseWriter, r *http.Request)
+	GetUserPosts(w http.ResponseWriter, r *http.Request)
+	GetUserThreads(w http.ResponseWriter, r *http.Request)
+	RenameUser(w http.ResponseWriter, r *http.Request)
+	DeleteUser(w http.ResponseWriter, r *http.Request)
+	ExportUser(w http.ResponseWriter, r *http.Request)
+	Login(w http.ResponseWriter, r *http.Request)
 }
 
 type UserDeliveryStruct struct {
-	Usecase usecase.UserUsecaseInterface
+	Usecase       usecase.UserUsecaseInterface
+	PostUsecase   usecase2.PostUsecaseInterface
+	ThreadUsecase usecase3.ThreadUsecaseInterface
 }
 
 func (u *UserDeliveryStruct) CreateUser(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 	user, err := u.Usecase.GetUserByRequest(r.Body, mux.Vars(r))
 	if err != nil {
+		response.Process(response.LoggerFunc(err.Error(), logger.ErrorFunc(r.Context(), err)), response.ErrorFunc(w, err))
 		return
 	}
 
-	Newuser, ok := u.Usecase.CreateUser(user)
-	if !ok {
-		response.Process(response.LoggerFunc("Пользователь уже есть", log.Println), response.ResponseFunc(w, http.StatusConflict, Newuser))
+	Newuser, err := u.Usecase.CreateUser(r.Context(), user)
+	if errs.Is(err, errs.KindConflict) {
+		response.Process(response.LoggerFunc("Пользователь уже есть", logger.FromContext(r.Context()).Debug), response.ResponseFunc(w, http.StatusConflict, Newuser))
+		return
+	}
+	if err != nil {
+		response.Process(response.LoggerFunc(err.Error(), logger.ErrorFunc(r.Context(), err)), response.ErrorFunc(w, err))
 		return
 	}
 
-	response.Process(response.LoggerFunc("Создан пользователь", log.Println), response.ResponseFunc(w, http.StatusCreated, Newuser[0]))
+	response.Process(response.LoggerFunc("Создан пользователь", logger.FromContext(r.Context()).Debug), response.ResponseFunc(w, http.StatusCreated, Newuser[0]))
 }
 
 func (u UserDeliveryStruct) GetUser(w http.ResponseWriter, r *http.Request) {
@@ -48,30 +77,196 @@ func (u UserDeliveryStruct) GetUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := u.Usecase.GetUserByNickName(nickname)
+	user, err := u.Usecase.GetUserByNickName(r.Context(), nickname)
 	if err != nil {
-		responseError := response.ErrorResponse{Err: models.MissingUser}
-		response.Process(response.LoggerFunc(responseError.Error(), log.Println), response.ResponseFunc(w, http.StatusNotFound, responseError))
+		response.Process(response.LoggerFunc(err.Error(), logger.ErrorFunc(r.Context(), err)), response.ErrorFunc(w, err))
 		return
 	}
 
-	response.Process(response.LoggerFunc("Success get User", log.Println), response.ResponseFunc(w, http.StatusOK, user))
+	response.Process(response.LoggerFunc("Success get User", logger.FromContext(r.Context()).Debug), response.ResponseFunc(w, http.StatusOK, user))
 }
 
 func (u UserDeliveryStruct) ChangeUser(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 	user, err := u.Usecase.GetUserByRequest(r.Body, mux.Vars(r))
 	if err != nil {
+		response.Process(response.LoggerFunc(err.Error(), logger.ErrorFunc(r.Context(), err)), response.ErrorFunc(w, err))
 		return
 	}
 
 	user = u.Usecase.CheckUserFields(user)
-	user, code, err := u.Usecase.ChangeUser(user)
+	user, err = u.Usecase.ChangeUser(r.Context(), user)
+	if err != nil {
+		response.Process(response.LoggerFunc(err.Error(), logger.ErrorFunc(r.Context(), err)), response.ErrorFunc(w, err))
+		return
+	}
+
+	response.Process(response.LoggerFunc("Success Change User", logger.FromContext(r.Context()).Debug), response.ResponseFunc(w, http.StatusOK, user))
+}
+
+// RenameUser меняет nickname; занятый nickname даёт 409, как и занятый email в ChangeUser.
+func (u UserDeliveryStruct) RenameUser(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	nickname, ok := utils.GetDataFromPath("nickname", mux.Vars(r))
+	if !ok {
+		return
+	}
+
+	rename, err := u.Usecase.ParseJsonToUserRename(r.Body)
+	if err != nil {
+		response.Process(response.LoggerFunc(err.Error(), logger.ErrorFunc(r.Context(), err)), response.ErrorFunc(w, err))
+		return
+	}
+
+	user, err := u.Usecase.RenameUser(r.Context(), nickname, rename)
+	if err != nil {
+		response.Process(response.LoggerFunc(err.Error(), logger.ErrorFunc(r.Context(), err)), response.ErrorFunc(w, err))
+		return
+	}
+
+	response.Process(response.LoggerFunc("Success Rename User", logger.FromContext(r.Context()).Debug), response.ResponseFunc(w, http.StatusOK, user))
+}
+
+func (u UserDeliveryStruct) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	nickname, ok := utils.GetDataFromPath("nickname", mux.Vars(r))
+	if !ok {
+		return
+	}
+
+	if err := u.Usecase.DeleteUser(r.Context(), nickname); err != nil {
+		response.Process(response.LoggerFunc(err.Error(), logger.ErrorFunc(r.Context(), err)), response.ErrorFunc(w, err))
+		return
+	}
+
+	logger.FromContext(r.Context()).Debug("Success Delete User")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ExportUser отдаёт ZIP-архив с данными пользователя. Архив пишется в ответ по
+// мере чтения из базы, поэтому ошибка посреди выгрузки только обрывает ответ.
+func (u UserDeliveryStruct) ExportUser(w http.ResponseWriter, r *http.Request) {
+	nickname, ok := utils.GetDataFromPath("nickname", mux.Vars(r))
+	if !ok {
+		return
+	}
+
+	started := false
+	err := u.Usecase.ExportUser(r.Context(), nickname, func(user models.User) io.Writer {
+		started = true
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": user.Nickname + ".zip"}))
+		w.WriteHeader(http.StatusOK)
+		return w
+	})
+	if err != nil && !started {
+		response.Process(response.LoggerFunc(err.Error(), logger.ErrorFunc(r.Context(), err)), response.ErrorFunc(w, err))
+		return
+	}
+	if err != nil {
+		logger.ErrorFunc(r.Context(), err)(err.Error())
+		return
+	}
+
+	logger.FromContext(r.Context()).Debug("Success Export User")
+}
+
+// GetUsers список всех пользователей по nickname; общее число подходящих
+// отдаётся в заголовке X-Total-Count.
+func (u UserDeliveryStruct) GetUsers(w http.ResponseWriter, r *http.Request) {
+	params, err := utils.ParseJsonToUserSearch(r.URL.Query())
 	if err != nil {
-		responseError := response.ErrorResponse{Err: models.MissingUser}
-		response.Process(response.LoggerFunc(responseError.Error(), log.Println), response.ResponseFunc(w, code, responseError))
+		response.Process(response.LoggerFunc(err.Error(), logger.ErrorFunc(r.Context(), err)), response.ErrorFunc(w, err))
 		return
 	}
 
-	response.Process(response.LoggerFunc("Success Change User", log.Println), response.ResponseFunc(w, http.StatusOK, user))
+	users, total, err := u.Usecase.FindUsers(r.Context(), params)
+	if err != nil {
+		response.Process(response.LoggerFunc(err.Error(), logger.ErrorFunc(r.Context(), err)), response.ErrorFunc(w, err))
+		return
+	}
+
+	if users == nil {
+		users = make([]models.User, 0)
+	}
+
+	w.Header().Set(response.TotalCountHeader, strconv.FormatInt(total, 10))
+	response.Process(response.LoggerFunc("Return users", logger.FromContext(r.Context()).Debug), response.ResponseFunc(w, http.StatusOK, users))
+}
+
+func (u UserDeliveryStruct) GetUserStats(w http.ResponseWriter, r *http.Request) {
+	nickname, ok := utils.GetDataFromPath("nickname", mux.Vars(r))
+	if !ok {
+		return
+	}
+
+	stats, err := u.Usecase.GetUserStats(r.Context(), nickname)
+	if err != nil {
+		response.Process(response.LoggerFunc(err.Error(), logger.ErrorFunc(r.Context(), err)), response.ErrorFunc(w, err))
+		return
+	}
+
+	response.Process(response.LoggerFunc("Return user stats", logger.FromContext(r.Context()).Debug), response.ResponseFunc(w, http.StatusOK, stats))
+}
+
+func (u UserDeliveryStruct) GetUserPosts(w http.ResponseWriter, r *http.Request) {
+	nickname, ok := utils.GetDataFromPath("nickname", mux.Vars(r))
+	if !ok {
+		return
+	}
+
+	params, err := utils.ParseJsonToUserPostsParams(r.URL.Query())
+	if err != nil {
+		response.Process(response.LoggerFunc(err.Error(), logger.ErrorFunc(r.Context(), err)), response.ErrorFunc(w, err))
+		return
+	}
+
+	posts, err := u.PostUsecase.FindPostsByUser(r.Context(), nickname, params)
+	if err != nil {
+		response.Process(response.LoggerFunc(err.Error(), logger.ErrorFunc(r.Context(), err)), response.ErrorFunc(w, err))
+		return
+	}
+
+	response.Process(response.LoggerFunc("Return posts by user", logger.FromContext(r.Context()).Debug), response.ResponseFunc(w, http.StatusOK, posts))
+}
+
+func (u UserDeliveryStruct) GetUserThreads(w http.ResponseWriter, r *http.Request) {
+	nickname, ok := utils.GetDataFromPath("nickname", mux.Vars(r))
+	if !ok {
+		return
+	}
+
+	params, err := utils.ParseJsonToUserThreadsParams(r.URL.Query())
+	if err != nil {
+		response.Process(response.LoggerFunc(err.Error(), logger.ErrorFunc(r.Context(), err)), response.ErrorFunc(w, err))
+		return
+	}
+
+	threads, err := u.ThreadUsecase.FindThreadsByUser(r.Context(), nickname, params)
+	if err != nil {
+		response.Process(response.LoggerFunc(err.Error(), logger.ErrorFunc(r.Context(), err)), response.ErrorFunc(w, err))
+		return
+	}
+
+	response.Process(response.LoggerFunc("Return threads by user", logger.FromContext(r.Context()).Debug), response.ResponseFunc(w, http.StatusOK, threads))
+}
+
+func (u UserDeliveryStruct) Login(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	nickname, ok := utils.GetDataFromPath("nickname", mux.Vars(r))
+	if !ok {
+		return
+	}
+
+	login, err := u.Usecase.ParseJsonToUserLogin(r.Body)
+	if err != nil {
+		response.Process(response.LoggerFunc(err.Error(), logger.ErrorFunc(r.Context(), err)), response.ErrorFunc(w, err))
+		return
+	}
+
+	session, err := u.Usecase.Login(r.Context(), nickname, login)
+	if err != nil {
+		response.Process(response.LoggerFunc(err.Error(), logger.ErrorFunc(r.Context(), err)), response.ErrorFunc(w, err))
+		return
+	}
+	response.Process(response.LoggerFunc("Success Login", logger.FromContext(r.Context()).Debug), response.ResponseFunc(w, http.StatusOK, session))
 }
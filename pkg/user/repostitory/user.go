@@ -1,43 +1,150 @@
 package repostitory
 
 import (
+	"context"
+	"forum/internal/utils/errs"
+	"forum/internal/utils/logger"
+	"forum/internal/utils/pgxtime"
+	"forum/internal/utils/utils"
 	"forum/pkg/models"
-	"github.com/jackc/pgx"
 	_ "github.com/jackc/pgx"
+	"github.com/jackc/pgx/pgtype"
 	_ "github.com/jackc/pgx/stdlib"
-	"log"
+	"time"
 )
 
 type UserRepositoryInterface interface {
-	AddUser(user models.User) ([]models.User, bool)
-	GetUser(nickname string) (models.User, error)
-	ChangeUser(user models.User) (models.User, error)
+	AddUser(ctx context.Context, user models.User) ([]models.User, error)
+	GetUser(ctx context.Context, nickname string) (models.User, error)
+	// GetUserCredentials как GetUser, но с PasswordHash.
+	GetUserCredentials(ctx context.Context, nickname string) (models.User, error)
+	ChangeUser(ctx context.Context, user models.User) (models.User, error)
+	FindUsers(ctx context.Context, params models.UserSearch) ([]models.User, error)
+	CountUsers(ctx context.Context, query string) (int64, error)
+	GetUserStats(ctx context.Context, nickname string) (models.UserStats, error)
+	RenameUser(ctx context.Context, nickname string, newNickname string, aliasExpires time.Time) (models.User, error)
+	DeleteUser(ctx context.Context, nickname string) error
+	// Export* передают записи пользователя в fn по одной, не собирая выборку в память.
+	ExportThreads(ctx context.Context, nickname string, fn func(models.Thread) error) error
+	ExportPosts(ctx context.Context, nickname string, fn func(models.UserExportPost) error) error
+	ExportVotes(ctx context.Context, nickname string, fn func(models.UserExportVote) error) error
+	ExportForums(ctx context.Context, nickname string, fn func(models.Forum) error) error
+	// IsAdmin проверяет роль администратора сайта по текущему nickname, псевдонимы не учитываются.
+	IsAdmin(ctx context.Context, nickname string) (bool, error)
+	// SetAdmin выдаёт или снимает роль администратора; NotFound, если пользователя нет.
+	SetAdmin(ctx context.Context, nickname string, admin bool) error
+	FindAdmins(ctx context.Context) ([]models.User, error)
 }
 
 type UserRepository struct {
-	DB *pgx.ConnPool
+	DB *pgxtime.Pool
 }
 
 const (
-	InsertUser = `INSERT INTO parkmaildb."User" (nickname, fullname, about, email) VALUES ($1, $2, $3, $4)`
-	SelectUser = `SELECT nickname, fullname, about, email FROM parkmaildb."User" WHERE nickname = $1 OR email = $2`
-	UpdateUser = `UPDATE parkmaildb."User" 
-					SET fullname = COALESCE(NULLIF($1, ''), fullname), about = COALESCE(NULLIF($2, ''), about), email = COALESCE(NULLIF($3, ''), email)
-					WHERE nickname = $4 
-					RETURNING nickname, fullname, about, email`
-	SelectUserByNick = `SELECT u.nickname, u.fullname, u.about, u.email FROM parkmaildb."User" u WHERE u.nickname = $1`
+	// Хэш пароля $5 записывается тем же запросом, если он не пустой.
+	InsertUser = `WITH u AS (
+						INSERT INTO parkmaildb."User" (nickname, fullname, about, email) VALUES ($1, $2, $3, $4) RETURNING nickname
+					)
+					INSERT INTO parkmaildb."User_password" (nickname, hash) SELECT nickname, $5 FROM u WHERE $5 <> ''`
+	// Вместе с владельцем nickname и email возвращает пользователя, чей
+	// действующий псевдоним $1 (drop_user_alias из миграции 0015).
+	SelectUser = `SELECT nickname, fullname, about, email FROM parkmaildb."User"
+					WHERE nickname = $1 OR email = $2
+						OR nickname = (SELECT a.nickname FROM parkmaildb."User_alias" a WHERE a.alias = $1 AND a.expires > now())`
+	UpdateUser = `WITH u AS (
+						UPDATE parkmaildb."User"
+						SET fullname = COALESCE(NULLIF($1, ''), fullname), about = COALESCE(NULLIF($2, ''), about), email = COALESCE(NULLIF($3, ''), email)
+						WHERE nickname = $4
+						RETURNING nickname, fullname, about, email
+					), p AS (
+						INSERT INTO parkmaildb."User_password" (nickname, hash) SELECT nickname, $5 FROM u WHERE $5 <> ''
+						ON CONFLICT (nickname) DO UPDATE SET hash = excluded.hash
+					)
+					SELECT nickname, fullname, about, email FROM u`
+	// Старый nickname после переименования находит пользователя, пока не истёк псевдоним.
+	SelectUserByNick = `SELECT u.nickname, u.fullname, u.about, u.email FROM parkmaildb."User" u
+					WHERE u.nickname = COALESCE((SELECT a.nickname FROM parkmaildb."User_alias" a WHERE a.alias = $1 AND a.expires > now()), $1)`
+	SelectUserCredentials = `SELECT u.nickname, u.fullname, u.about, u.email, COALESCE(p.hash, '') FROM parkmaildb."User" u
+					LEFT JOIN parkmaildb."User_password" p ON p.nickname = u.nickname
+					WHERE u.nickname = COALESCE((SELECT a.nickname FROM parkmaildb."User_alias" a WHERE a.alias = $1 AND a.expires > now()), $1)`
+	// $1 шаблон из utils.LikePrefix, $2 nickname с предыдущей страницы или ''.
+	SelectUsers = `SELECT nickname, fullname, about, email FROM parkmaildb."User"
+					WHERE (lower(nickname::text) LIKE $1 OR lower(fullname) LIKE $1) AND ($2::citext = '' OR nickname > $2::citext)
+					ORDER BY nickname LIMIT $3`
+	SelectUsersDesc = `SELECT nickname, fullname, about, email FROM parkmaildb."User"
+					WHERE (lower(nickname::text) LIKE $1 OR lower(fullname) LIKE $1) AND ($2::citext = '' OR nickname < $2::citext)
+					ORDER BY nickname DESC LIMIT $3`
+	CountUsers      = `SELECT COUNT(*) FROM parkmaildb."User" WHERE lower(nickname::text) LIKE $1 OR lower(fullname) LIKE $1`
+	SelectUserStats = `SELECT u.nickname,
+					(SELECT COUNT(*) FROM parkmaildb."Post" p WHERE p.author = u.nickname),
+					(SELECT COUNT(*) FROM parkmaildb."Thread" t WHERE t.author = u.nickname),
+					(SELECT COUNT(*) FROM parkmaildb."Vote" v WHERE v."user" = u.nickname),
+					(SELECT COALESCE(SUM(t.votes), 0) FROM parkmaildb."Thread" t WHERE t.author = u.nickname),
+					(SELECT COUNT(*) FROM parkmaildb."Users_by_Forum" f WHERE f."user" = u.nickname),
+					LEAST((SELECT MIN(p.created) FROM parkmaildb."Post" p WHERE p.author = u.nickname),
+						(SELECT MIN(t.created) FROM parkmaildb."Thread" t WHERE t.author = u.nickname)),
+					GREATEST((SELECT MAX(p.created) FROM parkmaildb."Post" p WHERE p.author = u.nickname),
+						(SELECT MAX(t.created) FROM parkmaildb."Thread" t WHERE t.author = u.nickname))
+					FROM parkmaildb."User" u WHERE u.nickname = $1`
+	// Внешние ключи на nickname объявлены с ON UPDATE CASCADE (миграция 0006),
+	// поэтому одно обновление "User" переименовывает автора во всех таблицах.
+	RenameUser = `WITH renamed AS (
+					UPDATE parkmaildb."User" SET nickname = $2 WHERE nickname = $1 RETURNING nickname, fullname, about, email
+				), alias AS (
+					INSERT INTO parkmaildb."User_alias" (alias, nickname, expires)
+					SELECT $1::citext, nickname, $3::timestamptz FROM renamed WHERE nickname <> $1::citext
+					ON CONFLICT (alias) DO UPDATE SET nickname = EXCLUDED.nickname, expires = EXCLUDED.expires
+				)
+				SELECT nickname, fullname, about, email FROM renamed`
+	// delete_user из миграции 0007.
+	DeleteUser = `SELECT delete_user($1, $2, $3, $4)`
+
+	ExportUserThreads = `SELECT id, title, author, forum, message, votes, slug, created FROM parkmaildb."Thread"
+					WHERE author = $1 ORDER BY created, id`
+	ExportUserPosts = `SELECT p.id, p.parent, p.author, p.message, p.isedited, p.forum, p.thread, p.created, t.title, t.slug, f.title
+					FROM parkmaildb."Post" p
+					JOIN parkmaildb."Thread" t ON t.id = p.thread
+					JOIN parkmaildb."Forum" f ON f.slug = p.forum
+					WHERE p.author = $1 ORDER BY p.id`
+	ExportUserVotes = `SELECT v.threadid, t.slug, t.forum, v.value FROM parkmaildb."Vote" v
+					JOIN parkmaildb."Thread" t ON t.id = v.threadid
+					WHERE v."user" = $1 ORDER BY v.threadid`
+	ExportUserForums = `SELECT f.title, f."user", f.slug, f.posts, f.threads FROM parkmaildb."Users_by_Forum" uf
+					JOIN parkmaildb."Forum" f ON f.slug = uf.forum
+					WHERE uf."user" = $1 ORDER BY f.slug`
+
+	SelectIsAdmin = `SELECT EXISTS (SELECT 1 FROM parkmaildb."User_admin" WHERE nickname = $1)`
+	InsertAdmin   = `WITH u AS (
+						SELECT nickname FROM parkmaildb."User" WHERE nickname = $1
+					), a AS (
+						INSERT INTO parkmaildb."User_admin" (nickname) SELECT nickname FROM u ON CONFLICT DO NOTHING
+					)
+					SELECT nickname FROM u`
+	DeleteAdmin = `WITH u AS (
+						SELECT nickname FROM parkmaildb."User" WHERE nickname = $1
+					), a AS (
+						DELETE FROM parkmaildb."User_admin" WHERE nickname IN (SELECT nickname FROM u)
+					)
+					SELECT nickname FROM u`
+	SelectAdmins = `SELECT u.nickname, u.fullname, u.about, u.email FROM parkmaildb."User_admin" a
+					JOIN parkmaildb."User" u ON u.nickname = a.nickname ORDER BY u.nickname`
 )
 
-func (u *UserRepository) AddUser(user models.User) ([]models.User, bool) {
-	_, err := u.DB.Exec("InsertUser", user.Nickname, user.Fullname, user.About, user.Email)
+func (u *UserRepository) AddUser(ctx context.Context, user models.User) ([]models.User, error) {
+	_, err := u.DB.ExecEx(ctx, "InsertUser", nil, user.Nickname, user.Fullname, user.About, user.Email, user.PasswordHash)
 	if err == nil {
-		return []models.User{user}, true
+		return []models.User{user}, nil
+	}
+
+	logger.FromContext(ctx).Debug(err)
+	if utils.PgxErrorCode(err) != "23505" {
+		return nil, errs.FromPgx(err, models.MissingUser)
 	}
 
-	log.Println(err)
-	rows, err := u.DB.Query("SelectUser", user.Nickname, user.Email)
+	rows, err := u.DB.QueryEx(ctx, "SelectUser", nil, user.Nickname, user.Email)
 	if err != nil {
-		log.Println(err)
+		logger.FromContext(ctx).Debug(err)
+		return nil, errs.FromPgx(err, models.MissingUser)
 	}
 
 	var users []models.User
@@ -45,40 +152,253 @@ func (u *UserRepository) AddUser(user models.User) ([]models.User, bool) {
 	for rows.Next() {
 		newUser := models.User{}
 		err = rows.Scan(&newUser.Nickname, &newUser.Fullname, &newUser.About, &newUser.Email)
-		users = append(users, newUser)
 		if err != nil {
 			rows.Close()
-			return []models.User{}, false
+			return nil, errs.FromPgx(err, models.MissingUser)
 		}
+		users = append(users, newUser)
 	}
 
 	rows.Close()
-	return users, false
+	return users, errs.Conflict(models.ErrUserExists)
 }
 
-func (u *UserRepository) ChangeUser(user models.User) (models.User, error) {
+func (u *UserRepository) ChangeUser(ctx context.Context, user models.User) (models.User, error) {
 	var newUser models.User
 
-	err := u.DB.QueryRow("UpdateUser",
-		user.Fullname, user.About, user.Email, user.Nickname).
+	err := u.DB.QueryRowEx(ctx, "UpdateUser", nil,
+		user.Fullname, user.About, user.Email, user.Nickname, user.PasswordHash).
 		Scan(&newUser.Nickname, &newUser.Fullname, &newUser.About, &newUser.Email)
 
 	if err != nil {
-		log.Println(err)
-		return models.User{}, err
+		logger.FromContext(ctx).Debug(err)
+		if utils.PgxErrorCode(err) == "23505" {
+			return models.User{}, errs.Wrap(errs.KindConflict, models.ErrUserEmail, err)
+		}
+		return models.User{}, errs.FromPgx(err, models.MissingUser)
 	}
 
 	return newUser, nil
 }
 
-func (u UserRepository) GetUser(nickname string) (models.User, error) {
+func (u UserRepository) GetUser(ctx context.Context, nickname string) (models.User, error) {
 	var user models.User = models.User{Nickname: nickname}
 
-	err := u.DB.QueryRow("SelectUserByNick", nickname).Scan(&user.Nickname, &user.Fullname, &user.About, &user.Email)
+	err := u.DB.QueryRowEx(ctx, "SelectUserByNick", nil, nickname).Scan(&user.Nickname, &user.Fullname, &user.About, &user.Email)
+	if err != nil {
+		logger.FromContext(ctx).Debug(err)
+		return models.User{}, errs.FromPgx(err, models.MissingUser)
+	}
+
+	return user, nil
+}
+
+func (u UserRepository) GetUserCredentials(ctx context.Context, nickname string) (models.User, error) {
+	var user models.User
+
+	err := u.DB.QueryRowEx(ctx, "SelectUserCredentials", nil, nickname).
+		Scan(&user.Nickname, &user.Fullname, &user.About, &user.Email, &user.PasswordHash)
+	if err != nil {
+		logger.FromContext(ctx).Debug(err)
+		return models.User{}, errs.FromPgx(err, models.MissingUser)
+	}
+
+	return user, nil
+}
+
+func (u UserRepository) FindUsers(ctx context.Context, params models.UserSearch) ([]models.User, error) {
+	query := "SelectUsers"
+	if params.Desc {
+		query = "SelectUsersDesc"
+	}
+
+	rows, err := u.DB.QueryEx(ctx, query, nil, utils.LikePrefix(params.Query), params.Since, params.Limit)
+	if err != nil {
+		logger.FromContext(ctx).Debug(err)
+		return nil, errs.FromPgx(err, models.MissingUser)
+	}
+	defer rows.Close()
+
+	var users []models.User
+	for rows.Next() {
+		var user models.User
+		if err = rows.Scan(&user.Nickname, &user.Fullname, &user.About, &user.Email); err != nil {
+			return nil, errs.FromPgx(err, models.MissingUser)
+		}
+		users = append(users, user)
+	}
+	return users, errs.FromPgx(rows.Err(), models.MissingUser)
+}
+
+func (u UserRepository) CountUsers(ctx context.Context, query string) (int64, error) {
+	var count int64
+	err := u.DB.QueryRowEx(ctx, "CountUsers", nil, utils.LikePrefix(query)).Scan(&count)
+	if err != nil {
+		logger.FromContext(ctx).Debug(err)
+	}
+	return count, errs.FromPgx(err, models.MissingUser)
+}
+
+func (u UserRepository) GetUserStats(ctx context.Context, nickname string) (models.UserStats, error) {
+	var stats models.UserStats
+	var first, last pgtype.Timestamptz
+
+	err := u.DB.QueryRowEx(ctx, "SelectUserStats", nil, nickname).Scan(&stats.Nickname, &stats.Posts, &stats.Threads,
+		&stats.VotesCast, &stats.VotesReceived, &stats.Forums, &first, &last)
 	if err != nil {
-		log.Println(err)
-		return models.User{}, err
+		logger.FromContext(ctx).Debug(err)
+		return models.UserStats{}, errs.FromPgx(err, models.MissingUser)
+	}
+
+	if first.Status == pgtype.Present {
+		stats.FirstActivity = &first.Time
+	}
+	if last.Status == pgtype.Present {
+		stats.LastActivity = &last.Time
+	}
+	return stats, nil
+}
+
+func (u UserRepository) RenameUser(ctx context.Context, nickname string, newNickname string, aliasExpires time.Time) (models.User, error) {
+	var user models.User
+
+	err := u.DB.QueryRowEx(ctx, "RenameUser", nil, nickname, newNickname, aliasExpires).
+		Scan(&user.Nickname, &user.Fullname, &user.About, &user.Email)
+	if err != nil {
+		logger.FromContext(ctx).Debug(err)
+		if utils.PgxErrorCode(err) == "23505" {
+			return models.User{}, errs.Wrap(errs.KindConflict, models.ErrUserNick, err)
+		}
+		return models.User{}, errs.FromPgx(err, models.MissingUser)
 	}
 
 	return user, nil
 }
+
+func (u UserRepository) DeleteUser(ctx context.Context, nickname string) error {
+	var deleted bool
+
+	err := u.DB.QueryRowEx(ctx, "DeleteUser", nil, nickname, models.DeletedUser, models.DeletedUserFullname, models.DeletedUserEmail).
+		Scan(&deleted)
+	if err != nil {
+		logger.FromContext(ctx).Debug(err)
+		return errs.FromPgx(err, models.MissingUser)
+	}
+	if !deleted {
+		return errs.NotFound(models.MissingUser)
+	}
+
+	return nil
+}
+
+// export выполняет запрос и передаёт каждую строку в scan, пока строки не
+// кончатся или scan не вернёт ошибку.
+func (u UserRepository) export(ctx context.Context, query string, nickname string, scan func(rows *pgxtime.Rows) error) error {
+	rows, err := u.DB.QueryEx(ctx, query, nil, nickname)
+	if err != nil {
+		logger.FromContext(ctx).Debug(err)
+		return errs.FromPgx(err, models.MissingUser)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err = scan(rows); err != nil {
+			return errs.FromPgx(err, models.MissingUser)
+		}
+	}
+	return errs.FromPgx(rows.Err(), models.MissingUser)
+}
+
+func (u UserRepository) ExportThreads(ctx context.Context, nickname string, fn func(models.Thread) error) error {
+	return u.export(ctx, "ExportUserThreads", nickname, func(rows *pgxtime.Rows) error {
+		var thread models.Thread
+		err := rows.Scan(&thread.Id, &thread.Title, &thread.Author, &thread.Forum, &thread.Message, &thread.Votes, &thread.Slug, &thread.Created)
+		if err != nil {
+			return err
+		}
+		if utils.IsValidUUID(thread.Slug) {
+			thread.Slug = ""
+		}
+		return fn(thread)
+	})
+}
+
+func (u UserRepository) ExportPosts(ctx context.Context, nickname string, fn func(models.UserExportPost) error) error {
+	return u.export(ctx, "ExportUserPosts", nickname, func(rows *pgxtime.Rows) error {
+		var post models.UserExportPost
+		err := rows.Scan(&post.Id, &post.Parent, &post.Author, &post.Message, &post.IsEdited, &post.Forum, &post.Thread, &post.Created,
+			&post.ThreadTitle, &post.ThreadSlug, &post.ForumTitle)
+		if err != nil {
+			return err
+		}
+		if utils.IsValidUUID(post.ThreadSlug) {
+			post.ThreadSlug = ""
+		}
+		return fn(post)
+	})
+}
+
+func (u UserRepository) ExportVotes(ctx context.Context, nickname string, fn func(models.UserExportVote) error) error {
+	return u.export(ctx, "ExportUserVotes", nickname, func(rows *pgxtime.Rows) error {
+		var vote models.UserExportVote
+		if err := rows.Scan(&vote.Thread, &vote.ThreadSlug, &vote.Forum, &vote.Voice); err != nil {
+			return err
+		}
+		if utils.IsValidUUID(vote.ThreadSlug) {
+			vote.ThreadSlug = ""
+		}
+		return fn(vote)
+	})
+}
+
+func (u UserRepository) ExportForums(ctx context.Context, nickname string, fn func(models.Forum) error) error {
+	return u.export(ctx, "ExportUserForums", nickname, func(rows *pgxtime.Rows) error {
+		var forum models.Forum
+		if err := rows.Scan(&forum.Title, &forum.User, &forum.Slug, &forum.Posts, &forum.Threads); err != nil {
+			return err
+		}
+		return fn(forum)
+	})
+}
+
+func (u UserRepository) IsAdmin(ctx context.Context, nickname string) (bool, error) {
+	var admin bool
+	err := u.DB.QueryRowEx(ctx, "SelectIsAdmin", nil, nickname).Scan(&admin)
+	if err != nil {
+		logger.FromContext(ctx).Debug(err)
+	}
+	return admin, errs.FromPgx(err, models.MissingUser)
+}
+
+func (u UserRepository) SetAdmin(ctx context.Context, nickname string, admin bool) error {
+	query := "DeleteAdmin"
+	if admin {
+		query = "InsertAdmin"
+	}
+
+	err := u.DB.QueryRowEx(ctx, query, nil, nickname).Scan(&nickname)
+	if err != nil {
+		logger.FromContext(ctx).Debug(err)
+		return errs.FromPgx(err, models.MissingUser)
+	}
+	return nil
+}
+
+func (u UserRepository) FindAdmins(ctx context.Context) ([]models.User, error) {
+	rows, err := u.DB.QueryEx(ctx, "SelectAdmins", nil)
+	if err != nil {
+		logger.FromContext(ctx).Debug(err)
+		return nil, errs.FromPgx(err, models.MissingUser)
+	}
+	defer rows.Close()
+
+	users := []models.User{}
+	for rows.Next() {
+		var user models.User
+		if err = rows.Scan(&user.Nickname, &user.Fullname, &user.About, &user.Email); err != nil {
+			return nil, errs.FromPgx(err, models.MissingUser)
+		}
+		users = append(users, user)
+	}
+	return users, errs.FromPgx(rows.Err(), models.MissingUser)
+}
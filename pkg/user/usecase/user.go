@@ -1,28 +1,81 @@
 package usecase
 
 import (
+	"archive/zip"
+	"context"
 	"encoding/json"
+	"forum/internal/utils/auth"
+	"forum/internal/utils/errs"
 	"forum/internal/utils/utils"
 	"forum/pkg/models"
 	"forum/pkg/user/repostitory"
-	"github.com/jackc/pgx"
-	"github.com/pkg/errors"
+	"golang.org/x/crypto/bcrypt"
 	"io"
 	"log"
-	"net/http"
+	"strings"
+	"time"
 )
 
 type UserUsecaseInterface interface {
 	ParseJsonToUser(body io.ReadCloser) (models.User, error)
-	CreateUser(user models.User) ([]models.User, bool)
-	GetUserByNickName(nickname string) (models.User, error)
-	ChangeUser(user models.User) (models.User, int, error)
+	CreateUser(ctx context.Context, user models.User) ([]models.User, error)
+	GetUserByNickName(ctx context.Context, nickname string) (models.User, error)
+	ChangeUser(ctx context.Context, user models.User) (models.User, error)
 	GetUserByRequest(body io.ReadCloser, vars map[string]string) (models.User, error)
 	CheckUserFields(user models.User) models.User
+	FindUsers(ctx context.Context, params models.UserSearch) ([]models.User, int64, error)
+	GetUserStats(ctx context.Context, nickname string) (models.UserStats, error)
+	ParseJsonToUserRename(body io.ReadCloser) (models.UserRename, error)
+	RenameUser(ctx context.Context, nickname string, rename models.UserRename) (models.User, error)
+	DeleteUser(ctx context.Context, nickname string) error
+	ExportUser(ctx context.Context, nickname string, start func(user models.User) io.Writer) error
+	ParseJsonToUserLogin(body io.ReadCloser) (models.UserLogin, error)
+	Login(ctx context.Context, nickname string, login models.UserLogin) (models.UserSession, error)
+	Authenticate(ctx context.Context, token string) (models.User, error)
 }
 
 type UserUsecase struct {
 	DB repostitory.UserRepositoryInterface
+	// Сколько старый nickname после RenameUser остаётся псевдонимом.
+	AliasTTL time.Duration
+	Tokens   auth.Tokens
+	// Регистрация без пароля запрещена.
+	PasswordRequired bool
+}
+
+// currentNickname текущий nickname пользователя, если nickname его старый
+// псевдоним; false, когда повторять запрос с другим nickname незачем.
+func (u UserUsecase) currentNickname(ctx context.Context, nickname string) (string, bool) {
+	user, err := u.DB.GetUser(ctx, nickname)
+	if err != nil || strings.EqualFold(user.Nickname, nickname) {
+		return "", false
+	}
+	return user.Nickname, true
+}
+
+// checkCaller как auth.Check, но nickname может быть старым псевдонимом вызывающего.
+func (u UserUsecase) checkCaller(ctx context.Context, nickname string) error {
+	err := auth.Check(ctx, nickname)
+	if err != nil {
+		if current, ok := u.currentNickname(ctx, nickname); ok {
+			return auth.Check(ctx, current)
+		}
+	}
+	return err
+}
+
+// hashPassword заменяет Password на PasswordHash.
+func hashPassword(user models.User) (models.User, error) {
+	if len(user.Password) > 72 {
+		return models.User{}, errs.Invalid(models.ErrLongPassword)
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return models.User{}, errs.Internal(err)
+	}
+	user.Password, user.PasswordHash = "", string(hash)
+	return user, nil
 }
 
 func (u UserUsecase) CheckUserFields(user models.User) models.User {
@@ -39,6 +92,10 @@ func (u UserUsecase) CheckUserFields(user models.User) models.User {
 		cleanUser.Email = user.Email
 	}
 
+	if user.Password != "" {
+		cleanUser.Password = user.Password
+	}
+
 	return cleanUser
 }
 
@@ -51,7 +108,7 @@ func (u UserUsecase) GetUserByRequest(body io.ReadCloser, vars map[string]string
 
 	nickname, ok := utils.GetDataFromPath("nickname", vars)
 	if !ok {
-		err = errors.New("Can't parse nickname from url")
+		err = errs.Invalid("Can't parse nickname from url")
 		log.Println(err)
 		return models.User{}, err
 	}
@@ -60,29 +117,288 @@ func (u UserUsecase) GetUserByRequest(body io.ReadCloser, vars map[string]string
 	return user, nil
 }
 
-func (u UserUsecase) ChangeUser(user models.User) (models.User, int, error) {
-	user, err := u.DB.ChangeUser(user)
-	if err == nil {
-		return user, http.StatusOK, nil
+func (u UserUsecase) ChangeUser(ctx context.Context, user models.User) (models.User, error) {
+	if reserved(user.Nickname) {
+		return models.User{}, errs.Invalid(models.ErrNickReserved)
+	}
+	if reservedEmail(user.Email) {
+		return models.User{}, errs.Invalid(models.ErrMailReserved)
+	}
+	if err := u.checkCaller(ctx, user.Nickname); err != nil {
+		return models.User{}, err
+	}
+	if user.Password != "" {
+		var err error
+		if user, err = hashPassword(user); err != nil {
+			return models.User{}, err
+		}
 	}
 
-	code := utils.PgxErrorCode(err)
-	if code == "23503" || err == pgx.ErrNoRows {
-		log.Println(err)
-		return models.User{}, http.StatusNotFound, err
+	changed, err := u.DB.ChangeUser(ctx, user)
+	if errs.Is(err, errs.KindNotFound) {
+		if nickname, ok := u.currentNickname(ctx, user.Nickname); ok {
+			user.Nickname = nickname
+			return u.DB.ChangeUser(ctx, user)
+		}
+	}
+	return changed, err
+}
+
+func (u UserUsecase) GetUserByNickName(ctx context.Context, nickname string) (models.User, error) {
+	return u.DB.GetUser(ctx, nickname)
+}
+
+func (u UserUsecase) CreateUser(ctx context.Context, user models.User) ([]models.User, error) {
+	if reserved(user.Nickname) {
+		return nil, errs.Invalid(models.ErrNickReserved)
+	}
+	if reservedEmail(user.Email) {
+		return nil, errs.Invalid(models.ErrMailReserved)
+	}
+	if user.Password != "" {
+		var err error
+		if user, err = hashPassword(user); err != nil {
+			return nil, err
+		}
+	} else if u.PasswordRequired {
+		return nil, errs.Invalid(models.ErrNoPassword)
+	}
+	return u.DB.AddUser(ctx, user)
+}
+
+// reserved nickname автора-заглушки удалённых пользователей.
+func reserved(nickname string) bool {
+	return strings.EqualFold(nickname, models.DeletedUser)
+}
+
+// reservedEmail адрес, по которому хранилище отличает заглушку от аккаунта с
+// её nickname.
+func reservedEmail(email string) bool {
+	return strings.EqualFold(email, models.DeletedUserEmail)
+}
+
+// FindUsers страница пользователей и общее число подходящих под params.Query.
+func (u UserUsecase) FindUsers(ctx context.Context, params models.UserSearch) ([]models.User, int64, error) {
+	total, err := u.DB.CountUsers(ctx, params.Query)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	users, err := u.DB.FindUsers(ctx, params)
+	if err != nil {
+		return nil, 0, err
+	}
+	return users, total, nil
+}
+
+func (u UserUsecase) GetUserStats(ctx context.Context, nickname string) (models.UserStats, error) {
+	stats, err := u.DB.GetUserStats(ctx, nickname)
+	if errs.Is(err, errs.KindNotFound) {
+		if current, ok := u.currentNickname(ctx, nickname); ok {
+			return u.DB.GetUserStats(ctx, current)
+		}
+	}
+	return stats, err
+}
+
+// RenameUser меняет nickname во всех сущностях пользователя; старый nickname
+// находит его ещё AliasTTL.
+func (u UserUsecase) RenameUser(ctx context.Context, nickname string, rename models.UserRename) (models.User, error) {
+	if rename.Nickname == "" {
+		return models.User{}, errs.Invalid(models.ErrEmptyNick)
+	}
+	if reserved(nickname) || reserved(rename.Nickname) {
+		return models.User{}, errs.Invalid(models.ErrNickReserved)
+	}
+	current, err := u.requireOwner(ctx, nickname)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	return u.DB.RenameUser(ctx, current, rename.Nickname, time.Now().Add(u.AliasTTL))
+}
+
+// DeleteUser удаляет пользователя и его личные данные; его форумы, ветки и
+// сообщения остаются за models.DeletedUser.
+func (u UserUsecase) DeleteUser(ctx context.Context, nickname string) error {
+	if reserved(nickname) {
+		return errs.Invalid(models.ErrNickReserved)
+	}
+	current, err := u.requireOwner(ctx, nickname)
+	if err != nil {
+		return err
+	}
+
+	return u.DB.DeleteUser(ctx, current)
+}
+
+// requireOwner текущий nickname пользователя, если запрос от него самого или
+// от администратора сайта. Переименование и удаление необратимы, поэтому
+// анонимно они запрещены и без обязательной аутентификации.
+func (u UserUsecase) requireOwner(ctx context.Context, nickname string) (string, error) {
+	if _, ok := auth.FromContext(ctx); !ok {
+		return "", errs.Unauthorized(models.ErrNoToken)
+	}
+	user, err := u.DB.GetUser(ctx, nickname)
+	if err != nil {
+		return "", err
+	}
+	return user.Nickname, u.checkOwnerOrAdmin(ctx, user.Nickname)
+}
+
+// checkOwnerOrAdmin пропускает самого пользователя nickname (текущий nickname,
+// не псевдоним) и администраторов сайта; анонимный запрос получает 401.
+func (u UserUsecase) checkOwnerOrAdmin(ctx context.Context, nickname string) error {
+	caller, ok := auth.FromContext(ctx)
+	if !ok {
+		return errs.Unauthorized(models.ErrNoToken)
+	}
+	if strings.EqualFold(caller.Nickname, nickname) {
+		return nil
+	}
+	admin, err := u.DB.IsAdmin(ctx, caller.Nickname)
+	if err != nil || admin {
+		return err
+	}
+	return errs.Forbidden(models.ErrNotCaller)
+}
+
+// ExportUser пишет ZIP-архив с профилем, ветками, сообщениями, голосами и
+// форумами пользователя. Выгрузку получают только он сам и администраторы сайта;
+// start вызывается после всех проверок и возвращает, куда писать архив. Записи
+// идут из базы в архив по одной.
+func (u UserUsecase) ExportUser(ctx context.Context, nickname string, start func(user models.User) io.Writer) error {
+	if _, ok := auth.FromContext(ctx); !ok {
+		return errs.Unauthorized(models.ErrNoToken)
+	}
+	user, err := u.DB.GetUser(ctx, nickname)
+	if err != nil {
+		return err
+	}
+	if err = u.checkOwnerOrAdmin(ctx, user.Nickname); err != nil {
+		return err
+	}
+
+	archive := zip.NewWriter(start(user))
+
+	profile, err := archive.Create("profile.json")
+	if err != nil {
+		return err
+	}
+	if err = json.NewEncoder(profile).Encode(user); err != nil {
+		return err
+	}
+
+	for _, file := range []struct {
+		name string
+		each func(emit func(v interface{}) error) error
+	}{
+		{"threads.json", func(emit func(v interface{}) error) error {
+			return u.DB.ExportThreads(ctx, user.Nickname, func(thread models.Thread) error { return emit(thread) })
+		}},
+		{"posts.json", func(emit func(v interface{}) error) error {
+			return u.DB.ExportPosts(ctx, user.Nickname, func(post models.UserExportPost) error { return emit(post) })
+		}},
+		{"votes.json", func(emit func(v interface{}) error) error {
+			return u.DB.ExportVotes(ctx, user.Nickname, func(vote models.UserExportVote) error { return emit(vote) })
+		}},
+		{"forums.json", func(emit func(v interface{}) error) error {
+			return u.DB.ExportForums(ctx, user.Nickname, func(forum models.Forum) error { return emit(forum) })
+		}},
+	} {
+		if err = exportArray(archive, file.name, file.each); err != nil {
+			return err
+		}
+	}
+
+	return archive.Close()
+}
+
+// exportArray пишет в архив файл с JSON-массивом, элементы которого по одному
+// передаёт each.
+func exportArray(archive *zip.Writer, name string, each func(emit func(v interface{}) error) error) error {
+	file, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+
+	if _, err = io.WriteString(file, "["); err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(file)
+	separator := "\n"
+	err = each(func(v interface{}) error {
+		if _, err := io.WriteString(file, separator); err != nil {
+			return err
+		}
+		separator = ","
+		return encoder.Encode(v)
+	})
+	if err != nil {
+		return err
 	}
 
-	log.Println(err)
-	return models.User{}, http.StatusConflict, err
+	_, err = io.WriteString(file, "]\n")
+	return err
 }
 
-func (u UserUsecase) GetUserByNickName(nickname string) (models.User, error) {
-	return u.DB.GetUser(nickname)
+func (UserUsecase) ParseJsonToUserRename(body io.ReadCloser) (models.UserRename, error) {
+	defer body.Close()
+
+	var rename models.UserRename
+	if err := json.NewDecoder(body).Decode(&rename); err != nil {
+		return rename, errs.Wrap(errs.KindInvalid, models.ErrBadBody, err)
+	}
+	return rename, nil
 }
 
-func (u UserUsecase) CreateUser(user models.User) ([]models.User, bool) {
-	users, ok := u.DB.AddUser(user)
-	return users, ok
+func (UserUsecase) ParseJsonToUserLogin(body io.ReadCloser) (models.UserLogin, error) {
+	defer body.Close()
+
+	var login models.UserLogin
+	if err := json.NewDecoder(body).Decode(&login); err != nil {
+		return login, errs.Wrap(errs.KindInvalid, models.ErrBadBody, err)
+	}
+	return login, nil
+}
+
+// Login проверяет пароль и выдаёт токен сессии. Неизвестный nickname и
+// неверный пароль неразличимы для клиента.
+func (u UserUsecase) Login(ctx context.Context, nickname string, login models.UserLogin) (models.UserSession, error) {
+	user, err := u.DB.GetUserCredentials(ctx, nickname)
+	if errs.Is(err, errs.KindNotFound) {
+		return models.UserSession{}, errs.Unauthorized(models.ErrBadLogin)
+	}
+	if err != nil {
+		return models.UserSession{}, err
+	}
+
+	if user.PasswordHash == "" || bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(login.Password)) != nil {
+		return models.UserSession{}, errs.Unauthorized(models.ErrBadLogin)
+	}
+	return u.Tokens.Issue(user, time.Now()), nil
+}
+
+// Authenticate пользователь, которому выдан token.
+func (u UserUsecase) Authenticate(ctx context.Context, token string) (models.User, error) {
+	nickname, err := u.Tokens.Nickname(token, time.Now())
+	if err != nil {
+		return models.User{}, err
+	}
+
+	user, err := u.DB.GetUserCredentials(ctx, nickname)
+	if errs.Is(err, errs.KindNotFound) {
+		return models.User{}, errs.Unauthorized(models.ErrBadToken)
+	}
+	if err != nil {
+		return models.User{}, err
+	}
+	if !u.Tokens.Verify(token, user) {
+		return models.User{}, errs.Unauthorized(models.ErrBadToken)
+	}
+
+	user.PasswordHash = ""
+	return user, nil
 }
 
 func (UserUsecase) ParseJsonToUser(body io.ReadCloser) (models.User, error) {
@@ -93,6 +409,7 @@ func (UserUsecase) ParseJsonToUser(body io.ReadCloser) (models.User, error) {
 	decoder := json.NewDecoder(body)
 	err := decoder.Decode(&user)
 	if err != nil {
+		return user, errs.Wrap(errs.KindInvalid, models.ErrBadBody, err)
 	}
-	return user, err
+	return user, nil
 }